@@ -0,0 +1,303 @@
+package goex
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+//以USD计价的交易所 , 其他交易所默认以USDT计价
+var usdQuotedExchanges = map[string]bool{
+	BITSTAMP:   true,
+	KRAKEN:     true,
+	BITFINEX:   true,
+	GDAX:       true,
+	OKCOIN_COM: true,
+	BITMEX:     true,
+}
+
+func RegisterUsdQuotedExchange(exName string) {
+	usdQuotedExchanges[exName] = true
+}
+
+/**
+ * 把统一的交易对转换为交易所实际使用的交易对 , 如 BTC_USD -> BTC_USDT (binance)
+ */
+func AdaptPairForExchange(exName string, pair CurrencyPair) CurrencyPair {
+	if usdQuotedExchanges[exName] {
+		return pair.AdaptUsdtToUsd()
+	}
+	return pair.AdaptUsdToUsdt()
+}
+
+//带交易所来源的价位
+type VenueDepthRecord struct {
+	Exchange string
+	Price,
+	Amount float64
+}
+
+//合并后的深度 , ask价格升序 , bid价格降序
+type ConsolidatedDepth struct {
+	Pair    CurrencyPair
+	UTime   time.Time
+	AskList []VenueDepthRecord
+	BidList []VenueDepthRecord
+}
+
+//单个交易所的买一卖一
+type VenueBBO struct {
+	Exchange string
+	Bid,
+	Ask DepthRecord
+	UTime time.Time
+	Stale bool
+}
+
+type venueDepth struct {
+	api   API
+	pair  CurrencyPair
+	depth *Depth
+	utime time.Time
+	err   error
+}
+
+/**
+ * 多交易所深度聚合
+ * 数据来源: rest接口轮询(AddAPI) 或 websocket推送(Update/DepthHandler)
+ */
+type DepthAggregator struct {
+	lock       sync.RWMutex
+	pair       CurrencyPair
+	size       int
+	staleAfter time.Duration
+	venues     map[string]*venueDepth
+	close      chan struct{}
+}
+
+func NewDepthAggregator(pair CurrencyPair, size int) *DepthAggregator {
+	return &DepthAggregator{
+		pair:       pair,
+		size:       size,
+		staleAfter: 10 * time.Second,
+		venues:     make(map[string]*venueDepth)}
+}
+
+//超过该时间未更新的交易所不参与合并
+func (agg *DepthAggregator) StaleAfter(d time.Duration) *DepthAggregator {
+	agg.staleAfter = d
+	return agg
+}
+
+//添加rest数据源 , 交易对按AdaptPairForExchange转换
+func (agg *DepthAggregator) AddAPI(api API) *DepthAggregator {
+	return agg.AddAPIWithPair(api, AdaptPairForExchange(api.GetExchangeName(), agg.pair))
+}
+
+//添加rest数据源 , 指定交易所使用的交易对
+func (agg *DepthAggregator) AddAPIWithPair(api API, venuePair CurrencyPair) *DepthAggregator {
+	agg.lock.Lock()
+	defer agg.lock.Unlock()
+	agg.venues[api.GetExchangeName()] = &venueDepth{api: api, pair: venuePair}
+	return agg
+}
+
+//推送某个交易所的最新深度(websocket数据源)
+func (agg *DepthAggregator) Update(exName string, dep *Depth) {
+	agg.lock.Lock()
+	defer agg.lock.Unlock()
+
+	v, ok := agg.venues[exName]
+	if !ok {
+		v = &venueDepth{pair: dep.Pair}
+		agg.venues[exName] = v
+	}
+	v.depth = dep.Normalize()
+	v.utime = time.Now()
+	v.err = nil
+}
+
+//用于GetDepthWithWs的回调
+func (agg *DepthAggregator) DepthHandler(exName string) func(*Depth) {
+	return func(dep *Depth) {
+		agg.Update(exName, dep)
+	}
+}
+
+//并发拉取所有rest数据源
+func (agg *DepthAggregator) Refresh() {
+	agg.lock.RLock()
+	var names []string
+	for name, v := range agg.venues {
+		if v.api != nil {
+			names = append(names, name)
+		}
+	}
+	agg.lock.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			agg.refreshVenue(name)
+		}(name)
+	}
+	wg.Wait()
+}
+
+func (agg *DepthAggregator) refreshVenue(name string) {
+	agg.lock.RLock()
+	v := agg.venues[name]
+	api, pair := v.api, v.pair
+	agg.lock.RUnlock()
+
+	dep, err := api.GetDepth(agg.size, pair)
+
+	agg.lock.Lock()
+	defer agg.lock.Unlock()
+	if err != nil {
+		log.Printf("[%s] get depth error: %s", name, err)
+		v.err = err
+		return
+	}
+	v.depth = dep.Normalize()
+	v.utime = time.Now()
+	v.err = nil
+}
+
+//按interval定时轮询 , 直到Stop
+func (agg *DepthAggregator) Start(interval time.Duration) {
+	agg.close = make(chan struct{})
+	go func(close chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		agg.Refresh()
+		for {
+			select {
+			case <-ticker.C:
+				agg.Refresh()
+			case <-close:
+				return
+			}
+		}
+	}(agg.close)
+}
+
+func (agg *DepthAggregator) Stop() {
+	if agg.close != nil {
+		close(agg.close)
+		agg.close = nil
+	}
+}
+
+func (agg *DepthAggregator) isStale(v *venueDepth, now time.Time) bool {
+	return v.depth == nil || (agg.staleAfter > 0 && now.Sub(v.utime) > agg.staleAfter)
+}
+
+//各交易所的买一卖一 , 包括已过期的
+func (agg *DepthAggregator) BBO() map[string]VenueBBO {
+	agg.lock.RLock()
+	defer agg.lock.RUnlock()
+
+	now := time.Now()
+	ret := make(map[string]VenueBBO, len(agg.venues))
+	for name, v := range agg.venues {
+		bbo := VenueBBO{Exchange: name, UTime: v.utime, Stale: agg.isStale(v, now)}
+		if v.depth != nil {
+			bbo.Bid, _ = v.depth.BestBid()
+			bbo.Ask, _ = v.depth.BestAsk()
+		}
+		ret[name] = bbo
+	}
+	return ret
+}
+
+//某个交易所的最新深度 , 没有数据时返回nil
+func (agg *DepthAggregator) VenueDepth(exName string) (*Depth, time.Time) {
+	agg.lock.RLock()
+	defer agg.lock.RUnlock()
+
+	v, ok := agg.venues[exName]
+	if !ok || v.depth == nil {
+		return nil, time.Time{}
+	}
+	return v.depth, v.utime
+}
+
+/**
+ * 合并所有未过期交易所的深度 , n为每边返回的条数 , n<=0 返回全部
+ * 同价位按交易所分别列出
+ */
+func (agg *DepthAggregator) Consolidated(n int) *ConsolidatedDepth {
+	agg.lock.RLock()
+	defer agg.lock.RUnlock()
+
+	now := time.Now()
+	cd := &ConsolidatedDepth{Pair: agg.pair}
+	for name, v := range agg.venues {
+		if agg.isStale(v, now) {
+			continue
+		}
+		for _, r := range v.depth.AskList {
+			cd.AskList = append(cd.AskList, VenueDepthRecord{name, r.Price, r.Amount})
+		}
+		for _, r := range v.depth.BidList {
+			cd.BidList = append(cd.BidList, VenueDepthRecord{name, r.Price, r.Amount})
+		}
+		if v.utime.After(cd.UTime) {
+			cd.UTime = v.utime
+		}
+	}
+
+	sort.SliceStable(cd.AskList, func(i, j int) bool {
+		if cd.AskList[i].Price == cd.AskList[j].Price {
+			return cd.AskList[i].Exchange < cd.AskList[j].Exchange
+		}
+		return cd.AskList[i].Price < cd.AskList[j].Price
+	})
+	sort.SliceStable(cd.BidList, func(i, j int) bool {
+		if cd.BidList[i].Price == cd.BidList[j].Price {
+			return cd.BidList[i].Exchange < cd.BidList[j].Exchange
+		}
+		return cd.BidList[i].Price > cd.BidList[j].Price
+	})
+
+	if n > 0 && len(cd.AskList) > n {
+		cd.AskList = cd.AskList[:n]
+	}
+	if n > 0 && len(cd.BidList) > n {
+		cd.BidList = cd.BidList[:n]
+	}
+	return cd
+}
+
+//全市场最优买卖价
+func (cd *ConsolidatedDepth) BestBidOffer() (bid, ask VenueDepthRecord, ok bool) {
+	if len(cd.BidList) == 0 || len(cd.AskList) == 0 {
+		return bid, ask, false
+	}
+	return cd.BidList[0], cd.AskList[0], true
+}
+
+//去掉交易所信息 , 同价位合并
+func (cd *ConsolidatedDepth) Depth() *Depth {
+	dep := &Depth{Pair: cd.Pair, UTime: cd.UTime}
+	dep.AskList = mergeVenueRecords(cd.AskList)
+	dep.BidList = mergeVenueRecords(cd.BidList)
+	return dep
+}
+
+func mergeVenueRecords(records []VenueDepthRecord) DepthRecords {
+	var ret DepthRecords
+	for _, r := range records {
+		n := len(ret)
+		if n > 0 && ret[n-1].Price == r.Price {
+			ret[n-1].Amount += r.Amount
+			continue
+		}
+		ret = append(ret, DepthRecord{Price: r.Price, Amount: r.Amount})
+	}
+	return ret
+}
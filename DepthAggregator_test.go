@@ -0,0 +1,59 @@
+package goex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDepthAPI struct {
+	API
+	name  string
+	depth *Depth
+	pairs []CurrencyPair
+}
+
+func (m *mockDepthAPI) GetExchangeName() string {
+	return m.name
+}
+
+func (m *mockDepthAPI) GetDepth(size int, pair CurrencyPair) (*Depth, error) {
+	m.pairs = append(m.pairs, pair)
+	return m.depth, nil
+}
+
+func TestDepthAggregator_Consolidated(t *testing.T) {
+	bn := &mockDepthAPI{name: BINANCE, depth: &Depth{
+		AskList: DepthRecords{{101, 1}, {102, 1}},
+		BidList: DepthRecords{{99, 1}, {98, 1}}}}
+	bs := &mockDepthAPI{name: BITSTAMP, depth: &Depth{
+		AskList: DepthRecords{{102, 2}, {100.5, 2}},
+		BidList: DepthRecords{{98.5, 2}, {99, 2}}}}
+
+	agg := NewDepthAggregator(BTC_USD, 10).AddAPI(bn).AddAPI(bs)
+	agg.Refresh()
+	agg.Update(HUOBI_PRO, &Depth{AskList: DepthRecords{{100, 1}}, BidList: DepthRecords{{97, 1}}})
+
+	assert.Equal(t, []CurrencyPair{BTC_USDT}, bn.pairs)
+	assert.Equal(t, []CurrencyPair{BTC_USD}, bs.pairs)
+
+	cd := agg.Consolidated(3)
+	assert.Equal(t, []VenueDepthRecord{{HUOBI_PRO, 100, 1}, {BITSTAMP, 100.5, 2}, {BINANCE, 101, 1}}, cd.AskList)
+	assert.Equal(t, []VenueDepthRecord{{BINANCE, 99, 1}, {BITSTAMP, 99, 2}, {BITSTAMP, 98.5, 2}}, cd.BidList)
+
+	bid, ask, ok := cd.BestBidOffer()
+	assert.True(t, ok)
+	assert.Equal(t, HUOBI_PRO, ask.Exchange)
+	assert.Equal(t, 99.0, bid.Price)
+	assert.Equal(t, DepthRecord{99, 3}, cd.Depth().BidList[0])
+
+	bbo := agg.BBO()
+	assert.Equal(t, 100.5, bbo[BITSTAMP].Ask.Price)
+	assert.False(t, bbo[BITSTAMP].Stale)
+
+	agg.StaleAfter(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, 0, len(agg.Consolidated(0).AskList))
+	assert.True(t, agg.BBO()[BINANCE].Stale)
+}
@@ -0,0 +1,283 @@
+package goex
+
+import (
+	"math"
+	"sort"
+)
+
+/**
+ * 深度相关的计算
+ * 各交易所返回的AskList顺序不一致(有的升序有的降序) , 以下函数都不依赖原始顺序
+ */
+
+//价格升序的拷贝
+func (dr DepthRecords) SortAsc() DepthRecords {
+	ret := make(DepthRecords, len(dr))
+	copy(ret, dr)
+	sort.Stable(ret)
+	return ret
+}
+
+//价格降序的拷贝
+func (dr DepthRecords) SortDesc() DepthRecords {
+	ret := make(DepthRecords, len(dr))
+	copy(ret, dr)
+	sort.Stable(sort.Reverse(ret))
+	return ret
+}
+
+func (dr DepthRecords) TotalAmount() float64 {
+	total := 0.0
+	for _, r := range dr {
+		total += r.Amount
+	}
+	return total
+}
+
+//按quote计算的总额
+func (dr DepthRecords) TotalVolume() float64 {
+	total := 0.0
+	for _, r := range dr {
+		total += r.Price * r.Amount
+	}
+	return total
+}
+
+/**
+ * 按最小价格单位合并价位
+ * roundUp: true 价格向上取整(用于ask) , false 向下取整(用于bid)
+ * 返回顺序与原顺序方向一致
+ */
+func (dr DepthRecords) GroupByTick(tick float64, roundUp bool) DepthRecords {
+	if tick <= 0 || len(dr) == 0 {
+		return dr
+	}
+
+	desc := len(dr) > 1 && dr[0].Price > dr[len(dr)-1].Price
+	sorted := dr.SortAsc()
+
+	var ret DepthRecords
+	for _, r := range sorted {
+		var price float64
+		if roundUp {
+			price = math.Ceil(r.Price/tick-1e-9) * tick
+		} else {
+			price = math.Floor(r.Price/tick+1e-9) * tick
+		}
+		n := len(ret)
+		if n > 0 && math.Abs(ret[n-1].Price-price) < tick/2 {
+			ret[n-1].Amount += r.Amount
+			continue
+		}
+		ret = append(ret, DepthRecord{Price: price, Amount: r.Amount})
+	}
+
+	if desc {
+		sort.Sort(sort.Reverse(ret))
+	}
+	return ret
+}
+
+//ask价格升序 , bid价格降序的拷贝
+func (dep *Depth) Normalize() *Depth {
+	return &Depth{
+		ContractType: dep.ContractType,
+		Pair:         dep.Pair,
+		UTime:        dep.UTime,
+		AskList:      dep.AskList.SortAsc(),
+		BidList:      dep.BidList.SortDesc()}
+}
+
+//卖一 , 不依赖AskList顺序
+func (dep *Depth) BestAsk() (DepthRecord, bool) {
+	if len(dep.AskList) == 0 {
+		return DepthRecord{}, false
+	}
+	best := dep.AskList[0]
+	for _, r := range dep.AskList[1:] {
+		if r.Price < best.Price {
+			best = r
+		}
+	}
+	return best, true
+}
+
+//买一 , 不依赖BidList顺序
+func (dep *Depth) BestBid() (DepthRecord, bool) {
+	if len(dep.BidList) == 0 {
+		return DepthRecord{}, false
+	}
+	best := dep.BidList[0]
+	for _, r := range dep.BidList[1:] {
+		if r.Price > best.Price {
+			best = r
+		}
+	}
+	return best, true
+}
+
+//中间价 , 缺少一边时返回0
+func (dep *Depth) MidPrice() float64 {
+	ask, ok1 := dep.BestAsk()
+	bid, ok2 := dep.BestBid()
+	if !ok1 || !ok2 {
+		return 0
+	}
+	return (ask.Price + bid.Price) / 2
+}
+
+//买卖价差 , 单位: 基点(1/10000) , 相对于中间价
+func (dep *Depth) SpreadBps() float64 {
+	ask, ok1 := dep.BestAsk()
+	bid, ok2 := dep.BestBid()
+	if !ok1 || !ok2 {
+		return 0
+	}
+	mid := (ask.Price + bid.Price) / 2
+	if mid == 0 {
+		return 0
+	}
+	return (ask.Price - bid.Price) / mid * 10000
+}
+
+//吃单模拟结果
+type DepthFill struct {
+	AvgPrice   float64 //成交均价(VWAP)
+	Amount     float64 //成交数量(base)
+	Volume     float64 //成交金额(quote)
+	WorstPrice float64 //最差成交价
+	Levels     int     //吃掉的档数
+	Complete   bool    //深度是否足够
+}
+
+/**
+ * 模拟市价单吃单
+ * side: BUY/BUY_MARKET 吃ask , SELL/SELL_MARKET 吃bid
+ * amount: 数量 , byQuote为true时表示金额(quote)
+ */
+func (dep *Depth) Fill(side TradeSide, amount float64, byQuote bool) DepthFill {
+	var levels DepthRecords
+	switch side {
+	case BUY, BUY_MARKET:
+		levels = dep.AskList.SortAsc()
+	default:
+		levels = dep.BidList.SortDesc()
+	}
+
+	var fill DepthFill
+	remain := amount
+	for _, r := range levels {
+		if remain <= 0 {
+			break
+		}
+		take := r.Amount
+		if byQuote {
+			if r.Price*take > remain {
+				take = remain / r.Price
+			}
+			remain -= take * r.Price
+		} else {
+			if take > remain {
+				take = remain
+			}
+			remain -= take
+		}
+		fill.Amount += take
+		fill.Volume += take * r.Price
+		fill.WorstPrice = r.Price
+		fill.Levels++
+	}
+
+	fill.Complete = remain <= amount*1e-12
+	if fill.Amount > 0 {
+		fill.AvgPrice = fill.Volume / fill.Amount
+	}
+	return fill
+}
+
+//买入amount个base的VWAP
+func (dep *Depth) BuyVWAP(amount float64) DepthFill {
+	return dep.Fill(BUY, amount, false)
+}
+
+//卖出amount个base的VWAP
+func (dep *Depth) SellVWAP(amount float64) DepthFill {
+	return dep.Fill(SELL, amount, false)
+}
+
+//花费quote金额买入的VWAP
+func (dep *Depth) BuyVWAPByQuote(quote float64) DepthFill {
+	return dep.Fill(BUY, quote, true)
+}
+
+//卖出换得quote金额的VWAP
+func (dep *Depth) SellVWAPByQuote(quote float64) DepthFill {
+	return dep.Fill(SELL, quote, true)
+}
+
+/**
+ * 滑点 , 成交均价相对于对手价一档的偏离 , 单位: 基点 , 总是>=0
+ * 深度不够时按能成交的部分计算
+ */
+func (dep *Depth) Slippage(side TradeSide, amount float64) float64 {
+	var (
+		best DepthRecord
+		ok   bool
+	)
+	switch side {
+	case BUY, BUY_MARKET:
+		best, ok = dep.BestAsk()
+	default:
+		best, ok = dep.BestBid()
+	}
+	if !ok || best.Price == 0 {
+		return 0
+	}
+
+	fill := dep.Fill(side, amount, false)
+	if fill.Amount == 0 {
+		return 0
+	}
+	return math.Abs(fill.AvgPrice-best.Price) / best.Price * 10000
+}
+
+/**
+ * 距中间价bps基点以内可成交的挂单数量和金额
+ * side: 吃单方向 , 与Fill一致 , BUY/BUY_MARKET 统计ask , SELL/SELL_MARKET 统计bid , 其他返回0
+ */
+func (dep *Depth) DepthWithinBps(side TradeSide, bps float64) (amount, volume float64) {
+	mid := dep.MidPrice()
+	if mid == 0 {
+		return 0, 0
+	}
+
+	switch side {
+	case BUY, BUY_MARKET:
+		limit := mid * (1 + bps/10000)
+		for _, r := range dep.AskList {
+			if r.Price <= limit {
+				amount += r.Amount
+				volume += r.Amount * r.Price
+			}
+		}
+	case SELL, SELL_MARKET:
+		limit := mid * (1 - bps/10000)
+		for _, r := range dep.BidList {
+			if r.Price >= limit {
+				amount += r.Amount
+				volume += r.Amount * r.Price
+			}
+		}
+	}
+	return amount, volume
+}
+
+//按最小价格单位合并深度 , ask向上取整 , bid向下取整
+func (dep *Depth) GroupByTick(tick float64) *Depth {
+	return &Depth{
+		ContractType: dep.ContractType,
+		Pair:         dep.Pair,
+		UTime:        dep.UTime,
+		AskList:      dep.AskList.GroupByTick(tick, true),
+		BidList:      dep.BidList.GroupByTick(tick, false)}
+}
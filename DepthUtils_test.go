@@ -0,0 +1,67 @@
+package goex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//ask倒序 , 与bitstamp/kraken等返回的一致
+var testDepth = &Depth{
+	AskList: DepthRecords{{103, 3}, {102, 2}, {101, 1}},
+	BidList: DepthRecords{{99, 1}, {98, 2}, {97, 3}},
+}
+
+func TestDepth_Best(t *testing.T) {
+	ask, _ := testDepth.BestAsk()
+	bid, _ := testDepth.BestBid()
+	assert.Equal(t, 101.0, ask.Price)
+	assert.Equal(t, 99.0, bid.Price)
+	assert.Equal(t, 100.0, testDepth.MidPrice())
+	assert.InDelta(t, 200.0, testDepth.SpreadBps(), 1e-9)
+
+	dep := testDepth.Normalize()
+	assert.Equal(t, 101.0, dep.AskList[0].Price)
+	assert.Equal(t, 99.0, dep.BidList[0].Price)
+}
+
+func TestDepth_Fill(t *testing.T) {
+	fill := testDepth.BuyVWAP(2)
+	assert.True(t, fill.Complete)
+	assert.Equal(t, 203.0, fill.Volume)
+	assert.Equal(t, 101.5, fill.AvgPrice)
+	assert.Equal(t, 102.0, fill.WorstPrice)
+	assert.Equal(t, 2, fill.Levels)
+
+	fill = testDepth.SellVWAPByQuote(99 + 98)
+	assert.True(t, fill.Complete)
+	assert.InDelta(t, 2.0, fill.Amount, 1e-9)
+
+	fill = testDepth.BuyVWAP(10)
+	assert.False(t, fill.Complete)
+	assert.Equal(t, 6.0, fill.Amount)
+
+	assert.InDelta(t, 0.5/99*10000, testDepth.Slippage(SELL, 2), 1e-9)
+}
+
+func TestDepth_DepthWithinBps(t *testing.T) {
+	//买单吃ask
+	amount, volume := testDepth.DepthWithinBps(BUY, 200)
+	assert.Equal(t, 3.0, amount)
+	assert.Equal(t, 101.0+204, volume)
+
+	amount, _ = testDepth.DepthWithinBps(SELL_MARKET, 100)
+	assert.Equal(t, 1.0, amount)
+
+	amount, volume = testDepth.DepthWithinBps(TradeSide(0), 10000)
+	assert.Equal(t, 0.0, amount)
+	assert.Equal(t, 0.0, volume)
+}
+
+func TestDepth_GroupByTick(t *testing.T) {
+	dep := (&Depth{
+		AskList: DepthRecords{{100.1, 1}, {100.4, 1}, {100.6, 1}},
+		BidList: DepthRecords{{99.9, 1}, {99.6, 1}, {99.4, 1}}}).GroupByTick(0.5)
+	assert.Equal(t, DepthRecords{{100.5, 2}, {101, 1}}, dep.AskList)
+	assert.Equal(t, DepthRecords{{99.5, 2}, {99, 1}}, dep.BidList)
+}
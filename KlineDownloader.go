@@ -0,0 +1,239 @@
+package goex
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+//各交易所GetKlineRecords中since参数的含义
+type KlineSince struct {
+	Unit      time.Duration //since的单位, 0 表示不支持since(只返回最新的数据)
+	Exclusive bool          //true: 返回的数据不包含since那根k线
+}
+
+var klineSinceConventions = map[string]KlineSince{
+	BINANCE:    {Unit: time.Nanosecond},
+	OKCOIN_CN:  {Unit: time.Millisecond},
+	OKCOIN_COM: {Unit: time.Millisecond},
+	OKEX:       {Unit: time.Millisecond},
+	KRAKEN:     {Unit: time.Second, Exclusive: true},
+	POLONIEX:   {Unit: time.Second},
+	GDAX:       {Unit: time.Second},
+	BITFINEX:   {Unit: time.Millisecond},
+}
+
+var klineSinceLock sync.RWMutex
+
+func RegisterKlineSince(exName string, since KlineSince) {
+	klineSinceLock.Lock()
+	defer klineSinceLock.Unlock()
+	klineSinceConventions[exName] = since
+}
+
+func GetKlineSince(exName string) KlineSince {
+	klineSinceLock.RLock()
+	defer klineSinceLock.RUnlock()
+	return klineSinceConventions[exName]
+}
+
+/**
+ * k线周期对应的时长, 月和年按30天和365天计算
+ */
+func KlinePeriodDuration(period int) time.Duration {
+	switch period {
+	case KLINE_PERIOD_1MIN:
+		return time.Minute
+	case KLINE_PERIOD_3MIN:
+		return 3 * time.Minute
+	case KLINE_PERIOD_5MIN:
+		return 5 * time.Minute
+	case KLINE_PERIOD_15MIN:
+		return 15 * time.Minute
+	case KLINE_PERIOD_30MIN:
+		return 30 * time.Minute
+	case KLINE_PERIOD_60MIN, KLINE_PERIOD_1H:
+		return time.Hour
+	case KLINE_PERIOD_2H:
+		return 2 * time.Hour
+	case KLINE_PERIOD_4H:
+		return 4 * time.Hour
+	case KLINE_PERIOD_6H:
+		return 6 * time.Hour
+	case KLINE_PERIOD_8H:
+		return 8 * time.Hour
+	case KLINE_PERIOD_12H:
+		return 12 * time.Hour
+	case KLINE_PERIOD_1DAY:
+		return 24 * time.Hour
+	case KLINE_PERIOD_3DAY:
+		return 3 * 24 * time.Hour
+	case KLINE_PERIOD_1WEEK:
+		return 7 * 24 * time.Hour
+	case KLINE_PERIOD_1MONTH:
+		return 30 * 24 * time.Hour
+	case KLINE_PERIOD_1YEAR:
+		return 365 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+//缺失的k线区间 [From , To) , unix timestamp (second)
+type KlineGap struct {
+	From,
+	To int64
+}
+
+type KlineDownloader struct {
+	api      API
+	pair     CurrencyPair
+	period   int
+	store    KlineStore
+	since    KlineSince
+	pageSize int
+	interval time.Duration //两次请求之间的间隔, 用于控制频率
+	retry    int
+	gaps     []KlineGap
+}
+
+func NewKlineDownloader(api API, pair CurrencyPair, period int, store KlineStore) *KlineDownloader {
+	return &KlineDownloader{
+		api:      api,
+		pair:     pair,
+		period:   period,
+		store:    store,
+		since:    GetKlineSince(api.GetExchangeName()),
+		pageSize: 500,
+		interval: time.Second,
+		retry:    3}
+}
+
+func (d *KlineDownloader) PageSize(size int) *KlineDownloader {
+	d.pageSize = size
+	return d
+}
+
+func (d *KlineDownloader) RateLimit(interval time.Duration) *KlineDownloader {
+	d.interval = interval
+	return d
+}
+
+func (d *KlineDownloader) Retry(retry int) *KlineDownloader {
+	d.retry = retry
+	return d
+}
+
+//覆盖默认的since约定, 用于未注册的交易所
+func (d *KlineDownloader) Since(since KlineSince) *KlineDownloader {
+	d.since = since
+	return d
+}
+
+//最近一次Download发现的缺失区间
+func (d *KlineDownloader) Gaps() []KlineGap {
+	return d.gaps
+}
+
+/**
+ * 下载[start , end)区间的k线并写入store , 如store中已有数据则从最后一根k线之后继续(断点续传)
+ * @return 写入的k线根数
+ */
+func (d *KlineDownloader) Download(start, end time.Time) (int, error) {
+	step := int64(KlinePeriodDuration(d.period) / time.Second)
+	if step <= 0 {
+		return 0, fmt.Errorf("unknown kline period %d", d.period)
+	}
+
+	d.gaps = nil
+	cursor := start.Unix()
+	endTs := end.Unix()
+
+	last, ok, err := d.store.Last()
+	if err != nil {
+		return 0, err
+	}
+	if ok && last+step > cursor {
+		cursor = last + step
+	}
+
+	total := 0
+	for cursor < endTs {
+		klines, err := d.fetch(cursor)
+		if err != nil {
+			return total, err
+		}
+
+		var page []Kline
+		next := cursor
+		for _, k := range klines {
+			if k.Timestamp < next || k.Timestamp >= endTs {
+				continue //duplicate or out of range
+			}
+			if k.Timestamp > next {
+				d.gaps = append(d.gaps, KlineGap{From: next, To: k.Timestamp})
+			}
+			k.Pair = d.pair
+			page = append(page, k)
+			next = k.Timestamp + step
+		}
+
+		if len(page) == 0 {
+			break //no more data
+		}
+
+		err = d.store.Append(page)
+		if err != nil {
+			return total, err
+		}
+		total += len(page)
+		cursor = next
+
+		if d.since.Unit == 0 {
+			break //the exchange returns only the latest klines
+		}
+
+		if cursor < endTs {
+			time.Sleep(d.interval)
+		}
+	}
+
+	return total, nil
+}
+
+func (d *KlineDownloader) fetch(cursor int64) ([]Kline, error) {
+	since := -1
+	if d.since.Unit > 0 {
+		ts := cursor
+		if d.since.Exclusive {
+			ts -= 1
+		}
+		since = int(time.Duration(ts) * time.Second / d.since.Unit)
+	}
+
+	var (
+		klines []Kline
+		err    error
+	)
+	for i := 0; i <= d.retry; i++ {
+		if i > 0 {
+			log.Printf("get kline records error: %s , begin retry [%d] ...", err, i)
+			time.Sleep(time.Duration(i) * d.interval)
+		}
+		klines, err = d.api.GetKlineRecords(d.pair, d.period, d.pageSize, since)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(klines, func(i, j int) bool {
+		return klines[i].Timestamp < klines[j].Timestamp
+	})
+
+	return klines, nil
+}
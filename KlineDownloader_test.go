@@ -0,0 +1,147 @@
+package goex
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//按since(ms)分页返回k线, 倒序, 且第一根与上一页重复
+type mockKlineAPI struct {
+	API
+	klines []Kline
+	calls  int
+}
+
+func (m *mockKlineAPI) GetExchangeName() string {
+	return OKEX
+}
+
+func (m *mockKlineAPI) GetKlineRecords(currency CurrencyPair, period, size, since int) ([]Kline, error) {
+	m.calls++
+	var ret []Kline
+	for _, k := range m.klines {
+		if k.Timestamp*1000 >= int64(since)-60000 && len(ret) < size {
+			ret = append(ret, k)
+		}
+	}
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret, nil
+}
+
+func newMockKlines(start int64, n int, skip int64) []Kline {
+	var klines []Kline
+	for i := 0; i < n; i++ {
+		ts := start + int64(i)*60
+		if ts == skip {
+			continue
+		}
+		klines = append(klines, Kline{Timestamp: ts, Open: float64(i), Close: float64(i)})
+	}
+	return klines
+}
+
+func TestKlineDownloader_Download(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kline")
+	defer os.RemoveAll(dir)
+
+	start := int64(1546300800)
+	api := &mockKlineAPI{klines: newMockKlines(start, 100, start+60*50)}
+	store, err := NewCsvKlineStore(filepath.Join(dir, "btc_usdt.csv"))
+	assert.Nil(t, err)
+
+	d := NewKlineDownloader(api, BTC_USDT, KLINE_PERIOD_1MIN, store).PageSize(30).RateLimit(0)
+	n, err := d.Download(time.Unix(start, 0), time.Unix(start+60*80, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, 79, n)
+	assert.Equal(t, []KlineGap{{From: start + 60*50, To: start + 60*51}}, d.Gaps())
+
+	last, ok, err := store.Last()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, start+60*79, last)
+
+	//resume
+	n, err = d.Download(time.Unix(start, 0), time.Unix(start+60*100, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, 20, n)
+	store.Close()
+}
+
+func TestCsvKlineStore_TruncatePartialLine(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kline")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "btc_usdt.csv")
+	store, err := NewCsvKlineStore(path)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Append(newMockKlines(1546300800, 3, 0)))
+	store.Close()
+
+	//a partial line longer than the 512 bytes tail
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write(bytes.Repeat([]byte("9"), 1500))
+	f.Close()
+
+	store, err = NewCsvKlineStore(path)
+	assert.Nil(t, err)
+	last, ok, err := store.Last()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1546300800+120), last)
+	store.Close()
+
+	//no newline at all
+	ioutil.WriteFile(path, bytes.Repeat([]byte("1"), 1500), 0644)
+	store, err = NewCsvKlineStore(path)
+	assert.Nil(t, err)
+	_, ok, _ = store.Last()
+	assert.False(t, ok)
+	store.Close()
+}
+
+func TestBinaryKlineStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kline")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "btc_usdt.bin")
+	store, err := NewBinaryKlineStore(path)
+	assert.Nil(t, err)
+
+	klines := newMockKlines(1546300800, 10, 0)
+	assert.Nil(t, store.Append(klines))
+	store.Close()
+
+	//simulate an interrupted write
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{1, 2, 3})
+	f.Close()
+
+	store, err = NewBinaryKlineStore(path)
+	assert.Nil(t, err)
+	defer store.Close()
+
+	all, err := store.ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, klines, all)
+
+	last, ok, _ := store.Last()
+	assert.True(t, ok)
+	assert.Equal(t, klines[9].Timestamp, last)
+}
+
+func TestGetKlineSince(t *testing.T) {
+	assert.Equal(t, KlineSince{Unit: time.Second, Exclusive: true}, GetKlineSince(KRAKEN))
+	assert.Equal(t, KlineSince{Unit: time.Second}, GetKlineSince(POLONIEX))
+	assert.Equal(t, KlineSince{}, GetKlineSince("unregistered.com"))
+
+	RegisterKlineSince("registered.com", KlineSince{Unit: time.Millisecond})
+	assert.Equal(t, time.Millisecond, GetKlineSince("registered.com").Unit)
+}
@@ -0,0 +1,438 @@
+package goex
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+//各交易所原生支持的k线周期, 未注册的交易所视为不支持k线接口
+var klineNativePeriods = map[string][]int{
+	BINANCE: {KLINE_PERIOD_1MIN, KLINE_PERIOD_3MIN, KLINE_PERIOD_5MIN, KLINE_PERIOD_15MIN, KLINE_PERIOD_30MIN,
+		KLINE_PERIOD_60MIN, KLINE_PERIOD_2H, KLINE_PERIOD_4H, KLINE_PERIOD_6H, KLINE_PERIOD_8H, KLINE_PERIOD_12H,
+		KLINE_PERIOD_1DAY, KLINE_PERIOD_3DAY, KLINE_PERIOD_1WEEK, KLINE_PERIOD_1MONTH},
+	HUOBI_PRO: {KLINE_PERIOD_1MIN, KLINE_PERIOD_5MIN, KLINE_PERIOD_15MIN, KLINE_PERIOD_30MIN, KLINE_PERIOD_60MIN,
+		KLINE_PERIOD_1DAY, KLINE_PERIOD_1WEEK, KLINE_PERIOD_1MONTH, KLINE_PERIOD_1YEAR},
+	OKEX:       okcoinKlinePeriods,
+	OKCOIN_CN:  okcoinKlinePeriods,
+	OKCOIN_COM: okcoinKlinePeriods,
+	KRAKEN: {KLINE_PERIOD_1MIN, KLINE_PERIOD_5MIN, KLINE_PERIOD_15MIN, KLINE_PERIOD_30MIN, KLINE_PERIOD_60MIN,
+		KLINE_PERIOD_4H, KLINE_PERIOD_1DAY, KLINE_PERIOD_1WEEK},
+	GDAX: {KLINE_PERIOD_1MIN, KLINE_PERIOD_5MIN, KLINE_PERIOD_15MIN, KLINE_PERIOD_60MIN, KLINE_PERIOD_6H,
+		KLINE_PERIOD_1DAY},
+	POLONIEX: {KLINE_PERIOD_5MIN, KLINE_PERIOD_15MIN, KLINE_PERIOD_30MIN, KLINE_PERIOD_2H, KLINE_PERIOD_4H,
+		KLINE_PERIOD_1DAY},
+	BITFINEX: {KLINE_PERIOD_1MIN, KLINE_PERIOD_5MIN, KLINE_PERIOD_15MIN, KLINE_PERIOD_30MIN, KLINE_PERIOD_60MIN,
+		KLINE_PERIOD_6H, KLINE_PERIOD_12H, KLINE_PERIOD_1DAY, KLINE_PERIOD_1WEEK, KLINE_PERIOD_1MONTH},
+}
+
+var okcoinKlinePeriods = []int{KLINE_PERIOD_1MIN, KLINE_PERIOD_5MIN, KLINE_PERIOD_15MIN, KLINE_PERIOD_30MIN,
+	KLINE_PERIOD_60MIN, KLINE_PERIOD_4H, KLINE_PERIOD_1DAY, KLINE_PERIOD_1WEEK}
+
+var ErrKlinePeriodNotSupport = errors.New("kline period not support")
+
+/**
+ * 允许用成交记录合成k线的交易所 , 需要显式注册
+ * sinceFunc 把毫秒时间戳转换成该交易所GetTrades的since参数 , 各交易所的含义不同(秒/毫秒/纳秒...)
+ * since 是trade id之类的游标时不能注册
+ * poloniex和huobi只返回since之后最近的一批成交 , 只能合成最近一段时间的k线
+ */
+var klineTradesSince = map[string]func(ms int64) int64{
+	BITFINEX:  func(ms int64) int64 { return ms },
+	HUOBI_PRO: func(ms int64) int64 { return ms },
+	KRAKEN:    func(ms int64) int64 { return ms * int64(time.Millisecond) },
+	POLONIEX:  func(ms int64) int64 { return ms / 1000 },
+}
+
+var klinePeriodsLock sync.RWMutex
+
+func RegisterKlinePeriods(exName string, periods ...int) {
+	klinePeriodsLock.Lock()
+	defer klinePeriodsLock.Unlock()
+	klineNativePeriods[exName] = periods
+}
+
+func RegisterKlineFromTrades(exName string, sinceFunc func(ms int64) int64) {
+	klinePeriodsLock.Lock()
+	defer klinePeriodsLock.Unlock()
+	klineTradesSince[exName] = sinceFunc
+}
+
+func nativeKlinePeriods(exName string) []int {
+	klinePeriodsLock.RLock()
+	defer klinePeriodsLock.RUnlock()
+	return klineNativePeriods[exName]
+}
+
+func IsKlinePeriodSupported(exName string, period int) bool {
+	_, ok := nativeKlinePeriod(exName, period)
+	return ok
+}
+
+//KLINE_PERIOD_60MIN和KLINE_PERIOD_1H是同一个周期
+func nativeKlinePeriod(exName string, period int) (int, bool) {
+	for _, p := range nativeKlinePeriods(exName) {
+		if p == period ||
+			(p == KLINE_PERIOD_60MIN && period == KLINE_PERIOD_1H) ||
+			(p == KLINE_PERIOD_1H && period == KLINE_PERIOD_60MIN) {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+/**
+ * k线开始时间(unix timestamp , second), 周线从周一开始, 月线和年线按UTC自然月/年
+ */
+func KlineOpenTime(ts int64, period int) int64 {
+	switch period {
+	case KLINE_PERIOD_1WEEK:
+		const monday = 4 * 24 * 3600 //1970-01-05
+		week := int64(7 * 24 * 3600)
+		return (ts-monday)/week*week + monday
+	case KLINE_PERIOD_1MONTH:
+		t := time.Unix(ts, 0).UTC()
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).Unix()
+	case KLINE_PERIOD_1YEAR:
+		t := time.Unix(ts, 0).UTC()
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	}
+
+	step := int64(KlinePeriodDuration(period) / time.Second)
+	if step <= 0 {
+		return ts
+	}
+	return ts / step * step
+}
+
+/**
+ * 用逐笔成交合成k线 , trade.Date单位为毫秒 , 结果按时间升序
+ */
+func BuildKlinesFromTrades(pair CurrencyPair, trades []Trade, period int) []Kline {
+	sorted := make([]Trade, len(trades))
+	copy(sorted, trades)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date < sorted[j].Date
+	})
+
+	b := &klineBuilder{pair: pair, period: period}
+	for _, t := range sorted {
+		b.add(t)
+	}
+	return b.klines
+}
+
+//逐笔累加成k线 , 成交应按时间升序加入
+type klineBuilder struct {
+	pair   CurrencyPair
+	period int
+	klines []Kline
+}
+
+func (b *klineBuilder) add(t Trade) {
+	ts := KlineOpenTime(t.Date/1000, b.period)
+	n := len(b.klines)
+	if n == 0 || b.klines[n-1].Timestamp < ts {
+		b.klines = append(b.klines, Kline{Pair: b.pair, Timestamp: ts,
+			Open: t.Price, High: t.Price, Low: t.Price, Close: t.Price, Vol: t.Amount})
+		return
+	}
+
+	//乱序的成交只更新所在k线的最高、最低和成交量
+	i := n - 1
+	for i >= 0 && b.klines[i].Timestamp > ts {
+		i--
+	}
+	if i < 0 || b.klines[i].Timestamp != ts {
+		return
+	}
+
+	k := &b.klines[i]
+	if t.Price > k.High {
+		k.High = t.Price
+	}
+	if t.Price < k.Low {
+		k.Low = t.Price
+	}
+	if i == n-1 {
+		k.Close = t.Price
+	}
+	k.Vol += t.Amount
+}
+
+/**
+ * 把小周期的k线合成大周期 , 结果按时间升序
+ */
+func ResampleKlines(klines []Kline, period int) []Kline {
+	sorted := make([]Kline, len(klines))
+	copy(sorted, klines)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+
+	var ret []Kline
+	for _, k := range sorted {
+		ts := KlineOpenTime(k.Timestamp, period)
+		n := len(ret)
+		if n == 0 || ret[n-1].Timestamp != ts {
+			k.Timestamp = ts
+			ret = append(ret, k)
+			continue
+		}
+
+		bar := &ret[n-1]
+		if k.High > bar.High {
+			bar.High = k.High
+		}
+		if k.Low < bar.Low {
+			bar.Low = k.Low
+		}
+		bar.Close = k.Close
+		bar.Vol += k.Vol
+	}
+
+	return ret
+}
+
+/**
+ * 获取任意周期的k线
+ * 1. 交易所原生支持该周期时直接获取
+ * 2. 否则用能整除的较小周期合成
+ * 3. 都不行时用成交记录合成 , 需RegisterKlineFromTrades
+ * 指定since时用KlineDownloader按交易所的since约定(GetKlineSince)翻页 , 不受单次请求条数的限制
+ */
+type KlineResampler struct {
+	api      API
+	pageSize int
+	interval time.Duration //两次请求之间的间隔
+	maxPages int           //用成交记录合成时最多请求的页数
+}
+
+func NewKlineResampler(api API) *KlineResampler {
+	return &KlineResampler{
+		api:      api,
+		pageSize: 500,
+		interval: time.Second,
+		maxPages: 100}
+}
+
+func (r *KlineResampler) PageSize(size int) *KlineResampler {
+	r.pageSize = size
+	return r
+}
+
+func (r *KlineResampler) RateLimit(interval time.Duration) *KlineResampler {
+	r.interval = interval
+	return r
+}
+
+func (r *KlineResampler) MaxPages(n int) *KlineResampler {
+	r.maxPages = n
+	return r
+}
+
+/**
+ * since: 毫秒时间戳 , 返回since开始的size根 ; 0为最近的size根 , 最后一根可能还没走完
+ * 结果按时间升序
+ */
+func (r *KlineResampler) GetKlineRecords(pair CurrencyPair, period, size, since int) ([]Kline, error) {
+	step := int64(KlinePeriodDuration(period) / time.Second)
+	if step <= 0 || size <= 0 {
+		return nil, ErrKlinePeriodNotSupport
+	}
+
+	//请求的时间范围 [start , end) , 秒
+	now := time.Now().Unix()
+	var start, end int64
+	if since > 0 {
+		start = KlineOpenTime(int64(since)/1000, period)
+		end = start + int64(size)*step
+		if end > now+1 {
+			end = now + 1
+		}
+	} else {
+		start = KlineOpenTime(KlineOpenTime(now, period)-int64(size-1)*step, period)
+		end = now + 1
+	}
+	pick := func(klines []Kline) []Kline {
+		if since > 0 && len(klines) > size {
+			return klines[:size]
+		}
+		return lastKlines(klines, size)
+	}
+
+	exName := r.api.GetExchangeName()
+	if native, ok := nativeKlinePeriod(exName, period); ok {
+		if since > 0 {
+			klines, err := r.download(pair, native, start, end)
+			return pick(klines), err
+		}
+
+		klines, err := r.api.GetKlineRecords(pair, native, size, 0)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(klines, func(i, j int) bool {
+			return klines[i].Timestamp < klines[j].Timestamp
+		})
+		return pick(klines), nil
+	}
+
+	if base := resampleBasePeriod(exName, period); base != 0 {
+		klines, err := r.download(pair, base, start, end)
+		if err != nil {
+			return nil, err
+		}
+		return pick(ResampleKlines(klines, period)), nil
+	}
+
+	klinePeriodsLock.RLock()
+	sinceFunc := klineTradesSince[exName]
+	klinePeriodsLock.RUnlock()
+	if sinceFunc == nil {
+		return nil, ErrKlinePeriodNotSupport
+	}
+
+	klines, err := r.klinesFromTrades(sinceFunc, pair, period, size, start*1000, end*1000)
+	if err != nil {
+		return nil, err
+	}
+	return pick(klines), nil
+}
+
+func (r *KlineResampler) download(pair CurrencyPair, period int, start, end int64) ([]Kline, error) {
+	store := &memKlineStore{}
+	d := NewKlineDownloader(r.api, pair, period, store).PageSize(r.pageSize).RateLimit(r.interval)
+	_, err := d.Download(time.Unix(start, 0), time.Unix(end, 0))
+	if err != nil {
+		return nil, err
+	}
+	return store.klines, nil
+}
+
+/**
+ * 从since(ms)开始向后翻页获取成交记录 , 直到凑够size根k线、超出end(ms)、没有更新的成交或达到maxPages
+ * k线随每一页增量合成
+ */
+func (r *KlineResampler) klinesFromTrades(sinceFunc func(ms int64) int64, pair CurrencyPair, period, size int, since, end int64) ([]Kline, error) {
+	var (
+		b      = &klineBuilder{pair: pair, period: period}
+		cursor = since
+		seen   = make(map[int64]bool)
+	)
+	for pages := 0; ; pages++ {
+		if pages >= r.maxPages {
+			log.Printf("[%s] kline from trades reach max pages %d", r.api.GetExchangeName(), r.maxPages)
+			break
+		}
+		if pages > 0 {
+			time.Sleep(r.interval)
+		}
+
+		page, err := r.api.GetTrades(pair, sinceFunc(cursor))
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(page, func(i, j int) bool {
+			return page[i].Date < page[j].Date
+		})
+
+		last, done := cursor, false
+		for _, t := range page {
+			if t.Date >= end {
+				done = true
+				continue
+			}
+			if t.Date < since {
+				continue
+			}
+			//翻页时since可能包含上一页的最后一笔 , 没有tid时按时间去重
+			if t.Tid != 0 {
+				if seen[t.Tid] {
+					continue
+				}
+				seen[t.Tid] = true
+			} else if pages > 0 && t.Date <= cursor {
+				continue
+			}
+			b.add(t)
+			if t.Date > last {
+				last = t.Date
+			}
+		}
+		if done || last <= cursor || len(b.klines) > size {
+			break
+		}
+		cursor = last
+	}
+
+	return b.klines, nil
+}
+
+/**
+ * 获取任意周期的k线 , since为毫秒时间戳 , 0为最近的size根 , 见KlineResampler
+ */
+func GetKlineRecordsWithResample(api API, pair CurrencyPair, period, size, since int) ([]Kline, error) {
+	return NewKlineResampler(api).GetKlineRecords(pair, period, size, since)
+}
+
+//交易所支持的、能整除目标周期的最大周期
+func resampleBasePeriod(exName string, period int) int {
+	target := KlinePeriodDuration(period)
+	if target <= 0 {
+		return 0
+	}
+
+	var (
+		base    int
+		baseDur time.Duration
+	)
+	for _, p := range nativeKlinePeriods(exName) {
+		d := KlinePeriodDuration(p)
+		if d <= 0 || d >= target || d <= baseDur {
+			continue
+		}
+		switch period {
+		case KLINE_PERIOD_1MONTH, KLINE_PERIOD_1YEAR: //自然月/年只能由日线及以下合成
+			if d > 24*time.Hour {
+				continue
+			}
+		}
+		if target%d != 0 {
+			continue
+		}
+		base, baseDur = p, d
+	}
+
+	return base
+}
+
+//内存中的KlineStore , 翻页获取后直接返回
+type memKlineStore struct {
+	klines []Kline
+}
+
+func (s *memKlineStore) Append(klines []Kline) error {
+	s.klines = append(s.klines, klines...)
+	return nil
+}
+
+func (s *memKlineStore) Last() (int64, bool, error) {
+	if len(s.klines) == 0 {
+		return 0, false, nil
+	}
+	return s.klines[len(s.klines)-1].Timestamp, true, nil
+}
+
+func (s *memKlineStore) Close() error {
+	return nil
+}
+
+func lastKlines(klines []Kline, size int) []Kline {
+	if size > 0 && len(klines) > size {
+		return klines[len(klines)-size:]
+	}
+	return klines
+}
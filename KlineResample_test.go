@@ -0,0 +1,169 @@
+package goex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildKlinesFromTrades(t *testing.T) {
+	start := int64(1546300800) //2019-01-01 00:00:00 UTC
+	trades := []Trade{
+		{Price: 10, Amount: 1, Date: (start + 30) * 1000},
+		{Price: 8, Amount: 2, Date: (start + 10) * 1000},
+		{Price: 12, Amount: 1, Date: (start + 170) * 1000},
+		{Price: 11, Amount: 3, Date: (start + 200) * 1000},
+	}
+
+	klines := BuildKlinesFromTrades(BTC_USDT, trades, KLINE_PERIOD_3MIN)
+	assert.Equal(t, 2, len(klines))
+	assert.Equal(t, Kline{Pair: BTC_USDT, Timestamp: start, Open: 8, High: 12, Low: 8, Close: 12, Vol: 4}, klines[0])
+	assert.Equal(t, Kline{Pair: BTC_USDT, Timestamp: start + 180, Open: 11, High: 11, Low: 11, Close: 11, Vol: 3}, klines[1])
+}
+
+func TestResampleKlines(t *testing.T) {
+	start := int64(1546300800)
+	var klines []Kline
+	for i := 0; i < 48; i++ {
+		klines = append(klines, Kline{Timestamp: start + int64(i)*3600, Open: float64(i), Close: float64(i + 1),
+			High: float64(i + 2), Low: float64(i), Vol: 1})
+	}
+
+	bars := ResampleKlines(klines, KLINE_PERIOD_8H)
+	assert.Equal(t, 6, len(bars))
+	assert.Equal(t, Kline{Timestamp: start + 8*3600, Open: 8, Close: 16, High: 17, Low: 8, Vol: 8}, bars[1])
+
+	weeks := ResampleKlines(klines, KLINE_PERIOD_1WEEK)
+	assert.Equal(t, 1, len(weeks))
+	assert.Equal(t, start-24*3600, weeks[0].Timestamp) //Monday 2018-12-31
+}
+
+func TestResampleBasePeriod(t *testing.T) {
+	assert.Equal(t, KLINE_PERIOD_1MIN, resampleBasePeriod(HUOBI_PRO, KLINE_PERIOD_3MIN))
+	assert.Equal(t, KLINE_PERIOD_60MIN, resampleBasePeriod(HUOBI_PRO, KLINE_PERIOD_8H))
+	assert.Equal(t, KLINE_PERIOD_4H, resampleBasePeriod(OKEX, KLINE_PERIOD_12H))
+	assert.Equal(t, KLINE_PERIOD_1DAY, resampleBasePeriod(OKEX, KLINE_PERIOD_1MONTH))
+	assert.True(t, IsKlinePeriodSupported(OKEX, KLINE_PERIOD_1H))
+	assert.True(t, IsKlinePeriodSupported(KRAKEN, KLINE_PERIOD_1H))
+	assert.Equal(t, KLINE_PERIOD_4H, resampleBasePeriod(KRAKEN, KLINE_PERIOD_12H))
+	assert.Equal(t, KLINE_PERIOD_6H, resampleBasePeriod(GDAX, KLINE_PERIOD_12H))
+	assert.Equal(t, KLINE_PERIOD_15MIN, resampleBasePeriod(GDAX, KLINE_PERIOD_30MIN))
+	assert.Equal(t, KLINE_PERIOD_30MIN, resampleBasePeriod(POLONIEX, KLINE_PERIOD_60MIN))
+	assert.Equal(t, KLINE_PERIOD_4H, resampleBasePeriod(POLONIEX, KLINE_PERIOD_8H))
+	assert.False(t, IsKlinePeriodSupported(POLONIEX, KLINE_PERIOD_1MIN))
+	assert.False(t, IsKlinePeriodSupported("unregistered.com", KLINE_PERIOD_1MIN))
+}
+
+type mockResampleAPI struct {
+	API
+	name        string
+	klines      []Kline
+	trades      []Trade
+	periods     []int
+	klineSinces []int
+	sinces      []int64
+	pageSize    int
+}
+
+func (m *mockResampleAPI) GetExchangeName() string {
+	return m.name
+}
+
+func (m *mockResampleAPI) GetKlineRecords(currency CurrencyPair, period, size, since int) ([]Kline, error) {
+	m.periods = append(m.periods, period)
+	m.klineSinces = append(m.klineSinces, since)
+	ret := append([]Kline{}, m.klines...)
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret, nil
+}
+
+//since单位为秒 , 包含since这一秒 , 每页最多pageSize笔
+func (m *mockResampleAPI) GetTrades(currencyPair CurrencyPair, since int64) ([]Trade, error) {
+	if m.pageSize == 0 {
+		panic("not implements")
+	}
+	m.sinces = append(m.sinces, since)
+	var ret []Trade
+	for _, t := range m.trades {
+		if t.Date >= since*1000 && len(ret) < m.pageSize {
+			ret = append(ret, t)
+		}
+	}
+	return ret, nil
+}
+
+func TestGetKlineRecordsWithResample(t *testing.T) {
+	start := int64(1546300800)
+	var klines []Kline
+	for i := 0; i < 6; i++ {
+		klines = append(klines, Kline{Timestamp: start + int64(i)*60, Open: float64(i), Close: float64(i + 1),
+			High: float64(i + 1), Low: float64(i), Vol: 1})
+	}
+
+	//native
+	api := &mockResampleAPI{name: HUOBI_PRO, klines: klines}
+	ret, err := GetKlineRecordsWithResample(api, BTC_USDT, KLINE_PERIOD_1MIN, 6, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, klines, ret)
+	assert.Equal(t, []int{KLINE_PERIOD_1MIN}, api.periods)
+
+	//resample , since为毫秒 , huobi的k线接口不支持since , 只请求一次
+	api = &mockResampleAPI{name: HUOBI_PRO, klines: klines}
+	ret, err = NewKlineResampler(api).RateLimit(0).GetKlineRecords(BTC_USDT, KLINE_PERIOD_3MIN, 1, int(start*1000))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{KLINE_PERIOD_1MIN}, api.periods)
+	assert.Equal(t, []Kline{{Pair: BTC_USDT, Timestamp: start, Open: 0, Close: 3, High: 3, Low: 0, Vol: 3}}, ret)
+
+	//native with since , 按kraken的约定转换成秒(不含since)
+	api = &mockResampleAPI{name: KRAKEN, klines: klines}
+	ret, err = NewKlineResampler(api).RateLimit(0).GetKlineRecords(BTC_USDT, KLINE_PERIOD_1MIN, 3, int(start*1000+30000))
+	assert.Nil(t, err)
+	assert.Equal(t, int(start-1), api.klineSinces[0])
+	assert.Equal(t, 3, len(ret))
+	assert.Equal(t, start, ret[0].Timestamp)
+	assert.Equal(t, start+120, ret[2].Timestamp)
+
+	//not registered, GetTrades must not be called
+	api = &mockResampleAPI{name: "unregistered.com"}
+	_, err = GetKlineRecordsWithResample(api, BTC_USDT, KLINE_PERIOD_1MIN, 10, int(start*1000))
+	assert.Equal(t, ErrKlinePeriodNotSupport, err)
+}
+
+func TestGetKlineRecordsWithResample_Trades(t *testing.T) {
+	RegisterKlineFromTrades("trades.com", func(ms int64) int64 {
+		return ms / 1000
+	})
+	defer func() {
+		klinePeriodsLock.Lock()
+		delete(klineTradesSince, "trades.com")
+		klinePeriodsLock.Unlock()
+	}()
+
+	start := int64(1546300800)
+	api := &mockResampleAPI{name: "trades.com", pageSize: 3, trades: []Trade{
+		{Price: 9, Amount: 1, Date: (start - 10) * 1000},
+		{Price: 10, Amount: 1, Date: (start + 10) * 1000},
+		{Price: 12, Amount: 1, Date: (start + 10) * 1000},
+		{Price: 8, Amount: 2, Date: (start + 50) * 1000},
+		{Price: 11, Amount: 1, Date: (start + 70) * 1000},
+		{Price: 13, Amount: 1, Date: (start + 130) * 1000},
+		{Price: 14, Amount: 1, Date: (start + 200) * 1000},
+	}}
+
+	ret, err := NewKlineResampler(api).RateLimit(0).GetKlineRecords(BTC_USDT, KLINE_PERIOD_1MIN, 2, int(start*1000))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{start, start + 50}, api.sinces) //stop after passing the end
+	assert.Equal(t, []Kline{
+		{Pair: BTC_USDT, Timestamp: start, Open: 10, High: 12, Low: 8, Close: 8, Vol: 4},
+		{Pair: BTC_USDT, Timestamp: start + 60, Open: 11, High: 11, Low: 11, Close: 11, Vol: 1},
+	}, ret)
+
+	//max pages
+	api.sinces = nil
+	ret, err = NewKlineResampler(api).RateLimit(0).MaxPages(1).GetKlineRecords(BTC_USDT, KLINE_PERIOD_1MIN, 2, int(start*1000))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(api.sinces))
+	assert.Equal(t, []Kline{{Pair: BTC_USDT, Timestamp: start, Open: 10, High: 12, Low: 8, Close: 8, Vol: 4}}, ret)
+}
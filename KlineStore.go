@@ -0,0 +1,257 @@
+package goex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//k线持久化
+type KlineStore interface {
+	Append(klines []Kline) error
+	Last() (int64, bool, error) //最后一根k线的时间戳
+	Close() error
+}
+
+/**
+ * csv格式: timestamp,open,high,low,close,vol
+ */
+type CsvKlineStore struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+func NewCsvKlineStore(path string) (*CsvKlineStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = truncateCsvPartialLine(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &CsvKlineStore{file: f}, nil
+}
+
+//截掉中断时写了一半的行 , 从文件尾部按块向前查找最后一个换行符 , 找不到时清空文件
+func truncateCsvPartialLine(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := info.Size()
+	end := size
+	buf := make([]byte, 512)
+	for end > 0 {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+		chunk := buf[:n]
+		_, err = f.ReadAt(chunk, end-n)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		i := bytes.LastIndexByte(chunk, '\n')
+		if i >= 0 {
+			end = end - n + int64(i+1)
+			break
+		}
+		end -= n
+	}
+
+	if end == size {
+		return nil
+	}
+	return f.Truncate(end)
+}
+
+func (s *CsvKlineStore) Append(klines []Kline) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	w := bufio.NewWriter(s.file)
+	for _, k := range klines {
+		fmt.Fprintf(w, "%d,%s,%s,%s,%s,%s\n", k.Timestamp, formatCsvFloat(k.Open), formatCsvFloat(k.High),
+			formatCsvFloat(k.Low), formatCsvFloat(k.Close), formatCsvFloat(k.Vol))
+	}
+	return w.Flush()
+}
+
+func (s *CsvKlineStore) Last() (int64, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	info, err := s.file.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+
+	size := info.Size()
+	if size == 0 {
+		return 0, false, nil
+	}
+
+	//读取文件尾部足够容纳一行的数据
+	var tail int64 = 512
+	if tail > size {
+		tail = size
+	}
+	buf := make([]byte, tail)
+	_, err = s.file.ReadAt(buf, size-tail)
+	if err != nil && err != io.EOF {
+		return 0, false, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	lastLine := lines[len(lines)-1]
+	fields := strings.Split(lastLine, ",")
+	ts, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("bad csv kline line: %s", lastLine)
+	}
+
+	return ts, true, nil
+}
+
+func (s *CsvKlineStore) Close() error {
+	return s.file.Close()
+}
+
+func formatCsvFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+/**
+ * 紧凑的二进制格式, 每根k线48字节(little endian):
+ * timestamp int64 , open , high , low , close , vol float64
+ */
+type BinaryKlineStore struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+const binaryKlineSize = 48
+
+func NewBinaryKlineStore(path string) (*BinaryKlineStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	//截掉中断时写了一半的记录
+	if rem := info.Size() % binaryKlineSize; rem != 0 {
+		err = f.Truncate(info.Size() - rem)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return &BinaryKlineStore{file: f}, nil
+}
+
+func (s *BinaryKlineStore) Append(klines []Kline) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var buf bytes.Buffer
+	for _, k := range klines {
+		buf.Write(encodeBinaryKline(k))
+	}
+
+	_, err := s.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(buf.Bytes())
+	return err
+}
+
+func (s *BinaryKlineStore) Last() (int64, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	info, err := s.file.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+
+	if info.Size() < binaryKlineSize {
+		return 0, false, nil
+	}
+
+	buf := make([]byte, 8)
+	_, err = s.file.ReadAt(buf, info.Size()-binaryKlineSize)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return int64(binary.LittleEndian.Uint64(buf)), true, nil
+}
+
+func (s *BinaryKlineStore) Close() error {
+	return s.file.Close()
+}
+
+//读取全部k线
+func (s *BinaryKlineStore) ReadAll() ([]Kline, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(s.file)
+	if err != nil {
+		return nil, err
+	}
+
+	klines := make([]Kline, 0, len(data)/binaryKlineSize)
+	for i := 0; i+binaryKlineSize <= len(data); i += binaryKlineSize {
+		klines = append(klines, decodeBinaryKline(data[i:i+binaryKlineSize]))
+	}
+	return klines, nil
+}
+
+func encodeBinaryKline(k Kline) []byte {
+	buf := make([]byte, binaryKlineSize)
+	binary.LittleEndian.PutUint64(buf[0:], uint64(k.Timestamp))
+	binary.LittleEndian.PutUint64(buf[8:], math.Float64bits(k.Open))
+	binary.LittleEndian.PutUint64(buf[16:], math.Float64bits(k.High))
+	binary.LittleEndian.PutUint64(buf[24:], math.Float64bits(k.Low))
+	binary.LittleEndian.PutUint64(buf[32:], math.Float64bits(k.Close))
+	binary.LittleEndian.PutUint64(buf[40:], math.Float64bits(k.Vol))
+	return buf
+}
+
+func decodeBinaryKline(buf []byte) Kline {
+	return Kline{
+		Timestamp: int64(binary.LittleEndian.Uint64(buf[0:])),
+		Open:      math.Float64frombits(binary.LittleEndian.Uint64(buf[8:])),
+		High:      math.Float64frombits(binary.LittleEndian.Uint64(buf[16:])),
+		Low:       math.Float64frombits(binary.LittleEndian.Uint64(buf[24:])),
+		Close:     math.Float64frombits(binary.LittleEndian.Uint64(buf[32:])),
+		Vol:       math.Float64frombits(binary.LittleEndian.Uint64(buf[40:]))}
+}
@@ -86,7 +86,7 @@ type APIConfig struct {
 	Endpoint      string
 	ApiKey        string
 	ApiSecretKey  string
-	ApiPassphrase string //for okex.com v3 api
+	ApiPassphrase string //for okex.com v3 api , coinbase pro
 	ClientId      string //for bitstamp.net , huobi.pro
 
 	Lever int //杠杆倍数 , for future
@@ -0,0 +1,476 @@
+package goex
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOrderBookGap      = errors.New("order book sequence gap")
+	ErrOrderBookChecksum = errors.New("order book checksum error")
+	ErrOrderBookNotSync  = errors.New("order book not synced")
+)
+
+/**
+ * 增量深度 , Amount为0表示删除该价位
+ * Seq: 本次更新的序号 (必须)
+ * FirstSeq: 本次更新包含的第一个序号 (binance的U) , 可选
+ * PrevSeq: 上一次更新的序号 (huobi mbp的prevSeqNum) , 可选
+ */
+type DepthUpdate struct {
+	FirstSeq,
+	Seq,
+	PrevSeq int64
+	AskList,
+	BidList DepthRecords
+	Checksum    int32
+	HasChecksum bool
+}
+
+//返回全量深度和对应的序号 , 序号为0表示没有序号, 之后的第一个增量无条件接受
+type OrderBookSnapshotFunc func() (*Depth, int64, error)
+
+//按交易所规则计算前N档的校验和
+type OrderBookChecksumFunc func(asks, bids DepthRecords) int32
+
+/**
+ * 本地维护的深度 , 由全量+增量构建
+ * asks 价格升序 , bids 价格降序
+ */
+type OrderBook struct {
+	lock      sync.RWMutex
+	pair      CurrencyPair
+	asks      DepthRecords
+	bids      DepthRecords
+	seq       int64
+	synced    bool
+	fresh     bool  //刚应用全量 , 下一个增量只需覆盖seq
+	syncing   bool  //正在获取全量
+	syncGen   int64 //每次开始同步加1 , 过期的同步结果直接丢弃
+	buffer    []*DepthUpdate
+	utime     time.Time
+	snapshot  OrderBookSnapshotFunc
+	checksum  OrderBookChecksumFunc
+	maxLevels int
+}
+
+func NewOrderBook(pair CurrencyPair) *OrderBook {
+	return &OrderBook{pair: pair}
+}
+
+//设置断档后用于重新同步的全量深度来源
+func (ob *OrderBook) SetSnapshotFunc(fn OrderBookSnapshotFunc) *OrderBook {
+	ob.snapshot = fn
+	return ob
+}
+
+func (ob *OrderBook) SetChecksumFunc(fn OrderBookChecksumFunc) *OrderBook {
+	ob.checksum = fn
+	return ob
+}
+
+//只保留前n档 , 交易所只推送固定档数的增量时使用 , 超出的档位不会再有更新
+func (ob *OrderBook) SetMaxLevels(n int) *OrderBook {
+	ob.maxLevels = n
+	return ob
+}
+
+//用rest接口GetDepth作为全量来源 , 没有序号
+func RestDepthSnapshot(api API, size int, pair CurrencyPair) OrderBookSnapshotFunc {
+	return func() (*Depth, int64, error) {
+		dep, err := api.GetDepth(size, pair)
+		return dep, 0, err
+	}
+}
+
+func (ob *OrderBook) Pair() CurrencyPair {
+	return ob.pair
+}
+
+func (ob *OrderBook) Seq() int64 {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.seq
+}
+
+func (ob *OrderBook) IsSynced() bool {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.synced
+}
+
+func (ob *OrderBook) UTime() time.Time {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+	return ob.utime
+}
+
+//用全量深度重置 , 作废正在进行的同步
+func (ob *OrderBook) Snapshot(dep *Depth, seq int64) {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	ob.syncGen++
+	ob.syncing = false
+	ob.buffer = nil
+	ob.reset(dep, seq)
+}
+
+func (ob *OrderBook) reset(dep *Depth, seq int64) {
+	ob.asks = make(DepthRecords, 0, len(dep.AskList))
+	ob.bids = make(DepthRecords, 0, len(dep.BidList))
+	for _, r := range dep.AskList {
+		if r.Amount > 0 {
+			ob.asks = append(ob.asks, r)
+		}
+	}
+	for _, r := range dep.BidList {
+		if r.Amount > 0 {
+			ob.bids = append(ob.bids, r)
+		}
+	}
+	sort.Sort(ob.asks)
+	sort.Sort(sort.Reverse(ob.bids))
+	ob.asks = ob.limit(ob.asks)
+	ob.bids = ob.limit(ob.bids)
+
+	ob.seq = seq
+	ob.synced = true
+	ob.fresh = true
+	ob.utime = time.Now()
+	if !dep.UTime.IsZero() {
+		ob.utime = dep.UTime
+	}
+}
+
+/**
+ * 应用增量 , 发现断档或校验和错误时如设置了全量来源则在后台重新同步
+ * 同步期间的增量先缓存 , 全量有序号时应用序号之后的缓存 , 没有序号时丢弃缓存 , 期间返回ErrOrderBookNotSync
+ * 出错的增量不会生效也不会缓存
+ */
+func (ob *OrderBook) Update(update *DepthUpdate) error {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+
+	if ob.syncing {
+		ob.buffer = append(ob.buffer, update)
+		return ErrOrderBookNotSync
+	}
+
+	err := ob.apply(update)
+	if err == nil || ob.snapshot == nil {
+		return err
+	}
+
+	log.Printf("[%s] order book %s , resync ...", ob.pair, err)
+	ob.startResync()
+	return err
+}
+
+//主动重新同步 , 阻塞到拿到全量 , 正在进行的后台同步作废
+func (ob *OrderBook) Resync() error {
+	if ob.snapshot == nil {
+		return ErrOrderBookNotSync
+	}
+
+	ob.lock.Lock()
+	ob.buffer = nil
+	gen := ob.beginResync()
+	ob.lock.Unlock()
+
+	return ob.resync(gen)
+}
+
+func (ob *OrderBook) startResync() {
+	if !ob.syncing {
+		go ob.resync(ob.beginResync())
+	}
+}
+
+func (ob *OrderBook) beginResync() int64 {
+	ob.synced = false
+	ob.syncing = true
+	ob.syncGen++
+	return ob.syncGen
+}
+
+//在锁外获取全量 , 不阻塞推送和读取
+func (ob *OrderBook) resync(gen int64) error {
+	dep, seq, err := ob.snapshot()
+
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+
+	if gen != ob.syncGen {
+		return ErrOrderBookNotSync //已被新的同步取代
+	}
+
+	ob.syncing = false
+	buffer := ob.buffer
+	ob.buffer = nil
+	if err != nil {
+		log.Printf("[%s] get order book snapshot error: %s", ob.pair, err)
+		return err //下一个增量重新同步
+	}
+
+	ob.reset(dep, seq)
+	if seq == 0 {
+		return nil //无法判断缓存的增量是否已包含在全量中 , 丢弃
+	}
+
+	for i, update := range buffer {
+		if err := ob.apply(update); err != nil {
+			log.Printf("[%s] order book %s , resync ...", ob.pair, err)
+			ob.buffer = append(ob.buffer, buffer[i+1:]...)
+			ob.startResync()
+			return err
+		}
+	}
+	return nil
+}
+
+func (ob *OrderBook) apply(update *DepthUpdate) error {
+	if !ob.synced {
+		return ErrOrderBookNotSync
+	}
+
+	if ob.seq > 0 && update.Seq > 0 {
+		if update.Seq <= ob.seq {
+			return nil //outdated
+		}
+
+		if ob.fresh {
+			if (update.PrevSeq > 0 && update.PrevSeq > ob.seq) || (update.FirstSeq > 0 && update.FirstSeq > ob.seq+1) {
+				ob.synced = false
+				return ErrOrderBookGap
+			}
+		} else if update.PrevSeq > 0 {
+			if update.PrevSeq != ob.seq {
+				ob.synced = false
+				return ErrOrderBookGap
+			}
+		} else if update.FirstSeq > 0 {
+			if update.FirstSeq > ob.seq+1 {
+				ob.synced = false
+				return ErrOrderBookGap
+			}
+		} else if update.Seq != ob.seq+1 {
+			ob.synced = false
+			return ErrOrderBookGap
+		}
+	}
+
+	asks, bids := ob.asks, ob.bids
+	verify := update.HasChecksum && ob.checksum != nil
+	if verify {
+		//在拷贝上更新 , 校验通过才生效
+		asks = append(make(DepthRecords, 0, len(asks)+len(update.AskList)), asks...)
+		bids = append(make(DepthRecords, 0, len(bids)+len(update.BidList)), bids...)
+	}
+
+	for _, r := range update.AskList {
+		asks = updateLevel(asks, r, func(a, b float64) bool { return a < b })
+	}
+	for _, r := range update.BidList {
+		bids = updateLevel(bids, r, func(a, b float64) bool { return a > b })
+	}
+	asks, bids = ob.limit(asks), ob.limit(bids)
+
+	if verify {
+		if sum := ob.checksum(asks, bids); sum != update.Checksum {
+			ob.synced = false
+			return fmt.Errorf("%s , expect %d but %d", ErrOrderBookChecksum, update.Checksum, sum)
+		}
+	}
+
+	ob.asks, ob.bids = asks, bids
+	if update.Seq > 0 {
+		ob.seq = update.Seq
+	}
+	ob.fresh = false
+	ob.utime = time.Now()
+
+	return nil
+}
+
+func (ob *OrderBook) limit(levels DepthRecords) DepthRecords {
+	if ob.maxLevels > 0 && len(levels) > ob.maxLevels {
+		return levels[:ob.maxLevels]
+	}
+	return levels
+}
+
+//在有序的价位列表中更新/插入/删除一档
+func updateLevel(levels DepthRecords, r DepthRecord, before func(a, b float64) bool) DepthRecords {
+	i := sort.Search(len(levels), func(i int) bool {
+		return !before(levels[i].Price, r.Price)
+	})
+
+	found := i < len(levels) && levels[i].Price == r.Price
+	if r.Amount <= 0 {
+		if found {
+			levels = append(levels[:i], levels[i+1:]...)
+		}
+		return levels
+	}
+
+	if found {
+		levels[i].Amount = r.Amount
+		return levels
+	}
+
+	levels = append(levels, DepthRecord{})
+	copy(levels[i+1:], levels[i:])
+	levels[i] = r
+	return levels
+}
+
+/**
+ * 前N档深度的拷贝 , n<=0 返回全部
+ * AskList 价格升序 , BidList 价格降序
+ */
+func (ob *OrderBook) Depth(n int) *Depth {
+	ob.lock.RLock()
+	defer ob.lock.RUnlock()
+
+	na, nb := len(ob.asks), len(ob.bids)
+	if n > 0 && na > n {
+		na = n
+	}
+	if n > 0 && nb > n {
+		nb = n
+	}
+
+	dep := &Depth{Pair: ob.pair, UTime: ob.utime}
+	dep.AskList = make(DepthRecords, na)
+	dep.BidList = make(DepthRecords, nb)
+	copy(dep.AskList, ob.asks[:na])
+	copy(dep.BidList, ob.bids[:nb])
+	return dep
+}
+
+/**
+ * 推送中价格和数量的原文 , 按原文计算checksum的交易所使用 , 例如okex的"0.10"不能格式化成"0.1"
+ * 按价格记录 , 没有原文的价位按最短表示格式化
+ */
+type DepthTexts struct {
+	lock sync.Mutex
+	asks map[float64][2]string
+	bids map[float64][2]string
+}
+
+func NewDepthTexts() *DepthTexts {
+	return &DepthTexts{
+		asks: make(map[float64][2]string),
+		bids: make(map[float64][2]string)}
+}
+
+//全量时先清空
+func (t *DepthTexts) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.asks = make(map[float64][2]string)
+	t.bids = make(map[float64][2]string)
+}
+
+//数量为0表示删除该价位
+func (t *DepthTexts) SetAsk(price, amount string) {
+	t.set(t.asks, price, amount)
+}
+
+func (t *DepthTexts) SetBid(price, amount string) {
+	t.set(t.bids, price, amount)
+}
+
+func (t *DepthTexts) set(levels map[float64][2]string, price, amount string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	p, _ := strconv.ParseFloat(price, 64)
+	if a, _ := strconv.ParseFloat(amount, 64); a == 0 {
+		delete(levels, p)
+		return
+	}
+	levels[p] = [2]string{price, amount}
+}
+
+func (t *DepthTexts) text(isAsk bool, r DepthRecord) (string, string) {
+	if t != nil {
+		t.lock.Lock()
+		levels := t.bids
+		if isAsk {
+			levels = t.asks
+		}
+		text, isok := levels[r.Price]
+		t.lock.Unlock()
+		if isok {
+			return text[0], text[1]
+		}
+	}
+	return formatChecksumFloat(r.Price), formatChecksumFloat(r.Amount)
+}
+
+/**
+ * okex v3 checksum: 前25档按 bid:ask 交替拼接 "price:size" , crc32
+ * 价格和数量必须是推送的原文 , texts由调用方在每次全量/增量时维护
+ */
+func OKExDepthChecksum(texts *DepthTexts) OrderBookChecksumFunc {
+	return func(asks, bids DepthRecords) int32 {
+		var parts []string
+		for i := 0; i < 25; i++ {
+			if i < len(bids) {
+				price, amount := texts.text(false, bids[i])
+				parts = append(parts, price, amount)
+			}
+			if i < len(asks) {
+				price, amount := texts.text(true, asks[i])
+				parts = append(parts, price, amount)
+			}
+		}
+		return int32(crc32.ChecksumIEEE([]byte(strings.Join(parts, ":"))))
+	}
+}
+
+/**
+ * bitfinex v2 checksum: 前25档按 bid:ask 交替拼接 "price:amount" , ask的amount为负数 , crc32
+ * bitfinex按javascript的数字格式输出 , 很小的数量是 1e-7 这样的指数形式
+ */
+func BitfinexDepthChecksum(asks, bids DepthRecords) int32 {
+	var parts []string
+	for i := 0; i < 25; i++ {
+		if i < len(bids) {
+			parts = append(parts, FormatJsNumber(bids[i].Price), FormatJsNumber(bids[i].Amount))
+		}
+		if i < len(asks) {
+			parts = append(parts, FormatJsNumber(asks[i].Price), FormatJsNumber(-asks[i].Amount))
+		}
+	}
+	return int32(crc32.ChecksumIEEE([]byte(strings.Join(parts, ":"))))
+}
+
+/**
+ * javascript Number.prototype.toString : 最短表示 ,
+ * 绝对值小于1e-6或不小于1e21时用指数形式 , 指数没有前导0 , 例如 1e-7 , 1.5e+21
+ */
+func FormatJsNumber(v float64) string {
+	if v == 0 {
+		return "0"
+	}
+	if abs := math.Abs(v); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	s := strconv.FormatFloat(v, 'e', -1, 64)
+	i := strings.IndexByte(s, 'e')
+	return s[:i+2] + strings.TrimLeft(s[i+2:], "0")
+}
+
+func formatChecksumFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
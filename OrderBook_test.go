@@ -0,0 +1,172 @@
+package goex
+
+import (
+	"hash/crc32"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderBook_Update(t *testing.T) {
+	ob := NewOrderBook(BTC_USDT)
+	ob.Snapshot(&Depth{
+		AskList: DepthRecords{{102, 1}, {101, 2}},
+		BidList: DepthRecords{{99, 1}, {100, 2}}}, 10)
+
+	err := ob.Update(&DepthUpdate{FirstSeq: 9, Seq: 11,
+		AskList: DepthRecords{{101, 0}, {103, 1}},
+		BidList: DepthRecords{{100.5, 3}}})
+	assert.Nil(t, err)
+
+	dep := ob.Depth(2)
+	assert.Equal(t, DepthRecords{{102, 1}, {103, 1}}, dep.AskList)
+	assert.Equal(t, DepthRecords{{100.5, 3}, {100, 2}}, dep.BidList)
+	assert.Equal(t, int64(11), ob.Seq())
+
+	//outdated
+	assert.Nil(t, ob.Update(&DepthUpdate{Seq: 11, BidList: DepthRecords{{100.5, 0}}}))
+	assert.Equal(t, 3, len(ob.Depth(0).BidList))
+
+	//gap without snapshot func
+	assert.Equal(t, ErrOrderBookGap, ob.Update(&DepthUpdate{FirstSeq: 13, Seq: 14}))
+	assert.False(t, ob.IsSynced())
+	assert.Equal(t, ErrOrderBookNotSync, ob.Update(&DepthUpdate{Seq: 15}))
+}
+
+func TestOrderBook_Resync(t *testing.T) {
+	calls := 0
+	release := make(chan struct{})
+	ob := NewOrderBook(BTC_USDT).SetSnapshotFunc(func() (*Depth, int64, error) {
+		calls++
+		<-release
+		return &Depth{AskList: DepthRecords{{101, 1}}, BidList: DepthRecords{{99, 1}}}, 20, nil
+	})
+	ob.Snapshot(&Depth{}, 1)
+
+	//断档后不阻塞 , 出错的增量不缓存 , 全量返回前的增量缓存起来
+	assert.Equal(t, ErrOrderBookGap, ob.Update(&DepthUpdate{PrevSeq: 5, Seq: 21, AskList: DepthRecords{{101, 9}}}))
+	assert.Equal(t, ErrOrderBookNotSync, ob.Update(&DepthUpdate{PrevSeq: 19, Seq: 20, AskList: DepthRecords{{101, 7}}}))
+	assert.Equal(t, ErrOrderBookNotSync, ob.Update(&DepthUpdate{PrevSeq: 20, Seq: 21, AskList: DepthRecords{{101, 5}}}))
+	assert.Equal(t, ErrOrderBookNotSync, ob.Update(&DepthUpdate{PrevSeq: 21, Seq: 22, BidList: DepthRecords{{99, 2}}}))
+	assert.False(t, ob.IsSynced())
+	assert.Equal(t, 0, len(ob.Depth(0).AskList))
+
+	close(release)
+	for i := 0; i < 100 && !ob.IsSynced(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, ob.IsSynced())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, DepthRecords{{101, 5}}, ob.Depth(1).AskList)
+	assert.Equal(t, DepthRecords{{99, 2}}, ob.Depth(1).BidList)
+	assert.Equal(t, int64(22), ob.Seq())
+}
+
+func TestOrderBook_ResyncWithoutSeq(t *testing.T) {
+	release := make(chan struct{})
+	ob := NewOrderBook(BTC_USDT).SetSnapshotFunc(func() (*Depth, int64, error) {
+		<-release
+		return &Depth{AskList: DepthRecords{{101, 1}}}, 0, nil
+	})
+	ob.SetChecksumFunc(func(asks, bids DepthRecords) int32 { return int32(len(asks)) })
+	ob.Snapshot(&Depth{AskList: DepthRecords{{102, 1}}}, 0)
+
+	//校验失败的增量不生效
+	err := ob.Update(&DepthUpdate{AskList: DepthRecords{{103, 1}}, Checksum: 1, HasChecksum: true})
+	assert.NotNil(t, err)
+	assert.Equal(t, DepthRecords{{102, 1}}, ob.Depth(0).AskList)
+
+	//全量没有序号 , 缓存的增量丢弃
+	assert.Equal(t, ErrOrderBookNotSync, ob.Update(&DepthUpdate{AskList: DepthRecords{{104, 1}}}))
+	close(release)
+	for i := 0; i < 100 && !ob.IsSynced(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, ob.IsSynced())
+	assert.Equal(t, DepthRecords{{101, 1}}, ob.Depth(0).AskList)
+
+	assert.Nil(t, ob.Update(&DepthUpdate{AskList: DepthRecords{{104, 1}}, Checksum: 2, HasChecksum: true}))
+	assert.Equal(t, DepthRecords{{101, 1}, {104, 1}}, ob.Depth(0).AskList)
+}
+
+func TestOrderBook_ResyncCancelBackground(t *testing.T) {
+	var (
+		calls   int32
+		entered = make(chan struct{})
+		release = make(chan struct{})
+	)
+	ob := NewOrderBook(BTC_USDT).SetSnapshotFunc(func() (*Depth, int64, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(entered)
+			<-release
+			return &Depth{AskList: DepthRecords{{101, 1}}}, 10, nil
+		}
+		return &Depth{AskList: DepthRecords{{102, 1}}}, 30, nil
+	})
+	ob.Snapshot(&Depth{}, 1)
+
+	assert.Equal(t, ErrOrderBookGap, ob.Update(&DepthUpdate{PrevSeq: 5, Seq: 6}))
+	assert.Equal(t, ErrOrderBookNotSync, ob.Update(&DepthUpdate{PrevSeq: 10, Seq: 11}))
+	<-entered
+
+	assert.Nil(t, ob.Resync())
+	assert.Equal(t, int64(30), ob.Seq())
+
+	//后台同步的结果作废
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, ob.IsSynced())
+	assert.Equal(t, DepthRecords{{102, 1}}, ob.Depth(0).AskList)
+	assert.Equal(t, int64(30), ob.Seq())
+}
+
+func TestOKExDepthChecksum(t *testing.T) {
+	//okex文档的例子
+	assert.Equal(t, int32(-1881014294), int32(crc32.ChecksumIEEE([]byte("3366.1:7:3366.8:9:3366:6:3368:8"))))
+	asks := DepthRecords{{3366.8, 9}, {3368, 8}}
+	bids := DepthRecords{{3366.1, 7}, {3366, 6}}
+	assert.Equal(t, int32(-1881014294), OKExDepthChecksum(nil)(asks, bids))
+
+	//按原文计算 , "3366.10:7.0:3366.8:9:3366:6:3368:8.00"
+	texts := NewDepthTexts()
+	texts.SetBid("3366.10", "7.0")
+	texts.SetBid("3366", "6")
+	texts.SetAsk("3366.8", "9")
+	texts.SetAsk("3368", "8.00")
+	assert.Equal(t, int32(1649692046), OKExDepthChecksum(texts)(asks, bids))
+
+	ob := NewOrderBook(BTC_USDT).SetChecksumFunc(OKExDepthChecksum(texts))
+	ob.Snapshot(&Depth{AskList: asks, BidList: bids}, 0)
+	err := ob.Update(&DepthUpdate{BidList: DepthRecords{{3365, 1}}, Checksum: 1649692046, HasChecksum: true})
+	assert.NotNil(t, err)
+	assert.False(t, ob.IsSynced())
+}
+
+func TestBitfinexDepthChecksum(t *testing.T) {
+	//"100:1e-7:101:-2.5"
+	assert.Equal(t, int32(-931931001), int32(crc32.ChecksumIEEE([]byte("100:1e-7:101:-2.5"))))
+	assert.Equal(t, int32(-931931001), BitfinexDepthChecksum(DepthRecords{{101, 2.5}}, DepthRecords{{100, 1e-7}}))
+
+	assert.Equal(t, "1e-7", FormatJsNumber(1e-7))
+	assert.Equal(t, "-1.5e-7", FormatJsNumber(-1.5e-7))
+	assert.Equal(t, "0.000001", FormatJsNumber(1e-6))
+	assert.Equal(t, "1e+21", FormatJsNumber(1e21))
+	assert.Equal(t, "123.45", FormatJsNumber(123.45))
+}
+
+func TestOrderBook_SetMaxLevels(t *testing.T) {
+	ob := NewOrderBook(BTC_USDT).SetMaxLevels(2)
+	ob.Snapshot(&Depth{
+		AskList: DepthRecords{{101, 1}, {102, 1}, {103, 1}},
+		BidList: DepthRecords{{99, 1}, {98, 1}}}, 0)
+	assert.Equal(t, DepthRecords{{101, 1}, {102, 1}}, ob.Depth(0).AskList)
+
+	assert.Nil(t, ob.Update(&DepthUpdate{BidList: DepthRecords{{99.5, 2}}}))
+	assert.Equal(t, DepthRecords{{99.5, 2}, {99, 1}}, ob.Depth(0).BidList)
+
+	//删除后由交易所补推下一档
+	assert.Nil(t, ob.Update(&DepthUpdate{AskList: DepthRecords{{101, 0}, {103, 3}}}))
+	assert.Equal(t, DepthRecords{{102, 1}, {103, 3}}, ob.Depth(0).AskList)
+}
@@ -0,0 +1,301 @@
+package goex
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type OrderEventType int
+
+const (
+	ORDER_EVENT_FILL   = 1 + iota //有新的成交
+	ORDER_EVENT_FINISH            //完全成交
+	ORDER_EVENT_CANCEL            //已撤销
+	ORDER_EVENT_REJECT            //被拒绝
+	ORDER_EVENT_STATUS            //其他状态变化, 如撤单中
+	ORDER_EVENT_VANISH            //交易所查不到该订单
+)
+
+func (t OrderEventType) String() string {
+	switch t {
+	case ORDER_EVENT_FILL:
+		return "FILL"
+	case ORDER_EVENT_FINISH:
+		return "FINISH"
+	case ORDER_EVENT_CANCEL:
+		return "CANCEL"
+	case ORDER_EVENT_REJECT:
+		return "REJECT"
+	case ORDER_EVENT_STATUS:
+		return "STATUS"
+	case ORDER_EVENT_VANISH:
+		return "VANISH"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type OrderEvent struct {
+	Type        OrderEventType
+	Order       Order
+	PrevStatus  TradeStatus
+	FilledDelta float64 //本次新增的成交数量
+	Time        time.Time
+}
+
+type trackedOrder struct {
+	order    Order
+	interval time.Duration
+	nextPoll time.Time
+	notFound int
+}
+
+/**
+ * 订单状态跟踪 , 轮询GetOneOrder(或由私有websocket调用Update推送) , 检测状态变化并回调
+ * 状态有变化时轮询间隔恢复到最小值 , 否则逐步加倍到最大值
+ */
+type OrderTracker struct {
+	lock        sync.Mutex
+	api         API
+	handle      func(*OrderEvent)
+	orders      map[string]*trackedOrder
+	minInterval time.Duration
+	maxInterval time.Duration
+	maxNotFound int
+	close       chan struct{}
+}
+
+const defaultPollInterval = time.Second
+
+func NewOrderTracker(api API, handle func(event *OrderEvent)) *OrderTracker {
+	return &OrderTracker{
+		api:         api,
+		handle:      handle,
+		orders:      make(map[string]*trackedOrder),
+		minInterval: defaultPollInterval,
+		maxInterval: 30 * time.Second,
+		maxNotFound: 3}
+}
+
+//min不大于0时按默认的1秒 , max小于min时按min , 运行中修改在下一次轮询后生效
+func (t *OrderTracker) PollInterval(min, max time.Duration) *OrderTracker {
+	if min <= 0 {
+		min = defaultPollInterval
+	}
+	if max < min {
+		max = min
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.minInterval = min
+	t.maxInterval = max
+	return t
+}
+
+//连续查不到多少次认为订单已消失
+func (t *OrderTracker) MaxNotFound(n int) *OrderTracker {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.maxNotFound = n
+	return t
+}
+
+//跟踪订单 , ord至少需要OrderID2和Currency
+func (t *OrderTracker) Track(ord Order) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.orders[ord.OrderID2] = &trackedOrder{order: ord, interval: t.minInterval, nextPoll: time.Now()}
+}
+
+func (t *OrderTracker) Untrack(orderId string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.orders, orderId)
+}
+
+//正在跟踪的订单
+func (t *OrderTracker) Orders() []Order {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	ret := make([]Order, 0, len(t.orders))
+	for _, o := range t.orders {
+		ret = append(ret, o.order)
+	}
+	return ret
+}
+
+/**
+ * 推送订单的最新状态 , 用于私有websocket
+ */
+func (t *OrderTracker) Update(ord Order) {
+	t.lock.Lock()
+	tracked, ok := t.orders[ord.OrderID2]
+	if !ok {
+		t.lock.Unlock()
+		return
+	}
+	events := t.transition(tracked, ord)
+	t.lock.Unlock()
+
+	t.emit(events)
+}
+
+//重复调用只启动一次
+func (t *OrderTracker) Start() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.close != nil {
+		return
+	}
+
+	t.close = make(chan struct{})
+	go func(close chan struct{}) {
+		timer := time.NewTimer(t.pollInterval())
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				t.Poll()
+				timer.Reset(t.pollInterval())
+			case <-close:
+				return
+			}
+		}
+	}(t.close)
+}
+
+func (t *OrderTracker) pollInterval() time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.minInterval
+}
+
+func (t *OrderTracker) Stop() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.close != nil {
+		close(t.close)
+		t.close = nil
+	}
+}
+
+//查询所有到期的订单
+func (t *OrderTracker) Poll() {
+	now := time.Now()
+	t.lock.Lock()
+	var due []Order
+	for _, o := range t.orders {
+		if !o.nextPoll.After(now) {
+			due = append(due, o.order)
+		}
+	}
+	t.lock.Unlock()
+
+	for _, ord := range due {
+		newOrd, err := t.api.GetOneOrder(ord.OrderID2, ord.Currency)
+
+		t.lock.Lock()
+		tracked, ok := t.orders[ord.OrderID2]
+		if !ok {
+			t.lock.Unlock()
+			continue
+		}
+
+		var events []*OrderEvent
+		if err != nil || newOrd == nil {
+			events = t.notFound(tracked, err)
+		} else {
+			tracked.notFound = 0
+			if newOrd.OrderID2 == "" {
+				newOrd.OrderID2 = ord.OrderID2
+			}
+			events = t.transition(tracked, *newOrd)
+		}
+		t.lock.Unlock()
+
+		t.emit(events)
+	}
+}
+
+func (t *OrderTracker) notFound(tracked *trackedOrder, err error) []*OrderEvent {
+	apiErr, isApiErr := err.(ApiError)
+	if err != nil && (!isApiErr || apiErr.ErrCode != EX_ERR_NOT_FIND_ORDER.ErrCode) {
+		log.Printf("[%s] get order %s error: %s", t.api.GetExchangeName(), tracked.order.OrderID2, err)
+		t.backoff(tracked, false)
+		return nil
+	}
+
+	tracked.notFound++
+	if tracked.notFound < t.maxNotFound {
+		t.backoff(tracked, false)
+		return nil
+	}
+
+	delete(t.orders, tracked.order.OrderID2)
+	return []*OrderEvent{{Type: ORDER_EVENT_VANISH, Order: tracked.order, PrevStatus: tracked.order.Status, Time: time.Now()}}
+}
+
+func (t *OrderTracker) backoff(tracked *trackedOrder, changed bool) {
+	if changed {
+		tracked.interval = t.minInterval
+	} else {
+		tracked.interval *= 2
+		if tracked.interval > t.maxInterval {
+			tracked.interval = t.maxInterval
+		}
+	}
+	tracked.nextPoll = time.Now().Add(tracked.interval)
+}
+
+func (t *OrderTracker) transition(tracked *trackedOrder, ord Order) []*OrderEvent {
+	prev := tracked.order
+	now := time.Now()
+	if ord.Currency == (CurrencyPair{}) {
+		ord.Currency = prev.Currency
+	}
+	if ord.Side == 0 {
+		ord.Side = prev.Side
+	}
+
+	var events []*OrderEvent
+	if delta := ord.DealAmount - prev.DealAmount; delta > 0 {
+		events = append(events, &OrderEvent{Type: ORDER_EVENT_FILL, Order: ord, PrevStatus: prev.Status, FilledDelta: delta, Time: now})
+	}
+
+	if ord.Status != prev.Status {
+		switch ord.Status {
+		case ORDER_FINISH:
+			events = append(events, &OrderEvent{Type: ORDER_EVENT_FINISH, Order: ord, PrevStatus: prev.Status, Time: now})
+		case ORDER_CANCEL:
+			events = append(events, &OrderEvent{Type: ORDER_EVENT_CANCEL, Order: ord, PrevStatus: prev.Status, Time: now})
+		case ORDER_REJECT:
+			events = append(events, &OrderEvent{Type: ORDER_EVENT_REJECT, Order: ord, PrevStatus: prev.Status, Time: now})
+		case ORDER_PART_FINISH:
+			if len(events) == 0 {
+				events = append(events, &OrderEvent{Type: ORDER_EVENT_STATUS, Order: ord, PrevStatus: prev.Status, Time: now})
+			}
+		default:
+			events = append(events, &OrderEvent{Type: ORDER_EVENT_STATUS, Order: ord, PrevStatus: prev.Status, Time: now})
+		}
+	}
+
+	tracked.order = ord
+	t.backoff(tracked, len(events) > 0)
+
+	switch ord.Status {
+	case ORDER_FINISH, ORDER_CANCEL, ORDER_REJECT:
+		delete(t.orders, ord.OrderID2)
+	}
+
+	return events
+}
+
+func (t *OrderTracker) emit(events []*OrderEvent) {
+	if t.handle == nil {
+		return
+	}
+	for _, e := range events {
+		t.handle(e)
+	}
+}
@@ -0,0 +1,94 @@
+package goex
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockOrderAPI struct {
+	API
+	orders map[string]*Order
+	polls  int32
+}
+
+func (m *mockOrderAPI) calls() int32 {
+	return atomic.LoadInt32(&m.polls)
+}
+
+func (m *mockOrderAPI) GetExchangeName() string {
+	return BINANCE
+}
+
+func (m *mockOrderAPI) GetOneOrder(orderId string, currency CurrencyPair) (*Order, error) {
+	atomic.AddInt32(&m.polls, 1)
+	ord, ok := m.orders[orderId]
+	if !ok {
+		return nil, EX_ERR_NOT_FIND_ORDER
+	}
+	ret := *ord
+	return &ret, nil
+}
+
+func TestOrderTracker_Poll(t *testing.T) {
+	api := &mockOrderAPI{orders: map[string]*Order{
+		"1": {OrderID2: "1", Amount: 2, Status: ORDER_UNFINISH},
+		"2": {OrderID2: "2", Amount: 1, Status: ORDER_UNFINISH},
+	}}
+
+	var events []OrderEvent
+	tracker := NewOrderTracker(api, func(e *OrderEvent) {
+		events = append(events, *e)
+	}).PollInterval(time.Nanosecond, time.Nanosecond).MaxNotFound(2)
+	tracker.Track(Order{OrderID2: "1", Currency: BTC_USDT, Status: ORDER_UNFINISH})
+	tracker.Track(Order{OrderID2: "2", Currency: BTC_USDT, Status: ORDER_UNFINISH})
+	tracker.Track(Order{OrderID2: "3", Currency: BTC_USDT, Status: ORDER_UNFINISH})
+
+	tracker.Poll()
+	assert.Equal(t, 0, len(events))
+
+	api.orders["1"].DealAmount = 0.5
+	api.orders["1"].Status = ORDER_PART_FINISH
+	api.orders["2"].Status = ORDER_CANCEL
+	tracker.Poll()
+	assert.Equal(t, 3, len(events)) //fill , cancel , vanish
+
+	tracker.Update(Order{OrderID2: "1", Amount: 2, DealAmount: 2, Status: ORDER_FINISH})
+	assert.Equal(t, 5, len(events))
+
+	byType := make(map[OrderEventType]OrderEvent)
+	for _, e := range events {
+		byType[e.Type] = e
+	}
+	assert.Equal(t, 1.5, events[3].FilledDelta)
+	assert.Equal(t, ORDER_EVENT_FINISH, int(events[4].Type))
+	assert.Equal(t, "2", byType[ORDER_EVENT_CANCEL].Order.OrderID2)
+	assert.Equal(t, "3", byType[ORDER_EVENT_VANISH].Order.OrderID2)
+	assert.Equal(t, BTC_USDT, byType[ORDER_EVENT_FINISH].Order.Currency)
+	assert.Equal(t, 0, len(tracker.Orders()))
+}
+
+func TestOrderTracker_StartStop(t *testing.T) {
+	tracker := NewOrderTracker(&mockOrderAPI{}, nil)
+	tracker.PollInterval(0, 0)
+	assert.Equal(t, time.Second, tracker.pollInterval())
+	assert.Equal(t, time.Second, tracker.maxInterval)
+
+	tracker.Start()
+	ch := tracker.close
+	tracker.Start()
+	assert.True(t, ch == tracker.close)
+
+	//运行中修改轮询间隔
+	api := tracker.api.(*mockOrderAPI)
+	tracker.Track(Order{OrderID2: "1", Currency: BTC_USDT})
+	tracker.PollInterval(time.Millisecond, time.Millisecond)
+	time.Sleep(1500 * time.Millisecond)
+	assert.True(t, api.calls() > 1)
+
+	tracker.Stop()
+	tracker.Stop()
+	assert.Nil(t, tracker.close)
+}
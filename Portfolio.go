@@ -0,0 +1,240 @@
+package goex
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+//合约账户在快照中的名字后缀 , okex现货和合约的交易所名字相同
+const FUTURE_VENUE_SUFFIX = ":future"
+
+type PortfolioBalance struct {
+	Currency  Currency
+	Available float64
+	Frozen    float64
+	Borrowed  float64
+}
+
+func (b PortfolioBalance) Total() float64 {
+	return b.Available + b.Frozen
+}
+
+func (b PortfolioBalance) Net() float64 {
+	return b.Available + b.Frozen - b.Borrowed
+}
+
+func (b *PortfolioBalance) add(o PortfolioBalance) {
+	b.Available += o.Available
+	b.Frozen += o.Frozen
+	b.Borrowed += o.Borrowed
+}
+
+//某一时刻所有交易所的资产
+type PortfolioSnapshot struct {
+	Time     time.Time
+	Balances map[Currency]PortfolioBalance            //按币种合并
+	Venues   map[string]map[Currency]PortfolioBalance //按交易所
+	Errors   map[string]error                         //获取失败的交易所
+}
+
+//两次快照之间的资产变化
+type BalanceChange struct {
+	Exchange string
+	Currency Currency
+	Before,
+	After PortfolioBalance
+	Delta         float64 //Net的变化 , 借币不影响
+	BorrowedDelta float64 //借币的变化
+}
+
+/**
+ * 多交易所资产汇总
+ */
+type Portfolio struct {
+	apis    []API
+	futures []FutureRestAPI
+}
+
+func NewPortfolio() *Portfolio {
+	return &Portfolio{}
+}
+
+func (p *Portfolio) AddAPI(apis ...API) *Portfolio {
+	p.apis = append(p.apis, apis...)
+	return p
+}
+
+func (p *Portfolio) AddFutureAPI(apis ...FutureRestAPI) *Portfolio {
+	p.futures = append(p.futures, apis...)
+	return p
+}
+
+/**
+ * 并发获取所有交易所的资产
+ */
+func (p *Portfolio) Snapshot() *PortfolioSnapshot {
+	snap := &PortfolioSnapshot{
+		Time:     time.Now(),
+		Balances: make(map[Currency]PortfolioBalance),
+		Venues:   make(map[string]map[Currency]PortfolioBalance),
+		Errors:   make(map[string]error)}
+
+	var (
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+	save := func(venue string, balances map[Currency]PortfolioBalance, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if err != nil {
+			log.Printf("[%s] get account error: %s", venue, err)
+			snap.Errors[venue] = err
+			return
+		}
+		snap.Venues[venue] = balances
+	}
+
+	for _, api := range p.apis {
+		wg.Add(1)
+		go func(api API) {
+			defer wg.Done()
+			acc, err := api.GetAccount()
+			if err != nil {
+				save(api.GetExchangeName(), nil, err)
+				return
+			}
+			save(api.GetExchangeName(), accountBalances(acc), nil)
+		}(api)
+	}
+
+	for _, api := range p.futures {
+		wg.Add(1)
+		go func(api FutureRestAPI) {
+			defer wg.Done()
+			venue := api.GetExchangeName() + FUTURE_VENUE_SUFFIX
+			acc, err := api.GetFutureUserinfo()
+			if err != nil {
+				save(venue, nil, err)
+				return
+			}
+			save(venue, futureAccountBalances(acc), nil)
+		}(api)
+	}
+	wg.Wait()
+
+	for _, balances := range snap.Venues {
+		for c, b := range balances {
+			merged := snap.Balances[c]
+			merged.Currency = c
+			merged.add(b)
+			snap.Balances[c] = merged
+		}
+	}
+
+	return snap
+}
+
+func accountBalances(acc *Account) map[Currency]PortfolioBalance {
+	ret := make(map[Currency]PortfolioBalance, len(acc.SubAccounts))
+	for _, sub := range acc.SubAccounts {
+		if sub.Amount == 0 && sub.ForzenAmount == 0 && sub.LoanAmount == 0 {
+			continue
+		}
+		c := sub.Currency.AdaptBccToBch()
+		b := ret[c]
+		b.Currency = c
+		b.add(PortfolioBalance{Available: sub.Amount, Frozen: sub.ForzenAmount, Borrowed: sub.LoanAmount})
+		ret[c] = b
+	}
+	return ret
+}
+
+//账户权益 = 可用 + 保证金
+func futureAccountBalances(acc *FutureAccount) map[Currency]PortfolioBalance {
+	ret := make(map[Currency]PortfolioBalance, len(acc.FutureSubAccounts))
+	for c, sub := range acc.FutureSubAccounts {
+		if sub.AccountRights == 0 && sub.KeepDeposit == 0 {
+			continue
+		}
+		ret[c] = PortfolioBalance{
+			Currency:  c,
+			Available: sub.AccountRights - sub.KeepDeposit,
+			Frozen:    sub.KeepDeposit}
+	}
+	return ret
+}
+
+/**
+ * 与上一次快照比较 , 返回净资产(Net)或借币变化超过threshold的币种
+ * 借币同时增加可用和借币 , 净资产不变 , 只体现在BorrowedDelta
+ * 本次或上次获取失败的交易所不参与比较
+ */
+func (snap *PortfolioSnapshot) Diff(prev *PortfolioSnapshot, threshold float64) []BalanceChange {
+	var changes []BalanceChange
+	for venue, balances := range snap.Venues {
+		prevBalances, ok := prev.Venues[venue]
+		if !ok {
+			if _, failed := prev.Errors[venue]; failed {
+				continue
+			}
+		}
+
+		currencies := make(map[Currency]bool)
+		for c := range balances {
+			currencies[c] = true
+		}
+		for c := range prevBalances {
+			currencies[c] = true
+		}
+
+		for c := range currencies {
+			before, after := prevBalances[c], balances[c]
+			delta, borrowed := after.Net()-before.Net(), after.Borrowed-before.Borrowed
+			if math.Abs(delta) <= threshold && math.Abs(borrowed) <= threshold {
+				continue
+			}
+			before.Currency, after.Currency = c, c
+			changes = append(changes, BalanceChange{
+				Exchange: venue, Currency: c, Before: before, After: after, Delta: delta, BorrowedDelta: borrowed})
+		}
+	}
+
+	for venue, balances := range prev.Venues {
+		if _, ok := snap.Venues[venue]; ok {
+			continue
+		}
+		if _, failed := snap.Errors[venue]; failed {
+			continue
+		}
+		for c, before := range balances {
+			if math.Abs(before.Net()) > threshold || math.Abs(before.Borrowed) > threshold {
+				changes = append(changes, BalanceChange{
+					Exchange: venue, Currency: c, Before: before, After: PortfolioBalance{Currency: c},
+					Delta: -before.Net(), BorrowedDelta: -before.Borrowed})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Exchange == changes[j].Exchange {
+			return changes[i].Currency.Symbol < changes[j].Currency.Symbol
+		}
+		return changes[i].Exchange < changes[j].Exchange
+	})
+	return changes
+}
+
+/**
+ * 按ref计价的净资产 , 返回无法估值的币种
+ */
+func (snap *PortfolioSnapshot) Value(v *Valuation, ref Currency) (float64, []Currency) {
+	acc := &Account{SubAccounts: make(map[Currency]SubAccount, len(snap.Balances))}
+	for c, b := range snap.Balances {
+		acc.SubAccounts[c] = SubAccount{Currency: c, Amount: b.Available, ForzenAmount: b.Frozen, LoanAmount: b.Borrowed}
+	}
+	unpriced := v.ValueAccount(acc, ref)
+	return acc.NetAsset, unpriced
+}
@@ -0,0 +1,88 @@
+package goex
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAccountAPI struct {
+	API
+	name string
+	acc  *Account
+	err  error
+}
+
+func (m *mockAccountAPI) GetExchangeName() string {
+	return m.name
+}
+
+func (m *mockAccountAPI) GetAccount() (*Account, error) {
+	return m.acc, m.err
+}
+
+type mockFutureAPI struct {
+	FutureRestAPI
+	acc *FutureAccount
+}
+
+func (m *mockFutureAPI) GetExchangeName() string {
+	return OKEX_FUTURE
+}
+
+func (m *mockFutureAPI) GetFutureUserinfo() (*FutureAccount, error) {
+	return m.acc, nil
+}
+
+func TestPortfolio_Snapshot(t *testing.T) {
+	bn := &mockAccountAPI{name: BINANCE, acc: &Account{SubAccounts: map[Currency]SubAccount{
+		BTC: {Currency: BTC, Amount: 1, ForzenAmount: 0.5},
+		BCC: {Currency: BCC, Amount: 2}}}}
+	ok := &mockAccountAPI{name: OKEX, acc: &Account{SubAccounts: map[Currency]SubAccount{
+		BTC: {Currency: BTC, Amount: 2, LoanAmount: 1}}}}
+	hb := &mockAccountAPI{name: HUOBI_PRO, err: errors.New("timeout")}
+	future := &mockFutureAPI{acc: &FutureAccount{FutureSubAccounts: map[Currency]FutureSubAccount{
+		BTC: {Currency: BTC, AccountRights: 3, KeepDeposit: 1}}}}
+
+	p := NewPortfolio().AddAPI(bn, ok, hb).AddFutureAPI(future)
+	snap := p.Snapshot()
+
+	assert.Equal(t, PortfolioBalance{Currency: BTC, Available: 5, Frozen: 1.5, Borrowed: 1}, snap.Balances[BTC])
+	assert.Equal(t, 2.0, snap.Balances[BCH].Available)
+	assert.Equal(t, 2.0, snap.Venues[OKEX_FUTURE+FUTURE_VENUE_SUFFIX][BTC].Available)
+	assert.NotNil(t, snap.Errors[HUOBI_PRO])
+
+	bn.acc.SubAccounts[BTC] = SubAccount{Currency: BTC, Amount: 0.5}
+	hb.err = nil
+	hb.acc = &Account{SubAccounts: map[Currency]SubAccount{ETH: {Currency: ETH, Amount: 1}}}
+
+	changes := p.Snapshot().Diff(snap, 1e-8)
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, BINANCE, changes[0].Exchange)
+	assert.Equal(t, -1.0, changes[0].Delta)
+
+	//借币: 可用和借币同时增加 , 净资产不变
+	prev := p.Snapshot()
+	ok.acc.SubAccounts[BTC] = SubAccount{Currency: BTC, Amount: 3, LoanAmount: 2}
+	changes = p.Snapshot().Diff(prev, 1e-8)
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, OKEX, changes[0].Exchange)
+	assert.Equal(t, 0.0, changes[0].Delta)
+	assert.Equal(t, 1.0, changes[0].BorrowedDelta)
+
+	//只还利息 , 借币不变 , 净资产减少
+	prev = p.Snapshot()
+	ok.acc.SubAccounts[BTC] = SubAccount{Currency: BTC, Amount: 2.9, LoanAmount: 2}
+	changes = p.Snapshot().Diff(prev, 1e-8)
+	assert.Equal(t, 1, len(changes))
+	assert.InDelta(t, -0.1, changes[0].Delta, 1e-9)
+	assert.Equal(t, 0.0, changes[0].BorrowedDelta)
+
+	v := NewValuation()
+	v.SetPrice(BTC_USD, 4000)
+	v.SetPrice(BCH_USD, 100)
+	value, unpriced := snap.Value(v, USD)
+	assert.Equal(t, 0, len(unpriced))
+	assert.InDelta(t, 5.5*4000+200, value, 1e-9)
+}
@@ -0,0 +1,28 @@
+package goex
+
+import "errors"
+
+var ErrStreamNotSupport = errors.New("stream: channel not supported by exchange")
+
+/**
+ * websocket行情订阅 , 同一个交易对同一种频道重复订阅会替换之前的回调
+ * 交易所不支持的频道返回ErrStreamNotSupport
+ */
+type StreamingAPI interface {
+	SubscribeTicker(pair CurrencyPair, handle func(*Ticker)) error
+	UnsubscribeTicker(pair CurrencyPair) error
+
+	SubscribeDepth(pair CurrencyPair, handle func(*Depth)) error
+	UnsubscribeDepth(pair CurrencyPair) error
+
+	SubscribeTrade(pair CurrencyPair, handle func(*Trade)) error
+	UnsubscribeTrade(pair CurrencyPair) error
+
+	SubscribeKline(pair CurrencyPair, period int, handle func(*Kline)) error
+	UnsubscribeKline(pair CurrencyPair, period int) error
+
+	//交易所拒绝订阅或确认超时
+	OnSubscribeError(handle func(channel string, err error))
+
+	GetExchangeName() string
+}
@@ -0,0 +1,215 @@
+package goex
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+//法币汇率 , 如 USD -> CNY
+type FiatRateProvider interface {
+	GetFiatRate(from, to Currency) (float64, error)
+}
+
+//固定汇率
+type StaticFiatRates map[Currency]map[Currency]float64
+
+func (r StaticFiatRates) GetFiatRate(from, to Currency) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	if rate, ok := r[from][to]; ok {
+		return rate, nil
+	}
+	if rate, ok := r[to][from]; ok && rate > 0 {
+		return 1 / rate, nil
+	}
+	return 0, errors.New("fiat rate not found: " + from.Symbol + "/" + to.Symbol)
+}
+
+var ErrValuationNoPath = errors.New("valuation: no conversion path")
+
+/**
+ * 币种估值 , 用交易对行情构建兑换图 , 按最少兑换次数找价格
+ * 别名: XBT=BTC , BCC=BCH , USDT默认视为USD
+ */
+type Valuation struct {
+	lock      sync.RWMutex
+	rates     map[Currency]map[Currency]float64
+	fiat      FiatRateProvider
+	usdtAsUsd bool
+}
+
+func NewValuation() *Valuation {
+	return &Valuation{
+		rates:     make(map[Currency]map[Currency]float64),
+		usdtAsUsd: true}
+}
+
+func (v *Valuation) FiatRateProvider(p FiatRateProvider) *Valuation {
+	v.fiat = p
+	return v
+}
+
+//是否把USDT等同于USD , 默认true
+func (v *Valuation) UsdtAsUsd(b bool) *Valuation {
+	v.usdtAsUsd = b
+	return v
+}
+
+func (v *Valuation) canonical(c Currency) Currency {
+	switch c.Symbol {
+	case "XBT", "XXBT":
+		return BTC
+	case "BCC":
+		return BCH
+	case "USDT":
+		if v.usdtAsUsd {
+			return USD
+		}
+	case "ZUSD":
+		return USD
+	}
+	return NewCurrency(c.Symbol, "")
+}
+
+//设置 1 base = price quote
+func (v *Valuation) SetPrice(pair CurrencyPair, price float64) {
+	if price <= 0 {
+		return
+	}
+	a, b := v.canonical(pair.CurrencyA), v.canonical(pair.CurrencyB)
+	if a == b {
+		return
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.rates[a] == nil {
+		v.rates[a] = make(map[Currency]float64)
+	}
+	if v.rates[b] == nil {
+		v.rates[b] = make(map[Currency]float64)
+	}
+	v.rates[a][b] = price
+	v.rates[b][a] = 1 / price
+}
+
+//用行情的中间价 , 没有买卖价时用最新价
+func (v *Valuation) AddTicker(ticker *Ticker) {
+	price := ticker.Last
+	if ticker.Buy > 0 && ticker.Sell > 0 {
+		price = (ticker.Buy + ticker.Sell) / 2
+	}
+	v.SetPrice(ticker.Pair, price)
+}
+
+//拉取交易所行情 , 失败的交易对被忽略
+func (v *Valuation) AddTickers(api API, pairs ...CurrencyPair) error {
+	var lastErr error
+	for _, pair := range pairs {
+		ticker, err := api.GetTicker(pair)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ticker.Pair = pair
+		v.AddTicker(ticker)
+	}
+	return lastErr
+}
+
+/**
+ * 1个c值多少ref
+ */
+func (v *Valuation) Price(c, ref Currency) (float64, error) {
+	from, to := v.canonical(c), v.canonical(ref)
+	if from == to {
+		return 1, nil
+	}
+
+	v.lock.RLock()
+	price, ok := v.path(from, to)
+	v.lock.RUnlock()
+	if ok {
+		return price, nil
+	}
+
+	//先换成USD , 再按法币汇率换算
+	if v.fiat != nil && to != USD {
+		usd, ok := 1.0, true
+		if from != USD {
+			v.lock.RLock()
+			usd, ok = v.path(from, USD)
+			v.lock.RUnlock()
+		}
+		if ok {
+			rate, err := v.fiat.GetFiatRate(USD, to)
+			if err != nil {
+				return 0, err
+			}
+			return usd * rate, nil
+		}
+	}
+
+	return 0, ErrValuationNoPath
+}
+
+//广度优先 , 兑换次数最少的路径
+func (v *Valuation) path(from, to Currency) (float64, bool) {
+	visited := map[Currency]bool{from: true}
+	price := map[Currency]float64{from: 1}
+	queue := []Currency{from}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		var nexts []Currency
+		for next := range v.rates[cur] {
+			nexts = append(nexts, next)
+		}
+		sort.Slice(nexts, func(i, j int) bool { return nexts[i].Symbol < nexts[j].Symbol })
+
+		for _, next := range nexts {
+			if visited[next] {
+				continue
+			}
+			rate := v.rates[cur][next]
+			visited[next] = true
+			price[next] = price[cur] * rate
+			if next == to {
+				return price[next], true
+			}
+			queue = append(queue, next)
+		}
+	}
+	return 0, false
+}
+
+/**
+ * 计算账户总资产和净资产(以ref计价) , 并写入acc.Asset , acc.NetAsset
+ * @return 无法估值的币种
+ */
+func (v *Valuation) ValueAccount(acc *Account, ref Currency) []Currency {
+	var (
+		asset, net float64
+		unpriced   []Currency
+	)
+	for c, sub := range acc.SubAccounts {
+		total := sub.Amount + sub.ForzenAmount
+		if total == 0 && sub.LoanAmount == 0 {
+			continue
+		}
+		price, err := v.Price(c, ref)
+		if err != nil {
+			unpriced = append(unpriced, c)
+			continue
+		}
+		asset += total * price
+		net += (total - sub.LoanAmount) * price
+	}
+
+	acc.Asset = asset
+	acc.NetAsset = net
+	return unpriced
+}
@@ -0,0 +1,50 @@
+package goex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValuation_Price(t *testing.T) {
+	v := NewValuation().FiatRateProvider(StaticFiatRates{USD: {CNY: 7}})
+	v.AddTicker(&Ticker{Pair: BTC_USDT, Buy: 3999, Sell: 4001})
+	v.AddTicker(&Ticker{Pair: ETH_BTC, Last: 0.03})
+	v.AddTicker(&Ticker{Pair: BCC_BTC, Last: 0.05})
+	v.SetPrice(NewCurrencyPair(NewCurrency("XRP", ""), ETH), 0.002)
+
+	price, err := v.Price(XBT, USD)
+	assert.Nil(t, err)
+	assert.Equal(t, 4000.0, price)
+
+	price, _ = v.Price(BCH, USDT)
+	assert.InDelta(t, 200.0, price, 1e-9)
+
+	price, _ = v.Price(NewCurrency("xrp", ""), BTC)
+	assert.InDelta(t, 0.00006, price, 1e-12)
+
+	price, err = v.Price(ETH, CNY)
+	assert.Nil(t, err)
+	assert.InDelta(t, 840.0, price, 1e-9)
+
+	_, err = v.Price(EOS, USD)
+	assert.Equal(t, ErrValuationNoPath, err)
+}
+
+func TestValuation_ValueAccount(t *testing.T) {
+	v := NewValuation()
+	v.SetPrice(BTC_USD, 4000)
+	v.SetPrice(ETH_BTC, 0.03)
+
+	acc := &Account{SubAccounts: map[Currency]SubAccount{
+		BTC:  {Currency: BTC, Amount: 1, ForzenAmount: 0.5, LoanAmount: 0.5},
+		ETH:  {Currency: ETH, Amount: 10},
+		USDT: {Currency: USDT, Amount: 100},
+		EOS:  {Currency: EOS, Amount: 1},
+	}}
+
+	unpriced := v.ValueAccount(acc, USD)
+	assert.Equal(t, []Currency{EOS}, unpriced)
+	assert.InDelta(t, 6000+1200+100, acc.Asset, 1e-9)
+	assert.InDelta(t, 4000+1200+100, acc.NetAsset, 1e-9)
+}
@@ -0,0 +1,244 @@
+package arbitrage
+
+import (
+	. "github.com/bxsmart/GoEx"
+	"sort"
+	"sync"
+	"time"
+)
+
+//跨交易所搬砖机会: 在BuyExchange买入 , 在SellExchange卖出
+type Opportunity struct {
+	Pair         CurrencyPair
+	BuyExchange  string
+	SellExchange string
+	BuyPrice     float64 //买入均价
+	SellPrice    float64 //卖出均价
+	Amount       float64 //可成交数量(base)
+	Profit       float64 //扣除手续费后的利润(quote)
+	ProfitRate   float64 //利润/买入成本
+	DataAge      time.Duration
+}
+
+type venue struct {
+	name string
+	fee  float64 //taker费率
+}
+
+/**
+ * 跨交易所价差扫描
+ * 深度来源为每个交易对一个DepthAggregator , 既可以rest轮询 , 也可以把websocket推送接入Aggregator(pair)
+ */
+type Scanner struct {
+	lock          sync.RWMutex
+	venues        map[string]*venue
+	aggs          map[CurrencyPair]*DepthAggregator
+	pairs         []CurrencyPair
+	minProfitRate float64
+	maxAmount     float64
+	close         chan struct{}
+}
+
+func NewScanner(depthSize int, pairs ...CurrencyPair) *Scanner {
+	s := &Scanner{
+		venues: make(map[string]*venue),
+		aggs:   make(map[CurrencyPair]*DepthAggregator),
+		pairs:  pairs}
+	for _, pair := range pairs {
+		s.aggs[pair] = NewDepthAggregator(pair, depthSize)
+	}
+	return s
+}
+
+//添加rest轮询的交易所 , fee为taker费率 , 如0.001
+func (s *Scanner) AddAPI(api API, fee float64) *Scanner {
+	for _, agg := range s.aggs {
+		agg.AddAPI(api)
+	}
+	return s.SetFee(api.GetExchangeName(), fee)
+}
+
+//设置交易所费率 , websocket数据源也需要设置
+func (s *Scanner) SetFee(exName string, fee float64) *Scanner {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.venues[exName] = &venue{name: exName, fee: fee}
+	return s
+}
+
+//最低利润率 , 低于该值的机会不返回
+func (s *Scanner) MinProfitRate(rate float64) *Scanner {
+	s.minProfitRate = rate
+	return s
+}
+
+//单次机会的最大数量(base) , 0表示不限制
+func (s *Scanner) MaxAmount(amount float64) *Scanner {
+	s.maxAmount = amount
+	return s
+}
+
+//交易对对应的深度聚合 , 用于接入websocket推送或设置过期时间
+func (s *Scanner) Aggregator(pair CurrencyPair) *DepthAggregator {
+	return s.aggs[pair]
+}
+
+func (s *Scanner) Refresh() {
+	var wg sync.WaitGroup
+	for _, agg := range s.aggs {
+		wg.Add(1)
+		go func(agg *DepthAggregator) {
+			defer wg.Done()
+			agg.Refresh()
+		}(agg)
+	}
+	wg.Wait()
+}
+
+/**
+ * 用当前深度计算所有交易对的搬砖机会 , 按利润从高到低排序
+ */
+func (s *Scanner) Scan() []Opportunity {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	now := time.Now()
+	var ops []Opportunity
+	for _, pair := range s.pairs {
+		agg := s.aggs[pair]
+		bbo := agg.BBO()
+		for buyName := range bbo {
+			for sellName := range bbo {
+				if buyName == sellName || bbo[buyName].Stale || bbo[sellName].Stale {
+					continue
+				}
+				buyVenue, ok1 := s.venues[buyName]
+				sellVenue, ok2 := s.venues[sellName]
+				if !ok1 || !ok2 {
+					continue
+				}
+				if bbo[buyName].Ask.Price*(1+buyVenue.fee) >= bbo[sellName].Bid.Price*(1-sellVenue.fee) {
+					continue
+				}
+
+				buyDepth, buyTime := agg.VenueDepth(buyName)
+				sellDepth, sellTime := agg.VenueDepth(sellName)
+				op, ok := s.evaluate(buyDepth, sellDepth, buyVenue.fee, sellVenue.fee)
+				if !ok || op.ProfitRate < s.minProfitRate {
+					continue
+				}
+
+				op.Pair = pair
+				op.BuyExchange = buyName
+				op.SellExchange = sellName
+				op.DataAge = now.Sub(buyTime)
+				if age := now.Sub(sellTime); age > op.DataAge {
+					op.DataAge = age
+				}
+				ops = append(ops, op)
+			}
+		}
+	}
+
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].Profit > ops[j].Profit
+	})
+	return ops
+}
+
+/**
+ * 逐档吃buy的ask , 同时吃sell的bid , 直到扣除手续费后不再有利润
+ */
+func (s *Scanner) evaluate(buy, sell *Depth, buyFee, sellFee float64) (Opportunity, bool) {
+	asks := buy.AskList.SortAsc()
+	bids := sell.BidList.SortDesc()
+
+	var (
+		op       Opportunity
+		cost     float64
+		proceeds float64
+	)
+	i, j := 0, 0
+	askRemain, bidRemain := 0.0, 0.0
+	if len(asks) > 0 {
+		askRemain = asks[0].Amount
+	}
+	if len(bids) > 0 {
+		bidRemain = bids[0].Amount
+	}
+
+	for i < len(asks) && j < len(bids) {
+		askCost := asks[i].Price * (1 + buyFee)
+		bidGain := bids[j].Price * (1 - sellFee)
+		if askCost >= bidGain {
+			break
+		}
+
+		take := askRemain
+		if bidRemain < take {
+			take = bidRemain
+		}
+		if s.maxAmount > 0 && op.Amount+take > s.maxAmount {
+			take = s.maxAmount - op.Amount
+		}
+		if take <= 0 {
+			break
+		}
+
+		op.Amount += take
+		cost += take * asks[i].Price
+		proceeds += take * bids[j].Price
+		op.Profit += take * (bidGain - askCost)
+
+		askRemain -= take
+		bidRemain -= take
+		if askRemain <= 0 {
+			i++
+			if i < len(asks) {
+				askRemain = asks[i].Amount
+			}
+		}
+		if bidRemain <= 0 {
+			j++
+			if j < len(bids) {
+				bidRemain = bids[j].Amount
+			}
+		}
+	}
+
+	if op.Amount <= 0 {
+		return op, false
+	}
+
+	op.BuyPrice = cost / op.Amount
+	op.SellPrice = proceeds / op.Amount
+	op.ProfitRate = op.Profit / (cost * (1 + buyFee))
+	return op, true
+}
+
+//定时刷新并扫描 , 有机会时回调handle
+func (s *Scanner) Start(interval time.Duration, handle func([]Opportunity)) {
+	s.close = make(chan struct{})
+	go func(close chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.Refresh()
+			if ops := s.Scan(); len(ops) > 0 {
+				handle(ops)
+			}
+			select {
+			case <-ticker.C:
+			case <-close:
+				return
+			}
+		}
+	}(s.close)
+}
+
+func (s *Scanner) Stop() {
+	if s.close != nil {
+		close(s.close)
+		s.close = nil
+	}
+}
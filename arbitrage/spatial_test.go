@@ -0,0 +1,35 @@
+package arbitrage
+
+import (
+	. "github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestScanner_Scan(t *testing.T) {
+	s := NewScanner(20, BTC_USDT).SetFee(BINANCE, 0.001).SetFee(HUOBI_PRO, 0.002)
+	s.Aggregator(BTC_USDT).Update(BINANCE, &Depth{
+		AskList: DepthRecords{{100, 1}, {100.5, 2}, {103, 5}},
+		BidList: DepthRecords{{99.5, 1}}})
+	s.Aggregator(BTC_USDT).Update(HUOBI_PRO, &Depth{
+		AskList: DepthRecords{{103, 1}},
+		BidList: DepthRecords{{102, 1.5}, {101, 3}, {100, 10}}})
+
+	ops := s.Scan()
+	assert.Equal(t, 1, len(ops))
+
+	op := ops[0]
+	assert.Equal(t, BINANCE, op.BuyExchange)
+	assert.Equal(t, HUOBI_PRO, op.SellExchange)
+	//100@1 + 100.5@2 vs 102@1.5 + 101@1.5 , 100.5 vs 100 is not profitable
+	assert.InDelta(t, 3.0, op.Amount, 1e-9)
+	assert.InDelta(t, (100+100.5*2)/3, op.BuyPrice, 1e-9)
+	assert.InDelta(t, (102*1.5+101*1.5)/3, op.SellPrice, 1e-9)
+	assert.True(t, op.Profit > 0)
+
+	s.MaxAmount(0.5)
+	assert.InDelta(t, 0.5, s.Scan()[0].Amount, 1e-9)
+
+	s.MinProfitRate(0.1)
+	assert.Equal(t, 0, len(s.Scan()))
+}
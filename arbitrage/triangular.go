@@ -0,0 +1,211 @@
+package arbitrage
+
+import (
+	. "github.com/bxsmart/GoEx"
+	"log"
+	"sort"
+	"sync"
+)
+
+//交易对及其下单限制
+type Market struct {
+	Pair      CurrencyPair
+	MinAmount float64 //最小下单数量(base)
+	MinVolume float64 //最小下单金额(quote)
+}
+
+func MarketsFromPairs(pairs ...CurrencyPair) []Market {
+	markets := make([]Market, 0, len(pairs))
+	for _, pair := range pairs {
+		markets = append(markets, Market{Pair: pair})
+	}
+	return markets
+}
+
+//需要执行的一笔委托
+type Leg struct {
+	Pair   CurrencyPair
+	Side   TradeSide //BUY or SELL
+	Price  float64
+	Amount float64 //base数量
+}
+
+/**
+ * 三角套利环: Start -> ... -> Start
+ */
+type Cycle struct {
+	Start       Currency
+	Path        []Currency
+	Legs        []Leg
+	StartAmount float64
+	EndAmount   float64
+	ProfitRate  float64
+}
+
+//图中的一条边: 用From兑换To
+type edge struct {
+	market Market
+	from   Currency
+	to     Currency
+	side   TradeSide
+	price  float64
+	size   float64 //一档可成交数量(base)
+}
+
+//兑换比例 , 已扣除手续费
+func (e *edge) rate(fee float64) float64 {
+	if e.side == SELL {
+		return e.price * (1 - fee)
+	}
+	return 1 / e.price * (1 - fee)
+}
+
+//一档可兑换的From数量
+func (e *edge) capacity() float64 {
+	if e.side == SELL {
+		return e.size
+	}
+	return e.size * e.price
+}
+
+/**
+ * 单个交易所内的三角套利检测
+ */
+type Triangular struct {
+	api           API
+	fee           float64
+	markets       []Market
+	bases         []Currency
+	minProfitRate float64
+}
+
+func NewTriangular(api API, fee float64, markets []Market) *Triangular {
+	return &Triangular{
+		api:     api,
+		fee:     fee,
+		markets: markets,
+		bases:   []Currency{USDT, BTC, ETH}}
+}
+
+//起始(也是结束)币种
+func (t *Triangular) Bases(currencies ...Currency) *Triangular {
+	t.bases = currencies
+	return t
+}
+
+func (t *Triangular) MinProfitRate(rate float64) *Triangular {
+	t.minProfitRate = rate
+	return t
+}
+
+/**
+ * 拉取所有交易对的一档深度并检测
+ */
+func (t *Triangular) Detect() []Cycle {
+	var (
+		lock   sync.Mutex
+		wg     sync.WaitGroup
+		depths = make(map[CurrencyPair]*Depth, len(t.markets))
+	)
+	for _, m := range t.markets {
+		wg.Add(1)
+		go func(pair CurrencyPair) {
+			defer wg.Done()
+			dep, err := t.api.GetDepth(5, pair)
+			if err != nil {
+				log.Printf("[%s] get %s depth error: %s", t.api.GetExchangeName(), pair, err)
+				return
+			}
+			lock.Lock()
+			depths[pair] = dep
+			lock.Unlock()
+		}(m.Pair)
+	}
+	wg.Wait()
+
+	return t.FindCycles(depths)
+}
+
+/**
+ * 用给定的深度查找有利润的环 , 按利润率从高到低排序
+ */
+func (t *Triangular) FindCycles(depths map[CurrencyPair]*Depth) []Cycle {
+	graph := make(map[Currency][]*edge)
+	for _, m := range t.markets {
+		dep, ok := depths[m.Pair]
+		if !ok {
+			continue
+		}
+		if bid, ok := dep.BestBid(); ok && bid.Price > 0 {
+			graph[m.Pair.CurrencyA] = append(graph[m.Pair.CurrencyA], &edge{
+				market: m, from: m.Pair.CurrencyA, to: m.Pair.CurrencyB, side: SELL, price: bid.Price, size: bid.Amount})
+		}
+		if ask, ok := dep.BestAsk(); ok && ask.Price > 0 {
+			graph[m.Pair.CurrencyB] = append(graph[m.Pair.CurrencyB], &edge{
+				market: m, from: m.Pair.CurrencyB, to: m.Pair.CurrencyA, side: BUY, price: ask.Price, size: ask.Amount})
+		}
+	}
+
+	var cycles []Cycle
+	for _, start := range t.bases {
+		for _, e1 := range graph[start] {
+			for _, e2 := range graph[e1.to] {
+				if e2.to == start || e2.market.Pair == e1.market.Pair {
+					continue
+				}
+				for _, e3 := range graph[e2.to] {
+					if e3.to != start {
+						continue
+					}
+					c, ok := t.evaluate(start, []*edge{e1, e2, e3})
+					if ok && c.ProfitRate > t.minProfitRate {
+						cycles = append(cycles, c)
+					}
+				}
+			}
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i].ProfitRate > cycles[j].ProfitRate
+	})
+	return cycles
+}
+
+func (t *Triangular) evaluate(start Currency, edges []*edge) (Cycle, bool) {
+	//一档深度允许的最大起始数量
+	maxStart := -1.0
+	cum := 1.0
+	for _, e := range edges {
+		limit := e.capacity() / cum
+		if maxStart < 0 || limit < maxStart {
+			maxStart = limit
+		}
+		cum *= e.rate(t.fee)
+	}
+
+	if cum <= 1 || maxStart <= 0 {
+		return Cycle{}, false
+	}
+
+	c := Cycle{Start: start, Path: []Currency{start}, StartAmount: maxStart}
+	in := maxStart
+	for _, e := range edges {
+		leg := Leg{Pair: e.market.Pair, Side: e.side, Price: e.price}
+		if e.side == SELL {
+			leg.Amount = in
+		} else {
+			leg.Amount = in / e.price
+		}
+		if leg.Amount < e.market.MinAmount || leg.Amount*leg.Price < e.market.MinVolume {
+			return Cycle{}, false
+		}
+		c.Legs = append(c.Legs, leg)
+		c.Path = append(c.Path, e.to)
+		in *= e.rate(t.fee)
+	}
+
+	c.EndAmount = in
+	c.ProfitRate = cum - 1
+	return c, true
+}
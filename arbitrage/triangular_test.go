@@ -0,0 +1,36 @@
+package arbitrage
+
+import (
+	. "github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTriangular_FindCycles(t *testing.T) {
+	tri := NewTriangular(nil, 0.001, []Market{
+		{Pair: BTC_USDT, MinAmount: 0.001},
+		{Pair: ETH_USDT, MinAmount: 0.01},
+		{Pair: ETH_BTC, MinAmount: 0.01},
+	}).Bases(USDT)
+
+	depths := map[CurrencyPair]*Depth{
+		BTC_USDT: {AskList: DepthRecords{{4000, 1}}, BidList: DepthRecords{{3999, 1}}},
+		ETH_USDT: {AskList: DepthRecords{{130, 10}}, BidList: DepthRecords{{129.9, 10}}},
+		ETH_BTC:  {AskList: DepthRecords{{0.0330, 5}}, BidList: DepthRecords{{0.0329, 5}}},
+	}
+
+	cycles := tri.FindCycles(depths)
+	assert.Equal(t, 1, len(cycles))
+
+	//USDT -> ETH -> BTC -> USDT
+	c := cycles[0]
+	assert.Equal(t, []Currency{USDT, ETH, BTC, USDT}, c.Path)
+	assert.Equal(t, BUY, int(c.Legs[0].Side))
+	assert.Equal(t, SELL, int(c.Legs[1].Side))
+	assert.Equal(t, SELL, int(c.Legs[2].Side))
+	assert.True(t, c.EndAmount > c.StartAmount)
+	assert.InDelta(t, 5/0.999, c.Legs[0].Amount, 1e-9) //limited by ETH_BTC bid size , fee deducted
+
+	tri.MinProfitRate(0.1)
+	assert.Equal(t, 0, len(tri.FindCycles(depths)))
+}
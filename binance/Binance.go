@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -48,8 +49,16 @@ var _INERNAL_KLINE_PERIOD_CONVERTER = map[int]string{
 type Binance struct {
 	accessKey,
 	secretKey string
-	httpClient *http.Client
-	timeoffset int64 //nanosecond
+	httpClient   *http.Client
+	timeoffset   int64 //nanosecond
+	wsShards     *WsShards
+	wsMaxSubs    int
+	createWsLock sync.Mutex
+	wsHandlers   *WsHandlers
+	wsLock       sync.Mutex
+	wsSubIds     map[int64]string
+	wsNextId     int64
+	wsDiffDepths map[string]func(*DepthUpdate)
 }
 
 func (bn *Binance) buildParamsSigned(postForm *url.Values) error {
@@ -64,6 +73,9 @@ func (bn *Binance) buildParamsSigned(postForm *url.Values) error {
 
 func New(client *http.Client, api_key, secret_key string) *Binance {
 	bn := &Binance{accessKey: api_key, secretKey: secret_key, httpClient: client}
+	bn.wsHandlers = NewWsHandlers()
+	bn.wsSubIds = make(map[int64]string)
+	bn.wsDiffDepths = make(map[string]func(*DepthUpdate))
 	bn.setTimeOffset()
 	return bn
 }
@@ -115,17 +127,23 @@ func (bn *Binance) GetDepth(size int, currencyPair CurrencyPair) (*Depth, error)
 	} else if size < 5 {
 		size = 5
 	}
+	depth, _, err := bn.getDepth(size, currencyPair)
+	return depth, err
+}
+
+//返回深度和lastUpdateId , size最大1000
+func (bn *Binance) getDepth(size int, currencyPair CurrencyPair) (*Depth, int64, error) {
 	currencyPair2 := bn.adaptCurrencyPair(currencyPair)
 
 	apiUrl := fmt.Sprintf(API_V1+DEPTH_URI, currencyPair2.ToSymbol(""), size)
 	resp, err := HttpGet(bn.httpClient, apiUrl)
 	if err != nil {
 		log.Println("GetDepth error:", err)
-		return nil, err
+		return nil, 0, err
 	}
 
 	if _, isok := resp["code"]; isok {
-		return nil, errors.New(resp["msg"].(string))
+		return nil, 0, errors.New(resp["msg"].(string))
 	}
 
 	bids := resp["bids"].([]interface{})
@@ -152,7 +170,7 @@ func (bn *Binance) GetDepth(size int, currencyPair CurrencyPair) (*Depth, error)
 		depth.AskList = append(depth.AskList, dr)
 	}
 
-	return depth, nil
+	return depth, int64(ToUint64(resp["lastUpdateId"])), nil
 }
 
 func (bn *Binance) placeOrder(amount, price string, pair CurrencyPair, orderType, orderSide string) (*Order, error) {
@@ -321,20 +339,7 @@ func (bn *Binance) GetOneOrder(orderId string, currencyPair CurrencyPair) (*Orde
 		ord.Side = BUY
 	}
 
-	switch status {
-	case "NEW":
-		ord.Status = ORDER_UNFINISH
-	case "FILLED":
-		ord.Status = ORDER_FINISH
-	case "PARTIALLY_FILLED":
-		ord.Status = ORDER_PART_FINISH
-	case "CANCELED":
-		ord.Status = ORDER_CANCEL
-	case "PENDING_CANCEL":
-		ord.Status = ORDER_CANCEL_ING
-	case "REJECTED":
-		ord.Status = ORDER_REJECT
-	}
+	ord.Status = adaptOrderStatus(status)
 
 	ord.Amount = ToFloat64(respmap["origQty"].(string))
 	ord.Price = ToFloat64(respmap["price"].(string))
@@ -344,6 +349,24 @@ func (bn *Binance) GetOneOrder(orderId string, currencyPair CurrencyPair) (*Orde
 	return &ord, nil
 }
 
+func adaptOrderStatus(status string) TradeStatus {
+	switch status {
+	case "NEW":
+		return ORDER_UNFINISH
+	case "FILLED":
+		return ORDER_FINISH
+	case "PARTIALLY_FILLED":
+		return ORDER_PART_FINISH
+	case "CANCELED", "EXPIRED":
+		return ORDER_CANCEL
+	case "PENDING_CANCEL":
+		return ORDER_CANCEL_ING
+	case "REJECTED":
+		return ORDER_REJECT
+	}
+	return ORDER_UNFINISH
+}
+
 func (bn *Binance) GetUnfinishOrders(currencyPair CurrencyPair) ([]Order, error) {
 	params := url.Values{}
 	currencyPair = bn.adaptCurrencyPair(currencyPair)
@@ -0,0 +1,319 @@
+package binance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	USER_DATA_STREAM_URI = "userDataStream"
+	WS_USER_DATA_URL     = "wss://stream.binance.com:9443/ws/"
+
+	LISTEN_KEY_KEEPALIVE_INTERVAL = 30 * time.Minute //listenKey 60分钟不续期失效
+)
+
+//按报价币种后缀拆分交易对 , 较长的放前面
+var _QUOTE_CURRENCIES = []string{"USDT", "BUSD", "USDC", "TUSD", "PAX", "USDS", "BTC", "ETH", "BNB", "XRP", "TRX"}
+
+func (bn *Binance) userDataStreamRequest(method string, params url.Values) ([]byte, error) {
+	return NewHttpRequest(bn.httpClient, method, API_V3+USER_DATA_STREAM_URI+"?"+params.Encode(), "",
+		map[string]string{"X-MBX-APIKEY": bn.accessKey})
+}
+
+//创建listenKey , 已有有效的listenKey时返回同一个
+func (bn *Binance) CreateListenKey() (string, error) {
+	resp, err := bn.userDataStreamRequest("POST", url.Values{})
+	if err != nil {
+		return "", err
+	}
+
+	respmap := make(map[string]interface{})
+	err = json.Unmarshal(resp, &respmap)
+	if err != nil {
+		log.Println(string(resp))
+		return "", err
+	}
+
+	listenKey, _ := respmap["listenKey"].(string)
+	if listenKey == "" {
+		return "", errors.New(string(resp))
+	}
+	return listenKey, nil
+}
+
+//延长listenKey有效期60分钟
+func (bn *Binance) KeepaliveListenKey(listenKey string) error {
+	_, err := bn.userDataStreamRequest("PUT", url.Values{"listenKey": {listenKey}})
+	return err
+}
+
+func (bn *Binance) CloseListenKey(listenKey string) error {
+	_, err := bn.userDataStreamRequest("DELETE", url.Values{"listenKey": {listenKey}})
+	return err
+}
+
+/**
+ * 用户数据websocket , 推送订单变化(executionReport)和余额变化(outboundAccountInfo)
+ * 每30分钟续期listenKey , 续期失败或收到listenKeyExpired时换新的listenKey重新连接
+ * 断线期间的推送会丢失 , 需要可靠的订单状态时可以配合OrderTracker , 把handleOrder设为tracker.Update
+ */
+type UserDataStream struct {
+	bn                *Binance
+	lock              sync.Mutex
+	ctx               context.Context
+	cancel            context.CancelFunc
+	ws                *WsConn
+	listenKey         string
+	keepaliveInterval time.Duration
+	rekeyC            chan struct{}
+	handleOrder       func(*Order)
+	handleAccount     func(*Account)
+}
+
+func (bn *Binance) NewUserDataStream(handleOrder func(*Order), handleAccount func(*Account)) *UserDataStream {
+	return &UserDataStream{
+		bn:                bn,
+		keepaliveInterval: LISTEN_KEY_KEEPALIVE_INTERVAL,
+		rekeyC:            make(chan struct{}, 1),
+		handleOrder:       handleOrder,
+		handleAccount:     handleAccount}
+}
+
+func (s *UserDataStream) KeepaliveInterval(d time.Duration) *UserDataStream {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.keepaliveInterval = d
+	return s
+}
+
+func (s *UserDataStream) ListenKey() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.listenKey
+}
+
+//获取listenKey并连接 , 之后在后台续期 , 重复调用无效
+func (s *UserDataStream) Start() error {
+	s.lock.Lock()
+	if s.ctx != nil {
+		s.lock.Unlock()
+		return nil
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.lock.Unlock()
+
+	if err := s.connect(); err != nil {
+		s.lock.Lock()
+		s.cancel()
+		s.ctx = nil
+		s.lock.Unlock()
+		return err
+	}
+
+	go s.supervise()
+	return nil
+}
+
+//关闭连接并删除listenKey
+func (s *UserDataStream) Stop() {
+	s.lock.Lock()
+	if s.ctx == nil {
+		s.lock.Unlock()
+		return
+	}
+	s.cancel()
+	s.ctx = nil
+	ws, listenKey := s.ws, s.listenKey
+	s.ws, s.listenKey = nil, ""
+	s.lock.Unlock()
+
+	if ws != nil {
+		ws.CloseWs()
+	}
+	if listenKey != "" {
+		if err := s.bn.CloseListenKey(listenKey); err != nil {
+			log.Println("close listen key error:", err)
+		}
+	}
+}
+
+//用新的listenKey建立连接 , 成功后替换旧连接
+func (s *UserDataStream) connect() error {
+	s.lock.Lock()
+	ctx := s.ctx
+	s.lock.Unlock()
+	if ctx == nil {
+		return ErrWsClosed
+	}
+
+	listenKey, err := s.bn.CreateListenKey()
+	if err != nil {
+		return err
+	}
+
+	ws, err := NewWsConnWithContext(ctx, WS_USER_DATA_URL+listenKey)
+	if err != nil {
+		return err
+	}
+	//没有主动推送时用LIST_SUBSCRIPTIONS的回执保持活跃时间
+	ws.Heartbeat(func() interface{} {
+		return map[string]interface{}{
+			"method": "LIST_SUBSCRIPTIONS",
+			"id":     0}
+	}, 30*time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		ws.UpdateActivedTime()
+		s.handleMessage(msg)
+	})
+
+	s.lock.Lock()
+	old, oldKey := s.ws, s.listenKey
+	s.ws, s.listenKey = ws, listenKey
+	s.lock.Unlock()
+
+	if old != nil {
+		old.CloseWs()
+	}
+	if oldKey != "" && oldKey != listenKey {
+		s.bn.CloseListenKey(oldKey)
+	}
+	return nil
+}
+
+func (s *UserDataStream) supervise() {
+	s.lock.Lock()
+	ctx, interval := s.ctx, s.keepaliveInterval
+	s.lock.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.bn.KeepaliveListenKey(s.ListenKey()); err != nil {
+				log.Println("keepalive listen key error:", err)
+				s.rekey(ctx)
+			}
+		case <-s.rekeyC:
+			s.rekey(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//换新的listenKey重连 , 失败时间隔从1秒加倍到1分钟重试
+func (s *UserDataStream) rekey(ctx context.Context) {
+	delay := time.Second
+	for {
+		log.Println("user data stream re-key")
+		err := s.connect()
+		if err == nil {
+			return
+		}
+		log.Printf("user data stream re-key fail: %s , retry after %s", err, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		if delay *= 2; delay > time.Minute {
+			delay = time.Minute
+		}
+	}
+}
+
+func (s *UserDataStream) handleMessage(msg []byte) {
+	datamap := make(map[string]interface{})
+	err := json.Unmarshal(msg, &datamap)
+	if err != nil {
+		log.Println("json unmarshal error for ", string(msg))
+		return
+	}
+
+	switch datamap["e"] {
+	case "executionReport":
+		if s.handleOrder != nil {
+			s.handleOrder(s.bn.parseExecutionReport(datamap))
+		}
+	case "outboundAccountInfo", "outboundAccountPosition":
+		if s.handleAccount != nil {
+			s.handleAccount(s.bn.parseAccountUpdate(datamap))
+		}
+	case "listenKeyExpired":
+		log.Println("listen key expired")
+		select {
+		case s.rekeyC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+/**
+ * 订单更新 , Fee为本次成交的手续费 , AvgPrice按累计成交额/累计成交量计算
+ */
+func (bn *Binance) parseExecutionReport(datamap map[string]interface{}) *Order {
+	orderId := ToInt(datamap["i"])
+	ord := &Order{
+		Currency:   symbolToPair(fmt.Sprint(datamap["s"])),
+		OrderID:    orderId,
+		OrderID2:   fmt.Sprint(orderId),
+		Price:      ToFloat64(datamap["p"]),
+		Amount:     ToFloat64(datamap["q"]),
+		DealAmount: ToFloat64(datamap["z"]),
+		Fee:        ToFloat64(datamap["n"]),
+		Status:     adaptOrderStatus(fmt.Sprint(datamap["X"])),
+		OrderTime:  int(ToUint64(datamap["O"]) / 1000),
+		Side:       BUY}
+
+	if datamap["S"] == "SELL" {
+		ord.Side = SELL
+	}
+	if ord.DealAmount > 0 {
+		ord.AvgPrice = ToFloat64(datamap["Z"]) / ord.DealAmount
+	}
+	return ord
+}
+
+//outboundAccountInfo为全部余额 , outboundAccountPosition只有变化的币种
+func (bn *Binance) parseAccountUpdate(datamap map[string]interface{}) *Account {
+	acc := &Account{}
+	acc.Exchange = bn.GetExchangeName()
+	acc.SubAccounts = make(map[Currency]SubAccount)
+
+	balances, _ := datamap["B"].([]interface{})
+	for _, v := range balances {
+		vv, isok := v.(map[string]interface{})
+		if !isok {
+			continue
+		}
+		currency := NewCurrency(fmt.Sprint(vv["a"]), "").AdaptBccToBch()
+		acc.SubAccounts[currency] = SubAccount{
+			Currency:     currency,
+			Amount:       ToFloat64(vv["f"]),
+			ForzenAmount: ToFloat64(vv["l"])}
+	}
+	return acc
+}
+
+//BTCUSDT => BTC_USDT , 不认识的报价币种返回UNKNOWN_PAIR
+func symbolToPair(symbol string) CurrencyPair {
+	symbol = strings.ToUpper(symbol)
+	for _, quote := range _QUOTE_CURRENCIES {
+		if len(symbol) > len(quote) && strings.HasSuffix(symbol, quote) {
+			base := NewCurrency(strings.TrimSuffix(symbol, quote), "").AdaptBccToBch()
+			return NewCurrencyPair(base, NewCurrency(quote, ""))
+		}
+	}
+	return UNKNOWN_PAIR
+}
@@ -0,0 +1,48 @@
+package binance
+
+import (
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSymbolToPair(t *testing.T) {
+	assert.Equal(t, goex.BTC_USDT, symbolToPair("BTCUSDT"))
+	assert.Equal(t, goex.ETH_BTC, symbolToPair("ethbtc"))
+	assert.Equal(t, goex.BCH_BTC, symbolToPair("BCCBTC"))
+	assert.Equal(t, goex.UNKNOWN_PAIR, symbolToPair("USDT"))
+}
+
+func TestUserDataStream_handleMessage(t *testing.T) {
+	var orders []*goex.Order
+	var accounts []*goex.Account
+	stream := ba.NewUserDataStream(func(ord *goex.Order) {
+		orders = append(orders, ord)
+	}, func(acc *goex.Account) {
+		accounts = append(accounts, acc)
+	})
+
+	stream.handleMessage([]byte(`{"e":"executionReport","E":1499405658658,"s":"ETHBTC","c":"mUvoqJxFIILMdfAW5iGSOW","S":"SELL","o":"LIMIT","f":"GTC","q":"2.00000000","p":"0.10264410","x":"TRADE","X":"PARTIALLY_FILLED","i":4293153,"l":"0.50000000","z":"0.50000000","L":"0.10264410","n":"0.00005000","N":"BNB","T":1499405658657,"t":101,"O":1499405658000,"Z":"0.05132205"}`))
+	assert.Equal(t, 1, len(orders))
+	ord := orders[0]
+	assert.Equal(t, goex.ETH_BTC, ord.Currency)
+	assert.Equal(t, 4293153, ord.OrderID)
+	assert.Equal(t, "4293153", ord.OrderID2)
+	assert.Equal(t, goex.TradeSide(goex.SELL), ord.Side)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_PART_FINISH), ord.Status)
+	assert.Equal(t, 2.0, ord.Amount)
+	assert.Equal(t, 0.5, ord.DealAmount)
+	assert.InDelta(t, 0.1026441, ord.AvgPrice, 1e-9)
+	assert.Equal(t, 1499405658, ord.OrderTime)
+
+	stream.handleMessage([]byte(`{"e":"outboundAccountInfo","E":1499405658849,"B":[{"a":"BTC","f":"1.5","l":"0.5"},{"a":"BCC","f":"2","l":"0"}]}`))
+	assert.Equal(t, 1, len(accounts))
+	assert.Equal(t, goex.BINANCE, accounts[0].Exchange)
+	assert.Equal(t, 1.5, accounts[0].SubAccounts[goex.BTC].Amount)
+	assert.Equal(t, 0.5, accounts[0].SubAccounts[goex.BTC].ForzenAmount)
+	assert.Equal(t, 2.0, accounts[0].SubAccounts[goex.BCH].Amount)
+
+	stream.handleMessage([]byte(`{"e":"listenKeyExpired","E":1576653824250}`))
+	stream.handleMessage([]byte(`{"e":"listenKeyExpired","E":1576653824251}`))
+	assert.Equal(t, 1, len(stream.rekeyC))
+}
@@ -0,0 +1,373 @@
+package binance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	WS_BASE_URL = "wss://stream.binance.com:9443/stream" //combined stream , 消息格式 {"stream":"<name>","data":<payload>}
+
+	WS_MAX_STREAMS_PER_CONN = 1024
+	WS_DIFF_DEPTH_SNAPSHOT  = 1000 //diff depth同步时rest全量的档数
+)
+
+//每个连接最多订阅n个stream , 超过后新建连接 , 默认1024
+func (bn *Binance) WsMaxSubsPerConn(n int) *Binance {
+	bn.createWsLock.Lock()
+	defer bn.createWsLock.Unlock()
+	bn.wsMaxSubs = n
+	return bn
+}
+
+//连接在第一次订阅时建立
+func (bn *Binance) wsConns() *WsShards {
+	bn.createWsLock.Lock()
+	defer bn.createWsLock.Unlock()
+
+	if bn.wsShards == nil {
+		if bn.wsMaxSubs == 0 {
+			bn.wsMaxSubs = WS_MAX_STREAMS_PER_CONN
+		}
+		bn.wsShards = NewWsShards(bn.wsMaxSubs, bn.dialWs)
+	}
+	return bn.wsShards
+}
+
+func (bn *Binance) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn(WS_BASE_URL)
+	if err != nil {
+		return nil, err
+	}
+	//服务端只发ping帧 , 用LIST_SUBSCRIPTIONS的回执保持活跃时间
+	ws.Heartbeat(func() interface{} {
+		return map[string]interface{}{
+			"method": "LIST_SUBSCRIPTIONS",
+			"id":     0}
+	}, 30*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		bn.handleWsMessage(ws, msg)
+	})
+	return ws, nil
+}
+
+func (bn *Binance) handleWsMessage(ws *WsConn, msg []byte) {
+	ws.UpdateActivedTime()
+
+	var resp struct {
+		Stream string                 `json:"stream"`
+		Data   map[string]interface{} `json:"data"`
+		Id     *int64                 `json:"id"`
+		Error  *struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		} `json:"error"`
+	}
+	err := json.Unmarshal(msg, &resp)
+	if err != nil {
+		log.Println("json unmarshal error for ", string(msg))
+		return
+	}
+
+	if resp.Stream == "" {
+		if resp.Id == nil {
+			log.Println(string(msg))
+			return
+		}
+		bn.wsLock.Lock()
+		stream, isok := bn.wsSubIds[*resp.Id]
+		bn.wsLock.Unlock()
+		if !isok {
+			return
+		}
+		if resp.Error != nil {
+			ws.FailSubscribe(stream, fmt.Errorf("%d: %s", resp.Error.Code, resp.Error.Msg))
+		} else {
+			ws.AckSubscribe(stream)
+		}
+		return
+	}
+
+	stream, data := resp.Stream, resp.Data
+	switch {
+	case strings.HasSuffix(stream, "@ticker"):
+		if handle := bn.wsHandlers.Ticker(stream); handle != nil {
+			handle(bn.parseWsTicker(data))
+		}
+	case strings.HasSuffix(stream, "@bookTicker"):
+		if handle := bn.wsHandlers.Ticker(stream); handle != nil {
+			handle(bn.parseWsBookTicker(data))
+		}
+	case strings.HasSuffix(stream, "@aggTrade"):
+		if handle := bn.wsHandlers.Trade(stream); handle != nil {
+			handle(bn.parseWsAggTrade(data))
+		}
+	case strings.Contains(stream, "@kline_"):
+		if handle := bn.wsHandlers.Kline(stream); handle != nil {
+			handle(bn.parseWsKline(data))
+		}
+	case strings.HasSuffix(stream, "@depth"):
+		bn.wsLock.Lock()
+		update := bn.wsDiffDepths[stream]
+		bn.wsLock.Unlock()
+		if update != nil {
+			update(bn.parseWsDepthUpdate(data))
+		}
+	case strings.Contains(stream, "@depth"):
+		if handle := bn.wsHandlers.Depth(stream); handle != nil {
+			handle(bn.parseWsPartialDepth(data))
+		}
+	default:
+		log.Println("unknown stream:", string(msg))
+	}
+}
+
+func (bn *Binance) streamName(pair CurrencyPair, stream string) string {
+	pair = bn.adaptCurrencyPair(pair)
+	return strings.ToLower(pair.ToSymbol("")) + "@" + stream
+}
+
+func (bn *Binance) subscribe(stream string) error {
+	bn.wsLock.Lock()
+	bn.wsNextId++
+	id := bn.wsNextId
+	bn.wsSubIds[id] = stream
+	bn.wsLock.Unlock()
+
+	return bn.wsConns().SubscribeChannel(stream, map[string]interface{}{
+		"method": "SUBSCRIBE",
+		"params": []string{stream},
+		"id":     id}, map[string]interface{}{
+		"method": "UNSUBSCRIBE",
+		"params": []string{stream},
+		"id":     0})
+}
+
+func (bn *Binance) unsubscribe(stream string) error {
+	bn.wsHandlers.Remove(stream)
+
+	bn.wsLock.Lock()
+	for id, s := range bn.wsSubIds {
+		if s == stream {
+			delete(bn.wsSubIds, id)
+		}
+	}
+	delete(bn.wsDiffDepths, stream)
+	bn.wsLock.Unlock()
+
+	return bn.wsConns().UnsubscribeChannel(stream)
+}
+
+//24小时滚动行情 , 每秒推送
+func (bn *Binance) SubscribeTicker(pair CurrencyPair, handle func(ticker *Ticker)) error {
+	stream := bn.streamName(pair, "ticker")
+	bn.wsHandlers.SetTicker(stream, func(ticker *Ticker) {
+		ticker.Pair = pair
+		handle(ticker)
+	})
+	return bn.subscribe(stream)
+}
+
+func (bn *Binance) UnsubscribeTicker(pair CurrencyPair) error {
+	return bn.unsubscribe(bn.streamName(pair, "ticker"))
+}
+
+//最优买卖价实时推送 , 只有Buy和Sell , Date为收到的时间
+func (bn *Binance) SubscribeBookTicker(pair CurrencyPair, handle func(ticker *Ticker)) error {
+	stream := bn.streamName(pair, "bookTicker")
+	bn.wsHandlers.SetTicker(stream, func(ticker *Ticker) {
+		ticker.Pair = pair
+		handle(ticker)
+	})
+	return bn.subscribe(stream)
+}
+
+func (bn *Binance) UnsubscribeBookTicker(pair CurrencyPair) error {
+	return bn.unsubscribe(bn.streamName(pair, "bookTicker"))
+}
+
+//前20档深度
+func (bn *Binance) SubscribeDepth(pair CurrencyPair, handle func(dep *Depth)) error {
+	return bn.SubscribePartialDepth(pair, 20, handle)
+}
+
+func (bn *Binance) UnsubscribeDepth(pair CurrencyPair) error {
+	return bn.UnsubscribePartialDepth(pair, 20)
+}
+
+//有限档深度 , levels: 5 , 10 , 20
+func (bn *Binance) SubscribePartialDepth(pair CurrencyPair, levels int, handle func(dep *Depth)) error {
+	if levels != 5 && levels != 10 && levels != 20 {
+		return errors.New("partial depth levels must be 5 , 10 or 20")
+	}
+	stream := bn.streamName(pair, fmt.Sprintf("depth%d", levels))
+	bn.wsHandlers.SetDepth(stream, func(dep *Depth) {
+		dep.Pair = pair
+		handle(dep)
+	})
+	return bn.subscribe(stream)
+}
+
+func (bn *Binance) UnsubscribePartialDepth(pair CurrencyPair, levels int) error {
+	return bn.unsubscribe(bn.streamName(pair, fmt.Sprintf("depth%d", levels)))
+}
+
+/**
+ * 增量深度 , 本地用rest全量(lastUpdateId)+增量(U , u)维护完整深度 , 每次更新回调前size档(size<=0为全部)
+ * 断档时由OrderBook在后台重新同步 , 同步完成前的推送不回调
+ */
+func (bn *Binance) SubscribeDiffDepth(pair CurrencyPair, size int, handle func(dep *Depth)) error {
+	stream := bn.streamName(pair, "depth")
+	book := NewOrderBook(pair).SetSnapshotFunc(func() (*Depth, int64, error) {
+		return bn.getDepth(WS_DIFF_DEPTH_SNAPSHOT, pair)
+	})
+	bn.setDiffDepth(stream, book, size, handle)
+	return bn.subscribe(stream)
+}
+
+func (bn *Binance) setDiffDepth(stream string, book *OrderBook, size int, handle func(dep *Depth)) {
+	bn.wsLock.Lock()
+	defer bn.wsLock.Unlock()
+	bn.wsDiffDepths[stream] = func(update *DepthUpdate) {
+		if book.Update(update) == nil {
+			handle(book.Depth(size))
+		}
+	}
+}
+
+func (bn *Binance) UnsubscribeDiffDepth(pair CurrencyPair) error {
+	return bn.unsubscribe(bn.streamName(pair, "depth"))
+}
+
+//归集成交
+func (bn *Binance) SubscribeTrade(pair CurrencyPair, handle func(trade *Trade)) error {
+	stream := bn.streamName(pair, "aggTrade")
+	bn.wsHandlers.SetTrade(stream, func(trade *Trade) {
+		trade.Pair = pair
+		handle(trade)
+	})
+	return bn.subscribe(stream)
+}
+
+func (bn *Binance) UnsubscribeTrade(pair CurrencyPair) error {
+	return bn.unsubscribe(bn.streamName(pair, "aggTrade"))
+}
+
+func (bn *Binance) klineStream(pair CurrencyPair, period int) (string, error) {
+	interval, isok := _INERNAL_KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return "", ErrKlinePeriodNotSupport
+	}
+	return bn.streamName(pair, "kline_"+interval), nil
+}
+
+func (bn *Binance) SubscribeKline(pair CurrencyPair, period int, handle func(kline *Kline)) error {
+	stream, err := bn.klineStream(pair, period)
+	if err != nil {
+		return err
+	}
+	bn.wsHandlers.SetKline(stream, func(kline *Kline) {
+		kline.Pair = pair
+		handle(kline)
+	})
+	return bn.subscribe(stream)
+}
+
+func (bn *Binance) UnsubscribeKline(pair CurrencyPair, period int) error {
+	stream, err := bn.klineStream(pair, period)
+	if err != nil {
+		return err
+	}
+	return bn.unsubscribe(stream)
+}
+
+func (bn *Binance) OnSubscribeError(handle func(channel string, err error)) {
+	bn.wsConns().OnSubscribeError(handle)
+}
+
+//关闭所有websocket连接
+func (bn *Binance) CloseWs() {
+	bn.wsLock.Lock()
+	bn.wsDiffDepths = make(map[string]func(*DepthUpdate))
+	bn.wsSubIds = make(map[int64]string)
+	bn.wsLock.Unlock()
+
+	bn.wsConns().CloseWs()
+}
+
+func (bn *Binance) parseWsTicker(data map[string]interface{}) *Ticker {
+	return &Ticker{
+		Last: ToFloat64(data["c"]),
+		Buy:  ToFloat64(data["b"]),
+		Sell: ToFloat64(data["a"]),
+		High: ToFloat64(data["h"]),
+		Low:  ToFloat64(data["l"]),
+		Vol:  ToFloat64(data["v"]),
+		Date: ToUint64(data["E"]) / 1000}
+}
+
+func (bn *Binance) parseWsBookTicker(data map[string]interface{}) *Ticker {
+	return &Ticker{
+		Buy:  ToFloat64(data["b"]),
+		Sell: ToFloat64(data["a"]),
+		Date: uint64(time.Now().Unix())}
+}
+
+func (bn *Binance) parseWsAggTrade(data map[string]interface{}) *Trade {
+	trade := &Trade{
+		Tid:    int64(ToUint64(data["a"])),
+		Type:   BUY,
+		Amount: ToFloat64(data["q"]),
+		Price:  ToFloat64(data["p"]),
+		Date:   int64(ToUint64(data["T"]))}
+	if isMaker, _ := data["m"].(bool); isMaker { //买方是maker即主动卖出
+		trade.Type = SELL
+	}
+	return trade
+}
+
+func (bn *Binance) parseWsKline(data map[string]interface{}) *Kline {
+	k, _ := data["k"].(map[string]interface{})
+	return &Kline{
+		Timestamp: int64(ToUint64(k["t"])) / 1000, //to unix timestramp
+		Open:      ToFloat64(k["o"]),
+		Close:     ToFloat64(k["c"]),
+		High:      ToFloat64(k["h"]),
+		Low:       ToFloat64(k["l"]),
+		Vol:       ToFloat64(k["v"])}
+}
+
+func (bn *Binance) parseWsPartialDepth(data map[string]interface{}) *Depth {
+	return &Depth{
+		UTime:   time.Now(),
+		AskList: parseWsDepthRecords(data["asks"]),
+		BidList: parseWsDepthRecords(data["bids"])}
+}
+
+func (bn *Binance) parseWsDepthUpdate(data map[string]interface{}) *DepthUpdate {
+	return &DepthUpdate{
+		FirstSeq: int64(ToUint64(data["U"])),
+		Seq:      int64(ToUint64(data["u"])),
+		AskList:  parseWsDepthRecords(data["a"]),
+		BidList:  parseWsDepthRecords(data["b"])}
+}
+
+func parseWsDepthRecords(v interface{}) DepthRecords {
+	records, _ := v.([]interface{})
+	ret := make(DepthRecords, 0, len(records))
+	for _, r := range records {
+		_r, isok := r.([]interface{})
+		if !isok || len(_r) < 2 {
+			continue
+		}
+		ret = append(ret, DepthRecord{Price: ToFloat64(_r[0]), Amount: ToFloat64(_r[1])})
+	}
+	return ret
+}
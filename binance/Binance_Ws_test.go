@@ -0,0 +1,75 @@
+package binance
+
+import (
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBinance_DiffDepth(t *testing.T) {
+	var snapshots int32
+	release := make(chan struct{}, 2)
+	book := goex.NewOrderBook(goex.BTC_USDT).SetSnapshotFunc(func() (*goex.Depth, int64, error) {
+		<-release
+		atomic.AddInt32(&snapshots, 1)
+		return &goex.Depth{
+			AskList: goex.DepthRecords{{Price: 101, Amount: 1}, {Price: 102, Amount: 2}},
+			BidList: goex.DepthRecords{{Price: 99, Amount: 1}, {Price: 98, Amount: 2}}}, 100, nil
+	})
+
+	deps := make(chan *goex.Depth, 10)
+	ba.setDiffDepth("btcusdt@depth", book, 5, func(dep *goex.Depth) {
+		deps <- dep
+	})
+	defer ba.unsubscribe("btcusdt@depth")
+
+	//第一条推送触发同步 , 同步完成前的推送先缓存 , u <= lastUpdateId 的丢弃
+	ba.handleWsMessage(&goex.WsConn{}, []byte(`{"stream":"btcusdt@depth","data":{"e":"depthUpdate","U":90,"u":95,"a":[["101","9"]],"b":[]}}`))
+	ba.handleWsMessage(&goex.WsConn{}, []byte(`{"stream":"btcusdt@depth","data":{"e":"depthUpdate","U":96,"u":102,"a":[["101","0"]],"b":[]}}`))
+	release <- struct{}{}
+	for i := 0; i < 100 && !book.IsSynced(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ba.handleWsMessage(&goex.WsConn{}, []byte(`{"stream":"btcusdt@depth","data":{"e":"depthUpdate","U":103,"u":105,"a":[],"b":[["99.5","3"]]}}`))
+	dep := <-deps
+	assert.Equal(t, int32(1), atomic.LoadInt32(&snapshots))
+	assert.Equal(t, goex.BTC_USDT, dep.Pair)
+	assert.Equal(t, goex.DepthRecords{{Price: 102, Amount: 2}}, dep.AskList)
+	assert.Equal(t, 99.5, dep.BidList[0].Price)
+
+	//断档后重新获取全量
+	ba.handleWsMessage(&goex.WsConn{}, []byte(`{"stream":"btcusdt@depth","data":{"e":"depthUpdate","U":110,"u":111,"a":[],"b":[]}}`))
+	assert.False(t, book.IsSynced())
+	release <- struct{}{}
+	for i := 0; i < 100 && !book.IsSynced(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&snapshots))
+	assert.Equal(t, 0, len(deps))
+
+	//取消订阅后不再回调
+	ba.unsubscribe("btcusdt@depth")
+	ba.handleWsMessage(&goex.WsConn{}, []byte(`{"stream":"btcusdt@depth","data":{"e":"depthUpdate","U":101,"u":101,"a":[],"b":[]}}`))
+	assert.Equal(t, 0, len(deps))
+}
+
+func TestBinance_handleWsMessage(t *testing.T) {
+	trades := make(chan *goex.Trade, 1)
+	assert.Nil(t, ba.wsHandlers.Trade("btcusdt@aggTrade"))
+	ba.wsHandlers.SetTrade("btcusdt@aggTrade", func(trade *goex.Trade) {
+		trade.Pair = goex.BTC_USDT
+		trades <- trade
+	})
+	defer ba.wsHandlers.Remove("btcusdt@aggTrade")
+
+	ba.handleWsMessage(&goex.WsConn{}, []byte(`{"stream":"btcusdt@aggTrade","data":{"e":"aggTrade","E":1560000000100,"s":"BTCUSDT","a":12345,"p":"8000.10","q":"0.5","f":100,"l":105,"T":1560000000000,"m":true}}`))
+	trade := <-trades
+	assert.Equal(t, int64(12345), trade.Tid)
+	assert.Equal(t, goex.TradeSide(goex.SELL), trade.Type)
+	assert.Equal(t, 8000.1, trade.Price)
+	assert.Equal(t, 0.5, trade.Amount)
+	assert.Equal(t, int64(1560000000000), trade.Date)
+}
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	. "github.com/bxsmart/GoEx"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,14 +19,35 @@ type Bitfinex struct {
 	httpClient *http.Client
 	accessKey,
 	secretKey string
+	wsShards        *WsShards
+	wsMaxSubs       int
+	createWsLock    sync.Mutex
+	wsHandlers      *WsHandlers
+	wsLock          sync.Mutex
+	wsChannels      map[wsChannelId]string
+	wsChanIds       map[string]int64
+	wsBooks         map[string]*wsBook
+	wsAuth          *WsConn
+	wsAuthHandle    wsAuthHandlers
+	wsSubErrHandles []func(channel string, err error)
+	pubUrl          string
 }
 
 const (
 	BASE_URL = "https://api.bitfinex.com/v1"
+	PUB_URL  = "https://api-pub.bitfinex.com/v2"
 )
 
 func New(client *http.Client, accessKey, secretKey string) *Bitfinex {
-	return &Bitfinex{client, accessKey, secretKey}
+	return &Bitfinex{
+		httpClient: client,
+		accessKey:  accessKey,
+		secretKey:  secretKey,
+		wsHandlers: NewWsHandlers(),
+		wsChannels: make(map[wsChannelId]string),
+		wsChanIds:  make(map[string]int64),
+		wsBooks:    make(map[string]*wsBook),
+		pubUrl:     PUB_URL}
 }
 
 func (bfx *Bitfinex) GetExchangeName() string {
@@ -87,14 +111,80 @@ func (bfx *Bitfinex) GetDepth(size int, currencyPair CurrencyPair) (*Depth, erro
 	return depth, nil
 }
 
+/**
+ * v2 candles , since: 毫秒 , 返回since及之后的k线(升序) , 0为最近的size条 , 每次最多10000条
+ * [[MTS, OPEN, CLOSE, HIGH, LOW, VOLUME]]
+ */
 func (bfx *Bitfinex) GetKlineRecords(currencyPair CurrencyPair, period, size, since int) ([]Kline, error) {
-	panic("not implement")
-}
+	timeframe, isok := _KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return nil, ErrKlinePeriodNotSupport
+	}
+
+	params := url.Values{}
+	if size > 0 {
+		params.Set("limit", fmt.Sprint(size))
+	}
+	if since > 0 {
+		params.Set("start", fmt.Sprint(since))
+		params.Set("sort", "1")
+	}
+	resp, err := HttpGet3(bfx.httpClient, fmt.Sprintf("%s/candles/trade:%s:%s/hist?%s",
+		bfx.pubUrl, timeframe, bfx.wsSymbol(currencyPair), params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var klines []Kline
+	for _, v := range resp {
+		entry, isok := v.([]interface{})
+		if !isok || len(entry) < 6 {
+			continue
+		}
+		kline := bfx.parseWsKline(entry)
+		kline.Pair = currencyPair
+		klines = append(klines, *kline)
+	}
 
-//非个人，整个交易所的交易记录
+	sort.Slice(klines, func(i, j int) bool {
+		return klines[i].Timestamp < klines[j].Timestamp
+	})
+	return klines, nil
+}
 
+/**
+ * 非个人，整个交易所的交易记录
+ * v2 trades , since: 毫秒 , 返回since及之后的成交(升序 , 最多1000笔) , 0为最近的100笔
+ * [[ID, MTS, AMOUNT, PRICE]]
+ */
 func (bfx *Bitfinex) GetTrades(currencyPair CurrencyPair, since int64) ([]Trade, error) {
-	panic("not implement")
+	params := url.Values{}
+	if since > 0 {
+		params.Set("start", fmt.Sprint(since))
+		params.Set("limit", "1000")
+		params.Set("sort", "1")
+	}
+	resp, err := HttpGet3(bfx.httpClient, fmt.Sprintf("%s/trades/%s/hist?%s",
+		bfx.pubUrl, bfx.wsSymbol(currencyPair), params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var trades []Trade
+	for _, v := range resp {
+		entry, isok := v.([]interface{})
+		if !isok || len(entry) < 4 {
+			continue
+		}
+		trade := bfx.parseWsTrade(entry)
+		trade.Pair = currencyPair
+		trades = append(trades, *trade)
+	}
+
+	sort.Slice(trades, func(i, j int) bool {
+		return trades[i].Date < trades[j].Date
+	})
+	return trades, nil
 }
 
 func (bfx *Bitfinex) GetWalletBalances() (map[string]*Account, error) {
@@ -2,7 +2,9 @@ package bitfinex
 
 import (
 	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -18,3 +20,41 @@ func TestBitfinex_GetDepth(t *testing.T) {
 	t.Log(dep.AskList)
 	t.Log(dep.BidList)
 }
+
+func TestBitfinex_GetTradesAndKlines(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.String())
+		switch r.URL.Path {
+		case "/trades/tBTCUSD/hist":
+			w.Write([]byte(`[[2,1560000001000,-0.5,8001],[1,1560000000000,0.2,8000]]`))
+		case "/candles/trade:1m:tBTCUSD/hist":
+			w.Write([]byte(`[[1560000060000,2,3,4,1,20],[1560000000000,1,2,3,0.5,10]]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ex := New(http.DefaultClient, "", "")
+	ex.pubUrl = srv.URL
+
+	trades, err := ex.GetTrades(goex.BTC_USDT, 1560000000000)
+	assert.Nil(t, err)
+	assert.Equal(t, "/trades/tBTCUSD/hist?limit=1000&sort=1&start=1560000000000", queries[0])
+	assert.Equal(t, []goex.Trade{
+		{Tid: 1, Type: goex.BUY, Amount: 0.2, Price: 8000, Date: 1560000000000, Pair: goex.BTC_USDT},
+		{Tid: 2, Type: goex.SELL, Amount: 0.5, Price: 8001, Date: 1560000001000, Pair: goex.BTC_USDT},
+	}, trades)
+
+	klines, err := ex.GetKlineRecords(goex.BTC_USDT, goex.KLINE_PERIOD_1MIN, 2, 1560000000000)
+	assert.Nil(t, err)
+	assert.Equal(t, "/candles/trade:1m:tBTCUSD/hist?limit=2&sort=1&start=1560000000000", queries[1])
+	assert.Equal(t, []goex.Kline{
+		{Pair: goex.BTC_USDT, Timestamp: 1560000000, Open: 1, Close: 2, High: 3, Low: 0.5, Vol: 10},
+		{Pair: goex.BTC_USDT, Timestamp: 1560000060, Open: 2, Close: 3, High: 4, Low: 1, Vol: 20},
+	}, klines)
+
+	_, err = ex.GetKlineRecords(goex.BTC_USDT, goex.KLINE_PERIOD_3MIN, 2, 0)
+	assert.Equal(t, goex.ErrKlinePeriodNotSupport, err)
+}
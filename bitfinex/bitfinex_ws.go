@@ -0,0 +1,669 @@
+package bitfinex
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"hash/crc32"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	WS_URL = "wss://api.bitfinex.com/ws/2"
+
+	_WS_FLAG_CHECKSUM = 131072 //订阅book时每次更新后推送前25档的checksum
+	_WS_BOOK_LEN      = 25
+)
+
+var _KLINE_PERIOD_CONVERTER = map[int]string{
+	KLINE_PERIOD_1MIN:   "1m",
+	KLINE_PERIOD_5MIN:   "5m",
+	KLINE_PERIOD_15MIN:  "15m",
+	KLINE_PERIOD_30MIN:  "30m",
+	KLINE_PERIOD_60MIN:  "1h",
+	KLINE_PERIOD_1H:     "1h",
+	KLINE_PERIOD_6H:     "6h",
+	KLINE_PERIOD_12H:    "12h",
+	KLINE_PERIOD_1DAY:   "1D",
+	KLINE_PERIOD_1WEEK:  "7D",
+	KLINE_PERIOD_1MONTH: "1M",
+}
+
+//chanId只在单个连接内有效
+type wsChannelId struct {
+	ws     *WsConn
+	chanId int64
+}
+
+/**
+ * 本地维护的book
+ * P0-P4: 按价位聚合 , 用OrderBook维护
+ * R0: 逐笔委托 , 按订单id维护 , 回调时再按价位聚合
+ */
+type wsBook struct {
+	pair   CurrencyPair
+	size   int
+	raw    bool
+	book   *OrderBook
+	orders map[int64]wsRawOrder
+	synced bool
+	handle func(*Depth)
+}
+
+type wsRawOrder struct {
+	Id     int64
+	Price  float64
+	Amount float64 //正数为买单 , 负数为卖单
+}
+
+func newWsBook(pair CurrencyPair, prec string, size int, handle func(*Depth)) *wsBook {
+	b := &wsBook{pair: pair, size: size, raw: strings.HasPrefix(prec, "R"), handle: handle}
+	b.book = NewOrderBook(pair).SetChecksumFunc(BitfinexDepthChecksum)
+	return b
+}
+
+//[PRICE, COUNT, AMOUNT] 或 [ORDER_ID, PRICE, AMOUNT]
+func (b *wsBook) snapshot(entries []interface{}) {
+	if b.raw {
+		b.orders = make(map[int64]wsRawOrder, len(entries))
+		for _, e := range entries {
+			b.updateRaw(e)
+		}
+		b.synced = true
+		return
+	}
+
+	dep := &Depth{Pair: b.pair}
+	for _, e := range entries {
+		entry, _ := e.([]interface{})
+		price, count, amount := wsFloat(entry, 0), wsFloat(entry, 1), wsFloat(entry, 2)
+		if count == 0 {
+			continue
+		}
+		if amount > 0 {
+			dep.BidList = append(dep.BidList, DepthRecord{Price: price, Amount: amount})
+		} else {
+			dep.AskList = append(dep.AskList, DepthRecord{Price: price, Amount: -amount})
+		}
+	}
+	b.book.Snapshot(dep, 0)
+	b.synced = true
+}
+
+func (b *wsBook) update(e interface{}) error {
+	if !b.synced {
+		return ErrOrderBookNotSync
+	}
+
+	if b.raw {
+		b.updateRaw(e)
+		return nil
+	}
+
+	entry, _ := e.([]interface{})
+	price, count, amount := wsFloat(entry, 0), wsFloat(entry, 1), wsFloat(entry, 2)
+	update := &DepthUpdate{}
+	record := DepthRecord{Price: price, Amount: math.Abs(amount)}
+	if count == 0 {
+		record.Amount = 0
+	}
+	if amount > 0 {
+		update.BidList = DepthRecords{record}
+	} else {
+		update.AskList = DepthRecords{record}
+	}
+	return b.book.Update(update)
+}
+
+func (b *wsBook) updateRaw(e interface{}) {
+	entry, _ := e.([]interface{})
+	id := int64(wsFloat(entry, 0))
+	price, amount := wsFloat(entry, 1), wsFloat(entry, 2)
+	if price == 0 {
+		delete(b.orders, id)
+		return
+	}
+	b.orders[id] = wsRawOrder{Id: id, Price: price, Amount: amount}
+}
+
+func (b *wsBook) checksum(cs int32) error {
+	if !b.synced {
+		return ErrOrderBookNotSync
+	}
+
+	if !b.raw {
+		return b.book.Update(&DepthUpdate{Checksum: cs, HasChecksum: true})
+	}
+
+	bids, asks := b.sortedRawOrders()
+	if sum := bitfinexRawChecksum(bids, asks); sum != cs {
+		b.synced = false
+		return fmt.Errorf("%s , expect %d but %d", ErrOrderBookChecksum, cs, sum)
+	}
+	return nil
+}
+
+//买单价格降序 , 卖单价格升序 , 同价位按id升序
+func (b *wsBook) sortedRawOrders() (bids, asks []wsRawOrder) {
+	for _, o := range b.orders {
+		if o.Amount > 0 {
+			bids = append(bids, o)
+		} else {
+			asks = append(asks, o)
+		}
+	}
+	sort.Slice(bids, func(i, j int) bool {
+		if bids[i].Price == bids[j].Price {
+			return bids[i].Id < bids[j].Id
+		}
+		return bids[i].Price > bids[j].Price
+	})
+	sort.Slice(asks, func(i, j int) bool {
+		if asks[i].Price == asks[j].Price {
+			return asks[i].Id < asks[j].Id
+		}
+		return asks[i].Price < asks[j].Price
+	})
+	return bids, asks
+}
+
+func (b *wsBook) depth() *Depth {
+	if !b.raw {
+		return b.book.Depth(b.size)
+	}
+
+	dep := &Depth{Pair: b.pair, UTime: time.Now()}
+	bids, asks := b.sortedRawOrders()
+	for _, o := range bids {
+		dep.BidList = appendRawLevel(dep.BidList, o.Price, o.Amount, b.size)
+	}
+	for _, o := range asks {
+		dep.AskList = appendRawLevel(dep.AskList, o.Price, -o.Amount, b.size)
+	}
+	return dep
+}
+
+//按价位聚合已经排好序的订单
+func appendRawLevel(levels DepthRecords, price, amount float64, size int) DepthRecords {
+	if n := len(levels); n > 0 && levels[n-1].Price == price {
+		levels[n-1].Amount += amount
+		return levels
+	}
+	if size > 0 && len(levels) >= size {
+		return levels
+	}
+	return append(levels, DepthRecord{Price: price, Amount: amount})
+}
+
+/**
+ * raw book checksum: 前25个订单按 bid:ask 交替拼接 "id:amount" , ask的amount为负数 , crc32
+ */
+func bitfinexRawChecksum(bids, asks []wsRawOrder) int32 {
+	var parts []string
+	for i := 0; i < 25; i++ {
+		if i < len(bids) {
+			parts = append(parts, fmt.Sprint(bids[i].Id), FormatJsNumber(bids[i].Amount))
+		}
+		if i < len(asks) {
+			parts = append(parts, fmt.Sprint(asks[i].Id), FormatJsNumber(asks[i].Amount))
+		}
+	}
+	return int32(crc32.ChecksumIEEE([]byte(strings.Join(parts, ":"))))
+}
+
+//每个连接最多订阅n个频道 , 超过后新建连接 , bitfinex限制每个连接30个
+func (bfx *Bitfinex) WsMaxSubsPerConn(n int) *Bitfinex {
+	bfx.createWsLock.Lock()
+	defer bfx.createWsLock.Unlock()
+	bfx.wsMaxSubs = n
+	return bfx
+}
+
+//连接在第一次订阅时建立
+func (bfx *Bitfinex) wsConns() *WsShards {
+	bfx.createWsLock.Lock()
+	defer bfx.createWsLock.Unlock()
+
+	if bfx.wsShards == nil {
+		if bfx.wsMaxSubs == 0 {
+			bfx.wsMaxSubs = 30
+		}
+		bfx.wsShards = NewWsShards(bfx.wsMaxSubs, bfx.dialWs)
+	}
+	return bfx.wsShards
+}
+
+func (bfx *Bitfinex) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn(WS_URL)
+	if err != nil {
+		return nil, err
+	}
+	ws.Heartbeat(func() interface{} {
+		return map[string]interface{}{
+			"event": "ping",
+			"cid":   time.Now().Unix()}
+	}, 10*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		bfx.handleWsMessage(ws, msg)
+	})
+
+	//第一个订阅 , 重连后最先重发
+	err = ws.SubscribeChannel("conf", map[string]interface{}{
+		"event": "conf",
+		"flags": _WS_FLAG_CHECKSUM}, nil)
+	if err != nil {
+		ws.CloseWs()
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (bfx *Bitfinex) handleWsMessage(ws *WsConn, msg []byte) {
+	ws.UpdateActivedTime()
+
+	if len(msg) > 0 && msg[0] == '{' {
+		datamap := make(map[string]interface{})
+		err := json.Unmarshal(msg, &datamap)
+		if err != nil {
+			log.Println("json unmarshal error for ", string(msg))
+			return
+		}
+		bfx.handleWsEvent(ws, datamap)
+		return
+	}
+
+	var data []interface{}
+	err := json.Unmarshal(msg, &data)
+	if err != nil || len(data) < 2 {
+		log.Println("json unmarshal error for ", string(msg))
+		return
+	}
+
+	chanId := int64(wsFloat(data, 0))
+	if chanId == 0 {
+		bfx.handleWsAuthMessage(data)
+		return
+	}
+
+	bfx.wsLock.Lock()
+	channel := bfx.wsChannels[wsChannelId{ws, chanId}]
+	bfx.wsLock.Unlock()
+	if channel == "" {
+		return
+	}
+
+	if typ, isok := data[1].(string); isok {
+		switch typ {
+		case "hb":
+		case "cs":
+			bfx.checksumWsBook(ws, channel, int32(wsFloat(data, 2)))
+		case "te":
+			if handle := bfx.wsHandlers.Trade(channel); handle != nil && len(data) > 2 {
+				entry, _ := data[2].([]interface{})
+				handle(bfx.parseWsTrade(entry))
+			}
+		}
+		return
+	}
+
+	entries, _ := data[1].([]interface{})
+	if len(entries) == 0 {
+		return
+	}
+	_, isSnapshot := entries[0].([]interface{})
+
+	switch {
+	case strings.HasPrefix(channel, "ticker:"):
+		if handle := bfx.wsHandlers.Ticker(channel); handle != nil {
+			handle(bfx.parseWsTicker(entries))
+		}
+	case strings.HasPrefix(channel, "book:"):
+		bfx.updateWsBook(channel, entries, isSnapshot)
+	case strings.HasPrefix(channel, "candles:"):
+		handle := bfx.wsHandlers.Kline(channel)
+		if handle == nil {
+			return
+		}
+		if isSnapshot { //快照第一条是最新的
+			entries, _ = entries[0].([]interface{})
+		}
+		handle(bfx.parseWsKline(entries))
+	}
+}
+
+func (bfx *Bitfinex) handleWsEvent(ws *WsConn, datamap map[string]interface{}) {
+	switch datamap["event"] {
+	case "subscribed":
+		channel := wsChannelKey(datamap)
+		chanId := int64(ToFloat64(datamap["chanId"]))
+		bfx.wsLock.Lock()
+		bfx.wsChannels[wsChannelId{ws, chanId}] = channel
+		bfx.wsChanIds[channel] = chanId
+		bfx.wsLock.Unlock()
+		ws.AckSubscribe(channel)
+	case "unsubscribed":
+		chanId := int64(ToFloat64(datamap["chanId"]))
+		bfx.wsLock.Lock()
+		delete(bfx.wsChannels, wsChannelId{ws, chanId})
+		bfx.wsLock.Unlock()
+	case "conf":
+		if datamap["status"] == "OK" {
+			ws.AckSubscribe("conf")
+		} else {
+			ws.FailSubscribe("conf", fmt.Errorf("conf %v", datamap["status"]))
+		}
+	case "auth":
+		if datamap["status"] == "OK" {
+			ws.AckSubscribe("auth")
+		} else {
+			ws.FailSubscribe("auth", fmt.Errorf("%v: %v", datamap["code"], datamap["msg"]))
+		}
+	case "error":
+		if datamap["channel"] == nil {
+			log.Println("websocket error:", datamap)
+			return
+		}
+		if code := ToInt(datamap["code"]); code == 10301 { //已经订阅
+			return
+		}
+		ws.FailSubscribe(wsChannelKey(datamap), fmt.Errorf("%v: %v", datamap["code"], datamap["msg"]))
+	case "pong":
+	default:
+		log.Println(datamap)
+	}
+}
+
+/**
+ * 订阅消息和订阅回执都用这个key , 例如:
+ * ticker:tBTCUSD , trades:tBTCUSD , book:tBTCUSD:P0:25 , candles:trade:1m:tBTCUSD
+ */
+func wsChannelKey(datamap map[string]interface{}) string {
+	channel := fmt.Sprint(datamap["channel"])
+	switch channel {
+	case "book":
+		return fmt.Sprintf("book:%v:%v:%v", datamap["symbol"], datamap["prec"], datamap["len"])
+	case "candles":
+		return fmt.Sprintf("candles:%v", datamap["key"])
+	default:
+		return fmt.Sprintf("%s:%v", channel, datamap["symbol"])
+	}
+}
+
+func (bfx *Bitfinex) updateWsBook(channel string, entries []interface{}, isSnapshot bool) {
+	bfx.wsLock.Lock()
+	b := bfx.wsBooks[channel]
+	if b == nil {
+		bfx.wsLock.Unlock()
+		return
+	}
+
+	if isSnapshot {
+		b.snapshot(entries)
+	} else if err := b.update(entries); err != nil {
+		bfx.wsLock.Unlock()
+		return //等待重新订阅后的快照
+	}
+	dep := b.depth()
+	bfx.wsLock.Unlock()
+
+	b.handle(dep)
+}
+
+func (bfx *Bitfinex) checksumWsBook(ws *WsConn, channel string, cs int32) {
+	bfx.wsLock.Lock()
+	b := bfx.wsBooks[channel]
+	if b == nil {
+		bfx.wsLock.Unlock()
+		return
+	}
+	err := b.checksum(cs)
+	chanId := bfx.wsChanIds[channel]
+	bfx.wsLock.Unlock()
+
+	if err == nil || err == ErrOrderBookNotSync {
+		return
+	}
+
+	//重新订阅获取新的快照
+	log.Printf("[%s] %s , resubscribe ...", channel, err)
+	sub, isok := ws.Subscription(channel)
+	if !isok {
+		return
+	}
+	ws.SendWriteJSON(map[string]interface{}{
+		"event":  "unsubscribe",
+		"chanId": chanId})
+	ws.SendWriteJSON(sub.Sub)
+}
+
+func (bfx *Bitfinex) wsSymbol(pair CurrencyPair) string {
+	pair = bfx.adaptCurrencyPair(pair)
+	a, b := pair.CurrencyA.Symbol, pair.CurrencyB.Symbol
+	if len(a) > 3 || len(b) > 3 {
+		return "t" + a + ":" + b
+	}
+	return "t" + a + b
+}
+
+func (bfx *Bitfinex) wsSymbolToPair(symbol string) CurrencyPair {
+	symbol = strings.TrimPrefix(symbol, "t")
+	if i := strings.Index(symbol, ":"); i > 0 {
+		return NewCurrencyPair(NewCurrency(symbol[:i], ""), NewCurrency(symbol[i+1:], ""))
+	}
+	if len(symbol) < 6 {
+		return UNKNOWN_PAIR
+	}
+	return bfx.symbolToCurrencyPair(symbol)
+}
+
+func (bfx *Bitfinex) subscribe(sub map[string]interface{}) error {
+	sub["event"] = "subscribe"
+	return bfx.wsConns().SubscribeChannel(wsChannelKey(sub), sub, nil)
+}
+
+//取消订阅需要订阅回执里的chanId
+func (bfx *Bitfinex) unsubscribe(channel string) error {
+	bfx.wsHandlers.Remove(channel)
+	ws := bfx.wsConns().Conn(channel)
+
+	bfx.wsLock.Lock()
+	chanId, isok := bfx.wsChanIds[channel]
+	delete(bfx.wsChanIds, channel)
+	delete(bfx.wsBooks, channel)
+	bfx.wsLock.Unlock()
+
+	err := bfx.wsConns().UnsubscribeChannel(channel)
+	if err != nil || ws == nil || !isok || ws.State() != WS_CONNECTED {
+		return err
+	}
+	return ws.SendWriteJSON(map[string]interface{}{
+		"event":  "unsubscribe",
+		"chanId": chanId})
+}
+
+func (bfx *Bitfinex) SubscribeTicker(pair CurrencyPair, handle func(ticker *Ticker)) error {
+	sub := map[string]interface{}{
+		"channel": "ticker",
+		"symbol":  bfx.wsSymbol(pair)}
+	bfx.wsHandlers.SetTicker(wsChannelKey(sub), func(ticker *Ticker) {
+		ticker.Pair = pair
+		handle(ticker)
+	})
+	return bfx.subscribe(sub)
+}
+
+func (bfx *Bitfinex) UnsubscribeTicker(pair CurrencyPair) error {
+	return bfx.unsubscribe("ticker:" + bfx.wsSymbol(pair))
+}
+
+func (bfx *Bitfinex) SubscribeTrade(pair CurrencyPair, handle func(trade *Trade)) error {
+	sub := map[string]interface{}{
+		"channel": "trades",
+		"symbol":  bfx.wsSymbol(pair)}
+	bfx.wsHandlers.SetTrade(wsChannelKey(sub), func(trade *Trade) {
+		trade.Pair = pair
+		handle(trade)
+	})
+	return bfx.subscribe(sub)
+}
+
+func (bfx *Bitfinex) UnsubscribeTrade(pair CurrencyPair) error {
+	return bfx.unsubscribe("trades:" + bfx.wsSymbol(pair))
+}
+
+//P0精度前25档
+func (bfx *Bitfinex) SubscribeDepth(pair CurrencyPair, handle func(dep *Depth)) error {
+	return bfx.SubscribeBook(pair, "P0", _WS_BOOK_LEN, handle)
+}
+
+func (bfx *Bitfinex) UnsubscribeDepth(pair CurrencyPair) error {
+	return bfx.UnsubscribeBook(pair, "P0", _WS_BOOK_LEN)
+}
+
+/**
+ * prec: P0 - P4 按价位聚合 , 精度依次降低; R0 逐笔委托
+ * length: 25 或 100 (R0另外支持1)
+ * 每次更新后回调完整的本地深度 , checksum不一致时自动重新订阅
+ */
+func (bfx *Bitfinex) SubscribeBook(pair CurrencyPair, prec string, length int, handle func(dep *Depth)) error {
+	sub := map[string]interface{}{
+		"channel": "book",
+		"symbol":  bfx.wsSymbol(pair),
+		"prec":    prec,
+		"len":     fmt.Sprint(length)}
+	if prec == "R0" {
+		sub["freq"] = "F0"
+	}
+	channel := wsChannelKey(sub)
+
+	bfx.wsLock.Lock()
+	bfx.wsBooks[channel] = newWsBook(pair, prec, length, handle)
+	bfx.wsLock.Unlock()
+	return bfx.subscribe(sub)
+}
+
+func (bfx *Bitfinex) UnsubscribeBook(pair CurrencyPair, prec string, length int) error {
+	return bfx.unsubscribe(fmt.Sprintf("book:%s:%s:%d", bfx.wsSymbol(pair), prec, length))
+}
+
+func (bfx *Bitfinex) klineChannel(pair CurrencyPair, period int) (string, error) {
+	timeframe, isok := _KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return "", ErrKlinePeriodNotSupport
+	}
+	return fmt.Sprintf("trade:%s:%s", timeframe, bfx.wsSymbol(pair)), nil
+}
+
+func (bfx *Bitfinex) SubscribeKline(pair CurrencyPair, period int, handle func(kline *Kline)) error {
+	key, err := bfx.klineChannel(pair, period)
+	if err != nil {
+		return err
+	}
+	sub := map[string]interface{}{
+		"channel": "candles",
+		"key":     key}
+	bfx.wsHandlers.SetKline(wsChannelKey(sub), func(kline *Kline) {
+		kline.Pair = pair
+		handle(kline)
+	})
+	return bfx.subscribe(sub)
+}
+
+func (bfx *Bitfinex) UnsubscribeKline(pair CurrencyPair, period int) error {
+	key, err := bfx.klineChannel(pair, period)
+	if err != nil {
+		return err
+	}
+	return bfx.unsubscribe("candles:" + key)
+}
+
+func (bfx *Bitfinex) OnSubscribeError(handle func(channel string, err error)) {
+	bfx.wsLock.Lock()
+	bfx.wsSubErrHandles = append(bfx.wsSubErrHandles, handle)
+	auth := bfx.wsAuth
+	bfx.wsLock.Unlock()
+
+	if auth != nil {
+		auth.OnSubscribeError(handle)
+	}
+	bfx.wsConns().OnSubscribeError(handle)
+}
+
+//关闭所有websocket连接 , 包括认证连接
+func (bfx *Bitfinex) CloseWs() {
+	bfx.wsConns().CloseWs()
+
+	bfx.wsLock.Lock()
+	auth := bfx.wsAuth
+	bfx.wsAuth = nil
+	bfx.wsChannels = make(map[wsChannelId]string)
+	bfx.wsChanIds = make(map[string]int64)
+	bfx.wsBooks = make(map[string]*wsBook)
+	bfx.wsLock.Unlock()
+
+	if auth != nil {
+		auth.CloseWs()
+	}
+}
+
+//[BID, BID_SIZE, ASK, ASK_SIZE, DAILY_CHANGE, DAILY_CHANGE_PERC, LAST_PRICE, VOLUME, HIGH, LOW]
+func (bfx *Bitfinex) parseWsTicker(entry []interface{}) *Ticker {
+	return &Ticker{
+		Buy:  wsFloat(entry, 0),
+		Sell: wsFloat(entry, 2),
+		Last: wsFloat(entry, 6),
+		Vol:  wsFloat(entry, 7),
+		High: wsFloat(entry, 8),
+		Low:  wsFloat(entry, 9),
+		Date: uint64(time.Now().Unix())}
+}
+
+//[ID, MTS, AMOUNT, PRICE] , AMOUNT负数为卖
+func (bfx *Bitfinex) parseWsTrade(entry []interface{}) *Trade {
+	trade := &Trade{
+		Tid:    int64(wsFloat(entry, 0)),
+		Date:   int64(wsFloat(entry, 1)),
+		Amount: math.Abs(wsFloat(entry, 2)),
+		Price:  wsFloat(entry, 3),
+		Type:   BUY}
+	if wsFloat(entry, 2) < 0 {
+		trade.Type = SELL
+	}
+	return trade
+}
+
+//[MTS, OPEN, CLOSE, HIGH, LOW, VOLUME]
+func (bfx *Bitfinex) parseWsKline(entry []interface{}) *Kline {
+	return &Kline{
+		Timestamp: int64(wsFloat(entry, 0)) / 1000,
+		Open:      wsFloat(entry, 1),
+		Close:     wsFloat(entry, 2),
+		High:      wsFloat(entry, 3),
+		Low:       wsFloat(entry, 4),
+		Vol:       wsFloat(entry, 5)}
+}
+
+//数组第i个数字 , 越界或者null返回0
+func wsFloat(arr []interface{}, i int) float64 {
+	if i < len(arr) {
+		if v, isok := arr[i].(float64); isok {
+			return v
+		}
+	}
+	return 0
+}
+
+func wsString(arr []interface{}, i int) string {
+	if i < len(arr) {
+		if v, isok := arr[i].(string); isok {
+			return v
+		}
+	}
+	return ""
+}
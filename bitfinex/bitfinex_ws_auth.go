@@ -0,0 +1,302 @@
+package bitfinex
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"math"
+	"strings"
+	"time"
+)
+
+/**
+ * 保证金仓位 , 认证频道推送
+ */
+type MarginPosition struct {
+	Pair          CurrencyPair
+	Status        string  //ACTIVE , CLOSED
+	Amount        float64 //正数多仓 , 负数空仓
+	BasePrice     float64
+	MarginFunding float64
+	PL            float64
+	PLPerc        float64
+	LiqPrice      float64
+	Leverage      float64
+}
+
+type wsAuthHandlers struct {
+	order        func(*Order)
+	position     func(*MarginPosition)
+	wallet       func(walletType string, sub *SubAccount)
+	fundingOffer func(*LendOrder)
+}
+
+//每次发送时重新生成nonce , 重连后重发认证不会因为nonce过小失败
+type wsAuthRequest struct {
+	bfx *Bitfinex
+}
+
+func (r wsAuthRequest) MarshalJSON() ([]byte, error) {
+	nonce := fmt.Sprint(time.Now().UnixNano() / 1000)
+	payload := "AUTH" + nonce
+	sign, err := GetParamHmacSha384Sign(r.bfx.secretKey, payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"event":       "auth",
+		"apiKey":      r.bfx.accessKey,
+		"authSig":     sign,
+		"authPayload": payload,
+		"authNonce":   nonce})
+}
+
+//订单推送: 快照(os) , 新建(on) , 更新(ou) , 取消/完成(oc)
+func (bfx *Bitfinex) OnWsOrder(handle func(order *Order)) *Bitfinex {
+	bfx.wsLock.Lock()
+	defer bfx.wsLock.Unlock()
+	bfx.wsAuthHandle.order = handle
+	return bfx
+}
+
+func (bfx *Bitfinex) OnWsPosition(handle func(position *MarginPosition)) *Bitfinex {
+	bfx.wsLock.Lock()
+	defer bfx.wsLock.Unlock()
+	bfx.wsAuthHandle.position = handle
+	return bfx
+}
+
+//walletType: exchange , margin , funding
+func (bfx *Bitfinex) OnWsWallet(handle func(walletType string, sub *SubAccount)) *Bitfinex {
+	bfx.wsLock.Lock()
+	defer bfx.wsLock.Unlock()
+	bfx.wsAuthHandle.wallet = handle
+	return bfx
+}
+
+//融资挂单 , Rate转换为和v1接口一致的年化百分比
+func (bfx *Bitfinex) OnWsFundingOffer(handle func(offer *LendOrder)) *Bitfinex {
+	bfx.wsLock.Lock()
+	defer bfx.wsLock.Unlock()
+	bfx.wsAuthHandle.fundingOffer = handle
+	return bfx
+}
+
+/**
+ * 建立认证连接 , 推送通过OnWsOrder , OnWsPosition , OnWsWallet , OnWsFundingOffer设置的回调
+ * 认证失败通过OnSubscribeError回调 , channel为auth
+ */
+func (bfx *Bitfinex) SubscribeAuth() error {
+	bfx.createWsLock.Lock()
+	defer bfx.createWsLock.Unlock()
+
+	bfx.wsLock.Lock()
+	auth := bfx.wsAuth
+	bfx.wsLock.Unlock()
+	if auth != nil {
+		return nil
+	}
+
+	ws, err := NewWsConn(WS_URL)
+	if err != nil {
+		return err
+	}
+	ws.Heartbeat(func() interface{} {
+		return map[string]interface{}{
+			"event": "ping",
+			"cid":   time.Now().Unix()}
+	}, 10*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	for _, handle := range bfx.subErrHandles() {
+		ws.OnSubscribeError(handle)
+	}
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		bfx.handleWsMessage(ws, msg)
+	})
+
+	err = ws.SubscribeChannel("auth", wsAuthRequest{bfx}, nil)
+	if err != nil {
+		ws.CloseWs()
+		return err
+	}
+
+	bfx.wsLock.Lock()
+	bfx.wsAuth = ws
+	bfx.wsLock.Unlock()
+	return nil
+}
+
+func (bfx *Bitfinex) UnsubscribeAuth() error {
+	bfx.wsLock.Lock()
+	auth := bfx.wsAuth
+	bfx.wsAuth = nil
+	bfx.wsLock.Unlock()
+
+	if auth == nil {
+		return nil
+	}
+	err := auth.SendWriteJSON(map[string]interface{}{"event": "unauth"})
+	auth.CloseWs()
+	return err
+}
+
+func (bfx *Bitfinex) subErrHandles() []func(channel string, err error) {
+	bfx.wsLock.Lock()
+	defer bfx.wsLock.Unlock()
+	return append([]func(string, error){}, bfx.wsSubErrHandles...)
+}
+
+//[0, TYPE, DATA] , 快照类型的DATA是数组的数组
+func (bfx *Bitfinex) handleWsAuthMessage(data []interface{}) {
+	typ, _ := data[1].(string)
+	if typ == "hb" || len(data) < 3 {
+		return
+	}
+
+	var entries []interface{}
+	switch v := data[2].(type) {
+	case []interface{}:
+		if len(v) > 0 {
+			if _, isok := v[0].([]interface{}); isok {
+				entries = v
+			} else {
+				entries = []interface{}{v}
+			}
+		}
+	default:
+		return
+	}
+
+	bfx.wsLock.Lock()
+	handles := bfx.wsAuthHandle
+	bfx.wsLock.Unlock()
+
+	for _, e := range entries {
+		entry, _ := e.([]interface{})
+		switch typ {
+		case "os", "on", "ou", "oc":
+			if handles.order != nil {
+				handles.order(bfx.parseWsOrder(entry))
+			}
+		case "ps", "pn", "pu", "pc":
+			if handles.position != nil {
+				handles.position(bfx.parseWsPosition(entry))
+			}
+		case "ws", "wu":
+			if handles.wallet != nil {
+				walletType, sub := bfx.parseWsWallet(entry)
+				handles.wallet(walletType, sub)
+			}
+		case "fos", "fon", "fou", "foc":
+			if handles.fundingOffer != nil {
+				handles.fundingOffer(bfx.parseWsFundingOffer(entry))
+			}
+		}
+	}
+}
+
+/**
+ * [ID, GID, CID, SYMBOL, MTS_CREATE, MTS_UPDATE, AMOUNT, AMOUNT_ORIG, TYPE, TYPE_PREV, MTS_TIF, _, FLAGS, STATUS, _, _, PRICE, PRICE_AVG, ...]
+ * AMOUNT为剩余数量 , 负数为卖单
+ */
+func (bfx *Bitfinex) parseWsOrder(entry []interface{}) *Order {
+	id := int(wsFloat(entry, 0))
+	amount, amountOrig := wsFloat(entry, 6), wsFloat(entry, 7)
+	order := &Order{
+		OrderID:    id,
+		OrderID2:   fmt.Sprint(id),
+		Currency:   bfx.wsSymbolToPair(wsString(entry, 3)),
+		OrderTime:  int(wsFloat(entry, 4) / 1000),
+		Amount:     math.Abs(amountOrig),
+		DealAmount: math.Abs(amountOrig) - math.Abs(amount),
+		Price:      wsFloat(entry, 16),
+		AvgPrice:   wsFloat(entry, 17),
+		Status:     adaptWsOrderStatus(wsString(entry, 13))}
+
+	isMarket := strings.HasSuffix(wsString(entry, 8), "MARKET")
+	switch {
+	case amountOrig > 0 && isMarket:
+		order.Side = BUY_MARKET
+	case amountOrig > 0:
+		order.Side = BUY
+	case isMarket:
+		order.Side = SELL_MARKET
+	default:
+		order.Side = SELL
+	}
+	return order
+}
+
+//ACTIVE , EXECUTED @ PRICE(AMOUNT) , PARTIALLY FILLED @ PRICE(AMOUNT) , CANCELED , INSUFFICIENT MARGIN ...
+func adaptWsOrderStatus(status string) TradeStatus {
+	switch {
+	case strings.HasPrefix(status, "ACTIVE"):
+		return ORDER_UNFINISH
+	case strings.HasPrefix(status, "EXECUTED"):
+		return ORDER_FINISH
+	case strings.HasPrefix(status, "PARTIALLY FILLED"):
+		return ORDER_PART_FINISH
+	case strings.Contains(status, "CANCELED"):
+		return ORDER_CANCEL
+	case strings.HasPrefix(status, "INSUFFICIENT"), strings.HasPrefix(status, "RSN_"):
+		return ORDER_REJECT
+	}
+	return ORDER_UNFINISH
+}
+
+//[SYMBOL, STATUS, AMOUNT, BASE_PRICE, MARGIN_FUNDING, MARGIN_FUNDING_TYPE, PL, PL_PERC, PRICE_LIQ, LEVERAGE]
+func (bfx *Bitfinex) parseWsPosition(entry []interface{}) *MarginPosition {
+	return &MarginPosition{
+		Pair:          bfx.wsSymbolToPair(wsString(entry, 0)),
+		Status:        wsString(entry, 1),
+		Amount:        wsFloat(entry, 2),
+		BasePrice:     wsFloat(entry, 3),
+		MarginFunding: wsFloat(entry, 4),
+		PL:            wsFloat(entry, 6),
+		PLPerc:        wsFloat(entry, 7),
+		LiqPrice:      wsFloat(entry, 8),
+		Leverage:      wsFloat(entry, 9)}
+}
+
+/**
+ * [WALLET_TYPE, CURRENCY, BALANCE, UNSETTLED_INTEREST, BALANCE_AVAILABLE]
+ * BALANCE_AVAILABLE可能为null , 这时全部算作可用
+ */
+func (bfx *Bitfinex) parseWsWallet(entry []interface{}) (string, *SubAccount) {
+	balance := wsFloat(entry, 2)
+	available := balance
+	if len(entry) > 4 && entry[4] != nil {
+		available = wsFloat(entry, 4)
+	}
+	return wsString(entry, 0), &SubAccount{
+		Currency:     NewCurrency(wsString(entry, 1), ""),
+		Amount:       available,
+		ForzenAmount: balance - available}
+}
+
+/**
+ * [ID, SYMBOL, MTS_CREATED, MTS_UPDATED, AMOUNT, AMOUNT_ORIG, TYPE, _, _, FLAGS, STATUS, _, _, _, RATE, PERIOD, ...]
+ * AMOUNT正数为放贷(lend) , 负数为借款(loan); v2的RATE是日利率
+ */
+func (bfx *Bitfinex) parseWsFundingOffer(entry []interface{}) *LendOrder {
+	amount, amountOrig := wsFloat(entry, 4), wsFloat(entry, 5)
+	status := wsString(entry, 10)
+	offer := &LendOrder{
+		Id:              int(wsFloat(entry, 0)),
+		Currency:        strings.TrimPrefix(wsString(entry, 1), "f"),
+		Rate:            wsFloat(entry, 14) * 365 * 100,
+		Period:          int(wsFloat(entry, 15)),
+		Direction:       "lend",
+		IsLive:          strings.HasPrefix(status, "ACTIVE") || strings.HasPrefix(status, "PARTIALLY FILLED"),
+		IsCancelled:     strings.Contains(status, "CANCELED"),
+		Amount:          math.Abs(amount),
+		RemainingAmount: math.Abs(amount),
+		OriginalAmount:  math.Abs(amountOrig),
+		ExecutedAmount:  math.Abs(amountOrig) - math.Abs(amount),
+		Timestamp:       fmt.Sprintf("%d.0", int64(wsFloat(entry, 2))/1000)}
+	if amountOrig < 0 {
+		offer.Direction = "loan"
+	}
+	return offer
+}
@@ -0,0 +1,103 @@
+package bitfinex
+
+import (
+	"fmt"
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestBitfinex_wsSymbol(t *testing.T) {
+	assert.Equal(t, "tBTCUSD", bfx.wsSymbol(goex.BTC_USDT))
+	assert.Equal(t, "tETHBTC", bfx.wsSymbol(goex.ETH_BTC))
+	assert.Equal(t, goex.ETH_BTC, bfx.wsSymbolToPair("tETHBTC"))
+	assert.Equal(t, "DUSK", bfx.wsSymbolToPair("tDUSK:USD").CurrencyA.Symbol)
+}
+
+func TestBitfinex_WsBook(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	ws := &goex.WsConn{}
+
+	var deps []*goex.Depth
+	ex.wsBooks["book:tBTCUSD:P0:25"] = newWsBook(goex.BTC_USD, "P0", 25, func(dep *goex.Depth) {
+		deps = append(deps, dep)
+	})
+
+	ex.handleWsMessage(ws, []byte(`{"event":"subscribed","channel":"book","chanId":10,"symbol":"tBTCUSD","prec":"P0","freq":"F0","len":"25","pair":"BTCUSD"}`))
+	ex.handleWsMessage(ws, []byte(`[10,[[100,1,2],[99,2,3],[101,1,-1],[102,3,-4]]]`))
+	ex.handleWsMessage(ws, []byte(`[10,[99,0,1]]`))
+	ex.handleWsMessage(ws, []byte(`[10,[101,2,-5]]`))
+	assert.Equal(t, 3, len(deps))
+
+	dep := deps[2]
+	assert.Equal(t, goex.DepthRecords{{Price: 100, Amount: 2}}, dep.BidList)
+	assert.Equal(t, goex.DepthRecords{{Price: 101, Amount: 5}, {Price: 102, Amount: 4}}, dep.AskList)
+
+	cs := goex.BitfinexDepthChecksum(dep.AskList, dep.BidList)
+	ex.handleWsMessage(ws, []byte(`[10,"cs",`+fmt.Sprint(cs)+`]`))
+	assert.True(t, ex.wsBooks["book:tBTCUSD:P0:25"].book.IsSynced())
+
+	//checksum错误后等待新的快照 , 期间的更新不回调
+	ex.handleWsMessage(ws, []byte(`[10,"cs",1]`))
+	assert.False(t, ex.wsBooks["book:tBTCUSD:P0:25"].book.IsSynced())
+	ex.handleWsMessage(ws, []byte(`[10,[100,1,1]]`))
+	assert.Equal(t, 3, len(deps))
+	ex.handleWsMessage(ws, []byte(`[10,[[100,1,2]]]`))
+	assert.Equal(t, 4, len(deps))
+}
+
+func TestBitfinex_WsRawBook(t *testing.T) {
+	b := newWsBook(goex.BTC_USD, "R0", 25, nil)
+	b.snapshot([]interface{}{
+		[]interface{}{1.0, 100.0, 1.0},
+		[]interface{}{2.0, 100.0, 0.5},
+		[]interface{}{3.0, 101.0, -2.0}})
+	assert.Nil(t, b.update([]interface{}{4.0, 102.0, -1.0}))
+	assert.Nil(t, b.update([]interface{}{2.0, 0.0, 1.0}))
+
+	dep := b.depth()
+	assert.Equal(t, goex.DepthRecords{{Price: 100, Amount: 1}}, dep.BidList)
+	assert.Equal(t, goex.DepthRecords{{Price: 101, Amount: 2}, {Price: 102, Amount: 1}}, dep.AskList)
+
+	bids, asks := b.sortedRawOrders()
+	assert.Nil(t, b.checksum(bitfinexRawChecksum(bids, asks)))
+	assert.NotNil(t, b.checksum(1))
+	assert.Equal(t, goex.ErrOrderBookNotSync, b.update([]interface{}{5.0, 99.0, 1.0}))
+}
+
+func TestBitfinex_handleWsAuthMessage(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+
+	var orders []*goex.Order
+	var wallets []*goex.SubAccount
+	ex.OnWsOrder(func(order *goex.Order) {
+		orders = append(orders, order)
+	}).OnWsWallet(func(walletType string, sub *goex.SubAccount) {
+		assert.Equal(t, "exchange", walletType)
+		wallets = append(wallets, sub)
+	})
+
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`[0,"ou",[123,null,456,"tETHBTC",1573000000000,1573000001000,-0.3,-1,"EXCHANGE LIMIT",null,null,null,0,"PARTIALLY FILLED @ 0.021(-0.7)",null,null,0.021,0.021,0,0,null,null,null,0,0,null,null,null,"API>BFX",null,null,null]]`))
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`[0,"ws",[["exchange","BTC",1.5,0,1.2],["exchange","USD",100,0,null]]]`))
+
+	assert.Equal(t, 1, len(orders))
+	assert.Equal(t, 123, orders[0].OrderID)
+	assert.Equal(t, goex.ETH_BTC, orders[0].Currency)
+	assert.Equal(t, goex.TradeSide(goex.SELL), orders[0].Side)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_PART_FINISH), orders[0].Status)
+	assert.Equal(t, 1.0, orders[0].Amount)
+	assert.InDelta(t, 0.7, orders[0].DealAmount, 1e-9)
+
+	assert.Equal(t, 2, len(wallets))
+	assert.Equal(t, 1.2, wallets[0].Amount)
+	assert.InDelta(t, 0.3, wallets[0].ForzenAmount, 1e-9)
+	assert.Equal(t, 100.0, wallets[1].Amount)
+
+	offer := ex.parseWsFundingOffer([]interface{}{41238747.0, "fUSD", 1573000000000.0, 1573000000000.0, -100.0, -100.0, "LIMIT", nil, nil, 0.0, "ACTIVE", nil, nil, nil, 0.0002, 2.0})
+	assert.Equal(t, "USD", offer.Currency)
+	assert.Equal(t, "loan", offer.Direction)
+	assert.True(t, offer.IsLive)
+	assert.InDelta(t, 7.3, offer.Rate, 1e-9)
+	assert.Equal(t, 2, offer.Period)
+}
@@ -1,71 +1,269 @@
 package bitmex
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	. "github.com/bxsmart/GoEx"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
-var (
-	base_url = "https://www.bitmex.com/api/v1/"
+const (
+	API_BASE_URL     = "https://www.bitmex.com"
+	TESTNET_BASE_URL = "https://testnet.bitmex.com"
+
+	PERPETUAL_CONTRACT = "perpetual" //永续合约 , 其他合约可以直接用bitmex的合约代码 , 例如 XBTZ19
+
+	EXEC_INST_POST_ONLY   = "ParticipateDoNotInitiate" //只做maker
+	EXEC_INST_REDUCE_ONLY = "ReduceOnly"               //只减仓
+	EXEC_INST_CLOSE       = "Close"                    //平仓 , 不需要OrderQty
+	EXEC_INST_MARK_PRICE  = "MarkPrice"                //止损按标记价格触发
+	EXEC_INST_LAST_PRICE  = "LastPrice"
+	EXEC_INST_INDEX_PRICE = "IndexPrice"
+
+	_API_PATH        = "/api/v1/"
+	_REQUEST_EXPIRES = 60  //签名有效期 , 秒
+	_SATOSHI         = 1e8 //XBt转XBT
 )
 
-//bitmex register link  https://www.bitmex.com/register/0fcQP7
+//bitmex register link  https://www.bitmex.com/register/0fcQP7
+
+var _KLINE_PERIOD_CONVERTER = map[int]string{
+	KLINE_PERIOD_1MIN:  "1m",
+	KLINE_PERIOD_5MIN:  "5m",
+	KLINE_PERIOD_60MIN: "1h",
+	KLINE_PERIOD_1H:    "1h",
+	KLINE_PERIOD_1DAY:  "1d",
+}
+
+/**
+ * 下单参数
+ * Side: Buy , Sell ; OrderQty为合约张数 , XBTUSD每张1美元
+ * OrdType: Limit , Market , Stop , StopLimit , MarketIfTouched , LimitIfTouched
+ * ExecInst多个用逗号分隔 , 例如 "ParticipateDoNotInitiate,ReduceOnly"
+ */
+type OrderParam struct {
+	Symbol      string  `json:"symbol"`
+	Side        string  `json:"side,omitempty"`
+	OrderQty    float64 `json:"orderQty,omitempty"`
+	Price       float64 `json:"price,omitempty"`
+	StopPx      float64 `json:"stopPx,omitempty"`
+	OrdType     string  `json:"ordType,omitempty"`
+	TimeInForce string  `json:"timeInForce,omitempty"`
+	ExecInst    string  `json:"execInst,omitempty"`
+	ClOrdID     string  `json:"clOrdID,omitempty"`
+	Text        string  `json:"text,omitempty"`
+}
+
+//资金费率 , 每8小时结算一次
+type Funding struct {
+	Symbol           string
+	Timestamp        int64 //ms
+	FundingRate      float64
+	FundingRateDaily float64
+}
+
+//交割合约的代码缓存到过期
+type contract struct {
+	symbol string
+	expiry time.Time
+}
 
 type Bitmex struct {
 	httpClient *http.Client
+	baseUrl,
 	accessKey,
 	secretKey string
+
+	contractLock sync.Mutex
+	contracts    map[string]*contract
+
+	wsShards        *WsShards
+	wsMaxSubs       int
+	createWsLock    sync.Mutex
+	wsHandlers      *WsHandlers
+	wsLock          sync.Mutex
+	wsBooks         map[string]*wsBook
+	wsInstruments   map[string]*Instrument
+	wsInstHandles   map[string]func(*Instrument)
+	wsPositions     map[string]map[string]interface{}
+	wsAuth          *WsConn
+	wsAuthHandle    wsAuthHandlers
+	wsSubErrHandles []func(channel string, err error)
 }
 
 func New(client *http.Client, accesskey, secretkey string) *Bitmex {
-	return &Bitmex{client, accesskey, secretkey}
+	return NewWithConfig(&APIConfig{
+		HttpClient:   client,
+		ApiKey:       accesskey,
+		ApiSecretKey: secretkey})
 }
 
-func (Bitmex *Bitmex) LimitBuy(amount, price string, currency CurrencyPair) (*Order, error) {
-	panic("not implements")
+//Endpoint为空时使用正式环境 , 测试网为TESTNET_BASE_URL
+func NewWithConfig(config *APIConfig) *Bitmex {
+	baseUrl := config.Endpoint
+	if baseUrl == "" {
+		baseUrl = API_BASE_URL
+	}
+	return &Bitmex{
+		httpClient:    config.HttpClient,
+		baseUrl:       strings.TrimSuffix(baseUrl, "/"),
+		accessKey:     config.ApiKey,
+		secretKey:     config.ApiSecretKey,
+		contracts:     make(map[string]*contract),
+		wsHandlers:    NewWsHandlers(),
+		wsBooks:       make(map[string]*wsBook),
+		wsInstruments: make(map[string]*Instrument),
+		wsInstHandles: make(map[string]func(*Instrument)),
+		wsPositions:   make(map[string]map[string]interface{})}
 }
 
-func (Bitmex *Bitmex) LimitSell(amount, price string, currency CurrencyPair) (*Order, error) {
-	panic("not implements")
+//切换到测试网 , 需要使用testnet.bitmex.com的api key
+func (mex *Bitmex) Testnet() *Bitmex {
+	mex.baseUrl = TESTNET_BASE_URL
+	return mex
 }
 
-func (Bitmex *Bitmex) MarketBuy(amount, price string, currency CurrencyPair) (*Order, error) {
-	panic("not implements")
+func (mex *Bitmex) GetExchangeName() string {
+	return BITMEX
 }
 
-func (Bitmex *Bitmex) MarketSell(amount, price string, currency CurrencyPair) (*Order, error) {
-	panic("not implements")
+/**
+ * 合约代码
+ * contractType: 空或PERPETUAL_CONTRACT为永续合约 , QUARTER_CONTRACT为最近到期的交割合约 , 其他按bitmex合约代码处理
+ */
+func (mex *Bitmex) symbol(pair CurrencyPair, contractType string) (string, error) {
+	switch contractType {
+	case "", PERPETUAL_CONTRACT:
+		return mex.pairToSymbol(pair), nil
+	case QUARTER_CONTRACT:
+		return mex.quarterSymbol(pair)
+	case THIS_WEEK_CONTRACT, NEXT_WEEK_CONTRACT:
+		return "", errors.New("bitmex not support contract type " + contractType)
+	default:
+		return contractType, nil
+	}
 }
 
-func (Bitmex *Bitmex) CancelOrder(orderId string, currency CurrencyPair) (bool, error) {
-	panic("not implements")
+func (mex *Bitmex) pairToSymbol(pair CurrencyPair) string {
+	if pair.CurrencyA.Symbol == BTC.Symbol {
+		return NewCurrencyPair(XBT, USD).ToSymbol("")
+	}
+	return pair.AdaptUsdtToUsd().ToSymbol("")
 }
 
-func (Bitmex *Bitmex) GetOneOrder(orderId string, currency CurrencyPair) (*Order, error) {
-	panic("not implements")
+func rootSymbol(pair CurrencyPair) string {
+	if pair.CurrencyA.Symbol == BTC.Symbol {
+		return XBT.Symbol
+	}
+	return pair.CurrencyA.Symbol
 }
-func (Bitmex *Bitmex) GetUnfinishOrders(currency CurrencyPair) ([]Order, error) {
-	panic("not implements")
+
+//最近到期的交割合约 , 例如 XBTZ19
+func (mex *Bitmex) quarterSymbol(pair CurrencyPair) (string, error) {
+	root := rootSymbol(pair)
+
+	mex.contractLock.Lock()
+	c := mex.contracts[root]
+	mex.contractLock.Unlock()
+	if c != nil && time.Now().Before(c.expiry) {
+		return c.symbol, nil
+	}
+
+	var instruments []map[string]interface{}
+	err := mex.doRequest("instrument/active", &instruments)
+	if err != nil {
+		return "", err
+	}
+
+	var nearest *contract
+	for _, inst := range instruments {
+		//FFCCSX: 交割期货
+		if toString(inst["rootSymbol"]) != root || toString(inst["typ"]) != "FFCCSX" {
+			continue
+		}
+		expiry := parseTime(inst["expiry"])
+		if expiry.IsZero() || !expiry.After(time.Now()) {
+			continue
+		}
+		if nearest == nil || expiry.Before(nearest.expiry) {
+			nearest = &contract{symbol: toString(inst["symbol"]), expiry: expiry}
+		}
+	}
+	if nearest == nil {
+		return "", errors.New("no active quarter contract for " + root)
+	}
+
+	mex.contractLock.Lock()
+	mex.contracts[root] = nearest
+	mex.contractLock.Unlock()
+	return nearest.symbol, nil
+}
+
+func (mex *Bitmex) instrument(symbol string) (map[string]interface{}, error) {
+	var instruments []map[string]interface{}
+	err := mex.doRequest("instrument?symbol="+url.QueryEscape(symbol), &instruments)
+	if err != nil {
+		return nil, err
+	}
+	if len(instruments) == 0 {
+		return nil, errors.New("instrument not found: " + symbol)
+	}
+	return instruments[0], nil
 }
 
-func (Bitmex *Bitmex) GetOrderHistorys(currency CurrencyPair, currentPage, pageSize int) ([]Order, error) {
-	panic("not implements")
+//预估结算价
+func (mex *Bitmex) GetFutureEstimatedPrice(currencyPair CurrencyPair) (float64, error) {
+	symbol, err := mex.quarterSymbol(currencyPair)
+	if err != nil {
+		return 0, err
+	}
+	inst, err := mex.instrument(symbol)
+	if err != nil {
+		return 0, err
+	}
+	return ToFloat64(inst["indicativeSettlePrice"]), nil
 }
 
-func (Bitmex *Bitmex) GetAccount() (*Account, error) {
-	panic("not implements")
+func (mex *Bitmex) GetFutureTicker(currencyPair CurrencyPair, contractType string) (*Ticker, error) {
+	symbol, err := mex.symbol(currencyPair, contractType)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := mex.instrument(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return &Ticker{
+		ContractType: symbol,
+		Pair:         currencyPair,
+		Last:         ToFloat64(inst["lastPrice"]),
+		Buy:          ToFloat64(inst["bidPrice"]),
+		Sell:         ToFloat64(inst["askPrice"]),
+		High:         ToFloat64(inst["highPrice"]),
+		Low:          ToFloat64(inst["lowPrice"]),
+		Vol:          ToFloat64(inst["volume24h"]),
+		Date:         uint64(parseTime(inst["timestamp"]).Unix())}, nil
 }
 
-func (Bitmex *Bitmex) GetTicker(currency CurrencyPair) (*Ticker, error) {
-	panic("not implements")
+//永续合约深度
+func (mex *Bitmex) GetDepth(size int, currency CurrencyPair) (*Depth, error) {
+	return mex.GetFutureDepth(currency, PERPETUAL_CONTRACT, size)
 }
 
-func (Bitmex *Bitmex) GetDepth(size int, currency CurrencyPair) (*Depth, error) {
-	uri := fmt.Sprintf("orderBook/L2?symbol=%s&depth=%d", Bitmex.pairToSymbol(currency), size)
-	resp, err := HttpGet3(Bitmex.httpClient, base_url+uri, nil)
+func (mex *Bitmex) GetFutureDepth(currencyPair CurrencyPair, contractType string, size int) (*Depth, error) {
+	symbol, err := mex.symbol(currencyPair, contractType)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("orderBook/L2?symbol=%s&depth=%d", symbol, size)
+	resp, err := HttpGet3(mex.httpClient, mex.baseUrl+_API_PATH+uri, nil)
 	if err != nil {
 		return nil, HTTP_ERR_CODE.OriginErr(err.Error())
 	}
@@ -74,7 +272,8 @@ func (Bitmex *Bitmex) GetDepth(size int, currency CurrencyPair) (*Depth, error)
 
 	dep := new(Depth)
 	dep.UTime = time.Now()
-	dep.Pair = currency
+	dep.Pair = currencyPair
+	dep.ContractType = symbol
 
 	for _, r := range resp {
 		rr := r.(map[string]interface{})
@@ -89,22 +288,522 @@ func (Bitmex *Bitmex) GetDepth(size int, currency CurrencyPair) (*Depth, error)
 	return dep, nil
 }
 
-func (Bitmex *Bitmex) GetKlineRecords(currency CurrencyPair, period, size, since int) ([]Kline, error) {
-	panic("not implements")
+//指数价格 , 例如XBTUSD的.BXBT
+func (mex *Bitmex) GetFutureIndex(currencyPair CurrencyPair) (float64, error) {
+	inst, err := mex.instrument(mex.pairToSymbol(currencyPair))
+	if err != nil {
+		return 0, err
+	}
+	index, err := mex.instrument(toString(inst["referenceSymbol"]))
+	if err != nil {
+		return 0, err
+	}
+	return ToFloat64(index["lastPrice"]), nil
+}
+
+/**
+ * 保证金账户 , 金额单位为XBT
+ * AccountRights: 保证金余额(含未实现盈亏) , KeepDeposit: 维持保证金 , RiskRate: 已用保证金比例
+ */
+func (mex *Bitmex) GetFutureUserinfo() (*FutureAccount, error) {
+	var margins []map[string]interface{}
+	err := mex.doAuthenticatedRequest("GET", "user/margin?currency=all", nil, &margins)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := &FutureAccount{FutureSubAccounts: make(map[Currency]FutureSubAccount, len(margins))}
+	for _, m := range margins {
+		currency, unit := adaptCurrency(toString(m["currency"]))
+		acc.FutureSubAccounts[currency] = FutureSubAccount{
+			Currency:      currency,
+			AccountRights: ToFloat64(m["marginBalance"]) / unit,
+			KeepDeposit:   ToFloat64(m["maintMargin"]) / unit,
+			ProfitReal:    ToFloat64(m["realisedPnl"]) / unit,
+			ProfitUnreal:  ToFloat64(m["unrealisedPnl"]) / unit,
+			RiskRate:      ToFloat64(m["marginUsedPcnt"])}
+	}
+	return acc, nil
 }
 
-//非个人，整个交易所的交易记录
-func (Bitmex *Bitmex) GetTrades(currencyPair CurrencyPair, since int64) ([]Trade, error) {
-	panic("not implements")
+/**
+ * bitmex没有开平仓的区分 , 开多和平空为买 , 开空和平多为卖 , 平仓单带ReduceOnly
+ * matchPrice为1时下市价单 , leverRate不在下单时生效 , 请用SetLeverage设置
+ */
+func (mex *Bitmex) PlaceFutureOrder(currencyPair CurrencyPair, contractType, price, amount string, openType, matchPrice, leverRate int) (string, error) {
+	symbol, err := mex.symbol(currencyPair, contractType)
+	if err != nil {
+		return "", err
+	}
+
+	param := &OrderParam{
+		Symbol:   symbol,
+		OrderQty: ToFloat64(amount),
+		OrdType:  "Limit"}
+
+	switch openType {
+	case OPEN_BUY, CLOSE_SELL:
+		param.Side = "Buy"
+	case OPEN_SELL, CLOSE_BUY:
+		param.Side = "Sell"
+	default:
+		return "", errors.New("unknown openType")
+	}
+	if openType == CLOSE_BUY || openType == CLOSE_SELL {
+		param.ExecInst = EXEC_INST_REDUCE_ONLY
+	}
+
+	if matchPrice == 1 {
+		param.OrdType = "Market"
+	} else {
+		param.Price = ToFloat64(price)
+	}
+
+	ord, err := mex.PlaceOrder(param)
+	if err != nil {
+		return "", err
+	}
+	return ord.OrderID2, nil
 }
 
-func (Bitmex *Bitmex) GetExchangeName() string {
-	return BITMEX
+//下单 , 支持止损单和execInst
+func (mex *Bitmex) PlaceOrder(param *OrderParam) (*FutureOrder, error) {
+	params := make(map[string]interface{})
+	data, _ := json.Marshal(param)
+	json.Unmarshal(data, &params)
+
+	var ordmap map[string]interface{}
+	err := mex.doAuthenticatedRequest("POST", "order", params, &ordmap)
+	if err != nil {
+		return nil, err
+	}
+	return mex.toFutureOrder(ordmap), nil
 }
 
-func (mex *Bitmex) pairToSymbol(pair CurrencyPair) string {
-	if pair.CurrencyA.Symbol == BTC.Symbol {
-		return NewCurrencyPair(XBT, USD).ToSymbol("")
+func (mex *Bitmex) FutureCancelOrder(currencyPair CurrencyPair, contractType, orderId string) (bool, error) {
+	var orders []map[string]interface{}
+	err := mex.doAuthenticatedRequest("DELETE", "order", map[string]interface{}{"orderID": orderId}, &orders)
+	if err != nil {
+		return false, err
 	}
-	return pair.AdaptUsdtToUsd().ToSymbol("")
+	for _, ord := range orders {
+		if msg := toString(ord["error"]); msg != "" {
+			return false, errors.New(msg)
+		}
+	}
+	return true, nil
+}
+
+/**
+ * 持仓 , bitmex每个合约只有一个方向的仓位
+ * currentQty大于0为多仓 , 小于0为空仓 , 盈亏单位为XBT
+ */
+func (mex *Bitmex) GetFuturePosition(currencyPair CurrencyPair, contractType string) ([]FuturePosition, error) {
+	symbol, err := mex.symbol(currencyPair, contractType)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, _ := json.Marshal(map[string]string{"symbol": symbol})
+	var positions []map[string]interface{}
+	err = mex.doAuthenticatedRequest("GET", "position?filter="+url.QueryEscape(string(filter)), nil, &positions)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []FuturePosition
+	for _, pos := range positions {
+		p := toFuturePosition(pos)
+		p.Symbol = currencyPair
+		ret = append(ret, *p)
+	}
+	return ret, nil
+}
+
+func (mex *Bitmex) GetFutureOrders(orderIds []string, currencyPair CurrencyPair, contractType string) ([]FutureOrder, error) {
+	symbol, err := mex.symbol(currencyPair, contractType)
+	if err != nil {
+		return nil, err
+	}
+	return mex.getOrders(symbol, map[string]interface{}{"orderID": orderIds}, len(orderIds))
+}
+
+func (mex *Bitmex) GetFutureOrder(orderId string, currencyPair CurrencyPair, contractType string) (*FutureOrder, error) {
+	orders, err := mex.GetFutureOrders([]string{orderId}, currencyPair, contractType)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, errors.New("order not found")
+	}
+	return &orders[0], nil
+}
+
+func (mex *Bitmex) GetUnfinishFutureOrders(currencyPair CurrencyPair, contractType string) ([]FutureOrder, error) {
+	symbol, err := mex.symbol(currencyPair, contractType)
+	if err != nil {
+		return nil, err
+	}
+	return mex.getOrders(symbol, map[string]interface{}{"open": true}, 500)
+}
+
+func (mex *Bitmex) getOrders(symbol string, filter map[string]interface{}, count int) ([]FutureOrder, error) {
+	data, _ := json.Marshal(filter)
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("filter", string(data))
+	params.Set("count", fmt.Sprint(count))
+	params.Set("reverse", "true")
+
+	var orders []map[string]interface{}
+	err := mex.doAuthenticatedRequest("GET", "order?"+params.Encode(), nil, &orders)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]FutureOrder, 0, len(orders))
+	for _, ordmap := range orders {
+		ret = append(ret, *mex.toFutureOrder(ordmap))
+	}
+	return ret, nil
+}
+
+//永续合约的taker费率
+func (mex *Bitmex) GetFee() (float64, error) {
+	inst, err := mex.instrument(mex.pairToSymbol(BTC_USD))
+	if err != nil {
+		return 0, err
+	}
+	return ToFloat64(inst["takerFee"]), nil
+}
+
+func (mex *Bitmex) GetExchangeRate() (float64, error) {
+	return 0, errors.New("not support")
+}
+
+/**
+ * 反向合约(XBTUSD)为每张合约的美元价值
+ * 其他合约为每张合约每1点价格变化对应的XBT
+ */
+func (mex *Bitmex) GetContractValue(currencyPair CurrencyPair) (float64, error) {
+	inst, err := mex.instrument(mex.pairToSymbol(currencyPair))
+	if err != nil {
+		return 0, err
+	}
+	multiplier := ToFloat64(inst["multiplier"])
+	if multiplier < 0 {
+		multiplier = -multiplier
+	}
+	return multiplier / _SATOSHI, nil
+}
+
+//交割合约在到期日(周五)UTC 12:00结算
+func (mex *Bitmex) GetDeliveryTime() (int, int, int, int) {
+	return 5, 12, 0, 0
+}
+
+/**
+ * 只支持1m , 5m , 1h , 1d
+ * since: 毫秒 , 0为最近size根 , 返回按时间升序 , Timestamp为开盘时间(秒)
+ */
+func (mex *Bitmex) GetKlineRecords(contract_type string, currency CurrencyPair, period, size, since int) ([]FutureKline, error) {
+	binSize, isok := _KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return nil, ErrKlinePeriodNotSupport
+	}
+	symbol, err := mex.symbol(currency, contract_type)
+	if err != nil {
+		return nil, err
+	}
+
+	//bitmex的k线时间是收盘时间
+	duration := KlinePeriodDuration(period)
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("binSize", binSize)
+	params.Set("partial", "false")
+	params.Set("count", fmt.Sprint(size))
+	if since > 0 {
+		start := time.Unix(0, int64(since)*int64(time.Millisecond)).Add(duration)
+		params.Set("startTime", start.UTC().Format(time.RFC3339))
+	} else {
+		params.Set("reverse", "true")
+	}
+
+	var buckets []map[string]interface{}
+	err = mex.doRequest("trade/bucketed?"+params.Encode(), &buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	var klines []FutureKline
+	for _, b := range buckets {
+		klines = append(klines, FutureKline{
+			Kline: &Kline{
+				Pair:      currency,
+				Timestamp: parseTime(b["timestamp"]).Add(-duration).Unix(),
+				Open:      ToFloat64(b["open"]),
+				Close:     ToFloat64(b["close"]),
+				High:      ToFloat64(b["high"]),
+				Low:       ToFloat64(b["low"]),
+				Vol:       ToFloat64(b["volume"])},
+			Vol2: ToFloat64(b["homeNotional"])})
+	}
+	sort.Slice(klines, func(i, j int) bool {
+		return klines[i].Timestamp < klines[j].Timestamp
+	})
+	return klines, nil
+}
+
+//非个人，整个交易所的交易记录 , since: 毫秒 , 0为最近500笔
+func (mex *Bitmex) GetTrades(contract_type string, currencyPair CurrencyPair, since int64) ([]Trade, error) {
+	symbol, err := mex.symbol(currencyPair, contract_type)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("count", "500")
+	if since > 0 {
+		params.Set("startTime", time.Unix(0, since*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano))
+	} else {
+		params.Set("reverse", "true")
+	}
+
+	var trades []map[string]interface{}
+	err = mex.doRequest("trade?"+params.Encode(), &trades)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Trade
+	for _, t := range trades {
+		ret = append(ret, *parseTrade(t, currencyPair))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Date < ret[j].Date
+	})
+	return ret, nil
+}
+
+//资金费率历史 , 按时间倒序
+func (mex *Bitmex) GetFundingHistory(currencyPair CurrencyPair, count int) ([]Funding, error) {
+	params := url.Values{}
+	params.Set("symbol", mex.pairToSymbol(currencyPair))
+	params.Set("count", fmt.Sprint(count))
+	params.Set("reverse", "true")
+
+	var fundings []map[string]interface{}
+	err := mex.doRequest("funding?"+params.Encode(), &fundings)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Funding
+	for _, f := range fundings {
+		ret = append(ret, Funding{
+			Symbol:           toString(f["symbol"]),
+			Timestamp:        parseTime(f["timestamp"]).UnixNano() / int64(time.Millisecond),
+			FundingRate:      ToFloat64(f["fundingRate"]),
+			FundingRateDaily: ToFloat64(f["fundingRateDaily"])})
+	}
+	return ret, nil
+}
+
+//设置杠杆 , leverage为0时切换为全仓
+func (mex *Bitmex) SetLeverage(currencyPair CurrencyPair, contractType string, leverage float64) error {
+	symbol, err := mex.symbol(currencyPair, contractType)
+	if err != nil {
+		return err
+	}
+	var pos map[string]interface{}
+	return mex.doAuthenticatedRequest("POST", "position/leverage", map[string]interface{}{
+		"symbol":   symbol,
+		"leverage": leverage}, &pos)
+}
+
+//逐仓或全仓
+func (mex *Bitmex) SetIsolateMargin(currencyPair CurrencyPair, contractType string, isolate bool) error {
+	symbol, err := mex.symbol(currencyPair, contractType)
+	if err != nil {
+		return err
+	}
+	var pos map[string]interface{}
+	return mex.doAuthenticatedRequest("POST", "position/isolate", map[string]interface{}{
+		"symbol":  symbol,
+		"enabled": isolate}, &pos)
+}
+
+//逐仓时追加(amount>0)或减少(amount<0)仓位保证金 , 单位XBT
+func (mex *Bitmex) TransferMargin(currencyPair CurrencyPair, contractType string, amount float64) error {
+	symbol, err := mex.symbol(currencyPair, contractType)
+	if err != nil {
+		return err
+	}
+	var pos map[string]interface{}
+	return mex.doAuthenticatedRequest("POST", "position/transferMargin", map[string]interface{}{
+		"symbol": symbol,
+		"amount": int64(amount * _SATOSHI)}, &pos)
+}
+
+func (mex *Bitmex) doRequest(uri string, ret interface{}) error {
+	resp, err := NewHttpRequest(mex.httpClient, "GET", mex.baseUrl+_API_PATH+uri, "", nil)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(resp, ret)
+	if err != nil {
+		return errors.New(string(resp))
+	}
+	return nil
+}
+
+/**
+ * 签名: hex(HMAC_SHA256(secret, verb + path + expires + body))
+ * path包含/api/v1和查询参数 , expires为过期时间(unix秒)
+ */
+func (mex *Bitmex) sign(method, path, expires, body string) (string, error) {
+	return GetParamHmacSHA256Sign(mex.secretKey, method+path+expires+body)
+}
+
+func (mex *Bitmex) doAuthenticatedRequest(method, uri string, params map[string]interface{}, ret interface{}) error {
+	body := ""
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		body = string(data)
+	}
+
+	path := _API_PATH + uri
+	expires := fmt.Sprint(time.Now().Unix() + _REQUEST_EXPIRES)
+	sign, err := mex.sign(method, path, expires, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := NewHttpRequest(mex.httpClient, method, mex.baseUrl+path, body, map[string]string{
+		"Content-Type":  "application/json",
+		"Accept":        "application/json",
+		"api-expires":   expires,
+		"api-key":       mex.accessKey,
+		"api-signature": sign})
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(resp, ret)
+	if err != nil {
+		return errors.New(string(resp))
+	}
+	return nil
+}
+
+/**
+ * ordStatus: New , PartiallyFilled , Filled , Canceled , Rejected
+ * 买单为开多 , 卖单为开空 , 带ReduceOnly或Close时为平仓
+ */
+func (mex *Bitmex) toFutureOrder(ordmap map[string]interface{}) *FutureOrder {
+	ord := &FutureOrder{
+		OrderID2:     toString(ordmap["orderID"]),
+		Price:        ToFloat64(ordmap["price"]),
+		Amount:       ToFloat64(ordmap["orderQty"]),
+		AvgPrice:     ToFloat64(ordmap["avgPx"]),
+		DealAmount:   ToFloat64(ordmap["cumQty"]),
+		OrderTime:    parseTime(ordmap["transactTime"]).UnixNano() / int64(time.Millisecond),
+		ContractName: toString(ordmap["symbol"]),
+		Status:       adaptOrderStatus(toString(ordmap["ordStatus"]))}
+
+	execInst := toString(ordmap["execInst"])
+	closing := strings.Contains(execInst, EXEC_INST_REDUCE_ONLY) || strings.Contains(execInst, EXEC_INST_CLOSE)
+	switch toString(ordmap["side"]) {
+	case "Buy":
+		ord.OType = OPEN_BUY
+		if closing {
+			ord.OType = CLOSE_SELL
+		}
+	case "Sell":
+		ord.OType = OPEN_SELL
+		if closing {
+			ord.OType = CLOSE_BUY
+		}
+	}
+	return ord
+}
+
+func adaptOrderStatus(status string) TradeStatus {
+	switch status {
+	case "PartiallyFilled":
+		return ORDER_PART_FINISH
+	case "Filled":
+		return ORDER_FINISH
+	case "Canceled":
+		return ORDER_CANCEL
+	case "Rejected":
+		return ORDER_REJECT
+	case "PendingCancel":
+		return ORDER_CANCEL_ING
+	default:
+		return ORDER_UNFINISH
+	}
+}
+
+func toFuturePosition(pos map[string]interface{}) *FuturePosition {
+	p := &FuturePosition{
+		ContractType:   toString(pos["symbol"]),
+		LeverRate:      int(ToFloat64(pos["leverage"])),
+		CreateDate:     parseTime(pos["openingTimestamp"]).UnixNano() / int64(time.Millisecond),
+		ForceLiquPrice: ToFloat64(pos["liquidationPrice"])}
+
+	qty := ToFloat64(pos["currentQty"])
+	profit := ToFloat64(pos["realisedPnl"]) / _SATOSHI
+	cost := ToFloat64(pos["posCost"]) / _SATOSHI
+	if qty >= 0 {
+		p.BuyAmount = qty
+		p.BuyAvailable = qty
+		p.BuyPriceAvg = ToFloat64(pos["avgEntryPrice"])
+		p.BuyPriceCost = cost
+		p.BuyProfitReal = profit
+	} else {
+		p.SellAmount = -qty
+		p.SellAvailable = -qty
+		p.SellPriceAvg = ToFloat64(pos["avgEntryPrice"])
+		p.SellPriceCost = cost
+		p.SellProfitReal = profit
+	}
+	return p
+}
+
+//{"timestamp", "symbol", "side":"Buy/Sell", "size", "price", "trdMatchID"}
+func parseTrade(t map[string]interface{}, pair CurrencyPair) *Trade {
+	trade := &Trade{
+		Pair:   pair,
+		Amount: ToFloat64(t["size"]),
+		Price:  ToFloat64(t["price"]),
+		Date:   parseTime(t["timestamp"]).UnixNano() / int64(time.Millisecond),
+		Type:   SELL}
+	if toString(t["side"]) == "Buy" {
+		trade.Type = BUY
+	}
+	return trade
+}
+
+//XBt的单位是聪
+func adaptCurrency(currency string) (Currency, float64) {
+	if currency == "XBt" {
+		return BTC, _SATOSHI
+	}
+	return NewCurrency(currency, ""), 1
+}
+
+func parseTime(v interface{}) time.Time {
+	t, _ := time.Parse(time.RFC3339, toString(v))
+	return t
+}
+
+func toString(v interface{}) string {
+	s, _ := v.(string)
+	return s
 }
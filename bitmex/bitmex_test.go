@@ -30,3 +30,41 @@ func TestBitmex_GetDepth(t *testing.T) {
 	assert.Nil(t, err)
 	t.Log(dep)
 }
+
+func TestBitmex_sign(t *testing.T) {
+	ex := New(http.DefaultClient, "LAqUlngMIQkIUjXMUreyu3qn", "chNOOS4KvNXR_Xq4k4c9qsfoKWvnDecLATCRlcBwyKDYnWgO")
+	sign, _ := ex.sign("GET", "/api/v1/instrument", "1518064236", "")
+	assert.Equal(t, "c7682d435d0cfe87c16098df34ef2eb5a549d4c5a3c2b1f0f77b8af73423bf00", sign)
+}
+
+func TestBitmex_symbol(t *testing.T) {
+	symbol, _ := mex.symbol(goex.BTC_USD, PERPETUAL_CONTRACT)
+	assert.Equal(t, "XBTUSD", symbol)
+	symbol, _ = mex.symbol(goex.BTC_USD, "XBTZ19")
+	assert.Equal(t, "XBTZ19", symbol)
+	_, err := mex.symbol(goex.BTC_USD, goex.THIS_WEEK_CONTRACT)
+	assert.NotNil(t, err)
+}
+
+func TestBitmex_toFutureOrder(t *testing.T) {
+	ord := mex.toFutureOrder(map[string]interface{}{
+		"orderID":      "b7a5fd39-0b3a-4c1a-8b7a-8b4e8e2e3c3d",
+		"symbol":       "XBTUSD",
+		"side":         "Sell",
+		"price":        8000.5,
+		"orderQty":     100.0,
+		"cumQty":       40.0,
+		"avgPx":        8000.5,
+		"execInst":     "ParticipateDoNotInitiate,ReduceOnly",
+		"ordStatus":    "PartiallyFilled",
+		"transactTime": "2019-10-01T12:00:00.123Z"})
+	assert.Equal(t, goex.CLOSE_BUY, ord.OType)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_PART_FINISH), ord.Status)
+	assert.Equal(t, 40.0, ord.DealAmount)
+	assert.Equal(t, int64(1569931200123), ord.OrderTime)
+
+	pos := toFuturePosition(map[string]interface{}{"symbol": "XBTUSD", "currentQty": -200.0, "avgEntryPrice": 8100.0, "leverage": 10.0, "realisedPnl": 1000000.0})
+	assert.Equal(t, 200.0, pos.SellAmount)
+	assert.Equal(t, 0.01, pos.SellProfitReal)
+	assert.Equal(t, 10, pos.LeverRate)
+}
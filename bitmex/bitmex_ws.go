@@ -0,0 +1,728 @@
+package bitmex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	_WS_AUTH_CHANNEL = "authKeyExpires"
+	_WS_BOOK_SIZE    = 25 //orderBookL2_25的档数
+)
+
+var _WS_BIN_DURATION = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+/**
+ * 合约行情 , 推送只包含变化的字段 , 回调的是合并后的完整数据
+ */
+type Instrument struct {
+	Symbol                string  `json:"symbol"`
+	State                 string  `json:"state"`
+	LastPrice             float64 `json:"lastPrice"`
+	BidPrice              float64 `json:"bidPrice"`
+	AskPrice              float64 `json:"askPrice"`
+	HighPrice             float64 `json:"highPrice"`
+	LowPrice              float64 `json:"lowPrice"`
+	MarkPrice             float64 `json:"markPrice"`
+	IndicativeSettlePrice float64 `json:"indicativeSettlePrice"`
+	FundingRate           float64 `json:"fundingRate"`
+	IndicativeFundingRate float64 `json:"indicativeFundingRate"`
+	OpenInterest          float64 `json:"openInterest"`
+	Volume24h             float64 `json:"volume24h"`
+	Timestamp             string  `json:"timestamp"`
+}
+
+/**
+ * 成交回报 , ExecType: New , Trade , Canceled , Replaced , Funding , Settlement
+ * Commission为费率 , ExecComm为本次手续费(XBt)
+ */
+type Execution struct {
+	ExecID     string  `json:"execID"`
+	OrderID    string  `json:"orderID"`
+	ClOrdID    string  `json:"clOrdID"`
+	Symbol     string  `json:"symbol"`
+	Side       string  `json:"side"`
+	OrdType    string  `json:"ordType"`
+	ExecInst   string  `json:"execInst"`
+	ExecType   string  `json:"execType"`
+	OrdStatus  string  `json:"ordStatus"`
+	Price      float64 `json:"price"`
+	OrderQty   float64 `json:"orderQty"`
+	LastPx     float64 `json:"lastPx"`
+	LastQty    float64 `json:"lastQty"`
+	CumQty     float64 `json:"cumQty"`
+	LeavesQty  float64 `json:"leavesQty"`
+	AvgPx      float64 `json:"avgPx"`
+	Commission float64 `json:"commission"`
+	ExecComm   float64 `json:"execComm"`
+	Timestamp  string  `json:"timestamp"`
+}
+
+type wsAuthHandlers struct {
+	execution func(*Execution)
+	position  func(*FuturePosition)
+}
+
+//orderBookL2的更新和删除只带id , 价格从全量里记录的id查找
+type wsBook struct {
+	table  string
+	book   *OrderBook
+	prices map[int64]float64
+	size   int
+}
+
+type wsL2Row struct {
+	Symbol string  `json:"symbol"`
+	Id     int64   `json:"id"`
+	Side   string  `json:"side"`
+	Size   float64 `json:"size"`
+	Price  float64 `json:"price"`
+}
+
+type wsMessage struct {
+	Success   bool   `json:"success"`
+	Subscribe string `json:"subscribe"`
+	Error     string `json:"error"`
+	Request   struct {
+		Op   string        `json:"op"`
+		Args []interface{} `json:"args"`
+	} `json:"request"`
+	Table  string            `json:"table"`
+	Action string            `json:"action"`
+	Filter map[string]string `json:"filter"`
+	Data   []json.RawMessage `json:"data"`
+}
+
+//每次发送时重新签名 , 重连后重新认证不会因为过期失败
+type wsAuthRequest struct {
+	mex *Bitmex
+}
+
+func (r wsAuthRequest) MarshalJSON() ([]byte, error) {
+	expires := time.Now().Unix() + _REQUEST_EXPIRES
+	sign, err := r.mex.sign("GET", "/realtime", fmt.Sprint(expires), "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"op":   _WS_AUTH_CHANNEL,
+		"args": []interface{}{r.mex.accessKey, expires, sign}})
+}
+
+//每个连接最多订阅n个频道 , 超过后新建连接 , 默认不限制
+func (mex *Bitmex) WsMaxSubsPerConn(n int) *Bitmex {
+	mex.createWsLock.Lock()
+	defer mex.createWsLock.Unlock()
+	mex.wsMaxSubs = n
+	return mex
+}
+
+//连接在第一次订阅时建立
+func (mex *Bitmex) wsConns() *WsShards {
+	mex.createWsLock.Lock()
+	defer mex.createWsLock.Unlock()
+
+	if mex.wsShards == nil {
+		mex.wsShards = NewWsShards(mex.wsMaxSubs, mex.dialWs)
+	}
+	return mex.wsShards
+}
+
+func (mex *Bitmex) wsUrl() string {
+	return strings.Replace(mex.baseUrl, "https://", "wss://", 1) + "/realtime"
+}
+
+//5秒没有消息时发送ping , 服务端返回pong
+func (mex *Bitmex) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn(mex.wsUrl())
+	if err != nil {
+		return nil, err
+	}
+	ws.Heartbeat(func() interface{} { return []byte("ping") }, 5*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		mex.handleWsMessage(ws, msg)
+	})
+	return ws, nil
+}
+
+/**
+ * 订阅回执: {"success":true,"subscribe":"trade:XBTUSD"}
+ * 认证回执: {"success":true,"request":{"op":"authKeyExpires"}}
+ * 错误: {"status":400,"error":"...","request":{"op":"subscribe","args":["trade:XBTUSD"]}}
+ * 数据: {"table":"trade","action":"partial/insert/update/delete","data":[...]}
+ */
+func (mex *Bitmex) handleWsMessage(ws *WsConn, msg []byte) {
+	ws.UpdateActivedTime()
+	if string(msg) == "pong" {
+		return
+	}
+
+	var resp wsMessage
+	err := json.Unmarshal(msg, &resp)
+	if err != nil {
+		log.Println("json unmarshal error for ", string(msg))
+		return
+	}
+
+	switch {
+	case resp.Error != "":
+		err := errors.New(resp.Error)
+		if resp.Request.Op == _WS_AUTH_CHANNEL {
+			ws.FailSubscribe(_WS_AUTH_CHANNEL, err)
+			return
+		}
+		for _, arg := range resp.Request.Args {
+			if channel, isok := arg.(string); isok {
+				ws.FailSubscribe(channel, err)
+			}
+		}
+	case resp.Success:
+		if resp.Request.Op == _WS_AUTH_CHANNEL {
+			ws.AckSubscribe(_WS_AUTH_CHANNEL)
+		} else if resp.Subscribe != "" {
+			ws.AckSubscribe(resp.Subscribe)
+		}
+	case resp.Table != "":
+		mex.handleWsTable(&resp)
+	}
+}
+
+func (mex *Bitmex) handleWsTable(resp *wsMessage) {
+	switch {
+	case strings.HasPrefix(resp.Table, "orderBookL2"):
+		mex.handleWsBook(resp)
+	case strings.HasPrefix(resp.Table, "tradeBin"):
+		mex.handleWsKline(resp)
+	case resp.Table == "trade":
+		mex.handleWsTrade(resp)
+	case resp.Table == "instrument":
+		mex.handleWsInstrument(resp)
+	case resp.Table == "execution":
+		mex.handleWsExecution(resp)
+	case resp.Table == "position":
+		mex.handleWsPosition(resp)
+	}
+}
+
+/**
+ * partial为全量 , 之前收到的增量丢弃
+ * insert带价格和数量 , update带新的数量 , delete表示删除
+ */
+func (mex *Bitmex) handleWsBook(resp *wsMessage) {
+	var rows []wsL2Row
+	for _, raw := range resp.Data {
+		var row wsL2Row
+		if json.Unmarshal(raw, &row) == nil {
+			rows = append(rows, row)
+		}
+	}
+
+	symbol := resp.Filter["symbol"]
+	if symbol == "" && len(rows) > 0 {
+		symbol = rows[0].Symbol
+	}
+
+	mex.wsLock.Lock()
+	b := mex.wsBooks[symbol]
+	if b == nil || b.table != resp.Table {
+		mex.wsLock.Unlock()
+		return
+	}
+
+	var err error
+	switch resp.Action {
+	case "partial":
+		dep := &Depth{}
+		b.prices = make(map[int64]float64, len(rows))
+		for _, row := range rows {
+			b.prices[row.Id] = row.Price
+			record := DepthRecord{Price: row.Price, Amount: row.Size}
+			if row.Side == "Sell" {
+				dep.AskList = append(dep.AskList, record)
+			} else {
+				dep.BidList = append(dep.BidList, record)
+			}
+		}
+		b.book.Snapshot(dep, 0)
+	case "insert", "update", "delete":
+		update := &DepthUpdate{}
+		for _, row := range rows {
+			price := row.Price
+			if price == 0 {
+				price = b.prices[row.Id]
+			}
+			if price == 0 {
+				continue
+			}
+
+			size := row.Size
+			if resp.Action == "delete" {
+				size = 0
+				delete(b.prices, row.Id)
+			} else {
+				b.prices[row.Id] = price
+			}
+
+			record := DepthRecord{Price: price, Amount: size}
+			if row.Side == "Sell" {
+				update.AskList = append(update.AskList, record)
+			} else {
+				update.BidList = append(update.BidList, record)
+			}
+		}
+		err = b.book.Update(update)
+	}
+	dep := b.book.Depth(b.size)
+	mex.wsLock.Unlock()
+
+	//全量到达之前的增量不回调
+	if err != nil {
+		return
+	}
+	dep.ContractType = symbol
+	if handle := mex.wsHandlers.Depth(resp.Table + ":" + symbol); handle != nil {
+		handle(dep)
+	}
+}
+
+//partial是最近的一笔成交 , 只推送insert
+func (mex *Bitmex) handleWsTrade(resp *wsMessage) {
+	if resp.Action != "insert" {
+		return
+	}
+	for _, raw := range resp.Data {
+		var t map[string]interface{}
+		if json.Unmarshal(raw, &t) != nil {
+			continue
+		}
+		if handle := mex.wsHandlers.Trade("trade:" + toString(t["symbol"])); handle != nil {
+			handle(parseTrade(t, CurrencyPair{}))
+		}
+	}
+}
+
+//{"timestamp"(收盘时间), "symbol", "open", "high", "low", "close", "volume"}
+func (mex *Bitmex) handleWsKline(resp *wsMessage) {
+	if resp.Action != "insert" {
+		return
+	}
+	duration := _WS_BIN_DURATION[strings.TrimPrefix(resp.Table, "tradeBin")]
+	for _, raw := range resp.Data {
+		var b map[string]interface{}
+		if json.Unmarshal(raw, &b) != nil {
+			continue
+		}
+		if handle := mex.wsHandlers.Kline(resp.Table + ":" + toString(b["symbol"])); handle != nil {
+			handle(&Kline{
+				Timestamp: parseTime(b["timestamp"]).Add(-duration).Unix(),
+				Open:      ToFloat64(b["open"]),
+				Close:     ToFloat64(b["close"]),
+				High:      ToFloat64(b["high"]),
+				Low:       ToFloat64(b["low"]),
+				Vol:       ToFloat64(b["volume"])})
+		}
+	}
+}
+
+func (mex *Bitmex) handleWsInstrument(resp *wsMessage) {
+	for _, raw := range resp.Data {
+		var row struct {
+			Symbol string `json:"symbol"`
+		}
+		if json.Unmarshal(raw, &row) != nil {
+			continue
+		}
+
+		mex.wsLock.Lock()
+		inst := mex.wsInstruments[row.Symbol]
+		if inst == nil || resp.Action == "partial" {
+			inst = &Instrument{}
+			mex.wsInstruments[row.Symbol] = inst
+		}
+		json.Unmarshal(raw, inst)
+		merged := *inst
+		handle := mex.wsInstHandles[row.Symbol]
+		mex.wsLock.Unlock()
+
+		if handle != nil {
+			handle(&merged)
+		}
+	}
+}
+
+//partial是最近的成交回报 , 只推送insert
+func (mex *Bitmex) handleWsExecution(resp *wsMessage) {
+	mex.wsLock.Lock()
+	handle := mex.wsAuthHandle.execution
+	mex.wsLock.Unlock()
+	if handle == nil || resp.Action != "insert" {
+		return
+	}
+
+	for _, raw := range resp.Data {
+		var exec Execution
+		if json.Unmarshal(raw, &exec) == nil {
+			handle(&exec)
+		}
+	}
+}
+
+//update只带变化的字段 , 按合约合并后回调
+func (mex *Bitmex) handleWsPosition(resp *wsMessage) {
+	var positions []*FuturePosition
+
+	mex.wsLock.Lock()
+	handle := mex.wsAuthHandle.position
+	if resp.Action == "partial" {
+		mex.wsPositions = make(map[string]map[string]interface{})
+	}
+	for _, raw := range resp.Data {
+		var row map[string]interface{}
+		if json.Unmarshal(raw, &row) != nil {
+			continue
+		}
+		symbol := toString(row["symbol"])
+		pos := mex.wsPositions[symbol]
+		if pos == nil {
+			pos = make(map[string]interface{})
+			mex.wsPositions[symbol] = pos
+		}
+		for k, v := range row {
+			pos[k] = v
+		}
+		if resp.Action == "delete" {
+			delete(mex.wsPositions, symbol)
+		}
+		positions = append(positions, toFuturePosition(pos))
+	}
+	mex.wsLock.Unlock()
+
+	if handle == nil {
+		return
+	}
+	for _, pos := range positions {
+		handle(pos)
+	}
+}
+
+func (mex *Bitmex) subscribe(channel string) error {
+	return mex.wsConns().SubscribeChannel(channel, wsSubscribeRequest("subscribe", channel), wsSubscribeRequest("unsubscribe", channel))
+}
+
+func (mex *Bitmex) unsubscribe(channel string) error {
+	return mex.wsConns().UnsubscribeChannel(channel)
+}
+
+func wsSubscribeRequest(op, channel string) map[string]interface{} {
+	return map[string]interface{}{"op": op, "args": []string{channel}}
+}
+
+/**
+ * 深度 , size<=25时订阅orderBookL2_25 , 否则订阅全量的orderBookL2 , 回调前size档
+ * 同一个合约只能订阅一种深度
+ */
+func (mex *Bitmex) SubscribeBook(symbol string, size int, handle func(dep *Depth)) error {
+	table := "orderBookL2"
+	if size <= _WS_BOOK_SIZE {
+		table = "orderBookL2_25"
+	}
+
+	mex.wsLock.Lock()
+	if b, isok := mex.wsBooks[symbol]; isok && b.table != table {
+		mex.wsLock.Unlock()
+		return errors.New("already subscribe " + b.table + ":" + symbol)
+	}
+	mex.wsBooks[symbol] = &wsBook{table: table, book: NewOrderBook(CurrencyPair{}), prices: make(map[int64]float64), size: size}
+	mex.wsLock.Unlock()
+
+	channel := table + ":" + symbol
+	mex.wsHandlers.SetDepth(channel, handle)
+	return mex.subscribe(channel)
+}
+
+func (mex *Bitmex) UnsubscribeBook(symbol string) error {
+	mex.wsLock.Lock()
+	b, isok := mex.wsBooks[symbol]
+	delete(mex.wsBooks, symbol)
+	mex.wsLock.Unlock()
+	if !isok {
+		return nil
+	}
+
+	channel := b.table + ":" + symbol
+	mex.wsHandlers.Remove(channel)
+	return mex.unsubscribe(channel)
+}
+
+func (mex *Bitmex) SubscribeTrades(symbol string, handle func(trade *Trade)) error {
+	mex.wsHandlers.SetTrade("trade:"+symbol, handle)
+	return mex.subscribe("trade:" + symbol)
+}
+
+func (mex *Bitmex) UnsubscribeTrades(symbol string) error {
+	mex.wsHandlers.Remove("trade:" + symbol)
+	return mex.unsubscribe("trade:" + symbol)
+}
+
+//合约信息 , 包括最新价 , 标记价格 , 资金费率和持仓量 , 每个合约只有一个回调
+func (mex *Bitmex) SubscribeInstrument(symbol string, handle func(inst *Instrument)) error {
+	mex.wsLock.Lock()
+	mex.wsInstHandles[symbol] = handle
+	mex.wsLock.Unlock()
+	return mex.subscribe("instrument:" + symbol)
+}
+
+func (mex *Bitmex) UnsubscribeInstrument(symbol string) error {
+	mex.wsLock.Lock()
+	delete(mex.wsInstHandles, symbol)
+	delete(mex.wsInstruments, symbol)
+	mex.wsLock.Unlock()
+	return mex.unsubscribe("instrument:" + symbol)
+}
+
+//binSize: 1m , 5m , 1h , 1d , 只推送已收盘的k线
+func (mex *Bitmex) SubscribeTradeBin(symbol, binSize string, handle func(kline *Kline)) error {
+	if _, isok := _WS_BIN_DURATION[binSize]; !isok {
+		return ErrKlinePeriodNotSupport
+	}
+	channel := "tradeBin" + binSize + ":" + symbol
+	mex.wsHandlers.SetKline(channel, handle)
+	return mex.subscribe(channel)
+}
+
+func (mex *Bitmex) UnsubscribeTradeBin(symbol, binSize string) error {
+	channel := "tradeBin" + binSize + ":" + symbol
+	mex.wsHandlers.Remove(channel)
+	return mex.unsubscribe(channel)
+}
+
+//私有频道的连接在第一次订阅时建立 , 先认证再订阅
+func (mex *Bitmex) authConn() (*WsConn, error) {
+	mex.createWsLock.Lock()
+	defer mex.createWsLock.Unlock()
+
+	mex.wsLock.Lock()
+	auth := mex.wsAuth
+	handles := append([]func(string, error){}, mex.wsSubErrHandles...)
+	mex.wsLock.Unlock()
+	if auth != nil {
+		return auth, nil
+	}
+
+	ws, err := mex.dialWs()
+	if err != nil {
+		return nil, err
+	}
+	for _, handle := range handles {
+		ws.OnSubscribeError(handle)
+	}
+	//认证作为第一个订阅 , 重连后先于私有频道重发
+	err = ws.SubscribeChannel(_WS_AUTH_CHANNEL, wsAuthRequest{mex}, nil)
+	if err != nil {
+		ws.CloseWs()
+		return nil, err
+	}
+
+	mex.wsLock.Lock()
+	mex.wsAuth = ws
+	mex.wsLock.Unlock()
+	return ws, nil
+}
+
+func (mex *Bitmex) subscribePrivate(table string) error {
+	ws, err := mex.authConn()
+	if err != nil {
+		return err
+	}
+	return ws.SubscribeChannel(table, wsSubscribeRequest("subscribe", table), wsSubscribeRequest("unsubscribe", table))
+}
+
+func (mex *Bitmex) unsubscribePrivate(table string) error {
+	mex.wsLock.Lock()
+	auth := mex.wsAuth
+	mex.wsLock.Unlock()
+	if auth == nil {
+		return nil
+	}
+	return auth.UnsubscribeChannel(table)
+}
+
+//成交回报 , 包括下单 , 撤单 , 成交和资金费用
+func (mex *Bitmex) SubscribeExecution(handle func(exec *Execution)) error {
+	mex.wsLock.Lock()
+	mex.wsAuthHandle.execution = handle
+	mex.wsLock.Unlock()
+	return mex.subscribePrivate("execution")
+}
+
+func (mex *Bitmex) UnsubscribeExecution() error {
+	return mex.unsubscribePrivate("execution")
+}
+
+//仓位变化 , ContractType为合约代码
+func (mex *Bitmex) SubscribePosition(handle func(pos *FuturePosition)) error {
+	mex.wsLock.Lock()
+	mex.wsAuthHandle.position = handle
+	mex.wsLock.Unlock()
+	return mex.subscribePrivate("position")
+}
+
+func (mex *Bitmex) UnsubscribePosition() error {
+	return mex.unsubscribePrivate("position")
+}
+
+func (mex *Bitmex) OnSubscribeError(handle func(channel string, err error)) {
+	mex.wsLock.Lock()
+	mex.wsSubErrHandles = append(mex.wsSubErrHandles, handle)
+	auth := mex.wsAuth
+	mex.wsLock.Unlock()
+
+	mex.wsConns().OnSubscribeError(handle)
+	if auth != nil {
+		auth.OnSubscribeError(handle)
+	}
+}
+
+//关闭所有websocket连接
+func (mex *Bitmex) CloseWs() {
+	mex.wsConns().CloseWs()
+
+	mex.wsLock.Lock()
+	auth := mex.wsAuth
+	mex.wsAuth = nil
+	mex.wsBooks = make(map[string]*wsBook)
+	mex.wsInstruments = make(map[string]*Instrument)
+	mex.wsPositions = make(map[string]map[string]interface{})
+	mex.wsLock.Unlock()
+
+	if auth != nil {
+		auth.CloseWs()
+	}
+}
+
+/**
+ * 固定合约类型的StreamingAPI , 多个合约类型共用同一组连接
+ * mex.Stream(PERPETUAL_CONTRACT).SubscribeDepth(BTC_USD, handle)
+ */
+type BitmexStream struct {
+	mex          *Bitmex
+	contractType string
+}
+
+func (mex *Bitmex) Stream(contractType string) *BitmexStream {
+	return &BitmexStream{mex: mex, contractType: contractType}
+}
+
+func (s *BitmexStream) GetExchangeName() string {
+	return BITMEX
+}
+
+func (s *BitmexStream) SubscribeTicker(pair CurrencyPair, handle func(*Ticker)) error {
+	symbol, err := s.mex.symbol(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.mex.SubscribeInstrument(symbol, func(inst *Instrument) {
+		handle(&Ticker{
+			ContractType: symbol,
+			Pair:         pair,
+			Last:         inst.LastPrice,
+			Buy:          inst.BidPrice,
+			Sell:         inst.AskPrice,
+			High:         inst.HighPrice,
+			Low:          inst.LowPrice,
+			Vol:          inst.Volume24h,
+			Date:         uint64(parseTime(inst.Timestamp).Unix())})
+	})
+}
+
+func (s *BitmexStream) UnsubscribeTicker(pair CurrencyPair) error {
+	symbol, err := s.mex.symbol(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.mex.UnsubscribeInstrument(symbol)
+}
+
+//前25档
+func (s *BitmexStream) SubscribeDepth(pair CurrencyPair, handle func(*Depth)) error {
+	symbol, err := s.mex.symbol(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.mex.SubscribeBook(symbol, _WS_BOOK_SIZE, func(dep *Depth) {
+		dep.Pair = pair
+		handle(dep)
+	})
+}
+
+func (s *BitmexStream) UnsubscribeDepth(pair CurrencyPair) error {
+	symbol, err := s.mex.symbol(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.mex.UnsubscribeBook(symbol)
+}
+
+func (s *BitmexStream) SubscribeTrade(pair CurrencyPair, handle func(*Trade)) error {
+	symbol, err := s.mex.symbol(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.mex.SubscribeTrades(symbol, func(trade *Trade) {
+		trade.Pair = pair
+		handle(trade)
+	})
+}
+
+func (s *BitmexStream) UnsubscribeTrade(pair CurrencyPair) error {
+	symbol, err := s.mex.symbol(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.mex.UnsubscribeTrades(symbol)
+}
+
+//只支持1m , 5m , 1h , 1d
+func (s *BitmexStream) SubscribeKline(pair CurrencyPair, period int, handle func(*Kline)) error {
+	binSize, isok := _KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return ErrKlinePeriodNotSupport
+	}
+	symbol, err := s.mex.symbol(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.mex.SubscribeTradeBin(symbol, binSize, func(kline *Kline) {
+		kline.Pair = pair
+		handle(kline)
+	})
+}
+
+func (s *BitmexStream) UnsubscribeKline(pair CurrencyPair, period int) error {
+	binSize, isok := _KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return ErrKlinePeriodNotSupport
+	}
+	symbol, err := s.mex.symbol(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.mex.UnsubscribeTradeBin(symbol, binSize)
+}
+
+func (s *BitmexStream) OnSubscribeError(handle func(channel string, err error)) {
+	s.mex.OnSubscribeError(handle)
+}
@@ -0,0 +1,84 @@
+package bitmex
+
+import (
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestBitmex_WsBook(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	ws := &goex.WsConn{}
+
+	var deps []*goex.Depth
+	ex.wsBooks["XBTUSD"] = &wsBook{table: "orderBookL2_25", book: goex.NewOrderBook(goex.BTC_USD), prices: make(map[int64]float64), size: 25}
+	ex.wsHandlers.SetDepth("orderBookL2_25:XBTUSD", func(dep *goex.Depth) {
+		deps = append(deps, dep)
+	})
+
+	//全量之前的增量丢弃
+	ex.handleWsMessage(ws, []byte(`{"table":"orderBookL2_25","action":"update","data":[{"symbol":"XBTUSD","id":8799199950,"side":"Sell","size":1}]}`))
+	ex.handleWsMessage(ws, []byte(`{"table":"orderBookL2_25","action":"partial","filter":{"symbol":"XBTUSD"},"data":[{"symbol":"XBTUSD","id":8799199950,"side":"Sell","size":100,"price":8000.5},{"symbol":"XBTUSD","id":8799199900,"side":"Sell","size":50,"price":8001},{"symbol":"XBTUSD","id":8799200000,"side":"Buy","size":200,"price":8000}]}`))
+	ex.handleWsMessage(ws, []byte(`{"table":"orderBookL2_25","action":"update","data":[{"symbol":"XBTUSD","id":8799199950,"side":"Sell","size":70}]}`))
+	ex.handleWsMessage(ws, []byte(`{"table":"orderBookL2_25","action":"delete","data":[{"symbol":"XBTUSD","id":8799200000,"side":"Buy"}]}`))
+	ex.handleWsMessage(ws, []byte(`{"table":"orderBookL2_25","action":"insert","data":[{"symbol":"XBTUSD","id":8799200050,"side":"Buy","size":30,"price":7999.5}]}`))
+
+	assert.Equal(t, 4, len(deps))
+	dep := deps[3]
+	assert.Equal(t, "XBTUSD", dep.ContractType)
+	assert.Equal(t, goex.DepthRecords{{Price: 8000.5, Amount: 70}, {Price: 8001, Amount: 50}}, dep.AskList)
+	assert.Equal(t, goex.DepthRecords{{Price: 7999.5, Amount: 30}}, dep.BidList)
+}
+
+func TestBitmex_WsInstrument(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	var insts []*Instrument
+	ex.wsInstHandles["XBTUSD"] = func(inst *Instrument) {
+		insts = append(insts, inst)
+	}
+
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`{"table":"instrument","action":"partial","data":[{"symbol":"XBTUSD","state":"Open","lastPrice":8000,"markPrice":8001.2,"fundingRate":0.0001}]}`))
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`{"table":"instrument","action":"update","data":[{"symbol":"XBTUSD","lastPrice":8002.5,"timestamp":"2019-10-01T12:00:00.000Z"}]}`))
+
+	assert.Equal(t, 2, len(insts))
+	assert.Equal(t, 8002.5, insts[1].LastPrice)
+	assert.Equal(t, 8001.2, insts[1].MarkPrice)
+	assert.Equal(t, 0.0001, insts[1].FundingRate)
+	assert.Equal(t, 8000.0, insts[0].LastPrice)
+}
+
+func TestBitmex_WsPrivate(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	var execs []*Execution
+	var positions []*goex.FuturePosition
+	ex.wsAuthHandle.execution = func(exec *Execution) {
+		execs = append(execs, exec)
+	}
+	ex.wsAuthHandle.position = func(pos *goex.FuturePosition) {
+		positions = append(positions, pos)
+	}
+
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`{"table":"execution","action":"partial","data":[{"execID":"1","symbol":"XBTUSD"}]}`))
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`{"table":"execution","action":"insert","data":[{"execID":"2","orderID":"abc","symbol":"XBTUSD","side":"Buy","execType":"Trade","ordStatus":"Filled","lastPx":8000,"lastQty":100,"execComm":-937}]}`))
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`{"table":"position","action":"partial","data":[{"symbol":"XBTUSD","currentQty":0,"leverage":5}]}`))
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`{"table":"position","action":"update","data":[{"symbol":"XBTUSD","currentQty":100,"avgEntryPrice":8000}]}`))
+
+	assert.Equal(t, 1, len(execs))
+	assert.Equal(t, "abc", execs[0].OrderID)
+	assert.Equal(t, 100.0, execs[0].LastQty)
+
+	assert.Equal(t, 2, len(positions))
+	assert.Equal(t, 100.0, positions[1].BuyAmount)
+	assert.Equal(t, 8000.0, positions[1].BuyPriceAvg)
+	assert.Equal(t, 5, positions[1].LeverRate)
+	assert.Equal(t, "XBTUSD", positions[1].ContractType)
+}
+
+func TestBitmex_wsAuthRequest(t *testing.T) {
+	ex := New(http.DefaultClient, "key", "secret")
+	data, err := wsAuthRequest{ex}.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"op":"authKeyExpires"`)
+	assert.Equal(t, "wss://testnet.bitmex.com/realtime", New(http.DefaultClient, "", "").Testnet().wsUrl())
+}
@@ -24,14 +24,14 @@ type Bitstamp struct {
 	clientId,
 	accessKey,
 	secretkey string
-	ws                *WsConn
-	createWsLock      sync.Mutex
-	wsTickerHandleMap map[string]func(*Ticker)
-	wsDepthHandleMap  map[string]func(*Depth)
+	wsShards     *WsShards
+	wsMaxSubs    int
+	createWsLock sync.Mutex
+	wsHandlers   *WsHandlers
 }
 
 func NewBitstamp(client *http.Client, accessKey, secertkey, clientId string) *Bitstamp {
-	return &Bitstamp{client: client, accessKey: accessKey, secretkey: secertkey, clientId: clientId}
+	return &Bitstamp{client: client, accessKey: accessKey, secretkey: secertkey, clientId: clientId, wsHandlers: NewWsHandlers()}
 }
 
 func (bitstamp *Bitstamp) buildPostForm(params *url.Values) {
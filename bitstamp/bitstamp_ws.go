@@ -16,58 +16,161 @@ type Event struct {
 	Data    interface{} `json:"data"`
 }
 
-func (bm *Bitstamp) createWsConn() {
-	if bm.ws != nil {
-		return
-	}
+//每个连接最多订阅n个频道 , 超过后新建连接 , 默认不限制
+func (bm *Bitstamp) WsMaxSubsPerConn(n int) *Bitstamp {
+	bm.createWsLock.Lock()
+	defer bm.createWsLock.Unlock()
+	bm.wsMaxSubs = n
+	return bm
+}
 
-	//connect wsx
+//连接在第一次订阅时建立
+func (bm *Bitstamp) wsConns() *goex.WsShards {
 	bm.createWsLock.Lock()
 	defer bm.createWsLock.Unlock()
 
-	if bm.ws == nil {
-		bm.wsDepthHandleMap = make(map[string]func(*goex.Depth), 1)
-		bm.wsTickerHandleMap = make(map[string]func(*goex.Ticker), 1)
-
-		bm.ws = goex.NewWsConn("wss://ws.pusherapp.com/app/de504dc5763aeef9ff52?protocol=7&client=js&version=2.1.6&flash=false")
-		bm.ws.Heartbeat(func() interface{} { return Event{Event: "pusher:ping"} }, 10*time.Second)
-		bm.ws.ReConnect()
-		bm.ws.ReceiveMessage(func(msg []byte) {
-			var e Event
-			err := json.Unmarshal(msg, &e)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			switch e.Event {
-			case "pusher:pong":
-				bm.ws.UpdateActivedTime()
-			case "data":
-				pair := bm.getPairFromChannel(e.Channel)
-				dep := bm.parseDepth(e.Data.(string))
-				dep.Pair = pair
-				if strings.HasPrefix(e.Channel, "order_book") {
-					bm.wsDepthHandleMap[e.Channel](dep)
-				}
-			default:
-				log.Printf("%+v", e)
-			}
-		})
+	if bm.wsShards == nil {
+		bm.wsShards = goex.NewWsShards(bm.wsMaxSubs, bm.dialWs)
 	}
+	return bm.wsShards
 }
 
-func (bm *Bitstamp) GetDepthWithWs(pair goex.CurrencyPair, handle func(*goex.Depth)) error {
-	bm.createWsConn()
-	channel := fmt.Sprintf("order_book_%s", strings.ToLower(pair.ToSymbol("")))
+func (bm *Bitstamp) dialWs() (*goex.WsConn, error) {
+	ws, err := goex.NewWsConn("wss://ws.pusherapp.com/app/de504dc5763aeef9ff52?protocol=7&client=js&version=2.1.6&flash=false")
+	if err != nil {
+		return nil, err
+	}
+	ws.Heartbeat(func() interface{} { return Event{Event: "pusher:ping"} }, 10*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		bm.handleWsMessage(ws, msg)
+	})
+	return ws, nil
+}
+
+func (bm *Bitstamp) handleWsMessage(ws *goex.WsConn, msg []byte) {
+	var e Event
+	err := json.Unmarshal(msg, &e)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	switch e.Event {
+	case "pusher:pong":
+		ws.UpdateActivedTime()
+	case "data":
+		pair := bm.getPairFromChannel(e.Channel)
+		dep := bm.parseDepth(e.Data.(string))
+		dep.Pair = pair
+		if handle := bm.wsHandlers.Depth(e.Channel); handle != nil && strings.HasPrefix(e.Channel, "order_book") {
+			handle(dep)
+		}
+	case "trade":
+		trade := bm.parseWsTrade(e.Data.(string))
+		trade.Pair = bm.getPairFromChannel(e.Channel)
+		if handle := bm.wsHandlers.Trade(e.Channel); handle != nil {
+			handle(trade)
+		}
+	case "pusher_internal:subscription_succeeded":
+		ws.AckSubscribe(e.Channel)
+	case "pusher:connection_established":
+	default:
+		log.Printf("%+v", e)
+	}
+}
+
+func (bm *Bitstamp) channel(prefix string, pair goex.CurrencyPair) string {
 	if pair == goex.BTC_USD {
-		channel = "order_book"
+		return prefix
 	}
-	bm.wsDepthHandleMap[channel] = handle
-	e := &Event{
+	return fmt.Sprintf("%s_%s", prefix, strings.ToLower(pair.ToSymbol("")))
+}
+
+func (bm *Bitstamp) subscribe(channel string) error {
+	return bm.wsConns().SubscribeChannel(channel, &Event{
 		Event: "pusher:subscribe",
 		Data: map[string]interface{}{
-			"channel": channel}}
-	return bm.ws.Subscribe(e)
+			"channel": channel}}, &Event{
+		Event: "pusher:unsubscribe",
+		Data: map[string]interface{}{
+			"channel": channel}})
+}
+
+func (bm *Bitstamp) unsubscribe(channel string) error {
+	bm.wsHandlers.Remove(channel)
+	return bm.wsConns().UnsubscribeChannel(channel)
+}
+
+func (bm *Bitstamp) GetDepthWithWs(pair goex.CurrencyPair, handle func(*goex.Depth)) error {
+	return bm.SubscribeDepth(pair, handle)
+}
+
+func (bm *Bitstamp) SubscribeDepth(pair goex.CurrencyPair, handle func(*goex.Depth)) error {
+	channel := bm.channel("order_book", pair)
+	bm.wsHandlers.SetDepth(channel, handle)
+	return bm.subscribe(channel)
+}
+
+func (bm *Bitstamp) UnsubscribeDepth(pair goex.CurrencyPair) error {
+	return bm.unsubscribe(bm.channel("order_book", pair))
+}
+
+func (bm *Bitstamp) SubscribeTrade(pair goex.CurrencyPair, handle func(*goex.Trade)) error {
+	channel := bm.channel("live_trades", pair)
+	bm.wsHandlers.SetTrade(channel, handle)
+	return bm.subscribe(channel)
+}
+
+func (bm *Bitstamp) UnsubscribeTrade(pair goex.CurrencyPair) error {
+	return bm.unsubscribe(bm.channel("live_trades", pair))
+}
+
+func (bm *Bitstamp) OnSubscribeError(handle func(channel string, err error)) {
+	bm.wsConns().OnSubscribeError(handle)
+}
+
+//关闭所有websocket连接
+func (bm *Bitstamp) CloseWs() {
+	bm.wsConns().CloseWs()
+}
+
+//pusher没有ticker和k线频道
+func (bm *Bitstamp) SubscribeTicker(pair goex.CurrencyPair, handle func(*goex.Ticker)) error {
+	return goex.ErrStreamNotSupport
+}
+
+func (bm *Bitstamp) UnsubscribeTicker(pair goex.CurrencyPair) error {
+	return goex.ErrStreamNotSupport
+}
+
+func (bm *Bitstamp) SubscribeKline(pair goex.CurrencyPair, period int, handle func(*goex.Kline)) error {
+	return goex.ErrStreamNotSupport
+}
+
+func (bm *Bitstamp) UnsubscribeKline(pair goex.CurrencyPair, period int) error {
+	return goex.ErrStreamNotSupport
+}
+
+//{"id": 1, "amount": 0.1, "price": 6000, "timestamp": "1540000000", "type": 0}  type: 0买 1卖
+func (bm *Bitstamp) parseWsTrade(data string) *goex.Trade {
+	var trademap map[string]interface{}
+	err := json.Unmarshal([]byte(data), &trademap)
+	if err != nil {
+		log.Println(err)
+		return &goex.Trade{}
+	}
+
+	trade := &goex.Trade{
+		Tid:    int64(goex.ToUint64(trademap["id"])),
+		Amount: goex.ToFloat64(trademap["amount"]),
+		Price:  goex.ToFloat64(trademap["price"]),
+		Date:   int64(goex.ToUint64(trademap["timestamp"])) * 1000,
+		Type:   goex.BUY}
+	if goex.ToInt(trademap["type"]) == 1 {
+		trade.Type = goex.SELL
+	}
+	return trade
 }
 
 func (bm *Bitstamp) parseDepth(dep string) *goex.Depth {
@@ -101,10 +204,10 @@ func (bm *Bitstamp) parseDepth(dep string) *goex.Depth {
 }
 
 func (bm *Bitstamp) getPairFromChannel(channel string) goex.CurrencyPair {
-	if channel == "order_book" {
+	if channel == "order_book" || channel == "live_trades" {
 		return goex.BTC_USD
 	}
 	metas := strings.Split(channel, "_")
-	pairstr := metas[2]
+	pairstr := metas[len(metas)-1]
 	return goex.NewCurrencyPair2(pairstr[0:3] + "_" + pairstr[3:])
 }
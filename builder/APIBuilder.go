@@ -3,17 +3,23 @@ package builder
 import (
 	"context"
 	. "github.com/bxsmart/GoEx"
+	"github.com/bxsmart/GoEx/bigone"
 	"github.com/bxsmart/GoEx/binance"
 	"github.com/bxsmart/GoEx/bitfinex"
 	"github.com/bxsmart/GoEx/bithumb"
+	"github.com/bxsmart/GoEx/bitmex"
 	"github.com/bxsmart/GoEx/bitstamp"
 	"github.com/bxsmart/GoEx/bittrex"
+	"github.com/bxsmart/GoEx/coin58"
 	"github.com/bxsmart/GoEx/coinex"
+	"github.com/bxsmart/GoEx/fcoin"
 	"github.com/bxsmart/GoEx/gateio"
 	"github.com/bxsmart/GoEx/gdax"
+	"github.com/bxsmart/GoEx/hitbtc"
 	"github.com/bxsmart/GoEx/huobi"
 	"github.com/bxsmart/GoEx/kraken"
 	"github.com/bxsmart/GoEx/okcoin"
+	"github.com/bxsmart/GoEx/okex"
 	"github.com/bxsmart/GoEx/poloniex"
 	"github.com/bxsmart/GoEx/wex"
 	"github.com/bxsmart/GoEx/zb"
@@ -21,10 +27,6 @@ import (
 	"net/http"
 	"net/url"
 	"time"
-	"github.com/bxsmart/GoEx/fcoin"
-	"github.com/bxsmart/GoEx/coin58"
-	"github.com/bxsmart/GoEx/bigone"
-	"github.com/bxsmart/GoEx/hitbtc"
 )
 
 type APIBuilder struct {
@@ -33,6 +35,7 @@ type APIBuilder struct {
 	apiKey      string
 	secretkey   string
 	clientId    string
+	passphrase  string
 }
 
 func NewAPIBuilder() (builder *APIBuilder) {
@@ -59,6 +62,12 @@ func (builder *APIBuilder) APISecretkey(key string) (_builder *APIBuilder) {
 	return builder
 }
 
+//coinbase pro的api passphrase
+func (builder *APIBuilder) APIPassphrase(passphrase string) (_builder *APIBuilder) {
+	builder.passphrase = passphrase
+	return builder
+}
+
 func (builder *APIBuilder) HttpProxy(proxyUrl string) (_builder *APIBuilder) {
 	proxy, err := url.Parse(proxyUrl)
 	if err != nil {
@@ -114,7 +123,7 @@ func (builder *APIBuilder) Build(exName string) (api API) {
 	case BITHUMB:
 		_api = bithumb.New(builder.client, builder.apiKey, builder.secretkey)
 	case GDAX:
-		_api = gdax.New(builder.client, builder.apiKey, builder.secretkey)
+		_api = gdax.NewWithConfig(builder.apiConfig())
 	case GATEIO:
 		_api = gateio.New(builder.client, builder.apiKey, builder.secretkey)
 	case WEX_NZ:
@@ -137,3 +146,78 @@ func (builder *APIBuilder) Build(exName string) (api API) {
 	}
 	return _api
 }
+
+/**
+ * websocket行情 , 只支持部分交易所
+ */
+func (builder *APIBuilder) BuildStreaming(exName string) (api StreamingAPI) {
+	var _api StreamingAPI
+	switch exName {
+	case HUOBI_PRO:
+		_api = huobi.NewHuoBiPro(builder.client, builder.apiKey, builder.secretkey, "")
+	case OKEX:
+		_api = okex.NewOKExV3Ws(builder.apiConfig()).Stream("")
+	case BITSTAMP:
+		_api = bitstamp.NewBitstamp(builder.client, builder.apiKey, builder.secretkey, builder.clientId)
+	case ZB:
+		_api = zb.New(builder.client, builder.apiKey, builder.secretkey)
+	case BINANCE:
+		_api = binance.New(builder.client, builder.apiKey, builder.secretkey)
+	case BITFINEX:
+		_api = bitfinex.New(builder.client, builder.apiKey, builder.secretkey)
+	case KRAKEN:
+		_api = kraken.New(builder.client, builder.apiKey, builder.secretkey)
+	case GDAX:
+		_api = gdax.NewWithConfig(builder.apiConfig())
+	case POLONIEX:
+		_api = poloniex.New(builder.client, builder.apiKey, builder.secretkey)
+	default:
+		panic("exchange [" + exName + "] not support streaming.")
+	}
+	return _api
+}
+
+//合约交易
+func (builder *APIBuilder) BuildFuture(exName string) (api FutureRestAPI) {
+	var _api FutureRestAPI
+	switch exName {
+	case OKEX_FUTURE:
+		_api = okcoin.NewOKEx(builder.client, builder.apiKey, builder.secretkey)
+	case BITMEX:
+		_api = bitmex.New(builder.client, builder.apiKey, builder.secretkey)
+	case HBDM:
+		_api = huobi.NewHbdm(builder.apiConfig())
+	default:
+		panic("exchange [" + exName + "] not support future.")
+	}
+	return _api
+}
+
+/**
+ * 合约websocket行情 , contractType: THIS_WEEK_CONTRACT , NEXT_WEEK_CONTRACT , QUARTER_CONTRACT
+ * bitmex另外支持bitmex.PERPETUAL_CONTRACT和bitmex合约代码 , okex永续合约忽略contractType
+ */
+func (builder *APIBuilder) BuildFutureStreaming(exName, contractType string) (api StreamingAPI) {
+	var _api StreamingAPI
+	switch exName {
+	case OKEX_FUTURE:
+		_api = okex.NewOKExV3Ws(builder.apiConfig()).Stream(contractType)
+	case BITMEX:
+		_api = bitmex.New(builder.client, builder.apiKey, builder.secretkey).Stream(contractType)
+	case OKEX_SWAP:
+		_api = okex.NewOKExV3Ws(builder.apiConfig()).Stream(okex.SWAP_CONTRACT)
+	case HBDM:
+		_api = huobi.NewHbdm(builder.apiConfig()).Stream(contractType)
+	default:
+		panic("exchange [" + exName + "] not support future streaming.")
+	}
+	return _api
+}
+
+func (builder *APIBuilder) apiConfig() *APIConfig {
+	return &APIConfig{
+		HttpClient:    builder.client,
+		ApiKey:        builder.apiKey,
+		ApiSecretKey:  builder.secretkey,
+		ApiPassphrase: builder.passphrase}
+}
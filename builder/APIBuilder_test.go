@@ -2,6 +2,7 @@ package builder
 
 import (
 	"github.com/bxsmart/GoEx"
+	"github.com/bxsmart/GoEx/okex"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -17,3 +18,30 @@ func TestAPIBuilder_Build(t *testing.T) {
 	assert.Equal(t, builder.APIKey("").APISecretkey("").Build(goex.POLONIEX).GetExchangeName(), goex.POLONIEX)
 	assert.Equal(t, builder.APIKey("").APISecretkey("").Build(goex.KRAKEN).GetExchangeName(), goex.KRAKEN)
 }
+
+func TestAPIBuilder_BuildStreaming(t *testing.T) {
+	assert.Equal(t, builder.BuildStreaming(goex.HUOBI_PRO).GetExchangeName(), goex.HUOBI_PRO)
+	assert.Equal(t, builder.BuildStreaming(goex.OKEX).GetExchangeName(), goex.OKEX)
+	assert.Equal(t, builder.BuildStreaming(goex.BITSTAMP).GetExchangeName(), goex.BITSTAMP)
+	assert.Equal(t, builder.BuildStreaming(goex.BINANCE).GetExchangeName(), goex.BINANCE)
+	assert.Equal(t, builder.BuildStreaming(goex.BITFINEX).GetExchangeName(), goex.BITFINEX)
+	assert.Equal(t, builder.BuildStreaming(goex.KRAKEN).GetExchangeName(), goex.KRAKEN)
+	assert.Equal(t, builder.BuildStreaming(goex.GDAX).GetExchangeName(), goex.GDAX)
+	assert.Equal(t, builder.BuildStreaming(goex.POLONIEX).GetExchangeName(), goex.POLONIEX)
+	assert.Equal(t, builder.BuildFutureStreaming(goex.OKEX_FUTURE, goex.QUARTER_CONTRACT).GetExchangeName(), goex.OKEX_FUTURE)
+	assert.Equal(t, builder.BuildFutureStreaming(goex.BITMEX, goex.QUARTER_CONTRACT).GetExchangeName(), goex.BITMEX)
+	assert.Equal(t, builder.BuildFutureStreaming(goex.OKEX_SWAP, "").GetExchangeName(), goex.OKEX_SWAP)
+	assert.Equal(t, builder.BuildFutureStreaming(goex.HBDM, goex.QUARTER_CONTRACT).GetExchangeName(), goex.HBDM)
+	assert.Panics(t, func() { builder.BuildStreaming(goex.BITTREX) })
+
+	//okex走v3 websocket
+	assert.IsType(t, &okex.OKExV3Stream{}, builder.BuildStreaming(goex.OKEX))
+	assert.IsType(t, &okex.OKExV3Stream{}, builder.BuildFutureStreaming(goex.OKEX_FUTURE, goex.QUARTER_CONTRACT))
+}
+
+func TestAPIBuilder_BuildFuture(t *testing.T) {
+	assert.Equal(t, builder.BuildFuture(goex.OKEX_FUTURE).GetExchangeName(), goex.OKEX_FUTURE)
+	assert.Equal(t, builder.BuildFuture(goex.BITMEX).GetExchangeName(), goex.BITMEX)
+	assert.Equal(t, builder.BuildFuture(goex.HBDM).GetExchangeName(), goex.HBDM)
+	assert.Panics(t, func() { builder.BuildFuture(goex.BITTREX) })
+}
@@ -1,51 +1,221 @@
 package gdax
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	. "github.com/bxsmart/GoEx"
 	"net/http"
+	"net/url"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 //www.coinbase.com or www.gdax.com
 
+const (
+	API_BASE_URL = "https://api.pro.coinbase.com"
+)
+
+//granularity单位为秒
+var _KLINE_PERIOD_CONVERTER = map[int]int{
+	KLINE_PERIOD_1MIN:  60,
+	KLINE_PERIOD_5MIN:  300,
+	KLINE_PERIOD_15MIN: 900,
+	KLINE_PERIOD_60MIN: 3600,
+	KLINE_PERIOD_1H:    3600,
+	KLINE_PERIOD_6H:    21600,
+	KLINE_PERIOD_1DAY:  86400,
+}
+
+/**
+ * 自己的成交 , Liquidity: M(maker) , T(taker)
+ */
+type Fill struct {
+	Trade
+	OrderId   string
+	Fee       float64
+	Liquidity string
+}
+
 type Gdax struct {
 	httpClient *http.Client
 	baseUrl,
 	accessKey,
-	secretKey string
+	secretKey,
+	passphrase string
+
+	wsShards        *WsShards
+	wsMaxSubs       int
+	createWsLock    sync.Mutex
+	wsHandlers      *WsHandlers
+	wsLock          sync.Mutex
+	wsBooks         map[string]*wsBook
+	wsSeqs          map[string]int64
+	wsFullHandles   map[string]func(*FullMessage)
+	wsHbHandles     map[string]func(*Heartbeat)
+	wsGapHandle     func(channel string, last, seq int64)
+	wsSubErrHandles []func(channel string, err error)
 }
 
 func New(client *http.Client, accesskey, secretkey string) *Gdax {
-	return &Gdax{client, "https://api.gdax.com", accesskey, secretkey}
+	return NewWithConfig(&APIConfig{
+		HttpClient:   client,
+		ApiKey:       accesskey,
+		ApiSecretKey: secretkey})
+}
+
+//交易接口需要ApiPassphrase
+func NewWithConfig(config *APIConfig) *Gdax {
+	baseUrl := config.Endpoint
+	if baseUrl == "" {
+		baseUrl = API_BASE_URL
+	}
+	return &Gdax{
+		httpClient:    config.HttpClient,
+		baseUrl:       baseUrl,
+		accessKey:     config.ApiKey,
+		secretKey:     config.ApiSecretKey,
+		passphrase:    config.ApiPassphrase,
+		wsHandlers:    NewWsHandlers(),
+		wsBooks:       make(map[string]*wsBook),
+		wsSeqs:        make(map[string]int64),
+		wsFullHandles: make(map[string]func(*FullMessage)),
+		wsHbHandles:   make(map[string]func(*Heartbeat))}
+}
+
+func (g *Gdax) placeOrder(orderType, side, amount, price string, currency CurrencyPair) (*Order, error) {
+	params := map[string]interface{}{
+		"type":       orderType,
+		"side":       side,
+		"product_id": currency.ToSymbol("-"),
+		"size":       amount}
+	if orderType == "limit" {
+		params["price"] = price
+	}
+
+	var respmap map[string]interface{}
+	err := g.doAuthenticatedRequest("POST", "/orders", params, &respmap)
+	if err != nil {
+		return nil, err
+	}
+
+	ord := g.toOrder(respmap)
+	ord.Currency = currency
+	return ord, nil
 }
 
 func (g *Gdax) LimitBuy(amount, price string, currency CurrencyPair) (*Order, error) {
-	panic("not implement")
+	return g.placeOrder("limit", "buy", amount, price, currency)
 }
 func (g *Gdax) LimitSell(amount, price string, currency CurrencyPair) (*Order, error) {
-	panic("not implement")
+	return g.placeOrder("limit", "sell", amount, price, currency)
 }
+
+//amount为基础币数量
 func (g *Gdax) MarketBuy(amount, price string, currency CurrencyPair) (*Order, error) {
-	panic("not implement")
+	return g.placeOrder("market", "buy", amount, price, currency)
 }
 func (g *Gdax) MarketSell(amount, price string, currency CurrencyPair) (*Order, error) {
-	panic("not implement")
+	return g.placeOrder("market", "sell", amount, price, currency)
 }
 func (g *Gdax) CancelOrder(orderId string, currency CurrencyPair) (bool, error) {
-	panic("not implement")
+	var resp interface{}
+	err := g.doAuthenticatedRequest("DELETE", "/orders/"+orderId+"?product_id="+currency.ToSymbol("-"), nil, &resp)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
+
+//已取消且没有成交的订单查询不到
 func (g *Gdax) GetOneOrder(orderId string, currency CurrencyPair) (*Order, error) {
-	panic("not implement")
+	var respmap map[string]interface{}
+	err := g.doAuthenticatedRequest("GET", "/orders/"+orderId, nil, &respmap)
+	if err != nil {
+		return nil, err
+	}
+	ord := g.toOrder(respmap)
+	ord.Currency = currency
+	return ord, nil
 }
+
 func (g *Gdax) GetUnfinishOrders(currency CurrencyPair) ([]Order, error) {
-	panic("not implement")
+	return g.getOrders(url.Values{
+		"status":     {"open", "pending", "active"},
+		"product_id": {currency.ToSymbol("-")}})
 }
+
+//coinbase按游标分页 , 不支持页码 , 只返回最近的pageSize个已完成订单
 func (g *Gdax) GetOrderHistorys(currency CurrencyPair, currentPage, pageSize int) ([]Order, error) {
-	panic("not implement")
+	return g.getOrders(url.Values{
+		"status":     {"done"},
+		"product_id": {currency.ToSymbol("-")},
+		"limit":      {fmt.Sprint(pageSize)}})
 }
+
+func (g *Gdax) getOrders(params url.Values) ([]Order, error) {
+	var resp []map[string]interface{}
+	err := g.doAuthenticatedRequest("GET", "/orders?"+params.Encode(), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]Order, 0, len(resp))
+	for _, v := range resp {
+		orders = append(orders, *g.toOrder(v))
+	}
+	return orders, nil
+}
+
 func (g *Gdax) GetAccount() (*Account, error) {
-	panic("not implement")
+	var resp []map[string]interface{}
+	err := g.doAuthenticatedRequest("GET", "/accounts", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := new(Account)
+	acc.Exchange = g.GetExchangeName()
+	acc.SubAccounts = make(map[Currency]SubAccount)
+	for _, v := range resp {
+		currency := NewCurrency(toString(v["currency"]), "")
+		acc.SubAccounts[currency] = SubAccount{
+			Currency:     currency,
+			Amount:       ToFloat64(v["available"]),
+			ForzenAmount: ToFloat64(v["hold"])}
+	}
+	return acc, nil
+}
+
+//最近100笔成交
+func (g *Gdax) GetFills(currency CurrencyPair) ([]Fill, error) {
+	var resp []map[string]interface{}
+	err := g.doAuthenticatedRequest("GET", "/fills?product_id="+currency.ToSymbol("-"), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	fills := make([]Fill, 0, len(resp))
+	for _, v := range resp {
+		fill := Fill{
+			OrderId:   toString(v["order_id"]),
+			Fee:       ToFloat64(v["fee"]),
+			Liquidity: toString(v["liquidity"])}
+		fill.Tid = int64(ToFloat64(v["trade_id"]))
+		fill.Pair = currency
+		fill.Price = ToFloat64(v["price"])
+		fill.Amount = ToFloat64(v["size"])
+		fill.Date = parseTime(v["created_at"]).UnixNano() / int64(time.Millisecond)
+		fill.Type = AdaptTradeSide(toString(v["side"]))
+		fills = append(fills, fill)
+	}
+	return fills, nil
 }
 
 func (g *Gdax) GetTicker(currency CurrencyPair) (*Ticker, error) {
@@ -112,15 +282,197 @@ func (g *Gdax) GetDepth(size int, currency CurrencyPair) (*Depth, error) {
 	return dep, nil
 }
 
+/**
+ * since: unix秒 , 0为最近的数据 , 每次最多300条
+ * [time, low, high, open, close, volume] , 按时间倒序返回 , 这里转为升序
+ */
 func (g *Gdax) GetKlineRecords(currency CurrencyPair, period, size, since int) ([]Kline, error) {
-	panic("not implement")
+	granularity, isok := _KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return nil, ErrKlinePeriodNotSupport
+	}
+
+	params := url.Values{}
+	params.Set("granularity", fmt.Sprint(granularity))
+	if since > 0 {
+		if size <= 0 || size > 300 {
+			size = 300
+		}
+		params.Set("start", time.Unix(int64(since), 0).UTC().Format(time.RFC3339))
+		params.Set("end", time.Unix(int64(since+size*granularity), 0).UTC().Format(time.RFC3339))
+	}
+
+	resp, err := HttpGet3(g.httpClient, fmt.Sprintf("%s/products/%s/candles?%s", g.baseUrl, currency.ToSymbol("-"), params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var klines []Kline
+	for i := len(resp) - 1; i >= 0; i-- {
+		record, _ := resp[i].([]interface{})
+		if len(record) < 6 {
+			continue
+		}
+		klines = append(klines, Kline{
+			Pair:      currency,
+			Timestamp: int64(ToFloat64(record[0])),
+			Low:       ToFloat64(record[1]),
+			High:      ToFloat64(record[2]),
+			Open:      ToFloat64(record[3]),
+			Close:     ToFloat64(record[4]),
+			Vol:       ToFloat64(record[5])})
+	}
+
+	if size > 0 && len(klines) > size {
+		klines = klines[len(klines)-size:]
+	}
+	return klines, nil
 }
 
-//非个人，整个交易所的交易记录
+/**
+ * 非个人，整个交易所的交易记录
+ * since: trade_id , 返回比它新的成交 , 0为最近100笔
+ */
 func (g *Gdax) GetTrades(currencyPair CurrencyPair, since int64) ([]Trade, error) {
-	panic("not implement")
+	apiurl := fmt.Sprintf("%s/products/%s/trades", g.baseUrl, currencyPair.ToSymbol("-"))
+	if since > 0 {
+		apiurl += fmt.Sprintf("?before=%d", since)
+	}
+
+	resp, err := HttpGet3(g.httpClient, apiurl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var trades []Trade
+	for _, v := range resp {
+		tradmap, isok := v.(map[string]interface{})
+		if !isok {
+			continue
+		}
+		trades = append(trades, Trade{
+			Tid:    int64(ToFloat64(tradmap["trade_id"])),
+			Type:   takerSide(toString(tradmap["side"])),
+			Amount: ToFloat64(tradmap["size"]),
+			Price:  ToFloat64(tradmap["price"]),
+			Date:   parseTime(tradmap["time"]).UnixNano() / int64(time.Millisecond),
+			Pair:   currencyPair})
+	}
+	return trades, nil
 }
 
 func (g *Gdax) GetExchangeName() string {
 	return GDAX
 }
+
+/**
+ * CB-ACCESS-SIGN: base64(hmac_sha256(base64decode(secret), timestamp + method + requestPath + body))
+ */
+func (g *Gdax) sign(payload string) (string, error) {
+	secret, err := base64.StdEncoding.DecodeString(g.secretKey)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (g *Gdax) doAuthenticatedRequest(method, uri string, params map[string]interface{}, ret interface{}) error {
+	body := ""
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		body = string(data)
+	}
+
+	timestamp := fmt.Sprint(time.Now().Unix())
+	sign, err := g.sign(timestamp + method + uri + body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := NewHttpRequest(g.httpClient, method, g.baseUrl+uri, body, map[string]string{
+		"Content-Type":         "application/json",
+		"CB-ACCESS-KEY":        g.accessKey,
+		"CB-ACCESS-SIGN":       sign,
+		"CB-ACCESS-TIMESTAMP":  timestamp,
+		"CB-ACCESS-PASSPHRASE": g.passphrase})
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(resp, ret)
+	if err != nil {
+		return errors.New(string(resp))
+	}
+	return nil
+}
+
+/**
+ * status: pending , open , active , done , rejected
+ * done_reason: filled , canceled
+ */
+func (g *Gdax) toOrder(ordmap map[string]interface{}) *Order {
+	ord := &Order{
+		OrderID2:   toString(ordmap["id"]),
+		Currency:   productToPair(toString(ordmap["product_id"])),
+		Price:      ToFloat64(ordmap["price"]),
+		Amount:     ToFloat64(ordmap["size"]),
+		DealAmount: ToFloat64(ordmap["filled_size"]),
+		Fee:        ToFloat64(ordmap["fill_fees"]),
+		OrderTime:  int(parseTime(ordmap["created_at"]).Unix()),
+		Side:       AdaptTradeSide(toString(ordmap["side"]))}
+
+	if ord.DealAmount > 0 {
+		ord.AvgPrice = ToFloat64(ordmap["executed_value"]) / ord.DealAmount
+	}
+	if ordmap["type"] == "market" {
+		if ord.Side == BUY {
+			ord.Side = BUY_MARKET
+		} else {
+			ord.Side = SELL_MARKET
+		}
+	}
+
+	switch ordmap["status"] {
+	case "done":
+		ord.Status = ORDER_FINISH
+		if ordmap["done_reason"] == "canceled" {
+			ord.Status = ORDER_CANCEL
+		}
+	case "rejected":
+		ord.Status = ORDER_REJECT
+	default:
+		ord.Status = ORDER_UNFINISH
+		if ord.DealAmount > 0 {
+			ord.Status = ORDER_PART_FINISH
+		}
+	}
+	return ord
+}
+
+//BTC-USD => BTC_USD
+func productToPair(productId string) CurrencyPair {
+	return NewCurrencyPair2(strings.Replace(productId, "-", "_", 1))
+}
+
+//成交记录的side是maker的方向
+func takerSide(makerSide string) TradeSide {
+	if makerSide == "buy" {
+		return SELL
+	}
+	return BUY
+}
+
+func parseTime(v interface{}) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, toString(v))
+	return t
+}
+
+func toString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,493 @@
+package gdax
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"log"
+	"time"
+)
+
+const (
+	WS_URL = "wss://ws-feed.pro.coinbase.com"
+
+	_WS_BOOK_SIZE = 20
+)
+
+/**
+ * full频道的逐笔委托消息
+ * Type: received , open , done , match , change , activate
+ */
+type FullMessage struct {
+	Type          string
+	Pair          CurrencyPair
+	Sequence      int64
+	OrderId       string
+	OrderType     string //limit , market
+	Side          TradeSide
+	Price         float64
+	Size          float64 //received , match , change(new_size)
+	RemainingSize float64 //open , done
+	Funds         float64 //市价单的金额
+	Reason        string  //done: filled , canceled
+	TradeId       int64   //match
+	MakerOrderId  string  //match
+	TakerOrderId  string  //match
+	Time          time.Time
+}
+
+//LastTradeId可以用来确认matches频道没有丢失成交
+type Heartbeat struct {
+	Pair        CurrencyPair
+	Sequence    int64
+	LastTradeId int64
+	Time        time.Time
+}
+
+//level2频道没有序号 , 快照后按增量更新
+type wsBook struct {
+	book   *OrderBook
+	size   int
+	handle func(*Depth)
+}
+
+/**
+ * 每次发送时重新签名 , 重连后重新订阅不会因为时间戳过期失败
+ * 设置了api key时订阅消息带签名 , full频道会额外推送自己订单的user_id , profile_id
+ */
+type wsRequest struct {
+	g         *Gdax
+	typ       string //subscribe , unsubscribe
+	productId string
+	channel   string
+}
+
+func (r wsRequest) MarshalJSON() ([]byte, error) {
+	req := map[string]interface{}{
+		"type":        r.typ,
+		"product_ids": []string{r.productId},
+		"channels":    []string{r.channel}}
+
+	if r.typ == "subscribe" && r.g.accessKey != "" {
+		timestamp := fmt.Sprint(time.Now().Unix())
+		sign, err := r.g.sign(timestamp + "GET" + "/users/self/verify")
+		if err != nil {
+			return nil, err
+		}
+		req["key"] = r.g.accessKey
+		req["passphrase"] = r.g.passphrase
+		req["timestamp"] = timestamp
+		req["signature"] = sign
+	}
+	return json.Marshal(req)
+}
+
+//每个连接最多订阅n个频道 , 超过后新建连接 , 默认100
+func (g *Gdax) WsMaxSubsPerConn(n int) *Gdax {
+	g.createWsLock.Lock()
+	defer g.createWsLock.Unlock()
+	g.wsMaxSubs = n
+	return g
+}
+
+//连接在第一次订阅时建立
+func (g *Gdax) wsConns() *WsShards {
+	g.createWsLock.Lock()
+	defer g.createWsLock.Unlock()
+
+	if g.wsShards == nil {
+		if g.wsMaxSubs == 0 {
+			g.wsMaxSubs = 100
+		}
+		g.wsShards = NewWsShards(g.wsMaxSubs, g.dialWs)
+	}
+	return g.wsShards
+}
+
+//服务端不响应ping消息 , 用heartbeat频道或者行情推送保持活跃
+func (g *Gdax) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn(WS_URL)
+	if err != nil {
+		return nil, err
+	}
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		g.handleWsMessage(ws, msg)
+	})
+	return ws, nil
+}
+
+/**
+ * 序号不连续时回调 , channel为 full:BTC-USD(sequence) 或 matches:BTC-USD(trade_id)
+ * full频道丢失消息后本地维护的委托簿需要重新获取快照
+ */
+func (g *Gdax) OnWsSequenceGap(handle func(channel string, last, seq int64)) *Gdax {
+	g.wsLock.Lock()
+	defer g.wsLock.Unlock()
+	g.wsGapHandle = handle
+	return g
+}
+
+func (g *Gdax) handleWsMessage(ws *WsConn, msg []byte) {
+	ws.UpdateActivedTime()
+
+	datamap := make(map[string]interface{})
+	err := json.Unmarshal(msg, &datamap)
+	if err != nil {
+		log.Println("json unmarshal error for ", string(msg))
+		return
+	}
+
+	productId := toString(datamap["product_id"])
+	switch typ := toString(datamap["type"]); typ {
+	case "subscriptions":
+		g.ackWsSubscriptions(ws, datamap)
+	case "error":
+		//错误消息不带频道 , 等待确认的订阅都视为失败
+		err := fmt.Errorf("%v: %v", datamap["message"], datamap["reason"])
+		for _, s := range ws.Subscriptions() {
+			if s.State == WS_SUB_PENDING {
+				ws.FailSubscribe(s.Channel, err)
+			}
+		}
+	case "heartbeat":
+		g.handleWsHeartbeat(ws, datamap)
+	case "ticker":
+		if handle := g.wsHandlers.Ticker("ticker:" + productId); handle != nil {
+			handle(parseWsTicker(datamap))
+		}
+	case "snapshot", "l2update":
+		g.updateWsBook("level2:"+productId, datamap)
+	case "last_match", "match":
+		//full和matches频道都会推送match
+		if g.checkWsSeq("matches:"+productId, int64(ToFloat64(datamap["trade_id"]))) {
+			if handle := g.wsHandlers.Trade("matches:" + productId); handle != nil {
+				handle(parseWsMatch(datamap))
+			}
+		}
+		if typ == "match" {
+			g.handleWsFull(productId, datamap)
+		}
+	case "received", "open", "done", "change", "activate":
+		g.handleWsFull(productId, datamap)
+	}
+}
+
+//{"type":"subscriptions","channels":[{"name":"level2","product_ids":["BTC-USD"]}]} , 包含连接上所有已订阅的频道
+func (g *Gdax) ackWsSubscriptions(ws *WsConn, datamap map[string]interface{}) {
+	channels, _ := datamap["channels"].([]interface{})
+	for _, c := range channels {
+		channel, _ := c.(map[string]interface{})
+		productIds, _ := channel["product_ids"].([]interface{})
+		for _, productId := range productIds {
+			ws.AckSubscribe(fmt.Sprintf("%v:%v", channel["name"], productId))
+		}
+	}
+}
+
+/**
+ * 序号小于等于上一个的消息丢弃 , 大于上一个+1的回调OnWsSequenceGap后照常处理
+ * 没有订阅过的频道不记录
+ */
+func (g *Gdax) checkWsSeq(channel string, seq int64) bool {
+	g.wsLock.Lock()
+	last, isok := g.wsSeqs[channel]
+	if !isok || seq <= 0 {
+		g.wsLock.Unlock()
+		return isok
+	}
+	if last > 0 && seq <= last {
+		g.wsLock.Unlock()
+		return false
+	}
+	g.wsSeqs[channel] = seq
+	handle := g.wsGapHandle
+	g.wsLock.Unlock()
+
+	if last > 0 && seq > last+1 {
+		log.Printf("[%s] sequence gap , last %d , current %d", channel, last, seq)
+		if handle != nil {
+			handle(channel, last, seq)
+		}
+	}
+	return true
+}
+
+func (g *Gdax) handleWsFull(productId string, datamap map[string]interface{}) {
+	channel := "full:" + productId
+	if !g.checkWsSeq(channel, int64(ToFloat64(datamap["sequence"]))) {
+		return
+	}
+
+	g.wsLock.Lock()
+	handle := g.wsFullHandles[channel]
+	g.wsLock.Unlock()
+	if handle != nil {
+		handle(parseWsFull(datamap))
+	}
+}
+
+//心跳的last_trade_id比收到的最后一笔成交新 , 说明matches频道丢失了成交
+func (g *Gdax) handleWsHeartbeat(ws *WsConn, datamap map[string]interface{}) {
+	hb := parseWsHeartbeat(datamap)
+	productId := hb.Pair.ToSymbol("-")
+	matches := "matches:" + productId
+	sameConn := g.wsConns().Conn(matches) == ws
+
+	g.wsLock.Lock()
+	handle := g.wsHbHandles["heartbeat:"+productId]
+	last, isok := g.wsSeqs[matches]
+	gapHandle := g.wsGapHandle
+	missed := isok && last > 0 && hb.LastTradeId > last && sameConn
+	if missed {
+		g.wsSeqs[matches] = hb.LastTradeId
+	}
+	g.wsLock.Unlock()
+
+	if missed {
+		log.Printf("[%s] sequence gap , last %d , heartbeat %d", matches, last, hb.LastTradeId)
+		if gapHandle != nil {
+			gapHandle(matches, last, hb.LastTradeId)
+		}
+	}
+	if handle != nil {
+		handle(hb)
+	}
+}
+
+/**
+ * snapshot: {"bids":[[price, size]], "asks":[...]}
+ * l2update: {"changes":[["buy", price, size]]} , size为0表示删除
+ */
+func (g *Gdax) updateWsBook(channel string, datamap map[string]interface{}) {
+	g.wsLock.Lock()
+	b := g.wsBooks[channel]
+	g.wsLock.Unlock()
+	if b == nil {
+		return
+	}
+
+	var err error
+	if datamap["type"] == "snapshot" {
+		b.book.Snapshot(&Depth{
+			AskList: parseWsLevels(datamap["asks"]),
+			BidList: parseWsLevels(datamap["bids"])}, 0)
+	} else {
+		update := &DepthUpdate{}
+		changes, _ := datamap["changes"].([]interface{})
+		for _, c := range changes {
+			change, _ := c.([]interface{})
+			if len(change) < 3 {
+				continue
+			}
+			record := DepthRecord{Price: ToFloat64(change[1]), Amount: ToFloat64(change[2])}
+			if change[0] == "buy" {
+				update.BidList = append(update.BidList, record)
+			} else {
+				update.AskList = append(update.AskList, record)
+			}
+		}
+		err = b.book.Update(update)
+	}
+
+	if err == nil {
+		b.handle(b.book.Depth(b.size))
+	}
+}
+
+func (g *Gdax) subscribe(pair CurrencyPair, channel string) error {
+	productId := pair.ToSymbol("-")
+	return g.wsConns().SubscribeChannel(channel+":"+productId,
+		wsRequest{g, "subscribe", productId, channel},
+		wsRequest{g, "unsubscribe", productId, channel})
+}
+
+func (g *Gdax) unsubscribe(channel string) error {
+	g.wsHandlers.Remove(channel)
+	g.wsLock.Lock()
+	delete(g.wsBooks, channel)
+	delete(g.wsSeqs, channel)
+	delete(g.wsFullHandles, channel)
+	delete(g.wsHbHandles, channel)
+	g.wsLock.Unlock()
+	return g.wsConns().UnsubscribeChannel(channel)
+}
+
+func (g *Gdax) SubscribeTicker(pair CurrencyPair, handle func(ticker *Ticker)) error {
+	g.wsHandlers.SetTicker("ticker:"+pair.ToSymbol("-"), func(ticker *Ticker) {
+		ticker.Pair = pair
+		handle(ticker)
+	})
+	return g.subscribe(pair, "ticker")
+}
+
+func (g *Gdax) UnsubscribeTicker(pair CurrencyPair) error {
+	return g.unsubscribe("ticker:" + pair.ToSymbol("-"))
+}
+
+//前20档
+func (g *Gdax) SubscribeDepth(pair CurrencyPair, handle func(dep *Depth)) error {
+	return g.SubscribeBook(pair, _WS_BOOK_SIZE, handle)
+}
+
+func (g *Gdax) UnsubscribeDepth(pair CurrencyPair) error {
+	return g.UnsubscribeBook(pair)
+}
+
+//level2频道 , 本地维护全量深度 , 每次更新后回调前size档 , size<=0回调全部
+func (g *Gdax) SubscribeBook(pair CurrencyPair, size int, handle func(dep *Depth)) error {
+	g.wsLock.Lock()
+	g.wsBooks["level2:"+pair.ToSymbol("-")] = &wsBook{
+		book:   NewOrderBook(pair),
+		size:   size,
+		handle: handle}
+	g.wsLock.Unlock()
+	return g.subscribe(pair, "level2")
+}
+
+func (g *Gdax) UnsubscribeBook(pair CurrencyPair) error {
+	return g.unsubscribe("level2:" + pair.ToSymbol("-"))
+}
+
+//matches频道 , trade_id不连续时回调OnWsSequenceGap
+func (g *Gdax) SubscribeTrade(pair CurrencyPair, handle func(trade *Trade)) error {
+	channel := "matches:" + pair.ToSymbol("-")
+	g.wsHandlers.SetTrade(channel, func(trade *Trade) {
+		trade.Pair = pair
+		handle(trade)
+	})
+	g.wsLock.Lock()
+	g.wsSeqs[channel] = 0
+	g.wsLock.Unlock()
+	return g.subscribe(pair, "matches")
+}
+
+func (g *Gdax) UnsubscribeTrade(pair CurrencyPair) error {
+	return g.unsubscribe("matches:" + pair.ToSymbol("-"))
+}
+
+/**
+ * full频道 , 推送所有委托的变化 , 可以用来维护逐笔委托簿(level3)
+ * sequence不连续时回调OnWsSequenceGap
+ */
+func (g *Gdax) SubscribeFull(pair CurrencyPair, handle func(msg *FullMessage)) error {
+	channel := "full:" + pair.ToSymbol("-")
+	g.wsLock.Lock()
+	g.wsFullHandles[channel] = func(msg *FullMessage) {
+		msg.Pair = pair
+		handle(msg)
+	}
+	g.wsSeqs[channel] = 0
+	g.wsLock.Unlock()
+	return g.subscribe(pair, "full")
+}
+
+func (g *Gdax) UnsubscribeFull(pair CurrencyPair) error {
+	return g.unsubscribe("full:" + pair.ToSymbol("-"))
+}
+
+//每秒一次 , 和matches频道在同一个连接时用来检查是否丢失成交
+func (g *Gdax) SubscribeHeartbeat(pair CurrencyPair, handle func(hb *Heartbeat)) error {
+	g.wsLock.Lock()
+	g.wsHbHandles["heartbeat:"+pair.ToSymbol("-")] = handle
+	g.wsLock.Unlock()
+	return g.subscribe(pair, "heartbeat")
+}
+
+func (g *Gdax) UnsubscribeHeartbeat(pair CurrencyPair) error {
+	return g.unsubscribe("heartbeat:" + pair.ToSymbol("-"))
+}
+
+//没有k线频道
+func (g *Gdax) SubscribeKline(pair CurrencyPair, period int, handle func(kline *Kline)) error {
+	return ErrStreamNotSupport
+}
+
+func (g *Gdax) UnsubscribeKline(pair CurrencyPair, period int) error {
+	return ErrStreamNotSupport
+}
+
+func (g *Gdax) OnSubscribeError(handle func(channel string, err error)) {
+	g.wsLock.Lock()
+	g.wsSubErrHandles = append(g.wsSubErrHandles, handle)
+	g.wsLock.Unlock()
+	g.wsConns().OnSubscribeError(handle)
+}
+
+func (g *Gdax) CloseWs() {
+	g.wsConns().CloseWs()
+
+	g.wsLock.Lock()
+	g.wsBooks = make(map[string]*wsBook)
+	g.wsSeqs = make(map[string]int64)
+	g.wsFullHandles = make(map[string]func(*FullMessage))
+	g.wsHbHandles = make(map[string]func(*Heartbeat))
+	g.wsLock.Unlock()
+}
+
+func parseWsTicker(datamap map[string]interface{}) *Ticker {
+	return &Ticker{
+		Last: ToFloat64(datamap["price"]),
+		Buy:  ToFloat64(datamap["best_bid"]),
+		Sell: ToFloat64(datamap["best_ask"]),
+		High: ToFloat64(datamap["high_24h"]),
+		Low:  ToFloat64(datamap["low_24h"]),
+		Vol:  ToFloat64(datamap["volume_24h"]),
+		Date: uint64(parseTime(datamap["time"]).Unix())}
+}
+
+//side是maker的方向
+func parseWsMatch(datamap map[string]interface{}) *Trade {
+	return &Trade{
+		Tid:    int64(ToFloat64(datamap["trade_id"])),
+		Type:   takerSide(toString(datamap["side"])),
+		Amount: ToFloat64(datamap["size"]),
+		Price:  ToFloat64(datamap["price"]),
+		Date:   parseTime(datamap["time"]).UnixNano() / int64(time.Millisecond)}
+}
+
+func parseWsFull(datamap map[string]interface{}) *FullMessage {
+	msg := &FullMessage{
+		Type:          toString(datamap["type"]),
+		Pair:          productToPair(toString(datamap["product_id"])),
+		Sequence:      int64(ToFloat64(datamap["sequence"])),
+		OrderId:       toString(datamap["order_id"]),
+		OrderType:     toString(datamap["order_type"]),
+		Side:          AdaptTradeSide(toString(datamap["side"])),
+		Price:         ToFloat64(datamap["price"]),
+		Size:          ToFloat64(datamap["size"]),
+		RemainingSize: ToFloat64(datamap["remaining_size"]),
+		Funds:         ToFloat64(datamap["funds"]),
+		Reason:        toString(datamap["reason"]),
+		TradeId:       int64(ToFloat64(datamap["trade_id"])),
+		MakerOrderId:  toString(datamap["maker_order_id"]),
+		TakerOrderId:  toString(datamap["taker_order_id"]),
+		Time:          parseTime(datamap["time"])}
+	if msg.Type == "change" {
+		msg.Size = ToFloat64(datamap["new_size"])
+		msg.Funds = ToFloat64(datamap["new_funds"])
+	}
+	return msg
+}
+
+func parseWsHeartbeat(datamap map[string]interface{}) *Heartbeat {
+	return &Heartbeat{
+		Pair:        productToPair(toString(datamap["product_id"])),
+		Sequence:    int64(ToFloat64(datamap["sequence"])),
+		LastTradeId: int64(ToFloat64(datamap["last_trade_id"])),
+		Time:        parseTime(datamap["time"])}
+}
+
+func parseWsLevels(v interface{}) DepthRecords {
+	levels, _ := v.([]interface{})
+	records := make(DepthRecords, 0, len(levels))
+	for _, l := range levels {
+		level, _ := l.([]interface{})
+		if len(level) < 2 {
+			continue
+		}
+		records = append(records, DepthRecord{Price: ToFloat64(level[0]), Amount: ToFloat64(level[1])})
+	}
+	return records
+}
@@ -0,0 +1,87 @@
+package gdax
+
+import (
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestGdax_WsBook(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	ws := &goex.WsConn{}
+
+	var deps []*goex.Depth
+	ex.wsBooks["level2:BTC-USD"] = &wsBook{book: goex.NewOrderBook(goex.BTC_USD), size: 2, handle: func(dep *goex.Depth) {
+		deps = append(deps, dep)
+	}}
+
+	ex.handleWsMessage(ws, []byte(`{"type":"snapshot","product_id":"BTC-USD","bids":[["10101.10","0.45054140"],["10101.00","1.0"]],"asks":[["10102.55","0.57753524"]]}`))
+	ex.handleWsMessage(ws, []byte(`{"type":"l2update","product_id":"BTC-USD","time":"2019-08-14T20:42:27.265Z","changes":[["buy","10101.10","0"],["sell","10103.00","2.5"]]}`))
+	assert.Equal(t, 2, len(deps))
+	assert.Equal(t, goex.DepthRecords{{Price: 10101, Amount: 1}}, deps[1].BidList)
+	assert.Equal(t, goex.DepthRecords{{Price: 10102.55, Amount: 0.57753524}, {Price: 10103, Amount: 2.5}}, deps[1].AskList)
+}
+
+func TestGdax_WsSequence(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	ws := &goex.WsConn{}
+
+	var gaps []string
+	ex.OnWsSequenceGap(func(channel string, last, seq int64) {
+		gaps = append(gaps, channel)
+	})
+
+	var trades []*goex.Trade
+	ex.wsHandlers.SetTrade("matches:BTC-USD", func(trade *goex.Trade) {
+		trades = append(trades, trade)
+	})
+	ex.wsSeqs["matches:BTC-USD"] = 0
+
+	var msgs []*FullMessage
+	ex.wsFullHandles["full:BTC-USD"] = func(msg *FullMessage) {
+		msgs = append(msgs, msg)
+	}
+	ex.wsSeqs["full:BTC-USD"] = 0
+
+	ex.handleWsMessage(ws, []byte(`{"type":"last_match","trade_id":10,"sequence":50,"maker_order_id":"ac928c66","taker_order_id":"132fb6ae","time":"2014-11-07T08:19:27.028459Z","product_id":"BTC-USD","size":"5.23512","price":"400.23","side":"sell"}`))
+	ex.handleWsMessage(ws, []byte(`{"type":"received","time":"2014-11-07T08:19:27.028459Z","product_id":"BTC-USD","sequence":51,"order_id":"d50ec984","size":"1.34","price":"502.1","side":"buy","order_type":"limit"}`))
+	ex.handleWsMessage(ws, []byte(`{"type":"match","trade_id":11,"sequence":52,"maker_order_id":"ac928c66","taker_order_id":"d50ec984","time":"2014-11-07T08:19:28.000000Z","product_id":"BTC-USD","size":"1.34","price":"400.23","side":"sell"}`))
+	assert.Equal(t, 0, len(gaps))
+
+	//重复的消息丢弃
+	ex.handleWsMessage(ws, []byte(`{"type":"match","trade_id":11,"sequence":52,"time":"2014-11-07T08:19:28.000000Z","product_id":"BTC-USD","size":"1.34","price":"400.23","side":"sell"}`))
+	assert.Equal(t, 2, len(trades))
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, goex.TradeSide(goex.BUY), trades[1].Type)
+	assert.Equal(t, int64(11), trades[1].Tid)
+	assert.Equal(t, int64(1415348368000), trades[1].Date)
+	assert.Equal(t, "received", msgs[0].Type)
+	assert.Equal(t, goex.BTC_USD, msgs[0].Pair)
+	assert.Equal(t, 1.34, msgs[0].Size)
+
+	ex.handleWsMessage(ws, []byte(`{"type":"done","time":"2014-11-07T08:19:29.000000Z","product_id":"BTC-USD","sequence":55,"price":"200.2","order_id":"d50ec984","reason":"filled","side":"sell","remaining_size":"0"}`))
+	assert.Equal(t, []string{"full:BTC-USD"}, gaps)
+	assert.Equal(t, 3, len(msgs))
+}
+
+func TestGdax_toOrder(t *testing.T) {
+	ord := gdax.toOrder(map[string]interface{}{
+		"id":             "68e6a28f-ae28-4788-8d4f-5ab4e5e5ae08",
+		"size":           "1.00000000",
+		"product_id":     "BTC-USD",
+		"side":           "buy",
+		"type":           "market",
+		"created_at":     "2016-12-08T20:09:05.508883Z",
+		"done_reason":    "filled",
+		"fill_fees":      "0.0249376391550000",
+		"filled_size":    "0.01291771",
+		"executed_value": "9.9750556620000000",
+		"status":         "done"})
+	assert.Equal(t, "68e6a28f-ae28-4788-8d4f-5ab4e5e5ae08", ord.OrderID2)
+	assert.Equal(t, goex.BTC_USD, ord.Currency)
+	assert.Equal(t, goex.TradeSide(goex.BUY_MARKET), ord.Side)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_FINISH), ord.Status)
+	assert.InDelta(t, 772.2, ord.AvgPrice, 0.1)
+	assert.Equal(t, 1481227745, ord.OrderTime)
+}
@@ -1,16 +1,65 @@
 package huobi
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	. "github.com/bxsmart/GoEx"
 	"log"
+	"net/url"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Hbdm struct {
-	config *APIConfig
+	config          *APIConfig
+	contractLock    sync.Mutex
+	contracts       map[string]ContractInfo
+	contractsExpiry time.Time
+	createWsLock    sync.Mutex
+	wsShards        *WsShards
+	wsMaxSubs       int
+	wsHandlers      *WsHandlers
+	wsLock          sync.Mutex
+	wsAuth          *WsConn
+	wsOrderHandles  map[string]func(*FutureOrder)
+	wsSubErrHandles []func(channel string, err error)
+}
+
+//合约信息 , contract_type: this_week , next_week , quarter
+type ContractInfo struct {
+	Symbol         string  `json:"symbol"`
+	ContractCode   string  `json:"contract_code"`
+	ContractType   string  `json:"contract_type"`
+	ContractSize   float64 `json:"contract_size"`
+	PriceTick      float64 `json:"price_tick"`
+	DeliveryDate   string  `json:"delivery_date"`
+	CreateDate     string  `json:"create_date"`
+	ContractStatus int     `json:"contract_status"`
+}
+
+type hbdmOrder struct {
+	Symbol         string  `json:"symbol"`
+	ContractType   string  `json:"contract_type"`
+	ContractCode   string  `json:"contract_code"`
+	Volume         float64 `json:"volume"`
+	Price          float64 `json:"price"`
+	OrderPriceType string  `json:"order_price_type"`
+	Direction      string  `json:"direction"`
+	Offset         string  `json:"offset"`
+	LeverRate      int     `json:"lever_rate"`
+	OrderId        int64   `json:"order_id"`
+	ClientOrderId  int64   `json:"client_order_id"`
+	CreatedAt      int64   `json:"created_at"`
+	TradeVolume    float64 `json:"trade_volume"`
+	TradeTurnover  float64 `json:"trade_turnover"`
+	Fee            float64 `json:"fee"`
+	TradeAvgPrice  float64 `json:"trade_avg_price"`
+	MarginFrozen   float64 `json:"margin_frozen"`
+	Profit         float64 `json:"profit"`
+	Status         int     `json:"status"`
 }
 
 type BaseResponse struct {
@@ -25,7 +74,11 @@ var (
 )
 
 func NewHbdm(conf *APIConfig) *Hbdm {
-	return &Hbdm{conf}
+	return &Hbdm{
+		config:         conf,
+		contracts:      make(map[string]ContractInfo),
+		wsHandlers:     NewWsHandlers(),
+		wsOrderHandles: make(map[string]func(*FutureOrder))}
 }
 
 func (dm *Hbdm) GetExchangeName() string {
@@ -167,7 +220,344 @@ func (dm *Hbdm) GetKlineRecords(contract_type string, currency CurrencyPair, per
 	return klines, nil
 }
 
+//全仓账户 , 每个币种一个账户
+func (dm *Hbdm) GetFutureUserinfo() (*FutureAccount, error) {
+	var infos []struct {
+		Symbol         string  `json:"symbol"`
+		MarginBalance  float64 `json:"margin_balance"`
+		MarginPosition float64 `json:"margin_position"`
+		ProfitReal     float64 `json:"profit_real"`
+		ProfitUnreal   float64 `json:"profit_unreal"`
+		RiskRate       float64 `json:"risk_rate"`
+	}
+	err := dm.doRequest("POST", "/api/v1/contract_account_info", map[string]interface{}{}, &infos)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := &FutureAccount{FutureSubAccounts: make(map[Currency]FutureSubAccount)}
+	for _, info := range infos {
+		currency := NewCurrency(info.Symbol, "")
+		acc.FutureSubAccounts[currency] = FutureSubAccount{
+			Currency:      currency,
+			AccountRights: info.MarginBalance,
+			KeepDeposit:   info.MarginPosition,
+			ProfitReal:    info.ProfitReal,
+			ProfitUnreal:  info.ProfitUnreal,
+			RiskRate:      info.RiskRate}
+	}
+	return acc, nil
+}
+
+/**
+ * openType转换成 direction + offset , 平多为卖出平仓 , 平空为买入平仓
+ * matchPrice=1时为对手价下单 , leverRate为0时使用APIConfig.Lever
+ */
+func (dm *Hbdm) PlaceFutureOrder(currencyPair CurrencyPair, contractType, price, amount string, openType, matchPrice, leverRate int) (string, error) {
+	if leverRate == 0 {
+		leverRate = dm.config.Lever
+	}
+	params := map[string]interface{}{
+		"volume":           ToInt(amount),
+		"lever_rate":       leverRate,
+		"order_price_type": "limit"}
+	dm.adaptContractParams(currencyPair, contractType, params)
+
+	switch openType {
+	case OPEN_BUY:
+		params["direction"], params["offset"] = "buy", "open"
+	case OPEN_SELL:
+		params["direction"], params["offset"] = "sell", "open"
+	case CLOSE_BUY:
+		params["direction"], params["offset"] = "sell", "close"
+	case CLOSE_SELL:
+		params["direction"], params["offset"] = "buy", "close"
+	default:
+		return "", fmt.Errorf("hbdm unknown open type %d", openType)
+	}
+
+	if matchPrice == 1 {
+		params["order_price_type"] = "opponent"
+	} else {
+		params["price"] = ToFloat64(price)
+	}
+
+	var ret struct {
+		OrderId int64 `json:"order_id"`
+	}
+	err := dm.doRequest("POST", "/api/v1/contract_order", params, &ret)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(ret.OrderId), nil
+}
+
+func (dm *Hbdm) FutureCancelOrder(currencyPair CurrencyPair, contractType, orderId string) (bool, error) {
+	var ret struct {
+		Errors []struct {
+			ErrCode int    `json:"err_code"`
+			ErrMsg  string `json:"err_msg"`
+		} `json:"errors"`
+		Successes string `json:"successes"`
+	}
+	err := dm.doRequest("POST", "/api/v1/contract_cancel", map[string]interface{}{
+		"order_id": orderId,
+		"symbol":   currencyPair.CurrencyA.Symbol}, &ret)
+	if err != nil {
+		return false, err
+	}
+
+	if len(ret.Errors) > 0 {
+		return false, fmt.Errorf("%d: %s", ret.Errors[0].ErrCode, ret.Errors[0].ErrMsg)
+	}
+	return strings.Contains(ret.Successes, orderId), nil
+}
+
+//多空合并为一个FuturePosition , 没有持仓时返回空
+func (dm *Hbdm) GetFuturePosition(currencyPair CurrencyPair, contractType string) ([]FuturePosition, error) {
+	var list []struct {
+		ContractCode string  `json:"contract_code"`
+		ContractType string  `json:"contract_type"`
+		Volume       float64 `json:"volume"`
+		Available    float64 `json:"available"`
+		CostOpen     float64 `json:"cost_open"`
+		CostHold     float64 `json:"cost_hold"`
+		Profit       float64 `json:"profit"`
+		LeverRate    int     `json:"lever_rate"`
+		Direction    string  `json:"direction"`
+	}
+	err := dm.doRequest("POST", "/api/v1/contract_position_info", map[string]interface{}{
+		"symbol": currencyPair.CurrencyA.Symbol}, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	var positions []FuturePosition
+	for _, p := range list {
+		if p.ContractType != contractType && p.ContractCode != contractType {
+			continue
+		}
+		if len(positions) == 0 {
+			positions = append(positions, FuturePosition{Symbol: currencyPair, ContractType: contractType})
+		}
+		pos := &positions[0]
+		pos.LeverRate = p.LeverRate
+		if p.Direction == "buy" {
+			pos.BuyAmount = p.Volume
+			pos.BuyAvailable = p.Available
+			pos.BuyPriceAvg = p.CostOpen
+			pos.BuyPriceCost = p.CostHold
+			pos.BuyProfitReal = p.Profit
+		} else {
+			pos.SellAmount = p.Volume
+			pos.SellAvailable = p.Available
+			pos.SellPriceAvg = p.CostOpen
+			pos.SellPriceCost = p.CostHold
+			pos.SellProfitReal = p.Profit
+		}
+	}
+	return positions, nil
+}
+
+func (dm *Hbdm) GetFutureOrders(orderIds []string, currencyPair CurrencyPair, contractType string) ([]FutureOrder, error) {
+	var list []hbdmOrder
+	err := dm.doRequest("POST", "/api/v1/contract_order_info", map[string]interface{}{
+		"order_id": strings.Join(orderIds, ","),
+		"symbol":   currencyPair.CurrencyA.Symbol}, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []FutureOrder
+	for i := range list {
+		ord := list[i].toFutureOrder()
+		ord.Currency = currencyPair
+		orders = append(orders, *ord)
+	}
+	return orders, nil
+}
+
+func (dm *Hbdm) GetFutureOrder(orderId string, currencyPair CurrencyPair, contractType string) (*FutureOrder, error) {
+	orders, err := dm.GetFutureOrders([]string{orderId}, currencyPair, contractType)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, EX_ERR_NOT_FIND_ORDER
+	}
+	return &orders[0], nil
+}
+
+//最多返回50个
+func (dm *Hbdm) GetUnfinishFutureOrders(currencyPair CurrencyPair, contractType string) ([]FutureOrder, error) {
+	var ret struct {
+		Orders []hbdmOrder `json:"orders"`
+	}
+	err := dm.doRequest("POST", "/api/v1/contract_openorders", map[string]interface{}{
+		"symbol":    currencyPair.CurrencyA.Symbol,
+		"page_size": 50}, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []FutureOrder
+	for i := range ret.Orders {
+		o := &ret.Orders[i]
+		if o.ContractType != contractType && o.ContractCode != contractType {
+			continue
+		}
+		ord := o.toFutureOrder()
+		ord.Currency = currencyPair
+		orders = append(orders, *ord)
+	}
+	return orders, nil
+}
+
+func (dm *Hbdm) GetFee() (float64, error) {
+	return 0, errors.New("not support")
+}
+
+func (dm *Hbdm) GetExchangeRate() (float64, error) {
+	return 0, errors.New("not support")
+}
+
+//每张合约的美元价值 , BTC为100 , 其他为10
+func (dm *Hbdm) GetContractValue(currencyPair CurrencyPair) (float64, error) {
+	c, err := dm.GetContractInfo(currencyPair.CurrencyA.Symbol + ":" + QUARTER_CONTRACT)
+	if err != nil {
+		return -1, err
+	}
+	return c.ContractSize, nil
+}
+
+func (dm *Hbdm) GetDeliveryTime() (int, int, int, int) {
+	return 4, 16, 0, 0 //星期五，下午4点交割
+}
+
+//最近2000笔 , since: 毫秒
+func (dm *Hbdm) GetTrades(contract_type string, currencyPair CurrencyPair, since int64) ([]Trade, error) {
+	symbol := dm.adaptSymbol(currencyPair, contract_type)
+	return getHistoryTrades(dm.config.HttpClient, apiUrl+"/market/history/trade?size=2000&symbol="+symbol, currencyPair, since)
+}
+
+/**
+ * status: 1,2准备提交 , 3已提交 , 4部分成交 , 5部分成交已撤单 , 6全部成交 , 7已撤单 , 11撤单中
+ */
+func adaptContractOrderStatus(status int) TradeStatus {
+	switch status {
+	case 4:
+		return ORDER_PART_FINISH
+	case 5, 7:
+		return ORDER_CANCEL
+	case 6:
+		return ORDER_FINISH
+	case 11:
+		return ORDER_CANCEL_ING
+	default:
+		return ORDER_UNFINISH
+	}
+}
+
+//direction + offset -> 1开多 , 2开空 , 3平多 , 4平空
+func adaptContractOType(direction, offset string) int {
+	switch {
+	case direction == "buy" && offset == "open":
+		return OPEN_BUY
+	case direction == "sell" && offset == "open":
+		return OPEN_SELL
+	case direction == "sell" && offset == "close":
+		return CLOSE_BUY
+	default:
+		return CLOSE_SELL
+	}
+}
+
+func (o *hbdmOrder) toFutureOrder() *FutureOrder {
+	return &FutureOrder{
+		OrderID2:     fmt.Sprint(o.OrderId),
+		OrderID:      o.OrderId,
+		Price:        o.Price,
+		Amount:       o.Volume,
+		AvgPrice:     o.TradeAvgPrice,
+		DealAmount:   o.TradeVolume,
+		OrderTime:    o.CreatedAt,
+		Status:       adaptContractOrderStatus(o.Status),
+		OType:        adaptContractOType(o.Direction, o.Offset),
+		LeverRate:    o.LeverRate,
+		Fee:          o.Fee,
+		ContractName: o.ContractCode}
+}
+
+//Signature等参数放在url里 , 签名字符串为 method\nhost\npath\n排序后的参数
+func (dm *Hbdm) sign(method, host, path string) url.Values {
+	params := url.Values{}
+	params.Set("AccessKeyId", dm.config.ApiKey)
+	params.Set("SignatureMethod", "HmacSHA256")
+	params.Set("SignatureVersion", "2")
+	params.Set("Timestamp", time.Now().UTC().Format("2006-01-02T15:04:05"))
+	payload := fmt.Sprintf("%s\n%s\n%s\n%s", method, host, path, params.Encode())
+	sign, _ := GetParamHmacSHA256Base64Sign(dm.config.ApiSecretKey, payload)
+	params.Set("Signature", sign)
+	return params
+}
+
+/**
+ * GET为公开接口 , POST为私有接口 , 参数为json
+ * 返回 {"status":"ok","data":...} , 错误 {"status":"error","err_code":1017,"err_msg":"..."} , data解析到result
+ */
+func (dm *Hbdm) doRequest(method, path string, params map[string]interface{}, result interface{}) error {
+	var (
+		resp []byte
+		err  error
+	)
+	if method == "GET" {
+		resp, err = HttpGet5(dm.config.HttpClient, apiUrl+path, nil)
+	} else {
+		u, _ := url.Parse(apiUrl)
+		body, _ := json.Marshal(params)
+		resp, err = HttpPostForm3(dm.config.HttpClient, apiUrl+path+"?"+dm.sign(method, u.Host, path).Encode(), string(body),
+			map[string]string{"Content-Type": "application/json", "Accept-Language": "zh-cn"})
+	}
+	if err != nil {
+		return err
+	}
+
+	var ret struct {
+		Status  string          `json:"status"`
+		ErrCode int             `json:"err_code"`
+		ErrMsg  string          `json:"err_msg"`
+		Data    json.RawMessage `json:"data"`
+	}
+	err = json.Unmarshal(resp, &ret)
+	if err != nil {
+		return err
+	}
+
+	if ret.Status != "ok" {
+		return fmt.Errorf("%d: %s", ret.ErrCode, ret.ErrMsg)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(ret.Data, result)
+}
+
+/**
+ * 行情接口的symbol , 例如 BTC_CQ
+ * contractType除了合约类型也可以是合约代码 , 例如 BTC190628 , 通过合约信息转换成对应的合约类型
+ */
 func (dm *Hbdm) adaptSymbol(pair CurrencyPair, contractType string) string {
+	switch contractType {
+	case THIS_WEEK_CONTRACT, NEXT_WEEK_CONTRACT, QUARTER_CONTRACT:
+	default:
+		c, err := dm.GetContractInfo(contractType)
+		if err != nil {
+			return contractType
+		}
+		pair = NewCurrencyPair(NewCurrency(c.Symbol, ""), USD)
+		contractType = c.ContractType
+	}
+
 	symbol := pair.CurrencyA.Symbol + "_"
 	switch contractType {
 	case THIS_WEEK_CONTRACT:
@@ -180,6 +570,52 @@ func (dm *Hbdm) adaptSymbol(pair CurrencyPair, contractType string) string {
 	return symbol
 }
 
+//交易接口的参数 , 合约类型用symbol+contract_type , 否则作为合约代码
+func (dm *Hbdm) adaptContractParams(pair CurrencyPair, contractType string, params map[string]interface{}) {
+	switch contractType {
+	case THIS_WEEK_CONTRACT, NEXT_WEEK_CONTRACT, QUARTER_CONTRACT:
+		params["symbol"] = pair.CurrencyA.Symbol
+		params["contract_type"] = contractType
+	default:
+		params["contract_code"] = contractType
+	}
+}
+
+/**
+ * 按合约代码或 symbol:contract_type (例如 BTC:quarter) 查找合约信息
+ * 合约信息缓存到最近一个合约交割 , 交割时间为交割日16:00(北京时间)
+ */
+func (dm *Hbdm) GetContractInfo(key string) (*ContractInfo, error) {
+	dm.contractLock.Lock()
+	defer dm.contractLock.Unlock()
+
+	if time.Now().After(dm.contractsExpiry) {
+		var infos []ContractInfo
+		err := dm.doRequest("GET", "/api/v1/contract_contract_info", nil, &infos)
+		if err != nil {
+			return nil, err
+		}
+
+		dm.contracts = make(map[string]ContractInfo)
+		dm.contractsExpiry = time.Now().Add(24 * time.Hour)
+		for _, c := range infos {
+			dm.contracts[c.ContractCode] = c
+			dm.contracts[c.Symbol+":"+c.ContractType] = c
+			if delivery, err := time.Parse("20060102", c.DeliveryDate); err == nil {
+				if expiry := delivery.Add(8 * time.Hour); expiry.After(time.Now()) && expiry.Before(dm.contractsExpiry) {
+					dm.contractsExpiry = expiry
+				}
+			}
+		}
+	}
+
+	c, isok := dm.contracts[key]
+	if !isok {
+		return nil, errors.New("hbdm contract not found: " + key)
+	}
+	return &c, nil
+}
+
 func (dm *Hbdm) adaptKLinePeriod(period int) string {
 	switch period {
 	case KLINE_PERIOD_1MIN:
@@ -0,0 +1,442 @@
+package huobi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	HBDM_WS_URL      = "wss://www.hbdm.com/ws"
+	HBDM_WS_AUTH_URL = "wss://api.hbdm.com/notification"
+)
+
+//每次发送时重新签名 , 重连后重新认证不会因为时间戳过期失败
+type hbdmWsAuthRequest struct {
+	dm *Hbdm
+}
+
+func (r hbdmWsAuthRequest) MarshalJSON() ([]byte, error) {
+	params := r.dm.sign("GET", "api.hbdm.com", "/notification")
+	msg := map[string]string{"op": "auth", "type": "api"}
+	for k := range params {
+		msg[k] = params.Get(k)
+	}
+	return json.Marshal(msg)
+}
+
+//每个连接最多订阅n个频道 , 超过后新建连接 , 默认不限制
+func (dm *Hbdm) WsMaxSubsPerConn(n int) *Hbdm {
+	dm.createWsLock.Lock()
+	defer dm.createWsLock.Unlock()
+	dm.wsMaxSubs = n
+	return dm
+}
+
+//连接在第一次订阅时建立
+func (dm *Hbdm) wsConns() *WsShards {
+	dm.createWsLock.Lock()
+	defer dm.createWsLock.Unlock()
+
+	if dm.wsShards == nil {
+		dm.wsShards = NewWsShards(dm.wsMaxSubs, dm.dialWs)
+	}
+	return dm.wsShards
+}
+
+func (dm *Hbdm) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn(HBDM_WS_URL)
+	if err != nil {
+		return nil, err
+	}
+	ws.Heartbeat(func() interface{} {
+		return map[string]interface{}{
+			"ping": time.Now().Unix()}
+	}, 5*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		dm.handleWsMessage(ws, msg)
+	})
+	return ws, nil
+}
+
+func gzipDecode(msg []byte) (map[string]interface{}, []byte, error) {
+	gzipreader, err := gzip.NewReader(bytes.NewReader(msg))
+	if err != nil {
+		return nil, nil, err
+	}
+	data, _ := ioutil.ReadAll(gzipreader)
+	datamap := make(map[string]interface{})
+	err = json.Unmarshal(data, &datamap)
+	if err != nil {
+		return nil, data, err
+	}
+	return datamap, data, nil
+}
+
+/**
+ * {"ping":...} 心跳 , 需要回复pong
+ * {"id":"market.BTC_CQ.depth.step0","subbed":"market.BTC_CQ.depth.step0","status":"ok"} 订阅回执
+ * {"ch":"market.BTC_CQ.depth.step0","ts":...,"tick":{...}} 推送
+ */
+func (dm *Hbdm) handleWsMessage(ws *WsConn, msg []byte) {
+	datamap, data, err := gzipDecode(msg)
+	if err != nil {
+		log.Println("json unmarshal error for ", string(data))
+		return
+	}
+
+	ws.UpdateActivedTime()
+	if datamap["ping"] != nil {
+		ws.SendWriteJSON(map[string]interface{}{
+			"pong": datamap["ping"]}) // 回应心跳
+		return
+	}
+
+	if datamap["pong"] != nil {
+		return
+	}
+
+	if datamap["id"] != nil { //订阅回执 , id即订阅的频道
+		id, _ := datamap["id"].(string)
+		if datamap["status"] == "ok" {
+			if datamap["subbed"] != nil {
+				ws.AckSubscribe(id)
+			}
+		} else {
+			ws.FailSubscribe(id, fmt.Errorf("%v: %v", datamap["err-code"], datamap["err-msg"]))
+		}
+		return
+	}
+
+	ch, isok := datamap["ch"].(string)
+	if !isok {
+		log.Println("error:", string(data))
+		return
+	}
+	tick, _ := datamap["tick"].(map[string]interface{})
+
+	if handle := dm.wsHandlers.Trade(ch); handle != nil {
+		list, _ := tick["data"].([]interface{})
+		for _, t := range list {
+			item, isok := t.(map[string]interface{})
+			if !isok {
+				continue
+			}
+			handle(parseTrade(item))
+		}
+		return
+	}
+
+	if handle := dm.wsHandlers.Ticker(ch); handle != nil {
+		handle(&Ticker{
+			Last: ToFloat64(tick["close"]),
+			High: ToFloat64(tick["high"]),
+			Low:  ToFloat64(tick["low"]),
+			Vol:  ToFloat64(tick["amount"]),
+			Date: ToUint64(datamap["ts"])})
+		return
+	}
+
+	if handle := dm.wsHandlers.Depth(ch); handle != nil {
+		mills := ToUint64(datamap["ts"])
+		dep := &Depth{
+			UTime:   time.Unix(int64(mills/1000), int64(mills%1000)*int64(time.Millisecond)),
+			AskList: dm.parseWsDepthRecords(tick["asks"]),
+			BidList: dm.parseWsDepthRecords(tick["bids"])}
+		sort.Sort(dep.AskList)
+		sort.Sort(sort.Reverse(dep.BidList))
+		handle(dep)
+		return
+	}
+
+	if handle := dm.wsHandlers.Kline(ch); handle != nil {
+		handle(&Kline{
+			Open:      ToFloat64(tick["open"]),
+			Close:     ToFloat64(tick["close"]),
+			High:      ToFloat64(tick["high"]),
+			Low:       ToFloat64(tick["low"]),
+			Vol:       ToFloat64(tick["vol"]),
+			Timestamp: int64(ToUint64(tick["id"]))})
+		return
+	}
+}
+
+func (dm *Hbdm) parseWsDepthRecords(v interface{}) DepthRecords {
+	rows, _ := v.([]interface{})
+	records := make(DepthRecords, 0, len(rows))
+	for _, r := range rows {
+		row, isok := r.([]interface{})
+		if !isok || len(row) < 2 {
+			continue
+		}
+		records = append(records, DepthRecord{
+			Price:  ToFloat64(row[0]),
+			Amount: ToFloat64(row[1])})
+	}
+	return records
+}
+
+//用频道名作为id , 回执里可以找到对应的订阅
+func (dm *Hbdm) subscribe(sub string) error {
+	return dm.wsConns().SubscribeChannel(sub, map[string]interface{}{
+		"id":  sub,
+		"sub": sub}, map[string]interface{}{
+		"id":    sub,
+		"unsub": sub})
+}
+
+func (dm *Hbdm) unsubscribe(sub string) error {
+	dm.wsHandlers.Remove(sub)
+	return dm.wsConns().UnsubscribeChannel(sub)
+}
+
+/**
+ * 订单推送的连接在第一次订阅时建立
+ * 认证作为第一个订阅 , 重连后先重新认证再重发订阅
+ */
+func (dm *Hbdm) authConn() (*WsConn, error) {
+	dm.createWsLock.Lock()
+	defer dm.createWsLock.Unlock()
+
+	dm.wsLock.Lock()
+	auth := dm.wsAuth
+	handles := append([]func(string, error){}, dm.wsSubErrHandles...)
+	dm.wsLock.Unlock()
+	if auth != nil {
+		return auth, nil
+	}
+
+	ws, err := NewWsConn(HBDM_WS_AUTH_URL)
+	if err != nil {
+		return nil, err
+	}
+	ws.AckTimeout(10 * time.Second)
+	for _, handle := range handles {
+		ws.OnSubscribeError(handle)
+	}
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		dm.handleWsAuthMessage(ws, msg)
+	})
+
+	err = ws.SubscribeChannel(_WS_AUTH_CHANNEL, hbdmWsAuthRequest{dm}, nil)
+	if err != nil {
+		ws.CloseWs()
+		return nil, err
+	}
+
+	dm.wsLock.Lock()
+	dm.wsAuth = ws
+	dm.wsLock.Unlock()
+	return ws, nil
+}
+
+/**
+ * {"op":"ping","ts":...} 心跳 , 需要回复pong
+ * {"op":"auth","err-code":0} 认证回执
+ * {"op":"sub","topic":"orders.btc","err-code":0} 订阅回执
+ * {"op":"notify","topic":"orders.btc","order_id":...,"status":...} 推送 , 订单字段与contract_order_info相同
+ */
+func (dm *Hbdm) handleWsAuthMessage(ws *WsConn, msg []byte) {
+	datamap, data, err := gzipDecode(msg)
+	if err != nil {
+		log.Println("json unmarshal error for ", string(data))
+		return
+	}
+
+	ws.UpdateActivedTime()
+	topic, _ := datamap["topic"].(string)
+	switch datamap["op"] {
+	case "ping":
+		ws.SendWriteJSON(map[string]interface{}{
+			"op": "pong",
+			"ts": datamap["ts"]})
+	case "auth":
+		if ToInt(datamap["err-code"]) == 0 {
+			ws.AckSubscribe(_WS_AUTH_CHANNEL)
+		} else {
+			ws.FailSubscribe(_WS_AUTH_CHANNEL, fmt.Errorf("%v: %v", datamap["err-code"], datamap["err-msg"]))
+		}
+	case "sub":
+		if ToInt(datamap["err-code"]) == 0 {
+			ws.AckSubscribe(topic)
+		} else {
+			ws.FailSubscribe(topic, fmt.Errorf("%v: %v", datamap["err-code"], datamap["err-msg"]))
+		}
+	case "notify":
+		dm.wsLock.Lock()
+		handle := dm.wsOrderHandles[topic]
+		dm.wsLock.Unlock()
+		if handle == nil {
+			return
+		}
+
+		var order hbdmOrder
+		if err := json.Unmarshal(data, &order); err != nil {
+			log.Println("json unmarshal error for ", string(data))
+			return
+		}
+		handle(order.toFutureOrder())
+	}
+}
+
+func (dm *Hbdm) ordersTopic(pair CurrencyPair) string {
+	return "orders." + strings.ToLower(pair.CurrencyA.Symbol)
+}
+
+/**
+ * 订单变化 , 包括该币种所有合约的订单 , ContractName为合约代码
+ * 每次推送订单的完整状态
+ */
+func (dm *Hbdm) SubscribeOrders(pair CurrencyPair, handle func(order *FutureOrder)) error {
+	topic := dm.ordersTopic(pair)
+	dm.wsLock.Lock()
+	dm.wsOrderHandles[topic] = func(order *FutureOrder) {
+		order.Currency = pair
+		handle(order)
+	}
+	dm.wsLock.Unlock()
+
+	ws, err := dm.authConn()
+	if err != nil {
+		return err
+	}
+	return ws.SubscribeChannel(topic, map[string]interface{}{
+		"op":    "sub",
+		"cid":   topic,
+		"topic": topic}, map[string]interface{}{
+		"op":    "unsub",
+		"cid":   topic,
+		"topic": topic})
+}
+
+func (dm *Hbdm) UnsubscribeOrders(pair CurrencyPair) error {
+	topic := dm.ordersTopic(pair)
+	dm.wsLock.Lock()
+	delete(dm.wsOrderHandles, topic)
+	auth := dm.wsAuth
+	dm.wsLock.Unlock()
+	if auth == nil {
+		return nil
+	}
+	return auth.UnsubscribeChannel(topic)
+}
+
+func (dm *Hbdm) OnSubscribeError(handle func(channel string, err error)) {
+	dm.wsLock.Lock()
+	dm.wsSubErrHandles = append(dm.wsSubErrHandles, handle)
+	auth := dm.wsAuth
+	dm.wsLock.Unlock()
+
+	dm.wsConns().OnSubscribeError(handle)
+	if auth != nil {
+		auth.OnSubscribeError(handle)
+	}
+}
+
+//关闭所有websocket连接 , 包括订单推送的连接
+func (dm *Hbdm) CloseWs() {
+	dm.wsConns().CloseWs()
+
+	dm.wsLock.Lock()
+	auth := dm.wsAuth
+	dm.wsAuth = nil
+	dm.wsLock.Unlock()
+	if auth != nil {
+		auth.CloseWs()
+	}
+}
+
+/**
+ * 固定合约类型的StreamingAPI , 多个合约类型共用同一组连接
+ * dm.Stream(QUARTER_CONTRACT).SubscribeDepth(BTC_USD, handle)
+ */
+type HbdmStream struct {
+	dm           *Hbdm
+	contractType string
+}
+
+func (dm *Hbdm) Stream(contractType string) *HbdmStream {
+	return &HbdmStream{dm: dm, contractType: contractType}
+}
+
+func (s *HbdmStream) GetExchangeName() string {
+	return HBDM
+}
+
+func (s *HbdmStream) channel(pair CurrencyPair, format string) string {
+	return fmt.Sprintf(format, s.dm.adaptSymbol(pair, s.contractType))
+}
+
+//24小时成交统计 , 没有买一卖一价
+func (s *HbdmStream) SubscribeTicker(pair CurrencyPair, handle func(*Ticker)) error {
+	sub := s.channel(pair, "market.%s.detail")
+	s.dm.wsHandlers.SetTicker(sub, func(ticker *Ticker) {
+		ticker.Pair = pair
+		ticker.ContractType = s.contractType
+		handle(ticker)
+	})
+	return s.dm.subscribe(sub)
+}
+
+func (s *HbdmStream) UnsubscribeTicker(pair CurrencyPair) error {
+	return s.dm.unsubscribe(s.channel(pair, "market.%s.detail"))
+}
+
+//150档全量
+func (s *HbdmStream) SubscribeDepth(pair CurrencyPair, handle func(*Depth)) error {
+	sub := s.channel(pair, "market.%s.depth.step0")
+	s.dm.wsHandlers.SetDepth(sub, func(dep *Depth) {
+		dep.Pair = pair
+		dep.ContractType = s.contractType
+		handle(dep)
+	})
+	return s.dm.subscribe(sub)
+}
+
+func (s *HbdmStream) UnsubscribeDepth(pair CurrencyPair) error {
+	return s.dm.unsubscribe(s.channel(pair, "market.%s.depth.step0"))
+}
+
+func (s *HbdmStream) SubscribeTrade(pair CurrencyPair, handle func(*Trade)) error {
+	sub := s.channel(pair, "market.%s.trade.detail")
+	s.dm.wsHandlers.SetTrade(sub, func(trade *Trade) {
+		trade.Pair = pair
+		handle(trade)
+	})
+	return s.dm.subscribe(sub)
+}
+
+func (s *HbdmStream) UnsubscribeTrade(pair CurrencyPair) error {
+	return s.dm.unsubscribe(s.channel(pair, "market.%s.trade.detail"))
+}
+
+func (s *HbdmStream) klineChannel(pair CurrencyPair, period int) string {
+	return s.channel(pair, "market.%s.kline."+s.dm.adaptKLinePeriod(period))
+}
+
+func (s *HbdmStream) SubscribeKline(pair CurrencyPair, period int, handle func(*Kline)) error {
+	sub := s.klineChannel(pair, period)
+	s.dm.wsHandlers.SetKline(sub, func(kline *Kline) {
+		kline.Pair = pair
+		handle(kline)
+	})
+	return s.dm.subscribe(sub)
+}
+
+func (s *HbdmStream) UnsubscribeKline(pair CurrencyPair, period int) error {
+	return s.dm.unsubscribe(s.klineChannel(pair, period))
+}
+
+func (s *HbdmStream) OnSubscribeError(handle func(channel string, err error)) {
+	s.dm.OnSubscribeError(handle)
+}
@@ -0,0 +1,67 @@
+package huobi
+
+import (
+	"encoding/json"
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestHbdm_hbdmWsAuthRequest(t *testing.T) {
+	dm := NewHbdm(&goex.APIConfig{HttpClient: http.DefaultClient, ApiKey: "key", ApiSecretKey: "secret"})
+	data, err := json.Marshal(hbdmWsAuthRequest{dm})
+	assert.Nil(t, err)
+
+	var msg map[string]string
+	json.Unmarshal(data, &msg)
+	assert.Equal(t, "auth", msg["op"])
+	assert.Equal(t, "api", msg["type"])
+	assert.Equal(t, "key", msg["AccessKeyId"])
+	assert.NotEmpty(t, msg["Signature"])
+}
+
+func TestHbdm_handleWsMessage(t *testing.T) {
+	dm := NewHbdm(&goex.APIConfig{HttpClient: http.DefaultClient})
+	ws := &goex.WsConn{}
+	s := dm.Stream(goex.QUARTER_CONTRACT)
+
+	var dep *goex.Depth
+	s.dm.wsHandlers.SetDepth(s.channel(goex.BTC_USD, "market.%s.depth.step0"), func(d *goex.Depth) { dep = d })
+	var trades []*goex.Trade
+	s.dm.wsHandlers.SetTrade(s.channel(goex.BTC_USD, "market.%s.trade.detail"), func(t *goex.Trade) { trades = append(trades, t) })
+	var kline *goex.Kline
+	s.dm.wsHandlers.SetKline(s.klineChannel(goex.BTC_USD, goex.KLINE_PERIOD_1MIN), func(k *goex.Kline) { kline = k })
+
+	dm.handleWsMessage(ws, gzipMessage(`{"ch":"market.BTC_CQ.depth.step0","ts":1539843937417,"tick":{"mrid":14868,"id":1539843937,"bids":[[6567,2],[6566.5,1]],"asks":[[6568,1],[6569.5,3]],"ts":1539843937417,"version":1539843937,"ch":"market.BTC_CQ.depth.step0"}}`))
+	dm.handleWsMessage(ws, gzipMessage(`{"ch":"market.BTC_CQ.trade.detail","ts":1539831709042,"tick":{"id":265842227,"ts":1539831709001,"data":[null,{"amount":20,"ts":1539831709001,"id":2658422270000,"price":6736.85,"direction":"buy"}]}}`))
+	dm.handleWsMessage(ws, gzipMessage(`{"ch":"market.BTC_CQ.kline.1min","ts":1539871571355,"tick":{"id":1539871560,"mrid":269073229,"open":6532.5,"close":6533,"high":6533,"low":6532,"amount":0.5,"vol":30,"count":3}}`))
+
+	assert.Equal(t, goex.DepthRecords{{Price: 6568, Amount: 1}, {Price: 6569.5, Amount: 3}}, dep.AskList)
+	assert.Equal(t, goex.DepthRecords{{Price: 6567, Amount: 2}, {Price: 6566.5, Amount: 1}}, dep.BidList)
+	assert.Equal(t, 1, len(trades))
+	assert.Equal(t, goex.TradeSide(goex.BUY), trades[0].Type)
+	assert.Equal(t, 20.0, trades[0].Amount)
+	assert.Equal(t, int64(1539871560), kline.Timestamp)
+	assert.Equal(t, 30.0, kline.Vol)
+}
+
+func TestHbdm_handleWsAuthMessage(t *testing.T) {
+	dm := NewHbdm(&goex.APIConfig{HttpClient: http.DefaultClient})
+	ws := &goex.WsConn{}
+
+	var orders []*goex.FutureOrder
+	dm.wsOrderHandles[dm.ordersTopic(goex.BTC_USD)] = func(order *goex.FutureOrder) {
+		orders = append(orders, order)
+	}
+
+	dm.handleWsAuthMessage(ws, gzipMessage(`{"op":"auth","type":"api","err-code":0,"ts":1535096405064,"data":{"user-id":"123456"}}`))
+	dm.handleWsAuthMessage(ws, gzipMessage(`{"op":"notify","topic":"orders.btc","ts":1489474082831,"symbol":"BTC","contract_type":"this_week","contract_code":"BTC180914","volume":111,"price":1111,"order_price_type":"limit","direction":"buy","offset":"open","status":6,"lever_rate":10,"order_id":106837,"client_order_id":10683,"order_source":"web","order_type":1,"created_at":1408076414000,"trade_volume":111,"trade_turnover":1111,"fee":-0.1,"trade_avg_price":1111,"margin_frozen":0,"profit":0,"trade":[{"trade_id":112,"trade_volume":111,"trade_price":1111,"trade_fee":-0.1,"trade_turnover":1111,"created_at":1490759594752,"role":"maker"}]}`))
+
+	assert.Equal(t, 1, len(orders))
+	assert.Equal(t, "106837", orders[0].OrderID2)
+	assert.Equal(t, goex.OPEN_BUY, orders[0].OType)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_FINISH), orders[0].Status)
+	assert.Equal(t, 111.0, orders[0].DealAmount)
+	assert.Equal(t, "BTC180914", orders[0].ContractName)
+}
@@ -1,7 +1,12 @@
 package huobi
 
 import (
+	"encoding/json"
 	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -34,3 +39,125 @@ func TestHbdm_GetKlineRecords(t *testing.T) {
 		t.Log(k.Pair, tt, k.Open, k.Close, k.High, k.Low, k.Vol, k.Vol2)
 	}
 }
+
+func newTestHbdm(t *testing.T, handle func(path string, params map[string]interface{}) string) *Hbdm {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := make(map[string]interface{})
+		if r.Method == "POST" {
+			assert.Equal(t, "key", r.URL.Query().Get("AccessKeyId"))
+			assert.NotEmpty(t, r.URL.Query().Get("Signature"))
+			body, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(body, &params)
+		}
+		w.Write([]byte(handle(r.URL.Path, params)))
+	}))
+
+	old := apiUrl
+	apiUrl = srv.URL
+	t.Cleanup(func() {
+		apiUrl = old
+		srv.Close()
+	})
+	return NewHbdm(&goex.APIConfig{HttpClient: http.DefaultClient, ApiKey: "key", ApiSecretKey: "secret", Lever: 20})
+}
+
+func TestHbdm_PlaceFutureOrder(t *testing.T) {
+	var params map[string]interface{}
+	dm := newTestHbdm(t, func(path string, p map[string]interface{}) string {
+		assert.Equal(t, "/api/v1/contract_order", path)
+		params = p
+		return `{"status":"ok","data":{"order_id":633766664829804544},"ts":1158797866555}`
+	})
+
+	orderId, err := dm.PlaceFutureOrder(goex.BTC_USD, goex.QUARTER_CONTRACT, "3900.5", "2", goex.CLOSE_BUY, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "633766664829804544", orderId)
+	assert.Equal(t, "BTC", params["symbol"])
+	assert.Equal(t, "quarter", params["contract_type"])
+	assert.Equal(t, "sell", params["direction"])
+	assert.Equal(t, "close", params["offset"])
+	assert.Equal(t, "limit", params["order_price_type"])
+	assert.Equal(t, 3900.5, params["price"])
+	assert.Equal(t, 2.0, params["volume"])
+	assert.Equal(t, 20.0, params["lever_rate"])
+
+	_, err = dm.PlaceFutureOrder(goex.BTC_USD, "BTC190628", "", "1", goex.OPEN_SELL, 1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "BTC190628", params["contract_code"])
+	assert.Equal(t, "opponent", params["order_price_type"])
+	assert.Nil(t, params["price"])
+}
+
+func TestHbdm_GetFuturePosition(t *testing.T) {
+	dm := newTestHbdm(t, func(path string, p map[string]interface{}) string {
+		assert.Equal(t, "/api/v1/contract_position_info", path)
+		return `{"status":"ok","data":[
+			{"symbol":"BTC","contract_code":"BTC190628","contract_type":"quarter","volume":2,"available":1,"frozen":1,"cost_open":3900,"cost_hold":3950,"profit_unreal":0.001,"profit":0.002,"lever_rate":20,"direction":"buy"},
+			{"symbol":"BTC","contract_code":"BTC190628","contract_type":"quarter","volume":3,"available":3,"frozen":0,"cost_open":4000,"cost_hold":4000,"profit_unreal":0,"profit":-0.001,"lever_rate":20,"direction":"sell"},
+			{"symbol":"BTC","contract_code":"BTC190412","contract_type":"this_week","volume":5,"available":5,"frozen":0,"cost_open":3800,"cost_hold":3800,"profit_unreal":0,"profit":0,"lever_rate":20,"direction":"buy"}],"ts":1158797866555}`
+	})
+
+	positions, err := dm.GetFuturePosition(goex.BTC_USD, goex.QUARTER_CONTRACT)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(positions))
+	assert.Equal(t, 2.0, positions[0].BuyAmount)
+	assert.Equal(t, 3900.0, positions[0].BuyPriceAvg)
+	assert.Equal(t, 3.0, positions[0].SellAmount)
+	assert.Equal(t, -0.001, positions[0].SellProfitReal)
+	assert.Equal(t, 20, positions[0].LeverRate)
+}
+
+func TestHbdm_GetFutureOrder(t *testing.T) {
+	dm := newTestHbdm(t, func(path string, p map[string]interface{}) string {
+		switch path {
+		case "/api/v1/contract_order_info":
+			assert.Equal(t, "633766664829804544", p["order_id"])
+			return `{"status":"ok","data":[{"symbol":"BTC","contract_type":"quarter","contract_code":"BTC190628","volume":2,"price":3900.5,"order_price_type":"limit","direction":"sell","offset":"close","lever_rate":20,"order_id":633766664829804544,"client_order_id":0,"created_at":1555056600000,"trade_volume":1,"trade_turnover":100,"fee":-0.00001,"trade_avg_price":3900.5,"margin_frozen":0,"profit":0,"status":4}],"ts":1158797866555}`
+		case "/api/v1/contract_cancel":
+			return `{"status":"ok","data":{"errors":[{"order_id":"633766664829804545","err_code":1061,"err_msg":"order not exist"}],"successes":""},"ts":1158797866555}`
+		}
+		return `{"status":"error","err_code":1017,"err_msg":"not found","ts":1158797866555}`
+	})
+
+	ord, err := dm.GetFutureOrder("633766664829804544", goex.BTC_USD, goex.QUARTER_CONTRACT)
+	assert.Nil(t, err)
+	assert.Equal(t, "633766664829804544", ord.OrderID2)
+	assert.Equal(t, int64(633766664829804544), ord.OrderID)
+	assert.Equal(t, goex.CLOSE_BUY, ord.OType)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_PART_FINISH), ord.Status)
+	assert.Equal(t, "BTC190628", ord.ContractName)
+	assert.Equal(t, goex.BTC_USD, ord.Currency)
+
+	ok, err := dm.FutureCancelOrder(goex.BTC_USD, goex.QUARTER_CONTRACT, "633766664829804545")
+	assert.False(t, ok)
+	assert.Equal(t, "1061: order not exist", err.Error())
+
+	_, err = dm.GetFutureUserinfo()
+	assert.Equal(t, "1017: not found", err.Error())
+}
+
+func TestHbdm_GetContractInfo(t *testing.T) {
+	dm := newTestHbdm(t, func(path string, p map[string]interface{}) string {
+		assert.Equal(t, "/api/v1/contract_contract_info", path)
+		return `{"status":"ok","data":[
+			{"symbol":"BTC","contract_code":"BTC190628","contract_type":"quarter","contract_size":100,"price_tick":0.01,"delivery_date":"20190628","create_date":"20190315","contract_status":1},
+			{"symbol":"EOS","contract_code":"EOS190412","contract_type":"this_week","contract_size":10,"price_tick":0.001,"delivery_date":"20190412","create_date":"20190329","contract_status":1}],"ts":1158797866555}`
+	})
+
+	assert.Equal(t, "BTC_CQ", dm.adaptSymbol(goex.BTC_USD, "BTC190628"))
+	assert.Equal(t, "EOS_CW", dm.adaptSymbol(goex.BTC_USD, "EOS190412"))
+	assert.Equal(t, "BTC_NW", dm.adaptSymbol(goex.BTC_USD, goex.NEXT_WEEK_CONTRACT))
+
+	v, err := dm.GetContractValue(goex.BTC_USD)
+	assert.Nil(t, err)
+	assert.Equal(t, 100.0, v)
+}
+
+func TestHbdm_NotSupport(t *testing.T) {
+	fee, err := dm.GetFee()
+	assert.Equal(t, 0.0, fee)
+	assert.NotNil(t, err)
+	rate, err := dm.GetExchangeRate()
+	assert.Equal(t, 0.0, rate)
+	assert.NotNil(t, err)
+}
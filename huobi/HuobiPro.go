@@ -19,7 +19,6 @@ import (
 )
 
 var HBPOINT = NewCurrency("HBPOINT", "")
-var onceWsConn sync.Once
 
 var _INERNAL_KLINE_PERIOD_CONVERTER = map[int]string{
 	KLINE_PERIOD_1MIN:   "1min",
@@ -51,11 +50,17 @@ type HuoBiPro struct {
 	accessKey         string
 	secretKey         string
 	ECDSAPrivateKey   string
-	ws                *WsConn
+	wsShards          *WsShards
+	wsMaxSubs         int
 	createWsLock      sync.Mutex
-	wsTickerHandleMap map[string]func(*Ticker)
-	wsDepthHandleMap  map[string]func(*Depth)
-	wsKLineHandleMap  map[string]func(*Kline)
+	wsHandlers        *WsHandlers
+	wsLock            sync.Mutex
+	wsAuth            *WsConn
+	wsAuthHandle      wsAuthHandlers
+	wsOrderHandles    map[string]func(*Order)
+	wsBalances        map[string]*SubAccount
+	wsBooks           map[string]*wsMbpBook
+	wsSubErrHandles   []func(channel string, err error)
 }
 
 type HuoBiProSymbol struct {
@@ -74,9 +79,10 @@ func NewHuoBiPro(client *http.Client, apikey, secretkey, accountId string) *HuoB
 	hbpro.accessKey = apikey
 	hbpro.secretKey = secretkey
 	hbpro.accountId = accountId
-	hbpro.wsDepthHandleMap = make(map[string]func(*Depth))
-	hbpro.wsTickerHandleMap = make(map[string]func(*Ticker))
-	hbpro.wsKLineHandleMap = make(map[string]func(*Kline))
+	hbpro.wsHandlers = NewWsHandlers()
+	hbpro.wsOrderHandles = make(map[string]func(*Order))
+	hbpro.wsBalances = make(map[string]*SubAccount)
+	hbpro.wsBooks = make(map[string]*wsMbpBook)
 	return hbpro
 }
 
@@ -300,36 +306,43 @@ func (hbpro *HuoBiPro) parseOrder(ordmap map[string]interface{}) Order {
 		OrderTime:  ToInt(ordmap["created-at"]),
 	}
 
-	state := ordmap["state"].(string)
+	ord.Status = adaptOrderState(ordmap["state"].(string))
+
+	if ord.DealAmount > 0.0 {
+		ord.AvgPrice = ToFloat64(ordmap["field-cash-amount"]) / ord.DealAmount
+	}
+
+	ord.Side = adaptOrderType(ordmap["type"].(string))
+	return ord
+}
+
+func adaptOrderState(state string) TradeStatus {
 	switch state {
 	case "submitted", "pre-submitted":
-		ord.Status = ORDER_UNFINISH
+		return ORDER_UNFINISH
 	case "filled":
-		ord.Status = ORDER_FINISH
+		return ORDER_FINISH
 	case "partial-filled":
-		ord.Status = ORDER_PART_FINISH
+		return ORDER_PART_FINISH
 	case "canceled", "partial-canceled":
-		ord.Status = ORDER_CANCEL
+		return ORDER_CANCEL
 	default:
-		ord.Status = ORDER_UNFINISH
-	}
-
-	if ord.DealAmount > 0.0 {
-		ord.AvgPrice = ToFloat64(ordmap["field-cash-amount"]) / ord.DealAmount
+		return ORDER_UNFINISH
 	}
+}
 
-	typeS := ordmap["type"].(string)
+func adaptOrderType(typeS string) TradeSide {
 	switch typeS {
 	case "buy-limit":
-		ord.Side = BUY
+		return BUY
 	case "buy-market":
-		ord.Side = BUY_MARKET
+		return BUY_MARKET
 	case "sell-limit":
-		ord.Side = SELL
+		return SELL
 	case "sell-market":
-		ord.Side = SELL_MARKET
+		return SELL_MARKET
 	}
-	return ord
+	return 0
 }
 
 func (hbpro *HuoBiPro) GetOneOrder(orderId string, currency CurrencyPair) (*Order, error) {
@@ -527,9 +540,69 @@ func (hbpro *HuoBiPro) GetKlineRecords(currency CurrencyPair, period, size, sinc
 	return klines, nil
 }
 
-//非个人，整个交易所的交易记录
+/**
+ * 非个人，整个交易所的交易记录
+ * 最多返回最近2000笔 , since: 毫秒 , 只返回since之后的成交 , 按时间升序
+ */
 func (hbpro *HuoBiPro) GetTrades(currencyPair CurrencyPair, since int64) ([]Trade, error) {
-	panic("not implement")
+	symbol := strings.ToLower(currencyPair.AdaptUsdToUsdt().ToSymbol(""))
+	return getHistoryTrades(hbpro.httpClient, hbpro.baseUrl+"/market/history/trade?size=2000&symbol="+symbol, currencyPair, since)
+}
+
+//现货和合约的history/trade接口格式相同
+func getHistoryTrades(client *http.Client, reqUrl string, currencyPair CurrencyPair, since int64) ([]Trade, error) {
+	ret, err := HttpGet(client, reqUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret["status"] != "ok" {
+		return nil, fmt.Errorf("%v: %v", ret["err-code"], ret["err-msg"])
+	}
+
+	data, _ := ret["data"].([]interface{})
+	var trades []Trade
+	for _, e := range data {
+		item, _ := e.(map[string]interface{})
+		list, _ := item["data"].([]interface{})
+		for _, t := range list {
+			tradeItem, isok := t.(map[string]interface{})
+			if !isok {
+				continue
+			}
+			trade := parseTrade(tradeItem)
+			if trade.Date <= since {
+				continue
+			}
+			trade.Pair = currencyPair
+			trades = append(trades, *trade)
+		}
+	}
+
+	sort.Slice(trades, func(i, j int) bool {
+		if trades[i].Date == trades[j].Date {
+			return trades[i].Tid < trades[j].Tid
+		}
+		return trades[i].Date < trades[j].Date
+	})
+	return trades, nil
+}
+
+//{"id", "trade-id"(rest) / "tradeId"(websocket), "amount", "price", "ts", "direction":"buy/sell"}
+func parseTrade(t map[string]interface{}) *Trade {
+	tid := t["trade-id"]
+	if tid == nil {
+		tid = t["tradeId"]
+	}
+	if tid == nil {
+		tid = t["id"]
+	}
+	return &Trade{
+		Tid:    int64(ToFloat64(tid)),
+		Type:   AdaptTradeSide(fmt.Sprint(t["direction"])),
+		Amount: ToFloat64(t["amount"]),
+		Price:  ToFloat64(t["price"]),
+		Date:   int64(ToFloat64(t["ts"]))}
 }
 
 type ecdsaSignature struct {
@@ -567,77 +640,127 @@ func (hbpro *HuoBiPro) toJson(params url.Values) string {
 	return string(jsonData)
 }
 
-func (hbpro *HuoBiPro) createWsConn() {
-
-	onceWsConn.Do(func() {
-		hbpro.ws = NewWsConn("wss://api.huobi.br.com/ws")
-		hbpro.ws.Heartbeat(func() interface{} {
-			return map[string]interface{}{
-				"ping": time.Now().Unix()}
-		}, 5*time.Second)
-		hbpro.ws.ReConnect()
-		hbpro.ws.ReceiveMessage(func(msg []byte) {
-			gzipreader, _ := gzip.NewReader(bytes.NewReader(msg))
-			data, _ := ioutil.ReadAll(gzipreader)
-			datamap := make(map[string]interface{})
-			err := json.Unmarshal(data, &datamap)
-			if err != nil {
-				log.Println("json unmarshal error for ", string(data))
-				return
-			}
+//每个连接最多订阅n个频道 , 超过后新建连接 , 默认不限制
+func (hbpro *HuoBiPro) WsMaxSubsPerConn(n int) *HuoBiPro {
+	hbpro.createWsLock.Lock()
+	defer hbpro.createWsLock.Unlock()
+	hbpro.wsMaxSubs = n
+	return hbpro
+}
 
-			if datamap["ping"] != nil {
-				//log.Println(datamap)
-				hbpro.ws.UpdateActivedTime()
-				hbpro.ws.SendWriteJSON(map[string]interface{}{
-					"pong": datamap["ping"]}) // 回应心跳
-				return
-			}
+//连接在第一次订阅时建立
+func (hbpro *HuoBiPro) wsConns() *WsShards {
+	hbpro.createWsLock.Lock()
+	defer hbpro.createWsLock.Unlock()
 
-			if datamap["pong"] != nil { //
-				hbpro.ws.UpdateActivedTime()
-				return
-			}
+	if hbpro.wsShards == nil {
+		hbpro.wsShards = NewWsShards(hbpro.wsMaxSubs, hbpro.dialWs)
+	}
+	return hbpro.wsShards
+}
 
-			if datamap["id"] != nil { //忽略订阅成功的回执消息
-				log.Println(string(data))
-				return
-			}
+func (hbpro *HuoBiPro) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn("wss://api.huobi.br.com/ws")
+	if err != nil {
+		return nil, err
+	}
+	ws.Heartbeat(func() interface{} {
+		return map[string]interface{}{
+			"ping": time.Now().Unix()}
+	}, 5*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		hbpro.handleWsMessage(ws, msg)
+	})
+	return ws, nil
+}
 
-			ch, isok := datamap["ch"].(string)
-			if !isok {
-				log.Println("error:", string(data))
-				return
-			}
+func (hbpro *HuoBiPro) handleWsMessage(ws *WsConn, msg []byte) {
+	gzipreader, _ := gzip.NewReader(bytes.NewReader(msg))
+	data, _ := ioutil.ReadAll(gzipreader)
+	datamap := make(map[string]interface{})
+	err := json.Unmarshal(data, &datamap)
+	if err != nil {
+		log.Println("json unmarshal error for ", string(data))
+		return
+	}
 
-			tick := datamap["tick"].(map[string]interface{})
-			pair := hbpro.getPairFromChannel(ch)
-			if hbpro.wsTickerHandleMap[ch] != nil {
-				tick := hbpro.parseTickerData(tick)
-				tick.Pair = pair
-				tick.Date = ToUint64(datamap["ts"])
-				(hbpro.wsTickerHandleMap[ch])(tick)
-				return
-			}
+	if datamap["ping"] != nil {
+		//log.Println(datamap)
+		ws.UpdateActivedTime()
+		ws.SendWriteJSON(map[string]interface{}{
+			"pong": datamap["ping"]}) // 回应心跳
+		return
+	}
+
+	if datamap["pong"] != nil { //
+		ws.UpdateActivedTime()
+		return
+	}
 
-			if hbpro.wsDepthHandleMap[ch] != nil {
-				depth := hbpro.parseDepthData(tick)
-				depth.Pair = pair
-				(hbpro.wsDepthHandleMap[ch])(depth)
-				return
+	if datamap["id"] != nil { //订阅回执 , id即订阅的频道
+		id, _ := datamap["id"].(string)
+		if datamap["status"] == "ok" {
+			if datamap["subbed"] != nil {
+				ws.AckSubscribe(id)
 			}
+		} else {
+			ws.FailSubscribe(id, fmt.Errorf("%v: %v", datamap["err-code"], datamap["err-msg"]))
+		}
+		return
+	}
+
+	ch, isok := datamap["ch"].(string)
+	if !isok {
+		log.Println("error:", string(data))
+		return
+	}
+
+	tick, _ := datamap["tick"].(map[string]interface{})
+	pair := hbpro.getPairFromChannel(ch)
+
+	if strings.Contains(ch, ".mbp.") {
+		hbpro.handleWsMbp(ch, tick)
+		return
+	}
 
-			if hbpro.wsKLineHandleMap[ch] != nil {
-				kline := hbpro.parseWsKLineData(tick)
-				kline.Pair = pair
-				(hbpro.wsKLineHandleMap[ch])(kline)
-				return
+	if handle := hbpro.wsHandlers.Trade(ch); handle != nil {
+		list, _ := tick["data"].([]interface{})
+		for _, t := range list {
+			item, isok := t.(map[string]interface{})
+			if !isok {
+				continue
 			}
+			trade := parseTrade(item)
+			trade.Pair = pair
+			handle(trade)
+		}
+		return
+	}
+	if handle := hbpro.wsHandlers.Ticker(ch); handle != nil {
+		tick := hbpro.parseTickerData(tick)
+		tick.Pair = pair
+		tick.Date = ToUint64(datamap["ts"])
+		handle(tick)
+		return
+	}
 
-			//log.Println(string(data))
-		})
-	})
+	if handle := hbpro.wsHandlers.Depth(ch); handle != nil {
+		depth := hbpro.parseDepthData(tick)
+		depth.Pair = pair
+		handle(depth)
+		return
+	}
 
+	if handle := hbpro.wsHandlers.Kline(ch); handle != nil {
+		kline := hbpro.parseWsKLineData(tick)
+		kline.Pair = pair
+		handle(kline)
+		return
+	}
+
+	//log.Println(string(data))
 }
 
 func (hbpro *HuoBiPro) getPairFromChannel(ch string) CurrencyPair {
@@ -759,33 +882,113 @@ func (hbpro *HuoBiPro) GetCurrenciesPrecision() ([]HuoBiProSymbol, error)  {
 }
 
 func (hbpro *HuoBiPro) GetTickerWithWs(pair CurrencyPair, handle func(ticker *Ticker)) error {
-	hbpro.createWsConn()
-	sub := fmt.Sprintf("market.%s.detail", strings.ToLower(pair.ToSymbol("")))
-	hbpro.wsTickerHandleMap[sub] = handle
-	return hbpro.ws.Subscribe(map[string]interface{}{
-		"id":  1,
-		"sub": sub})
+	return hbpro.SubscribeTicker(pair, handle)
 }
 
 func (hbpro *HuoBiPro) GetDepthWithWs(pair CurrencyPair, handle func(dep *Depth)) error {
-	hbpro.createWsConn()
-	sub := fmt.Sprintf("market.%s.depth.step0", strings.ToLower(pair.ToSymbol("")))
-	hbpro.wsDepthHandleMap[sub] = handle
-	return hbpro.ws.Subscribe(map[string]interface{}{
-		"id":  2,
-		"sub": sub})
+	return hbpro.SubscribeDepth(pair, handle)
 }
 
 func (hbpro *HuoBiPro) GetKLineWithWs(pair CurrencyPair, period int, handle func(kline *Kline)) error {
-	hbpro.createWsConn()
+	return hbpro.SubscribeKline(pair, period, handle)
+}
+
+func (hbpro *HuoBiPro) tickerChannel(pair CurrencyPair) string {
+	return fmt.Sprintf("market.%s.detail", strings.ToLower(pair.ToSymbol("")))
+}
+
+func (hbpro *HuoBiPro) depthChannel(pair CurrencyPair) string {
+	return fmt.Sprintf("market.%s.depth.step0", strings.ToLower(pair.ToSymbol("")))
+}
+
+func (hbpro *HuoBiPro) klineChannel(pair CurrencyPair, period int) string {
 	periodS, isOk := _INERNAL_KLINE_PERIOD_CONVERTER[period]
 	if isOk != true {
 		periodS = "1min"
 	}
+	return fmt.Sprintf("market.%s.kline.%s", strings.ToLower(pair.ToSymbol("")), periodS)
+}
+
+//用频道名作为id , 回执里可以找到对应的订阅
+func (hbpro *HuoBiPro) subscribe(sub string) error {
+	return hbpro.wsConns().SubscribeChannel(sub, map[string]interface{}{
+		"id":  sub,
+		"sub": sub}, map[string]interface{}{
+		"id":    sub,
+		"unsub": sub})
+}
+
+func (hbpro *HuoBiPro) unsubscribe(sub string) error {
+	hbpro.wsHandlers.Remove(sub)
+	return hbpro.wsConns().UnsubscribeChannel(sub)
+}
+
+func (hbpro *HuoBiPro) SubscribeTicker(pair CurrencyPair, handle func(ticker *Ticker)) error {
+	sub := hbpro.tickerChannel(pair)
+	hbpro.wsHandlers.SetTicker(sub, handle)
+	return hbpro.subscribe(sub)
+}
+
+func (hbpro *HuoBiPro) UnsubscribeTicker(pair CurrencyPair) error {
+	return hbpro.unsubscribe(hbpro.tickerChannel(pair))
+}
+
+func (hbpro *HuoBiPro) SubscribeDepth(pair CurrencyPair, handle func(dep *Depth)) error {
+	sub := hbpro.depthChannel(pair)
+	hbpro.wsHandlers.SetDepth(sub, handle)
+	return hbpro.subscribe(sub)
+}
+
+func (hbpro *HuoBiPro) UnsubscribeDepth(pair CurrencyPair) error {
+	return hbpro.unsubscribe(hbpro.depthChannel(pair))
+}
+
+func (hbpro *HuoBiPro) SubscribeKline(pair CurrencyPair, period int, handle func(kline *Kline)) error {
+	sub := hbpro.klineChannel(pair, period)
+	hbpro.wsHandlers.SetKline(sub, handle)
+	return hbpro.subscribe(sub)
+}
+
+func (hbpro *HuoBiPro) UnsubscribeKline(pair CurrencyPair, period int) error {
+	return hbpro.unsubscribe(hbpro.klineChannel(pair, period))
+}
+
+func (hbpro *HuoBiPro) OnSubscribeError(handle func(channel string, err error)) {
+	hbpro.wsLock.Lock()
+	hbpro.wsSubErrHandles = append(hbpro.wsSubErrHandles, handle)
+	auth := hbpro.wsAuth
+	hbpro.wsLock.Unlock()
+
+	hbpro.wsConns().OnSubscribeError(handle)
+	if auth != nil {
+		auth.OnSubscribeError(handle)
+	}
+}
+
+//关闭所有websocket连接 , 包括私有频道的连接
+func (hbpro *HuoBiPro) CloseWs() {
+	hbpro.wsConns().CloseWs()
+
+	hbpro.wsLock.Lock()
+	auth := hbpro.wsAuth
+	hbpro.wsAuth = nil
+	hbpro.wsLock.Unlock()
+	if auth != nil {
+		auth.CloseWs()
+	}
+}
+
+func (hbpro *HuoBiPro) tradeChannel(pair CurrencyPair) string {
+	return fmt.Sprintf("market.%s.trade.detail", strings.ToLower(pair.ToSymbol("")))
+}
+
+//逐笔成交
+func (hbpro *HuoBiPro) SubscribeTrade(pair CurrencyPair, handle func(*Trade)) error {
+	sub := hbpro.tradeChannel(pair)
+	hbpro.wsHandlers.SetTrade(sub, handle)
+	return hbpro.subscribe(sub)
+}
 
-	sub := fmt.Sprintf("market.%s.kline.%s", strings.ToLower(pair.ToSymbol("")), periodS)
-	hbpro.wsKLineHandleMap[sub] = handle
-	return hbpro.ws.Subscribe(map[string]interface{}{
-		"id":  3,
-		"sub": sub})
+func (hbpro *HuoBiPro) UnsubscribeTrade(pair CurrencyPair) error {
+	return hbpro.unsubscribe(hbpro.tradeChannel(pair))
 }
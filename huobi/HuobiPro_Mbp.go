@@ -0,0 +1,73 @@
+package huobi
+
+import (
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"log"
+	"strings"
+)
+
+//market.$symbol.mbp.$levels 增量深度
+type wsMbpBook struct {
+	book *OrderBook
+	size int
+}
+
+func (hbpro *HuoBiPro) mbpChannel(pair CurrencyPair, levels int) string {
+	return fmt.Sprintf("market.%s.mbp.%d", strings.ToLower(pair.ToSymbol("")), levels)
+}
+
+/**
+ * {"seqNum":..., "prevSeqNum":..., "bids":[[price, amount]], "asks":[[price, amount]]}
+ * amount为0表示删除该价位 , prevSeqNum与本地序号不一致时用rest深度重新同步
+ */
+func (hbpro *HuoBiPro) handleWsMbp(ch string, tick map[string]interface{}) {
+	hbpro.wsLock.Lock()
+	b := hbpro.wsBooks[ch]
+	hbpro.wsLock.Unlock()
+	if b == nil {
+		return
+	}
+
+	dep := hbpro.parseDepthData(tick)
+	err := b.book.Update(&DepthUpdate{
+		Seq:     int64(ToFloat64(tick["seqNum"])),
+		PrevSeq: int64(ToFloat64(tick["prevSeqNum"])),
+		AskList: dep.AskList,
+		BidList: dep.BidList})
+	if err != nil {
+		log.Printf("[%s] %s", ch, err)
+		return
+	}
+
+	if handle := hbpro.wsHandlers.Depth(ch); handle != nil {
+		handle(b.book.Depth(b.size))
+	}
+}
+
+/**
+ * 增量深度 , levels: 5 , 20 , 150
+ * 本地用rest的step0深度作为全量 , 收到第一个增量或者发现断档时重新同步
+ * rest深度没有seqNum , 同步后的第一个增量无条件接受 , 之后按prevSeqNum检查连续性
+ */
+func (hbpro *HuoBiPro) SubscribeMbpDepth(pair CurrencyPair, levels int, handle func(dep *Depth)) error {
+	sub := hbpro.mbpChannel(pair, levels)
+	book := NewOrderBook(pair).
+		SetSnapshotFunc(RestDepthSnapshot(hbpro, levels, pair)).
+		SetMaxLevels(levels)
+
+	hbpro.wsLock.Lock()
+	hbpro.wsBooks[sub] = &wsMbpBook{book: book, size: levels}
+	hbpro.wsLock.Unlock()
+
+	hbpro.wsHandlers.SetDepth(sub, handle)
+	return hbpro.subscribe(sub)
+}
+
+func (hbpro *HuoBiPro) UnsubscribeMbpDepth(pair CurrencyPair, levels int) error {
+	sub := hbpro.mbpChannel(pair, levels)
+	hbpro.wsLock.Lock()
+	delete(hbpro.wsBooks, sub)
+	hbpro.wsLock.Unlock()
+	return hbpro.unsubscribe(sub)
+}
@@ -0,0 +1,81 @@
+package huobi
+
+import (
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHuoBiPro_handleWsMbp(t *testing.T) {
+	ex := NewHuoBiPro(http.DefaultClient, "", "", "")
+	ws := &goex.WsConn{}
+
+	ch := ex.mbpChannel(goex.BTC_USDT, 5)
+	assert.Equal(t, "market.btcusdt.mbp.5", ch)
+
+	book := goex.NewOrderBook(goex.BTC_USDT).SetMaxLevels(5)
+	book.Snapshot(&goex.Depth{
+		AskList: goex.DepthRecords{{Price: 101, Amount: 1}, {Price: 102, Amount: 2}},
+		BidList: goex.DepthRecords{{Price: 100, Amount: 1}, {Price: 99, Amount: 2}}}, 100)
+	ex.wsBooks[ch] = &wsMbpBook{book: book, size: 5}
+
+	var deps []*goex.Depth
+	ex.wsHandlers.SetDepth(ch, func(dep *goex.Depth) {
+		deps = append(deps, dep)
+	})
+
+	ex.handleWsMessage(ws, gzipMessage(`{"ch":"market.btcusdt.mbp.5","ts":1573199608679,"tick":{"seqNum":101,"prevSeqNum":100,"asks":[[101,0],[103,3]],"bids":[[100,5]]}}`))
+	ex.handleWsMessage(ws, gzipMessage(`{"ch":"market.btcusdt.mbp.5","ts":1573199608680,"tick":{"seqNum":105,"prevSeqNum":103,"asks":[[104,4]],"bids":[]}}`))
+
+	assert.Equal(t, 1, len(deps))
+	assert.Equal(t, goex.DepthRecords{{Price: 102, Amount: 2}, {Price: 103, Amount: 3}}, deps[0].AskList)
+	assert.Equal(t, goex.DepthRecords{{Price: 100, Amount: 5}, {Price: 99, Amount: 2}}, deps[0].BidList)
+	assert.False(t, book.IsSynced())
+}
+
+func TestHuoBiPro_handleWsTrade(t *testing.T) {
+	ex := NewHuoBiPro(http.DefaultClient, "", "", "")
+	ws := &goex.WsConn{}
+
+	var trades []*goex.Trade
+	ch := ex.tradeChannel(goex.BTC_USDT)
+	ex.wsHandlers.SetTrade(ch, func(trade *goex.Trade) {
+		trades = append(trades, trade)
+	})
+
+	ex.handleWsMessage(ws, gzipMessage(`{"ch":"market.btcusdt.trade.detail","ts":1489474082831,"tick":{"id":14650745135,"ts":1533265950234,"data":[null,"bad",{"amount":0.0099,"ts":1533265950234,"id":146507451359183894799,"tradeId":102043495674,"price":401.74,"direction":"buy"},{"amount":0.5,"ts":1533265950235,"id":146507451359183894800,"tradeId":102043495675,"price":401.7,"direction":"sell"}]}}`))
+
+	assert.Equal(t, 2, len(trades))
+	assert.Equal(t, int64(102043495674), trades[0].Tid)
+	assert.Equal(t, goex.TradeSide(goex.BUY), trades[0].Type)
+	assert.Equal(t, 401.74, trades[0].Price)
+	assert.Equal(t, int64(1533265950234), trades[0].Date)
+	assert.Equal(t, goex.BTC_USDT, trades[0].Pair)
+	assert.Equal(t, goex.TradeSide(goex.SELL), trades[1].Type)
+}
+
+func TestHuoBiPro_GetTrades(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/market/history/trade", r.URL.Path)
+		assert.Equal(t, "btcusdt", r.URL.Query().Get("symbol"))
+		w.Write([]byte(`{"status":"ok","data":[
+			{"id":31618787514,"ts":1544390317905,"data":[null,{"amount":0.5,"ts":1544390317905,"trade-id":102043495676,"id":3161878751413,"price":3882.1,"direction":"sell"}]},
+			{"id":31618787513,"ts":1544390317900,"data":[{"amount":1,"ts":1544390317900,"trade-id":102043495675,"id":3161878751412,"price":3882.2,"direction":"buy"}]},
+			{"id":31618787512,"ts":1544390317800,"data":[{"amount":2,"ts":1544390317800,"trade-id":102043495674,"id":3161878751411,"price":3882.3,"direction":"buy"}]}]}`))
+	}))
+	defer srv.Close()
+
+	ex := NewHuoBiPro(http.DefaultClient, "", "", "")
+	ex.baseUrl = srv.URL
+
+	trades, err := ex.GetTrades(goex.BTC_USDT, 1544390317800)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(trades))
+	assert.Equal(t, int64(102043495675), trades[0].Tid)
+	assert.Equal(t, goex.TradeSide(goex.BUY), trades[0].Type)
+	assert.Equal(t, int64(102043495676), trades[1].Tid)
+	assert.Equal(t, goex.TradeSide(goex.SELL), trades[1].Type)
+	assert.Equal(t, goex.BTC_USDT, trades[1].Pair)
+}
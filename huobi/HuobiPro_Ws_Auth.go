@@ -0,0 +1,271 @@
+package huobi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	_WS_AUTH_PATH    = "/ws/v1"
+	_WS_AUTH_CHANNEL = "auth"
+)
+
+type wsAuthHandlers struct {
+	balance func(accountId string, sub *SubAccount)
+}
+
+//每次发送时重新签名 , 重连后重新认证不会因为时间戳过期失败
+type wsAuthRequest struct {
+	hbpro *HuoBiPro
+}
+
+func (r wsAuthRequest) MarshalJSON() ([]byte, error) {
+	params := url.Values{}
+	r.hbpro.buildPostForm("GET", _WS_AUTH_PATH, &params)
+
+	msg := map[string]string{"op": "auth"}
+	for k := range params {
+		msg[k] = params.Get(k)
+	}
+	return json.Marshal(msg)
+}
+
+func (hbpro *HuoBiPro) wsAuthUrl() string {
+	return strings.Replace(hbpro.baseUrl, "https://", "wss://", 1) + _WS_AUTH_PATH
+}
+
+/**
+ * 私有频道的连接在第一次订阅时建立
+ * 认证作为第一个订阅 , 重连后先重新认证再重发私有频道的订阅
+ */
+func (hbpro *HuoBiPro) authConn() (*WsConn, error) {
+	hbpro.createWsLock.Lock()
+	defer hbpro.createWsLock.Unlock()
+
+	hbpro.wsLock.Lock()
+	auth := hbpro.wsAuth
+	handles := append([]func(string, error){}, hbpro.wsSubErrHandles...)
+	hbpro.wsLock.Unlock()
+	if auth != nil {
+		return auth, nil
+	}
+
+	ws, err := NewWsConn(hbpro.wsAuthUrl())
+	if err != nil {
+		return nil, err
+	}
+	ws.AckTimeout(10 * time.Second)
+	for _, handle := range handles {
+		ws.OnSubscribeError(handle)
+	}
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		hbpro.handleWsAuthMessage(ws, msg)
+	})
+
+	err = ws.SubscribeChannel(_WS_AUTH_CHANNEL, wsAuthRequest{hbpro}, nil)
+	if err != nil {
+		ws.CloseWs()
+		return nil, err
+	}
+
+	hbpro.wsLock.Lock()
+	hbpro.wsAuth = ws
+	hbpro.wsLock.Unlock()
+	return ws, nil
+}
+
+/**
+ * {"op":"ping","ts":...} 心跳 , 需要回复pong
+ * {"op":"auth","err-code":0} 认证回执
+ * {"op":"sub","topic":"orders.htusdt","err-code":0} 订阅回执
+ * {"op":"notify","topic":"orders.htusdt","data":{...}} 推送
+ */
+func (hbpro *HuoBiPro) handleWsAuthMessage(ws *WsConn, msg []byte) {
+	gzipreader, _ := gzip.NewReader(bytes.NewReader(msg))
+	data, _ := ioutil.ReadAll(gzipreader)
+	datamap := make(map[string]interface{})
+	err := json.Unmarshal(data, &datamap)
+	if err != nil {
+		log.Println("json unmarshal error for ", string(data))
+		return
+	}
+
+	ws.UpdateActivedTime()
+	topic, _ := datamap["topic"].(string)
+	switch datamap["op"] {
+	case "ping":
+		ws.SendWriteJSON(map[string]interface{}{
+			"op": "pong",
+			"ts": datamap["ts"]})
+	case "auth":
+		if ToInt(datamap["err-code"]) == 0 {
+			ws.AckSubscribe(_WS_AUTH_CHANNEL)
+		} else {
+			ws.FailSubscribe(_WS_AUTH_CHANNEL, fmt.Errorf("%v: %v", datamap["err-code"], datamap["err-msg"]))
+		}
+	case "sub":
+		if ToInt(datamap["err-code"]) == 0 {
+			ws.AckSubscribe(topic)
+		} else {
+			ws.FailSubscribe(topic, fmt.Errorf("%v: %v", datamap["err-code"], datamap["err-msg"]))
+		}
+	case "notify":
+		info, _ := datamap["data"].(map[string]interface{})
+		if topic == "accounts" {
+			hbpro.handleWsBalance(info)
+		} else if strings.HasPrefix(topic, "orders.") {
+			hbpro.wsLock.Lock()
+			handle := hbpro.wsOrderHandles[topic]
+			hbpro.wsLock.Unlock()
+			if handle != nil {
+				handle(hbpro.parseWsOrder(info))
+			}
+		}
+	}
+}
+
+/**
+ * {"event":"order.place", "list":[{"account-id", "currency", "type":"trade/frozen", "balance"}]}
+ * 每次只推送变化的部分 , 回调按账户和币种合并后的余额
+ */
+func (hbpro *HuoBiPro) handleWsBalance(info map[string]interface{}) {
+	list, _ := info["list"].([]interface{})
+
+	type balance struct {
+		accountId string
+		sub       SubAccount
+	}
+	var changed []balance
+
+	hbpro.wsLock.Lock()
+	handle := hbpro.wsAuthHandle.balance
+	for _, v := range list {
+		item, isok := v.(map[string]interface{})
+		if !isok {
+			continue
+		}
+		accountId := fmt.Sprint(ToInt(item["account-id"]))
+		currency := NewCurrency(fmt.Sprint(item["currency"]), "")
+		key := accountId + ":" + currency.Symbol
+
+		sub := hbpro.wsBalances[key]
+		if sub == nil {
+			sub = &SubAccount{Currency: currency}
+			hbpro.wsBalances[key] = sub
+		}
+		switch item["type"] {
+		case "trade":
+			sub.Amount = ToFloat64(item["balance"])
+		case "frozen":
+			sub.ForzenAmount = ToFloat64(item["balance"])
+		}
+		changed = append(changed, balance{accountId, *sub})
+	}
+	hbpro.wsLock.Unlock()
+
+	if handle == nil {
+		return
+	}
+	for i := range changed {
+		handle(changed[i].accountId, &changed[i].sub)
+	}
+}
+
+/**
+ * {"order-id", "symbol", "order-amount", "order-price", "created-at", "order-type", "order-state",
+ *  "filled-amount", "filled-cash-amount", "filled-fees", "unfilled-amount"}
+ * filled-*为累计值
+ */
+func (hbpro *HuoBiPro) parseWsOrder(info map[string]interface{}) *Order {
+	ord := &Order{
+		OrderID:    ToInt(info["order-id"]),
+		OrderID2:   fmt.Sprint(ToInt(info["order-id"])),
+		Currency:   hbpro.getPairFromChannel("orders." + fmt.Sprint(info["symbol"])),
+		Amount:     ToFloat64(info["order-amount"]),
+		Price:      ToFloat64(info["order-price"]),
+		DealAmount: ToFloat64(info["filled-amount"]),
+		Fee:        ToFloat64(info["filled-fees"]),
+		OrderTime:  ToInt(info["created-at"]),
+		Status:     adaptOrderState(fmt.Sprint(info["order-state"])),
+		Side:       adaptOrderType(fmt.Sprint(info["order-type"]))}
+	if ord.DealAmount > 0 {
+		ord.AvgPrice = ToFloat64(info["filled-cash-amount"]) / ord.DealAmount
+	}
+	return ord
+}
+
+func (hbpro *HuoBiPro) subscribePrivate(topic string, params map[string]interface{}) error {
+	ws, err := hbpro.authConn()
+	if err != nil {
+		return err
+	}
+
+	sub := map[string]interface{}{"op": "sub", "cid": topic, "topic": topic}
+	for k, v := range params {
+		sub[k] = v
+	}
+	return ws.SubscribeChannel(topic, sub, map[string]interface{}{
+		"op":    "unsub",
+		"cid":   topic,
+		"topic": topic})
+}
+
+func (hbpro *HuoBiPro) unsubscribePrivate(topic string) error {
+	hbpro.wsLock.Lock()
+	auth := hbpro.wsAuth
+	hbpro.wsLock.Unlock()
+	if auth == nil {
+		return nil
+	}
+	return auth.UnsubscribeChannel(topic)
+}
+
+func (hbpro *HuoBiPro) ordersTopic(pair CurrencyPair) string {
+	return "orders." + strings.ToLower(pair.ToSymbol(""))
+}
+
+/**
+ * 订单变化 , 每次推送订单的完整状态 , 可以直接交给OrderTracker.Update
+ */
+func (hbpro *HuoBiPro) SubscribeOrders(pair CurrencyPair, handle func(order *Order)) error {
+	topic := hbpro.ordersTopic(pair)
+	hbpro.wsLock.Lock()
+	hbpro.wsOrderHandles[topic] = func(order *Order) {
+		order.Currency = pair
+		handle(order)
+	}
+	hbpro.wsLock.Unlock()
+	return hbpro.subscribePrivate(topic, nil)
+}
+
+func (hbpro *HuoBiPro) UnsubscribeOrders(pair CurrencyPair) error {
+	topic := hbpro.ordersTopic(pair)
+	hbpro.wsLock.Lock()
+	delete(hbpro.wsOrderHandles, topic)
+	hbpro.wsLock.Unlock()
+	return hbpro.unsubscribePrivate(topic)
+}
+
+//所有账户的余额变化 , Amount为可用 , ForzenAmount为冻结
+func (hbpro *HuoBiPro) SubscribeAccounts(handle func(accountId string, sub *SubAccount)) error {
+	hbpro.wsLock.Lock()
+	hbpro.wsAuthHandle.balance = handle
+	hbpro.wsLock.Unlock()
+	return hbpro.subscribePrivate("accounts", map[string]interface{}{"model": "0"})
+}
+
+func (hbpro *HuoBiPro) UnsubscribeAccounts() error {
+	hbpro.wsLock.Lock()
+	hbpro.wsBalances = make(map[string]*SubAccount)
+	hbpro.wsLock.Unlock()
+	return hbpro.unsubscribePrivate("accounts")
+}
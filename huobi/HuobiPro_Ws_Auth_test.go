@@ -0,0 +1,66 @@
+package huobi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func gzipMessage(msg string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(msg))
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestHuoBiPro_wsAuthRequest(t *testing.T) {
+	ex := NewHuoBiPro(http.DefaultClient, "key", "secret", "")
+	data, err := json.Marshal(wsAuthRequest{ex})
+	assert.Nil(t, err)
+
+	var msg map[string]string
+	json.Unmarshal(data, &msg)
+	assert.Equal(t, "auth", msg["op"])
+	assert.Equal(t, "key", msg["AccessKeyId"])
+	assert.Equal(t, "2", msg["SignatureVersion"])
+	assert.NotEmpty(t, msg["Signature"])
+	assert.Equal(t, "wss://api.huobi.br.com/ws/v1", ex.wsAuthUrl())
+}
+
+func TestHuoBiPro_handleWsAuthMessage(t *testing.T) {
+	ex := NewHuoBiPro(http.DefaultClient, "", "", "")
+	ws := &goex.WsConn{}
+
+	var orders []*goex.Order
+	ex.wsOrderHandles["orders.htusdt"] = func(order *goex.Order) {
+		orders = append(orders, order)
+	}
+	var balances []*goex.SubAccount
+	ex.wsAuthHandle.balance = func(accountId string, sub *goex.SubAccount) {
+		assert.Equal(t, "419013", accountId)
+		balances = append(balances, sub)
+	}
+
+	ex.handleWsAuthMessage(ws, gzipMessage(`{"op":"auth","ts":1489474081631,"err-code":0,"data":{"user-id":12345678}}`))
+	ex.handleWsAuthMessage(ws, gzipMessage(`{"op":"notify","topic":"orders.htusdt","ts":1522856623232,"data":{"seq-id":94984,"order-id":2039498445,"symbol":"htusdt","account-id":100077,"order-amount":"5.000000000000000000","order-price":"1.662100000000000000","created-at":1522858623622,"order-type":"buy-limit","order-source":"api","order-state":"partial-filled","role":"taker","price":"1.662100000000000000","filled-amount":"2.000000000000000000","unfilled-amount":"3.000000000000000000","filled-cash-amount":"3.324200000000000000","filled-fees":"0.004000000000000000"}}`))
+	ex.handleWsAuthMessage(ws, gzipMessage(`{"op":"notify","topic":"accounts","ts":1522856623232,"data":{"event":"order.place","list":[{"account-id":419013,"currency":"usdt","type":"trade","balance":"500009195917.4362872650"}]}}`))
+	ex.handleWsAuthMessage(ws, gzipMessage(`{"op":"notify","topic":"accounts","ts":1522856623233,"data":{"event":"order.place","list":[{"account-id":419013,"currency":"usdt","type":"frozen","balance":"10"}]}}`))
+
+	assert.Equal(t, 1, len(orders))
+	assert.Equal(t, 2039498445, orders[0].OrderID)
+	assert.Equal(t, goex.NewCurrencyPair2("HT_USDT"), orders[0].Currency)
+	assert.Equal(t, goex.TradeSide(goex.BUY), orders[0].Side)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_PART_FINISH), orders[0].Status)
+	assert.Equal(t, 2.0, orders[0].DealAmount)
+	assert.InDelta(t, 1.6621, orders[0].AvgPrice, 1e-9)
+
+	assert.Equal(t, 2, len(balances))
+	assert.Equal(t, 500009195917.4362872650, balances[1].Amount)
+	assert.Equal(t, 10.0, balances[1].ForzenAmount)
+	assert.Equal(t, goex.USDT, balances[1].Currency)
+}
@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -30,6 +31,18 @@ type Kraken struct {
 	httpClient *http.Client
 	accessKey,
 	secretKey string
+
+	wsShards        *WsShards
+	wsMaxSubs       int
+	createWsLock    sync.Mutex
+	wsHandlers      *WsHandlers
+	wsLock          sync.Mutex
+	wsBooks         map[string]*wsBook
+	wsAuth          *WsConn
+	wsToken         string
+	wsTokenTime     time.Time
+	wsAuthHandle    wsAuthHandlers
+	wsSubErrHandles []func(channel string, err error)
 }
 
 var (
@@ -40,8 +53,26 @@ var (
 	PRIVATE    = "private/"
 )
 
+//interval单位为分钟
+var _KLINE_PERIOD_CONVERTER = map[int]int{
+	KLINE_PERIOD_1MIN:  1,
+	KLINE_PERIOD_5MIN:  5,
+	KLINE_PERIOD_15MIN: 15,
+	KLINE_PERIOD_30MIN: 30,
+	KLINE_PERIOD_60MIN: 60,
+	KLINE_PERIOD_1H:    60,
+	KLINE_PERIOD_4H:    240,
+	KLINE_PERIOD_1DAY:  1440,
+	KLINE_PERIOD_1WEEK: 10080,
+}
+
 func New(client *http.Client, accesskey, secretkey string) *Kraken {
-	return &Kraken{client, accesskey, secretkey}
+	return &Kraken{
+		httpClient: client,
+		accessKey:  accesskey,
+		secretKey:  secretkey,
+		wsHandlers: NewWsHandlers(),
+		wsBooks:    make(map[string]*wsBook)}
 }
 
 func (k *Kraken) placeOrder(orderType, side, amount, price string, pair CurrencyPair) (*Order, error) {
@@ -268,13 +299,94 @@ func (k *Kraken) GetDepth(size int, currency CurrencyPair) (*Depth, error) {
 	return &dep, nil
 }
 
+/**
+ * since: unix秒 , 返回since之后的k线(不含since) , 0为最近的数据 , 最多返回720条 , size<=0返回全部
+ * [time, open, high, low, close, vwap, volume, count]
+ */
 func (k *Kraken) GetKlineRecords(currency CurrencyPair, period, size, since int) ([]Kline, error) {
-	panic("")
+	interval, isok := _KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return nil, ErrKlinePeriodNotSupport
+	}
+
+	apiuri := fmt.Sprintf("public/OHLC?pair=%s&interval=%d", k.convertPair(currency).ToSymbol(""), interval)
+	if since > 0 {
+		apiuri += fmt.Sprintf("&since=%d", since)
+	}
+
+	var resultmap map[string]interface{}
+	err := k.doAuthenticatedRequest("GET", apiuri, url.Values{}, &resultmap)
+	if err != nil {
+		return nil, err
+	}
+
+	var klines []Kline
+	for key, v := range resultmap {
+		if key == "last" {
+			continue
+		}
+		records, _ := v.([]interface{})
+		for _, r := range records {
+			record, _ := r.([]interface{})
+			if len(record) < 7 {
+				continue
+			}
+			klines = append(klines, Kline{
+				Pair:      currency,
+				Timestamp: int64(ToFloat64(record[0])),
+				Open:      ToFloat64(record[1]),
+				High:      ToFloat64(record[2]),
+				Low:       ToFloat64(record[3]),
+				Close:     ToFloat64(record[4]),
+				Vol:       ToFloat64(record[6])})
+		}
+	}
+
+	//指定since时从since开始取 , 否则取最新的size条
+	if size > 0 && len(klines) > size {
+		if since > 0 {
+			klines = klines[:size]
+		} else {
+			klines = klines[len(klines)-size:]
+		}
+	}
+	return klines, nil
 }
 
-//非个人，整个交易所的交易记录
+/**
+ * 非个人，整个交易所的交易记录
+ * since: 上次返回的last(纳秒) , 0为最近的数据
+ * [price, volume, time, buy/sell, market/limit, miscellaneous]
+ */
 func (k *Kraken) GetTrades(currencyPair CurrencyPair, since int64) ([]Trade, error) {
-	panic("")
+	apiuri := "public/Trades?pair=" + k.convertPair(currencyPair).ToSymbol("")
+	if since > 0 {
+		apiuri += fmt.Sprintf("&since=%d", since)
+	}
+
+	var resultmap map[string]interface{}
+	err := k.doAuthenticatedRequest("GET", apiuri, url.Values{}, &resultmap)
+	if err != nil {
+		return nil, err
+	}
+
+	var trades []Trade
+	for key, v := range resultmap {
+		if key == "last" {
+			continue
+		}
+		records, _ := v.([]interface{})
+		for _, r := range records {
+			record, _ := r.([]interface{})
+			if len(record) < 4 {
+				continue
+			}
+			trade := parseTrade(record)
+			trade.Pair = currencyPair
+			trades = append(trades, *trade)
+		}
+	}
+	return trades, nil
 }
 
 func (k *Kraken) GetExchangeName() string {
@@ -344,6 +456,15 @@ func (k *Kraken) convertCurrency(currencySymbol string) Currency {
 	return NewCurrency(currencySymbol, "")
 }
 
+//kraken的XBT对应BTC
+func (k *Kraken) adaptCurrency(currencySymbol string) Currency {
+	currency := k.convertCurrency(currencySymbol)
+	if currency.Symbol == "XBT" {
+		return BTC
+	}
+	return currency
+}
+
 func (k *Kraken) convertPair(pair CurrencyPair) CurrencyPair {
 	if "BTC" == pair.CurrencyA.Symbol {
 		return NewCurrencyPair(XBT, pair.CurrencyB)
@@ -0,0 +1,504 @@
+package kraken
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"hash/crc32"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WS_URL = "wss://ws.kraken.com"
+
+	_WS_BOOK_DEPTH     = 10
+	_WS_CHECKSUM_DEPTH = 10 //checksum只计算前10档
+)
+
+/**
+ * 本地维护的book , 交易所只推送前depth档的增量 , 超出的档位丢弃
+ * checksum要求价格和数量按推送的小数位格式化 , 小数位从推送的字符串中获取
+ */
+type wsBook struct {
+	pair     CurrencyPair
+	depth    int
+	book     *OrderBook
+	priceDec int
+	volDec   int
+	handle   func(*Depth)
+}
+
+func newWsBook(pair CurrencyPair, depth int, handle func(*Depth)) *wsBook {
+	b := &wsBook{pair: pair, depth: depth, handle: handle}
+	b.book = NewOrderBook(pair).SetMaxLevels(depth).SetChecksumFunc(b.checksum)
+	return b
+}
+
+/**
+ * 全量: [{"as":[[price, volume, timestamp], ...], "bs":[...]}]
+ * 增量: [{"a":[[price, volume, timestamp, "r"], ...]}, {"b":[...], "c":"checksum"}] , a和b可能在同一个对象中
+ */
+func (b *wsBook) apply(payload []interface{}) error {
+	dep := &Depth{Pair: b.pair}
+	update := &DepthUpdate{}
+	isSnapshot := false
+
+	for _, p := range payload {
+		m, _ := p.(map[string]interface{})
+		for key, v := range m {
+			levels, _ := v.([]interface{})
+			switch key {
+			case "as":
+				isSnapshot = true
+				dep.AskList = b.parseLevels(levels)
+			case "bs":
+				isSnapshot = true
+				dep.BidList = b.parseLevels(levels)
+			case "a":
+				update.AskList = append(update.AskList, b.parseLevels(levels)...)
+			case "b":
+				update.BidList = append(update.BidList, b.parseLevels(levels)...)
+			case "c":
+				cs, err := strconv.ParseUint(fmt.Sprint(v), 10, 32)
+				update.Checksum = int32(uint32(cs))
+				update.HasChecksum = err == nil
+			}
+		}
+	}
+
+	if isSnapshot {
+		b.book.Snapshot(dep, 0)
+		return nil
+	}
+	return b.book.Update(update)
+}
+
+func (b *wsBook) parseLevels(levels []interface{}) DepthRecords {
+	records := make(DepthRecords, 0, len(levels))
+	for _, l := range levels {
+		level, _ := l.([]interface{})
+		if len(level) < 2 {
+			continue
+		}
+		price, volume := wsString(level, 0), wsString(level, 1)
+		b.priceDec, b.volDec = decimals(price), decimals(volume)
+		records = append(records, DepthRecord{Price: ToFloat64(price), Amount: ToFloat64(volume)})
+	}
+	return records
+}
+
+/**
+ * 前10档ask(价格升序)和前10档bid(价格降序)依次拼接 price+volume ,
+ * 价格和数量去掉小数点和前导0 , crc32
+ */
+func (b *wsBook) checksum(asks, bids DepthRecords) int32 {
+	var buf strings.Builder
+	for _, levels := range []DepthRecords{asks, bids} {
+		for i := 0; i < _WS_CHECKSUM_DEPTH && i < len(levels); i++ {
+			buf.WriteString(checksumField(levels[i].Price, b.priceDec))
+			buf.WriteString(checksumField(levels[i].Amount, b.volDec))
+		}
+	}
+	return int32(crc32.ChecksumIEEE([]byte(buf.String())))
+}
+
+func checksumField(v float64, dec int) string {
+	s := strings.Replace(strconv.FormatFloat(v, 'f', dec, 64), ".", "", 1)
+	return strings.TrimLeft(s, "0")
+}
+
+func decimals(s string) int {
+	if i := strings.Index(s, "."); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+//每个连接最多订阅n个频道 , 超过后新建连接 , kraken没有公布限制 , 默认100
+func (k *Kraken) WsMaxSubsPerConn(n int) *Kraken {
+	k.createWsLock.Lock()
+	defer k.createWsLock.Unlock()
+	k.wsMaxSubs = n
+	return k
+}
+
+//连接在第一次订阅时建立
+func (k *Kraken) wsConns() *WsShards {
+	k.createWsLock.Lock()
+	defer k.createWsLock.Unlock()
+
+	if k.wsShards == nil {
+		if k.wsMaxSubs == 0 {
+			k.wsMaxSubs = 100
+		}
+		k.wsShards = NewWsShards(k.wsMaxSubs, k.dialWs)
+	}
+	return k.wsShards
+}
+
+func (k *Kraken) dialWs() (*WsConn, error) {
+	return k.dial(WS_URL)
+}
+
+func (k *Kraken) dial(wsURL string) (*WsConn, error) {
+	ws, err := NewWsConn(wsURL)
+	if err != nil {
+		return nil, err
+	}
+	ws.Heartbeat(func() interface{} {
+		return map[string]interface{}{
+			"event": "ping",
+			"reqid": time.Now().Unix()}
+	}, 10*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		k.handleWsMessage(ws, msg)
+	})
+	return ws, nil
+}
+
+/**
+ * 事件是json对象 , 数据是数组:
+ * 公共频道 [channelID, payload..., channelName, pair]
+ * 私有频道 [payload, channelName, {"sequence":n}]
+ */
+func (k *Kraken) handleWsMessage(ws *WsConn, msg []byte) {
+	ws.UpdateActivedTime()
+
+	if len(msg) > 0 && msg[0] == '{' {
+		datamap := make(map[string]interface{})
+		err := json.Unmarshal(msg, &datamap)
+		if err != nil {
+			log.Println("json unmarshal error for ", string(msg))
+			return
+		}
+		k.handleWsEvent(ws, datamap)
+		return
+	}
+
+	var data []interface{}
+	err := json.Unmarshal(msg, &data)
+	if err != nil || len(data) < 3 {
+		log.Println("json unmarshal error for ", string(msg))
+		return
+	}
+
+	if _, isok := data[0].(float64); !isok {
+		k.handleWsPrivateMessage(data)
+		return
+	}
+
+	channelName := wsString(data, len(data)-2)
+	channel := channelName + ":" + wsString(data, len(data)-1)
+	payload := data[1 : len(data)-2]
+
+	switch {
+	case channelName == "ticker":
+		handle := k.wsHandlers.Ticker(channel)
+		if m, isok := payload[0].(map[string]interface{}); isok && handle != nil {
+			handle(parseWsTicker(m))
+		}
+	case channelName == "spread":
+		handle := k.wsHandlers.Ticker(channel)
+		if entry, isok := payload[0].([]interface{}); isok && handle != nil {
+			handle(parseWsSpread(entry))
+		}
+	case channelName == "trade":
+		handle := k.wsHandlers.Trade(channel)
+		if handle == nil {
+			return
+		}
+		entries, _ := payload[0].([]interface{})
+		for _, e := range entries {
+			if entry, isok := e.([]interface{}); isok && len(entry) > 3 {
+				handle(parseTrade(entry))
+			}
+		}
+	case strings.HasPrefix(channelName, "ohlc-"):
+		handle := k.wsHandlers.Kline(channel)
+		interval, _ := strconv.Atoi(strings.TrimPrefix(channelName, "ohlc-"))
+		if entry, isok := payload[0].([]interface{}); isok && handle != nil {
+			handle(parseWsKline(entry, interval))
+		}
+	case strings.HasPrefix(channelName, "book-"):
+		k.updateWsBook(ws, channel, payload)
+	}
+}
+
+func (k *Kraken) handleWsEvent(ws *WsConn, datamap map[string]interface{}) {
+	switch datamap["event"] {
+	case "subscriptionStatus":
+		subscription, _ := datamap["subscription"].(map[string]interface{})
+		channel := wsChannelKey(subscription, datamap["pair"])
+		switch datamap["status"] {
+		case "subscribed":
+			ws.AckSubscribe(channel)
+		case "error":
+			ws.FailSubscribe(channel, errors.New(fmt.Sprint(datamap["errorMessage"])))
+		}
+	case "heartbeat", "pong", "systemStatus":
+	default:
+		log.Println(datamap)
+	}
+}
+
+/**
+ * 订阅消息和订阅回执都用这个key , 例如:
+ * ticker:XBT/USD , book-10:XBT/USD , ohlc-5:XBT/USD , 私有频道没有pair: ownTrades
+ */
+func wsChannelKey(subscription map[string]interface{}, pair interface{}) string {
+	name := fmt.Sprint(subscription["name"])
+	switch name {
+	case "book":
+		name = fmt.Sprintf("book-%v", subscription["depth"])
+	case "ohlc":
+		name = fmt.Sprintf("ohlc-%v", subscription["interval"])
+	}
+	if pair == nil {
+		return name
+	}
+	return fmt.Sprintf("%s:%v", name, pair)
+}
+
+func (k *Kraken) updateWsBook(ws *WsConn, channel string, payload []interface{}) {
+	k.wsLock.Lock()
+	b := k.wsBooks[channel]
+	if b == nil {
+		k.wsLock.Unlock()
+		return
+	}
+	err := b.apply(payload)
+	dep := b.book.Depth(b.depth)
+	k.wsLock.Unlock()
+
+	if err == nil {
+		b.handle(dep)
+		return
+	}
+	if err == ErrOrderBookNotSync {
+		return //等待重新订阅后的快照
+	}
+
+	//checksum错误 , 重新订阅获取新的快照
+	log.Printf("[%s] %s , resubscribe ...", channel, err)
+	sub, isok := ws.Subscription(channel)
+	if !isok {
+		return
+	}
+	ws.SendWriteJSON(sub.Unsub)
+	ws.SendWriteJSON(sub.Sub)
+}
+
+//XBT/USD
+func (k *Kraken) wsPair(pair CurrencyPair) string {
+	return k.convertPair(pair).ToSymbol("/")
+}
+
+func (k *Kraken) wsPairToCurrencyPair(pair string) CurrencyPair {
+	currencies := strings.Split(pair, "/")
+	if len(currencies) != 2 {
+		return UNKNOWN_PAIR
+	}
+	return NewCurrencyPair(k.adaptCurrency(currencies[0]), k.adaptCurrency(currencies[1]))
+}
+
+func (k *Kraken) subscribe(pair CurrencyPair, subscription map[string]interface{}) error {
+	wsPair := k.wsPair(pair)
+	sub := map[string]interface{}{
+		"event":        "subscribe",
+		"pair":         []string{wsPair},
+		"subscription": subscription}
+	unsub := map[string]interface{}{
+		"event":        "unsubscribe",
+		"pair":         []string{wsPair},
+		"subscription": subscription}
+	return k.wsConns().SubscribeChannel(wsChannelKey(subscription, wsPair), sub, unsub)
+}
+
+func (k *Kraken) unsubscribe(channel string) error {
+	k.wsHandlers.Remove(channel)
+	k.wsLock.Lock()
+	delete(k.wsBooks, channel)
+	k.wsLock.Unlock()
+	return k.wsConns().UnsubscribeChannel(channel)
+}
+
+func (k *Kraken) SubscribeTicker(pair CurrencyPair, handle func(ticker *Ticker)) error {
+	k.wsHandlers.SetTicker("ticker:"+k.wsPair(pair), func(ticker *Ticker) {
+		ticker.Pair = pair
+		handle(ticker)
+	})
+	return k.subscribe(pair, map[string]interface{}{"name": "ticker"})
+}
+
+func (k *Kraken) UnsubscribeTicker(pair CurrencyPair) error {
+	return k.unsubscribe("ticker:" + k.wsPair(pair))
+}
+
+//买一卖一 , 只有Buy , Sell , Date
+func (k *Kraken) SubscribeSpread(pair CurrencyPair, handle func(ticker *Ticker)) error {
+	k.wsHandlers.SetTicker("spread:"+k.wsPair(pair), func(ticker *Ticker) {
+		ticker.Pair = pair
+		handle(ticker)
+	})
+	return k.subscribe(pair, map[string]interface{}{"name": "spread"})
+}
+
+func (k *Kraken) UnsubscribeSpread(pair CurrencyPair) error {
+	return k.unsubscribe("spread:" + k.wsPair(pair))
+}
+
+func (k *Kraken) SubscribeTrade(pair CurrencyPair, handle func(trade *Trade)) error {
+	k.wsHandlers.SetTrade("trade:"+k.wsPair(pair), func(trade *Trade) {
+		trade.Pair = pair
+		handle(trade)
+	})
+	return k.subscribe(pair, map[string]interface{}{"name": "trade"})
+}
+
+func (k *Kraken) UnsubscribeTrade(pair CurrencyPair) error {
+	return k.unsubscribe("trade:" + k.wsPair(pair))
+}
+
+//前10档
+func (k *Kraken) SubscribeDepth(pair CurrencyPair, handle func(dep *Depth)) error {
+	return k.SubscribeBook(pair, _WS_BOOK_DEPTH, handle)
+}
+
+func (k *Kraken) UnsubscribeDepth(pair CurrencyPair) error {
+	return k.UnsubscribeBook(pair, _WS_BOOK_DEPTH)
+}
+
+/**
+ * depth: 10 , 25 , 100 , 500 , 1000
+ * 每次更新后回调完整的本地深度 , checksum不一致时自动重新订阅
+ */
+func (k *Kraken) SubscribeBook(pair CurrencyPair, depth int, handle func(dep *Depth)) error {
+	k.wsLock.Lock()
+	k.wsBooks[fmt.Sprintf("book-%d:%s", depth, k.wsPair(pair))] = newWsBook(pair, depth, handle)
+	k.wsLock.Unlock()
+	return k.subscribe(pair, map[string]interface{}{
+		"name":  "book",
+		"depth": depth})
+}
+
+func (k *Kraken) UnsubscribeBook(pair CurrencyPair, depth int) error {
+	return k.unsubscribe(fmt.Sprintf("book-%d:%s", depth, k.wsPair(pair)))
+}
+
+func (k *Kraken) SubscribeKline(pair CurrencyPair, period int, handle func(kline *Kline)) error {
+	interval, isok := _KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return ErrKlinePeriodNotSupport
+	}
+	k.wsHandlers.SetKline(fmt.Sprintf("ohlc-%d:%s", interval, k.wsPair(pair)), func(kline *Kline) {
+		kline.Pair = pair
+		handle(kline)
+	})
+	return k.subscribe(pair, map[string]interface{}{
+		"name":     "ohlc",
+		"interval": interval})
+}
+
+func (k *Kraken) UnsubscribeKline(pair CurrencyPair, period int) error {
+	interval, isok := _KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return ErrKlinePeriodNotSupport
+	}
+	return k.unsubscribe(fmt.Sprintf("ohlc-%d:%s", interval, k.wsPair(pair)))
+}
+
+func (k *Kraken) OnSubscribeError(handle func(channel string, err error)) {
+	k.wsLock.Lock()
+	k.wsSubErrHandles = append(k.wsSubErrHandles, handle)
+	auth := k.wsAuth
+	k.wsLock.Unlock()
+
+	if auth != nil {
+		auth.OnSubscribeError(handle)
+	}
+	k.wsConns().OnSubscribeError(handle)
+}
+
+//关闭所有websocket连接 , 包括私有频道的连接
+func (k *Kraken) CloseWs() {
+	k.wsConns().CloseWs()
+
+	k.wsLock.Lock()
+	auth := k.wsAuth
+	k.wsAuth = nil
+	k.wsBooks = make(map[string]*wsBook)
+	k.wsLock.Unlock()
+
+	if auth != nil {
+		auth.CloseWs()
+	}
+}
+
+//{"a":[price, wholeLotVolume, lotVolume], "b":[...], "c":[price, lotVolume], "v":[today, last24Hours], "l":[...], "h":[...]}
+func parseWsTicker(tickermap map[string]interface{}) *Ticker {
+	first := func(key string) float64 {
+		arr, _ := tickermap[key].([]interface{})
+		if len(arr) == 0 {
+			return 0
+		}
+		return ToFloat64(arr[0])
+	}
+	return &Ticker{
+		Last: first("c"),
+		Buy:  first("b"),
+		Sell: first("a"),
+		Low:  first("l"),
+		High: first("h"),
+		Vol:  first("v"),
+		Date: uint64(time.Now().Unix())}
+}
+
+//[bid, ask, timestamp, bidVolume, askVolume]
+func parseWsSpread(entry []interface{}) *Ticker {
+	return &Ticker{
+		Buy:  ToFloat64(wsString(entry, 0)),
+		Sell: ToFloat64(wsString(entry, 1)),
+		Date: uint64(ToFloat64(wsString(entry, 2)))}
+}
+
+/**
+ * [time, etime, open, high, low, close, vwap, volume, count]
+ * time是最后一次更新的时间 , etime是k线结束时间
+ */
+func parseWsKline(entry []interface{}, interval int) *Kline {
+	return &Kline{
+		Timestamp: int64(ToFloat64(wsString(entry, 1))) - int64(interval*60),
+		Open:      ToFloat64(wsString(entry, 2)),
+		High:      ToFloat64(wsString(entry, 3)),
+		Low:       ToFloat64(wsString(entry, 4)),
+		Close:     ToFloat64(wsString(entry, 5)),
+		Vol:       ToFloat64(wsString(entry, 7))}
+}
+
+//rest和websocket格式相同: [price, volume, time, buy/sell, market/limit, miscellaneous] , kraken的成交没有id
+func parseTrade(entry []interface{}) *Trade {
+	trade := &Trade{
+		Price:  ToFloat64(entry[0]),
+		Amount: ToFloat64(entry[1]),
+		Date:   int64(ToFloat64(entry[2]) * 1000),
+		Type:   BUY}
+	if wsString(entry, 3) == "s" {
+		trade.Type = SELL
+	}
+	return trade
+}
+
+func wsString(arr []interface{}, i int) string {
+	if i < len(arr) {
+		if v, isok := arr[i].(string); isok {
+			return v
+		}
+	}
+	return ""
+}
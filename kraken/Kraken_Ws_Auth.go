@@ -0,0 +1,238 @@
+package kraken
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/bxsmart/GoEx"
+	"net/url"
+	"time"
+)
+
+const (
+	WS_AUTH_URL = "wss://ws-auth.kraken.com"
+
+	_WS_TOKEN_TTL = 10 * time.Minute //token创建后15分钟内没有使用则失效
+)
+
+/**
+ * 自己的成交 , kraken的成交id和订单id都是字符串
+ */
+type OwnTrade struct {
+	Trade
+	TradeId string
+	OrderId string
+	Fee     float64
+}
+
+type wsAuthHandlers struct {
+	ownTrade  func(*OwnTrade)
+	openOrder func(*Order)
+}
+
+//每次发送时带上有效的token , 重连后重新订阅不会因为token过期失败
+type wsPrivateRequest struct {
+	k     *Kraken
+	event string
+	name  string
+}
+
+func (r wsPrivateRequest) MarshalJSON() ([]byte, error) {
+	token, err := r.k.wsAuthToken()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"event": r.event,
+		"subscription": map[string]interface{}{
+			"name":  r.name,
+			"token": token}})
+}
+
+//私有频道的认证token
+func (k *Kraken) GetWebSocketsToken() (string, error) {
+	var result struct {
+		Token   string `json:"token"`
+		Expires int    `json:"expires"`
+	}
+	err := k.doAuthenticatedRequest("POST", "private/GetWebSocketsToken", url.Values{}, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.Token == "" {
+		return "", errors.New("empty websocket token")
+	}
+	return result.Token, nil
+}
+
+func (k *Kraken) wsAuthToken() (string, error) {
+	k.wsLock.Lock()
+	token, tokenTime := k.wsToken, k.wsTokenTime
+	k.wsLock.Unlock()
+	if token != "" && time.Since(tokenTime) < _WS_TOKEN_TTL {
+		return token, nil
+	}
+
+	token, err := k.GetWebSocketsToken()
+	if err != nil {
+		return "", err
+	}
+
+	k.wsLock.Lock()
+	k.wsToken, k.wsTokenTime = token, time.Now()
+	k.wsLock.Unlock()
+	return token, nil
+}
+
+//私有频道的连接在第一次订阅时建立
+func (k *Kraken) authConn() (*WsConn, error) {
+	k.createWsLock.Lock()
+	defer k.createWsLock.Unlock()
+
+	k.wsLock.Lock()
+	auth := k.wsAuth
+	handles := append([]func(string, error){}, k.wsSubErrHandles...)
+	k.wsLock.Unlock()
+	if auth != nil {
+		return auth, nil
+	}
+
+	ws, err := k.dial(WS_AUTH_URL)
+	if err != nil {
+		return nil, err
+	}
+	for _, handle := range handles {
+		ws.OnSubscribeError(handle)
+	}
+
+	k.wsLock.Lock()
+	k.wsAuth = ws
+	k.wsLock.Unlock()
+	return ws, nil
+}
+
+func (k *Kraken) subscribePrivate(name string) error {
+	ws, err := k.authConn()
+	if err != nil {
+		return err
+	}
+	return ws.SubscribeChannel(name, wsPrivateRequest{k, "subscribe", name}, wsPrivateRequest{k, "unsubscribe", name})
+}
+
+func (k *Kraken) unsubscribePrivate(name string) error {
+	k.wsLock.Lock()
+	auth := k.wsAuth
+	k.wsLock.Unlock()
+	if auth == nil {
+		return nil
+	}
+	return auth.UnsubscribeChannel(name)
+}
+
+//订阅后先推送最近50笔成交 , 之后推送新的成交
+func (k *Kraken) SubscribeOwnTrades(handle func(trade *OwnTrade)) error {
+	k.wsLock.Lock()
+	k.wsAuthHandle.ownTrade = handle
+	k.wsLock.Unlock()
+	return k.subscribePrivate("ownTrades")
+}
+
+func (k *Kraken) UnsubscribeOwnTrades() error {
+	return k.unsubscribePrivate("ownTrades")
+}
+
+/**
+ * 订阅后先推送全部未完成订单 , 之后推送订单变化
+ * 变化只包含改变的字段(例如只有Status , 或者只有DealAmount) , 没有推送的字段为零值 , 可以按OrderID2合并
+ */
+func (k *Kraken) SubscribeOpenOrders(handle func(order *Order)) error {
+	k.wsLock.Lock()
+	k.wsAuthHandle.openOrder = handle
+	k.wsLock.Unlock()
+	return k.subscribePrivate("openOrders")
+}
+
+func (k *Kraken) UnsubscribeOpenOrders() error {
+	return k.unsubscribePrivate("openOrders")
+}
+
+//[[{ID: {...}}, ...], channelName, {"sequence":n}]
+func (k *Kraken) handleWsPrivateMessage(data []interface{}) {
+	entries, _ := data[0].([]interface{})
+
+	k.wsLock.Lock()
+	handles := k.wsAuthHandle
+	k.wsLock.Unlock()
+
+	for _, e := range entries {
+		m, _ := e.(map[string]interface{})
+		for id, v := range m {
+			info, isok := v.(map[string]interface{})
+			if !isok {
+				continue
+			}
+			switch wsString(data, 1) {
+			case "ownTrades":
+				if handles.ownTrade != nil {
+					handles.ownTrade(k.parseWsOwnTrade(id, info))
+				}
+			case "openOrders":
+				if handles.openOrder != nil {
+					handles.openOrder(k.parseWsOrder(id, info))
+				}
+			}
+		}
+	}
+}
+
+//{"ordertxid", "pair":"XBT/EUR", "time", "type":"buy/sell", "ordertype", "price", "cost", "fee", "vol", "margin"}
+func (k *Kraken) parseWsOwnTrade(tradeId string, info map[string]interface{}) *OwnTrade {
+	trade := &OwnTrade{
+		TradeId: tradeId,
+		OrderId: toString(info["ordertxid"]),
+		Fee:     ToFloat64(info["fee"])}
+	trade.Pair = k.wsPairToCurrencyPair(toString(info["pair"]))
+	trade.Price = ToFloat64(info["price"])
+	trade.Amount = ToFloat64(info["vol"])
+	trade.Date = int64(ToFloat64(info["time"]) * 1000)
+	trade.Type = AdaptTradeSide(toString(info["type"]))
+	return trade
+}
+
+/**
+ * {"status", "vol", "vol_exec", "avg_price", "fee", "opentm", "descr":{"pair", "type", "ordertype", "price"}}
+ * 没有status的变化按成交量判断是否部分成交
+ */
+func (k *Kraken) parseWsOrder(orderId string, info map[string]interface{}) *Order {
+	order := &Order{
+		OrderID2:   orderId,
+		Amount:     ToFloat64(info["vol"]),
+		DealAmount: ToFloat64(info["vol_exec"]),
+		AvgPrice:   ToFloat64(info["avg_price"]),
+		Fee:        ToFloat64(info["fee"]),
+		OrderTime:  int(ToFloat64(info["opentm"]))}
+
+	if status, isok := info["status"].(string); isok {
+		order.Status = k.convertOrderStatus(status)
+	} else if order.DealAmount > 0 {
+		order.Status = ORDER_PART_FINISH
+	}
+
+	if descr, isok := info["descr"].(map[string]interface{}); isok {
+		order.Currency = k.wsPairToCurrencyPair(toString(descr["pair"]))
+		order.Price = ToFloat64(descr["price"])
+		order.Side = AdaptTradeSide(toString(descr["type"]))
+		if descr["ordertype"] == "market" {
+			if order.Side == BUY {
+				order.Side = BUY_MARKET
+			} else {
+				order.Side = SELL_MARKET
+			}
+		}
+	}
+	return order
+}
+
+func toString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
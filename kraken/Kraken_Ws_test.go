@@ -0,0 +1,108 @@
+package kraken
+
+import (
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestKraken_wsPair(t *testing.T) {
+	assert.Equal(t, "XBT/USD", k.wsPair(goex.BTC_USD))
+	assert.Equal(t, "ETH/XBT", k.wsPair(goex.ETH_BTC))
+	assert.Equal(t, goex.BTC_USD, k.wsPairToCurrencyPair("XBT/USD"))
+	assert.Equal(t, goex.ETH_BTC, k.wsPairToCurrencyPair("ETH/XBT"))
+}
+
+func TestKraken_WsBook(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	ws := &goex.WsConn{}
+
+	var deps []*goex.Depth
+	ex.wsBooks["book-2:XBT/USD"] = newWsBook(goex.BTC_USD, 2, func(dep *goex.Depth) {
+		deps = append(deps, dep)
+	})
+
+	ex.handleWsMessage(ws, []byte(`[0,{"as":[["0.05005","0.00000500","1582905487.684110"],["0.05010","0.00500000","1582905486.187983"]],"bs":[["0.05000","0.00000100","1582905487.439814"],["0.04995","0.00100000","1582905485.282733"]]},"book-2","XBT/USD"]`))
+	assert.Equal(t, 1, len(deps))
+
+	//删除一档后补推第三档 , 并附带前两档的checksum
+	sum := crc32.ChecksumIEEE([]byte("5005500" + "5010500000" + "5000100" + "4990200000"))
+	ex.handleWsMessage(ws, []byte(`[0,{"b":[["0.04995","0.00000000","1582905488.000000"],["0.04990","0.00200000","1582905488.000001","r"]],"c":"`+formatUint(sum)+`"},"book-2","XBT/USD"]`))
+	assert.Equal(t, 2, len(deps))
+	assert.True(t, ex.wsBooks["book-2:XBT/USD"].book.IsSynced())
+	assert.Equal(t, goex.DepthRecords{{Price: 0.05, Amount: 0.000001}, {Price: 0.0499, Amount: 0.002}}, deps[1].BidList)
+
+	//超出深度的档位丢弃
+	ex.handleWsMessage(ws, []byte(`[0,{"a":[["0.05020","1.00000000","1582905489.000000"]]},"book-2","XBT/USD"]`))
+	assert.Equal(t, goex.DepthRecords{{Price: 0.05005, Amount: 0.000005}, {Price: 0.0501, Amount: 0.005}}, deps[2].AskList)
+
+	//checksum错误后等待新的快照
+	ex.handleWsMessage(ws, []byte(`[0,{"a":[["0.05005","0.00000600","1582905490.000000"]]},{"b":[],"c":"1"},"book-2","XBT/USD"]`))
+	assert.False(t, ex.wsBooks["book-2:XBT/USD"].book.IsSynced())
+	ex.handleWsMessage(ws, []byte(`[0,{"a":[["0.05005","0.00000700","1582905491.000000"]]},"book-2","XBT/USD"]`))
+	assert.Equal(t, 3, len(deps))
+}
+
+func TestKraken_handleWsMessage(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	ws := &goex.WsConn{}
+
+	var trades []*goex.Trade
+	var klines []*goex.Kline
+	ex.wsHandlers.SetTrade("trade:XBT/USD", func(trade *goex.Trade) {
+		trades = append(trades, trade)
+	})
+	ex.wsHandlers.SetKline("ohlc-5:XBT/USD", func(kline *goex.Kline) {
+		klines = append(klines, kline)
+	})
+
+	ex.handleWsMessage(ws, []byte(`[0,[["5541.20000","0.15850568","1534614057.321597","s","l",""],["6060.00000","0.02455000","1534614057.324998","b","l",""]],"trade","XBT/USD"]`))
+	assert.Equal(t, 2, len(trades))
+	assert.Equal(t, goex.TradeSide(goex.SELL), trades[0].Type)
+	assert.Equal(t, 5541.2, trades[0].Price)
+	assert.Equal(t, int64(1534614057321), trades[0].Date)
+	assert.Equal(t, goex.TradeSide(goex.BUY), trades[1].Type)
+
+	ex.handleWsMessage(ws, []byte(`[42,["1542057314.748456","1542057600.000000","3586.70000","3586.70000","3586.60000","3586.60000","3586.68894","0.03373000",2],"ohlc-5","XBT/USD"]`))
+	assert.Equal(t, 1, len(klines))
+	assert.Equal(t, int64(1542057300), klines[0].Timestamp)
+	assert.Equal(t, 3586.6, klines[0].Close)
+	assert.Equal(t, 0.03373, klines[0].Vol)
+}
+
+func TestKraken_handleWsPrivateMessage(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+
+	var trades []*OwnTrade
+	var orders []*goex.Order
+	ex.wsAuthHandle.ownTrade = func(trade *OwnTrade) {
+		trades = append(trades, trade)
+	}
+	ex.wsAuthHandle.openOrder = func(order *goex.Order) {
+		orders = append(orders, order)
+	}
+
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`[[{"TDLH43-DVQXD-2KHVYY":{"cost":"1000000.00000","fee":"1600.00000","margin":"0.00000","ordertxid":"TDLH43-DVQXD-2KHVYY","ordertype":"limit","pair":"XBT/EUR","postxid":"OGTT3Y-C6I3P-XRI6HX","price":"100000.00000","time":"1560516023.070651","type":"sell","vol":"1000000000.00000000"}}],"ownTrades",{"sequence":2948}]`))
+	assert.Equal(t, 1, len(trades))
+	assert.Equal(t, "TDLH43-DVQXD-2KHVYY", trades[0].OrderId)
+	assert.Equal(t, goex.NewCurrencyPair(goex.BTC, goex.EUR), trades[0].Pair)
+	assert.Equal(t, goex.TradeSide(goex.SELL), trades[0].Type)
+	assert.Equal(t, 1600.0, trades[0].Fee)
+
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`[[{"OGTT3Y-C6I3P-XRI6HX":{"status":"open","vol":"1.00000000","vol_exec":"0.00000000","opentm":"1560516023.070651","descr":{"pair":"XBT/EUR","type":"buy","ordertype":"limit","price":"34.50000"}}},{"OGTT3Y-C6I3P-XRI6HX":{"vol_exec":"0.40000000","avg_price":"34.50000"}}],"openOrders",{"sequence":59342}]`))
+	assert.Equal(t, 2, len(orders))
+	assert.Equal(t, goex.NewCurrencyPair(goex.BTC, goex.EUR), orders[0].Currency)
+	assert.Equal(t, goex.TradeSide(goex.BUY), orders[0].Side)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_UNFINISH), orders[0].Status)
+	assert.Equal(t, 34.5, orders[0].Price)
+	assert.Equal(t, "OGTT3Y-C6I3P-XRI6HX", orders[1].OrderID2)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_PART_FINISH), orders[1].Status)
+	assert.Equal(t, 0.4, orders[1].DealAmount)
+}
+
+func formatUint(v uint32) string {
+	return strconv.FormatUint(uint64(v), 10)
+}
@@ -35,11 +35,10 @@ type OKEx struct {
 	apiKey,
 	apiSecretKey string
 	client            *http.Client
-	ws                *WsConn
-	createWsLock      sync.Mutex
-	wsTickerHandleMap map[string]func(*Ticker)
-	wsDepthHandleMap  map[string]func(*Depth)
-	wsTradeHandleMap  map[string]func(*Trade)
+	wsShards     *WsShards
+	wsMaxSubs    int
+	createWsLock sync.Mutex
+	wsHandlers   *WsHandlers
 }
 
 func NewOKEx(client *http.Client, api_key, secret_key string) *OKEx {
@@ -47,6 +46,7 @@ func NewOKEx(client *http.Client, api_key, secret_key string) *OKEx {
 	ok.apiKey = api_key
 	ok.apiSecretKey = secret_key
 	ok.client = client
+	ok.wsHandlers = NewWsHandlers()
 	return ok
 }
 
@@ -20,19 +20,34 @@ import (
 
 type OKExSpot struct {
 	OKCoinCN_API
-	ws                *WsConn
-	createWsLock      sync.Mutex
-	wsTickerHandleMap map[string]func(*Ticker)
-	wsDepthHandleMap  map[string]func(*Depth)
-	wsTradeHandleMap  map[string]func(*Trade)
+	wsShards     *WsShards
+	wsMaxSubs    int
+	createWsLock sync.Mutex
+	wsHandlers   *WsHandlers
+}
+
+//websocket的k线周期和rest接口的写法不同
+var _OKEX_WS_KLINE_PERIOD_CONVERTER = map[int]string{
+	KLINE_PERIOD_1MIN:  "1min",
+	KLINE_PERIOD_3MIN:  "3min",
+	KLINE_PERIOD_5MIN:  "5min",
+	KLINE_PERIOD_15MIN: "15min",
+	KLINE_PERIOD_30MIN: "30min",
+	KLINE_PERIOD_60MIN: "1hour",
+	KLINE_PERIOD_1H:    "1hour",
+	KLINE_PERIOD_2H:    "2hour",
+	KLINE_PERIOD_4H:    "4hour",
+	KLINE_PERIOD_6H:    "6hour",
+	KLINE_PERIOD_12H:   "12hour",
+	KLINE_PERIOD_1DAY:  "day",
+	KLINE_PERIOD_3DAY:  "3day",
+	KLINE_PERIOD_1WEEK: "week",
 }
 
 func NewOKExSpot(client *http.Client, accesskey, secretkey string) *OKExSpot {
 	return &OKExSpot{
-		OKCoinCN_API:      OKCoinCN_API{client, accesskey, secretkey, "https://www.okex.com/api/v1/"},
-		wsTickerHandleMap: make(map[string]func(*Ticker)),
-		wsDepthHandleMap:  make(map[string]func(*Depth)),
-		wsTradeHandleMap:  make(map[string]func(*Trade))}
+		OKCoinCN_API: OKCoinCN_API{client, accesskey, secretkey, "https://www.okex.com/api/v1/"},
+		wsHandlers:   NewWsHandlers()}
 }
 
 func (ctx *OKExSpot) GetExchangeName() string {
@@ -101,125 +116,266 @@ func (okSpot *OKExSpot) MessageDecode(msg []byte) {
 
 }
 
-func (okSpot *OKExSpot) createWsConn() {
-	if okSpot.ws == nil {
-		//connect wsx
-		okSpot.createWsLock.Lock()
-		defer okSpot.createWsLock.Unlock()
+//每个连接最多订阅n个频道 , 超过后新建连接 , 默认不限制
+func (okSpot *OKExSpot) WsMaxSubsPerConn(n int) *OKExSpot {
+	okSpot.createWsLock.Lock()
+	defer okSpot.createWsLock.Unlock()
+	okSpot.wsMaxSubs = n
+	return okSpot
+}
+
+//连接在第一次订阅时建立
+func (okSpot *OKExSpot) wsConns() *WsShards {
+	okSpot.createWsLock.Lock()
+	defer okSpot.createWsLock.Unlock()
+
+	if okSpot.wsShards == nil {
+		okSpot.wsShards = NewWsShards(okSpot.wsMaxSubs, okSpot.dialWs)
+	}
+	return okSpot.wsShards
+}
+
+func (okSpot *OKExSpot) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn("wss://real.okex.com:10440/ws/v1")
+	if err != nil {
+		return nil, err
+	}
+	ws.Heartbeat(func() interface{} { return map[string]string{"event": "ping"} }, 20*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		okSpot.handleWsMessage(ws, msg)
+	})
+	return ws, nil
+}
+
+func (okSpot *OKExSpot) handleWsMessage(ws *WsConn, msg []byte) {
+	var err error
+	msg, err = okSpot.GzipDecode(msg)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if string(msg) == "{\"event\":\"pong\"}" {
+		ws.UpdateActivedTime()
+		return
+	}
+
+	var data []interface{}
+	err = json.Unmarshal(msg, &data)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if len(data) == 0 {
+		return
+	}
+
+	jsonparser.ArrayEach(msg, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		channel, err := jsonparser.GetString(value, "channel")
+		if err != nil {
+			fmt.Printf("channel err :%s \n", err)
+			return
+		}
+
+		m, _, _, err := jsonparser.Get(value, "data")
+		if err != nil {
+			fmt.Printf("data err :%s \n", err)
+			return
+		}
+
+		if result, err := jsonparser.GetBoolean(m, "result"); err == nil { //订阅回执
+			if c, err := jsonparser.GetString(m, "channel"); err == nil {
+				channel = c
+			}
+			if result {
+				ws.AckSubscribe(channel)
+			} else {
+				errCode, _ := jsonparser.GetInt(m, "error_code")
+				ws.FailSubscribe(channel, fmt.Errorf("error_code: %d", errCode))
+			}
+			return
+		}
+
+		if channel == "addChannel" || channel == "removeChannel" {
+			return
+		}
 
-		if okSpot.ws == nil {
-			okSpot.ws = NewWsConn("wss://real.okex.com:10440/ws/v1")
-			okSpot.ws.Heartbeat(func() interface{} { return map[string]string{"event": "ping"} }, 20*time.Second)
-			okSpot.ws.ReConnect()
-			okSpot.ws.ReceiveMessage(func(msg []byte) {
-				var err error
-				msg, err = okSpot.GzipDecode(msg)
+		pair := okSpot.getPairFormChannel(channel)
+
+		if strings.Contains(channel, "_deals") {
+			jsonparser.ArrayEach(m, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+				var t []string
+				err = json.Unmarshal(value, &t)
 				if err != nil {
-					log.Println(err)
+					fmt.Printf("tradeArr  Unmarshal err :%s \n", err)
 					return
 				}
 
-				if string(msg) == "{\"event\":\"pong\"}" {
-					okSpot.ws.UpdateActivedTime()
-					return
-				}
+				trade := okSpot.parseTrade(t)
+				trade.Pair = pair
 
-				var data []interface{}
-				err = json.Unmarshal(msg, &data)
-				if err != nil {
-					log.Println(err)
-					return
+				if handle := okSpot.wsHandlers.Trade(channel); handle != nil {
+					handle(trade)
 				}
+			})
+			return
+		}
 
-				if len(data) == 0 {
+		if strings.Contains(channel, "_kline_") {
+			jsonparser.ArrayEach(m, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+				var k []string
+				err = json.Unmarshal(value, &k)
+				if err != nil || len(k) < 6 {
+					fmt.Printf("kline Unmarshal err :%s \n", err)
 					return
 				}
 
-				jsonparser.ArrayEach(msg, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
-					channel, err := jsonparser.GetString(value, "channel")
-					if err != nil {
-						fmt.Printf("channel err :%s \n", err)
-						return
-					}
-
-					m, _, _, err := jsonparser.Get(value, "data")
-					if err != nil {
-						fmt.Printf("data err :%s \n", err)
-						return
-					}
-
-					if channel == "addChannel" {
-						fmt.Printf("msg: %s \n", m)
-						return
-					}
-
-					pair := okSpot.getPairFormChannel(channel)
-
-					if strings.Contains(channel, "_deals") {
-						jsonparser.ArrayEach(m, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
-							var t []string
-							err = json.Unmarshal(value, &t)
-							if err != nil {
-								fmt.Printf("tradeArr  Unmarshal err :%s \n", err)
-								return
-							}
-
-							trade := okSpot.parseTrade(t)
-							trade.Pair = pair
-
-							okSpot.wsTradeHandleMap[channel](trade)
-						})
-						return
-					}
-
-					tickmap := make(map[string]interface{})
-					err = json.Unmarshal(m, &tickmap)
-
-					if strings.HasSuffix(channel, "_ticker") {
-						ticker := okSpot.parseTicker(tickmap)
-						ticker.Pair = pair
-						okSpot.wsTickerHandleMap[channel](ticker)
-					} else if strings.Contains(channel, "depth_") {
-						dep := okSpot.parseDepth(tickmap)
-						dep.Pair = pair
-						okSpot.wsDepthHandleMap[channel](dep)
-					}
-
-				}, )
+				kline := okSpot.parseWsKline(k)
+				kline.Pair = pair
 
+				if handle := okSpot.wsHandlers.Kline(channel); handle != nil {
+					handle(kline)
+				}
 			})
+			return
 		}
-	}
+
+		tickmap := make(map[string]interface{})
+		err = json.Unmarshal(m, &tickmap)
+
+		if strings.HasSuffix(channel, "_ticker") {
+			ticker := okSpot.parseTicker(tickmap)
+			ticker.Pair = pair
+			if handle := okSpot.wsHandlers.Ticker(channel); handle != nil {
+				handle(ticker)
+			}
+		} else if strings.Contains(channel, "depth_") {
+			dep := okSpot.parseDepth(tickmap)
+			dep.Pair = pair
+			if handle := okSpot.wsHandlers.Depth(channel); handle != nil {
+				handle(dep)
+			}
+		}
+
+	}, )
+
 }
 
 func (okSpot *OKExSpot) GetDepthWithWs(pair CurrencyPair, handle func(*Depth)) error {
-	okSpot.createWsConn()
-	channel := fmt.Sprintf("ok_sub_spot_%s_depth_5", strings.ToLower(pair.ToSymbol("_")))
-	okSpot.wsDepthHandleMap[channel] = handle
-	return okSpot.ws.Subscribe(map[string]string{
-		"event":   "addChannel",
-		"channel": channel})
+	return okSpot.SubscribeDepth(pair, handle)
 }
 
 func (okSpot *OKExSpot) GetTickerWithWs(pair CurrencyPair, handle func(*Ticker)) error {
-	okSpot.createWsConn()
-	channel := fmt.Sprintf("ok_sub_spot_%s_ticker", strings.ToLower(pair.ToSymbol("_")))
-	okSpot.wsTickerHandleMap[channel] = handle
-	return okSpot.ws.Subscribe(map[string]string{
-		"event":   "addChannel",
-		"channel": channel})
+	return okSpot.SubscribeTicker(pair, handle)
 }
 
 func (okSpot *OKExSpot) GetTradeWithWs(pair CurrencyPair, handle func(*Trade)) error {
-	okSpot.createWsConn()
-	channel := fmt.Sprintf("ok_sub_spot_%s_deals", strings.ToLower(pair.String()))
-	fmt.Printf("channel:%s \n", channel)
-	okSpot.wsTradeHandleMap[channel] = handle
-	return okSpot.ws.Subscribe(map[string]string{
+	return okSpot.SubscribeTrade(pair, handle)
+}
+
+func (okSpot *OKExSpot) addChannel(channel string) error {
+	return okSpot.wsConns().SubscribeChannel(channel, map[string]string{
 		"event":   "addChannel",
+		"channel": channel}, map[string]string{
+		"event":   "removeChannel",
 		"channel": channel})
 }
 
+func (okSpot *OKExSpot) removeChannel(channel string) error {
+	okSpot.wsHandlers.Remove(channel)
+	return okSpot.wsConns().UnsubscribeChannel(channel)
+}
+
+func (okSpot *OKExSpot) OnSubscribeError(handle func(channel string, err error)) {
+	okSpot.wsConns().OnSubscribeError(handle)
+}
+
+//关闭所有websocket连接
+func (okSpot *OKExSpot) CloseWs() {
+	okSpot.wsConns().CloseWs()
+}
+
+func (okSpot *OKExSpot) depthChannel(pair CurrencyPair) string {
+	return fmt.Sprintf("ok_sub_spot_%s_depth_5", strings.ToLower(pair.ToSymbol("_")))
+}
+
+func (okSpot *OKExSpot) tickerChannel(pair CurrencyPair) string {
+	return fmt.Sprintf("ok_sub_spot_%s_ticker", strings.ToLower(pair.ToSymbol("_")))
+}
+
+func (okSpot *OKExSpot) tradeChannel(pair CurrencyPair) string {
+	return fmt.Sprintf("ok_sub_spot_%s_deals", strings.ToLower(pair.ToSymbol("_")))
+}
+
+func (okSpot *OKExSpot) SubscribeDepth(pair CurrencyPair, handle func(*Depth)) error {
+	channel := okSpot.depthChannel(pair)
+	okSpot.wsHandlers.SetDepth(channel, handle)
+	return okSpot.addChannel(channel)
+}
+
+func (okSpot *OKExSpot) UnsubscribeDepth(pair CurrencyPair) error {
+	return okSpot.removeChannel(okSpot.depthChannel(pair))
+}
+
+func (okSpot *OKExSpot) SubscribeTicker(pair CurrencyPair, handle func(*Ticker)) error {
+	channel := okSpot.tickerChannel(pair)
+	okSpot.wsHandlers.SetTicker(channel, handle)
+	return okSpot.addChannel(channel)
+}
+
+func (okSpot *OKExSpot) UnsubscribeTicker(pair CurrencyPair) error {
+	return okSpot.removeChannel(okSpot.tickerChannel(pair))
+}
+
+func (okSpot *OKExSpot) SubscribeTrade(pair CurrencyPair, handle func(*Trade)) error {
+	channel := okSpot.tradeChannel(pair)
+	okSpot.wsHandlers.SetTrade(channel, handle)
+	return okSpot.addChannel(channel)
+}
+
+func (okSpot *OKExSpot) UnsubscribeTrade(pair CurrencyPair) error {
+	return okSpot.removeChannel(okSpot.tradeChannel(pair))
+}
+
+func (okSpot *OKExSpot) klineChannel(pair CurrencyPair, period int) (string, error) {
+	periodS, isOk := _OKEX_WS_KLINE_PERIOD_CONVERTER[period]
+	if !isOk {
+		return "", ErrKlinePeriodNotSupport
+	}
+	return fmt.Sprintf("ok_sub_spot_%s_kline_%s", strings.ToLower(pair.ToSymbol("_")), periodS), nil
+}
+
+func (okSpot *OKExSpot) SubscribeKline(pair CurrencyPair, period int, handle func(*Kline)) error {
+	channel, err := okSpot.klineChannel(pair, period)
+	if err != nil {
+		return err
+	}
+	okSpot.wsHandlers.SetKline(channel, handle)
+	return okSpot.addChannel(channel)
+}
+
+func (okSpot *OKExSpot) UnsubscribeKline(pair CurrencyPair, period int) error {
+	channel, err := okSpot.klineChannel(pair, period)
+	if err != nil {
+		return err
+	}
+	return okSpot.removeChannel(channel)
+}
+
+//[时间戳(ms), 开, 高, 低, 收, 量]
+func (okSpot *OKExSpot) parseWsKline(arr []string) *Kline {
+	return &Kline{
+		Timestamp: int64(ToUint64(arr[0])) / 1000,
+		Open:      ToFloat64(arr[1]),
+		High:      ToFloat64(arr[2]),
+		Low:       ToFloat64(arr[3]),
+		Close:     ToFloat64(arr[4]),
+		Vol:       ToFloat64(arr[5])}
+}
+
 func (okSpot *OKExSpot) parseTrade(arr []string) *Trade {
 
 	trade := new(Trade)
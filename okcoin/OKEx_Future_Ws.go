@@ -12,86 +12,204 @@ import (
 	"time"
 )
 
-func (okFuture *OKEx) createWsConn() {
-	if okFuture.ws == nil {
-		//connect wsx
-		okFuture.createWsLock.Lock()
-		defer okFuture.createWsLock.Unlock()
-
-		if okFuture.ws == nil {
-			okFuture.wsTickerHandleMap = make(map[string]func(*Ticker))
-			okFuture.wsDepthHandleMap = make(map[string]func(*Depth))
-
-			okFuture.ws = NewWsConn("wss://real.okex.com:10440/ws/v1")
-			okFuture.ws.Heartbeat(func() interface{} { return map[string]string{"event": "ping"} }, 30*time.Second)
-			okFuture.ws.ReConnect()
-			okFuture.ws.ReceiveMessage(func(d []byte) {
-				reader := flate.NewReader(bytes.NewReader(d))
-				msg, err := ioutil.ReadAll(reader)
-
-				if err != nil {
-					log.Println(err)
-					return
-				}
-
-				if string(msg) == "{\"event\":\"pong\"}" {
-					okFuture.ws.UpdateActivedTime()
-					return
-				}
-
-				var data []interface{}
-				err = json.Unmarshal(msg, &data)
-				if err != nil {
-					log.Println(err)
-					return
-				}
-
-				if len(data) == 0 {
-					return
-				}
-
-				datamap := data[0].(map[string]interface{})
-				channel := datamap["channel"].(string)
-				if channel == "addChannel" {
-					return
-				}
-
-				tickmap := datamap["data"].(map[string]interface{})
-				pair := okFuture.getPairFromChannel(channel)
-				contractType := okFuture.getContractFromChannel(channel)
-
-				if strings.HasSuffix(channel, "_ticker") {
-					ticker := okFuture.parseTicker(tickmap)
-					ticker.Pair = pair
-					ticker.ContractType = contractType
-					okFuture.wsTickerHandleMap[channel](ticker)
-				} else if strings.Contains(channel, "depth_") {
-					dep := okFuture.parseDepth(tickmap)
-					dep.Pair = pair
-					dep.ContractType = contractType
-					okFuture.wsDepthHandleMap[channel](dep)
-				}
-			})
+//每个连接最多订阅n个频道 , 超过后新建连接 , 默认不限制
+func (okFuture *OKEx) WsMaxSubsPerConn(n int) *OKEx {
+	okFuture.createWsLock.Lock()
+	defer okFuture.createWsLock.Unlock()
+	okFuture.wsMaxSubs = n
+	return okFuture
+}
+
+//连接在第一次订阅时建立
+func (okFuture *OKEx) wsConns() *WsShards {
+	okFuture.createWsLock.Lock()
+	defer okFuture.createWsLock.Unlock()
+
+	if okFuture.wsShards == nil {
+		okFuture.wsShards = NewWsShards(okFuture.wsMaxSubs, okFuture.dialWs)
+	}
+	return okFuture.wsShards
+}
+
+func (okFuture *OKEx) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn("wss://real.okex.com:10440/ws/v1")
+	if err != nil {
+		return nil, err
+	}
+	ws.Heartbeat(func() interface{} { return map[string]string{"event": "ping"} }, 30*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(d []byte) {
+		okFuture.handleWsMessage(ws, d)
+	})
+	return ws, nil
+}
+
+func (okFuture *OKEx) handleWsMessage(ws *WsConn, d []byte) {
+	reader := flate.NewReader(bytes.NewReader(d))
+	msg, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if string(msg) == "{\"event\":\"pong\"}" {
+		ws.UpdateActivedTime()
+		return
+	}
+
+	var data []interface{}
+	err = json.Unmarshal(msg, &data)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if len(data) == 0 {
+		return
+	}
+
+	datamap, _ := data[0].(map[string]interface{})
+	channel, _ := datamap["channel"].(string)
+	tickmap, _ := datamap["data"].(map[string]interface{})
+	if result, isok := tickmap["result"].(bool); isok { //订阅回执
+		if c, isok := tickmap["channel"].(string); isok {
+			channel = c
+		}
+		if result {
+			ws.AckSubscribe(channel)
+		} else {
+			ws.FailSubscribe(channel, fmt.Errorf("error_code: %v", tickmap["error_code"]))
+		}
+		return
+	}
+
+	if channel == "addChannel" || channel == "removeChannel" || tickmap == nil {
+		return
+	}
+
+	pair := okFuture.getPairFromChannel(channel)
+	contractType := okFuture.getContractFromChannel(channel)
+
+	if strings.HasSuffix(channel, "_ticker") {
+		ticker := okFuture.parseTicker(tickmap)
+		ticker.Pair = pair
+		ticker.ContractType = contractType
+		if handle := okFuture.wsHandlers.Ticker(channel); handle != nil {
+			handle(ticker)
+		}
+	} else if strings.Contains(channel, "depth_") {
+		dep := okFuture.parseDepth(tickmap)
+		dep.Pair = pair
+		dep.ContractType = contractType
+		if handle := okFuture.wsHandlers.Depth(channel); handle != nil {
+			handle(dep)
 		}
 	}
 }
 
-func (okFuture *OKEx) GetDepthWithWs(pair CurrencyPair, contractType string, handle func(*Depth)) error {
-	okFuture.createWsConn()
-	channel := fmt.Sprintf("ok_sub_futureusd_%s_depth_%s_5", strings.ToLower(pair.CurrencyA.Symbol), contractType)
-	okFuture.wsDepthHandleMap[channel] = handle
-	return okFuture.ws.Subscribe(map[string]string{
+func (okFuture *OKEx) depthChannel(pair CurrencyPair, contractType string) string {
+	return fmt.Sprintf("ok_sub_futureusd_%s_depth_%s_5", strings.ToLower(pair.CurrencyA.Symbol), contractType)
+}
+
+func (okFuture *OKEx) tickerChannel(pair CurrencyPair, contractType string) string {
+	return fmt.Sprintf("ok_sub_futureusd_%s_ticker_%s", strings.ToLower(pair.CurrencyA.Symbol), contractType)
+}
+
+func (okFuture *OKEx) addChannel(channel string) error {
+	return okFuture.wsConns().SubscribeChannel(channel, map[string]string{
 		"event":   "addChannel",
+		"channel": channel}, map[string]string{
+		"event":   "removeChannel",
 		"channel": channel})
 }
 
+func (okFuture *OKEx) removeChannel(channel string) error {
+	okFuture.wsHandlers.Remove(channel)
+	return okFuture.wsConns().UnsubscribeChannel(channel)
+}
+
+func (okFuture *OKEx) GetDepthWithWs(pair CurrencyPair, contractType string, handle func(*Depth)) error {
+	channel := okFuture.depthChannel(pair, contractType)
+	okFuture.wsHandlers.SetDepth(channel, handle)
+	return okFuture.addChannel(channel)
+}
+
 func (okFuture *OKEx) GetTickerWithWs(pair CurrencyPair, contractType string, handle func(*Ticker)) error {
-	okFuture.createWsConn()
-	channel := fmt.Sprintf("ok_sub_futureusd_%s_ticker_%s", strings.ToLower(pair.CurrencyA.Symbol), contractType)
-	okFuture.wsTickerHandleMap[channel] = handle
-	return okFuture.ws.Subscribe(map[string]string{
-		"event":   "addChannel",
-		"channel": channel})
+	channel := okFuture.tickerChannel(pair, contractType)
+	okFuture.wsHandlers.SetTicker(channel, handle)
+	return okFuture.addChannel(channel)
+}
+
+func (okFuture *OKEx) OnSubscribeError(handle func(channel string, err error)) {
+	okFuture.wsConns().OnSubscribeError(handle)
+}
+
+//关闭所有websocket连接
+func (okFuture *OKEx) CloseWs() {
+	okFuture.wsConns().CloseWs()
+}
+
+func (okFuture *OKEx) UnsubscribeDepthWithWs(pair CurrencyPair, contractType string) error {
+	return okFuture.removeChannel(okFuture.depthChannel(pair, contractType))
+}
+
+func (okFuture *OKEx) UnsubscribeTickerWithWs(pair CurrencyPair, contractType string) error {
+	return okFuture.removeChannel(okFuture.tickerChannel(pair, contractType))
+}
+
+/**
+ * 固定合约类型的StreamingAPI , 多个合约类型共用同一个连接
+ * okFuture.Stream(QUARTER_CONTRACT).SubscribeDepth(BTC_USD, handle)
+ */
+type OKExFutureStream struct {
+	okFuture     *OKEx
+	contractType string
+}
+
+func (okFuture *OKEx) Stream(contractType string) *OKExFutureStream {
+	return &OKExFutureStream{okFuture: okFuture, contractType: contractType}
+}
+
+func (s *OKExFutureStream) GetExchangeName() string {
+	return OKEX_FUTURE
+}
+
+func (s *OKExFutureStream) SubscribeTicker(pair CurrencyPair, handle func(*Ticker)) error {
+	return s.okFuture.GetTickerWithWs(pair, s.contractType, handle)
+}
+
+func (s *OKExFutureStream) UnsubscribeTicker(pair CurrencyPair) error {
+	return s.okFuture.UnsubscribeTickerWithWs(pair, s.contractType)
+}
+
+func (s *OKExFutureStream) SubscribeDepth(pair CurrencyPair, handle func(*Depth)) error {
+	return s.okFuture.GetDepthWithWs(pair, s.contractType, handle)
+}
+
+func (s *OKExFutureStream) UnsubscribeDepth(pair CurrencyPair) error {
+	return s.okFuture.UnsubscribeDepthWithWs(pair, s.contractType)
+}
+
+func (s *OKExFutureStream) OnSubscribeError(handle func(channel string, err error)) {
+	s.okFuture.OnSubscribeError(handle)
+}
+
+func (s *OKExFutureStream) SubscribeTrade(pair CurrencyPair, handle func(*Trade)) error {
+	return ErrStreamNotSupport
+}
+
+func (s *OKExFutureStream) UnsubscribeTrade(pair CurrencyPair) error {
+	return ErrStreamNotSupport
+}
+
+func (s *OKExFutureStream) SubscribeKline(pair CurrencyPair, period int, handle func(*Kline)) error {
+	return ErrStreamNotSupport
+}
+
+func (s *OKExFutureStream) UnsubscribeKline(pair CurrencyPair, period int) error {
+	return ErrStreamNotSupport
 }
 
 func (okFuture *OKEx) parseTicker(tickmap map[string]interface{}) *Ticker {
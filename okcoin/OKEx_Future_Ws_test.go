@@ -11,9 +11,13 @@ import (
 var okexFuture = NewOKEx(http.DefaultClient, "", "")
 
 func TestOKEx_GetDepthWithWs(t *testing.T) {
-	okexFuture.GetDepthWithWs(goex.BTC_USD, goex.QUARTER_CONTRACT, func(depth *goex.Depth) {
+	err := okexFuture.GetDepthWithWs(goex.BTC_USD, goex.QUARTER_CONTRACT, func(depth *goex.Depth) {
 		log.Print(depth)
 	})
+	if err != nil {
+		t.Log(err)
+		return
+	}
 	time.Sleep(1 * time.Minute)
-	okexFuture.ws.CloseWs()
+	okexFuture.CloseWs()
 }
@@ -0,0 +1,757 @@
+package okex
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	V3_WS_URL     = "wss://real.okex.com:8443/ws/v3"
+	SWAP_CONTRACT = "swap" //永续合约
+
+	_WS_LOGIN_CHANNEL = "login"
+	_WS_BOOK_LEVELS   = 400 //depth频道维护的档数
+)
+
+var _WS_CANDLE_PERIOD = map[int]int{
+	KLINE_PERIOD_1MIN:  60,
+	KLINE_PERIOD_3MIN:  180,
+	KLINE_PERIOD_5MIN:  300,
+	KLINE_PERIOD_15MIN: 900,
+	KLINE_PERIOD_30MIN: 1800,
+	KLINE_PERIOD_1H:    3600,
+	KLINE_PERIOD_60MIN: 3600,
+	KLINE_PERIOD_2H:    7200,
+	KLINE_PERIOD_4H:    14400,
+	KLINE_PERIOD_6H:    21600,
+	KLINE_PERIOD_12H:   43200,
+	KLINE_PERIOD_1DAY:  86400,
+	KLINE_PERIOD_1WEEK: 604800}
+
+type wsMessage struct {
+	Event     string            `json:"event"`
+	Channel   string            `json:"channel"`
+	Success   bool              `json:"success"`
+	Message   string            `json:"message"`
+	ErrorCode int               `json:"errorCode"`
+	Table     string            `json:"table"`
+	Action    string            `json:"action"`
+	Data      []json.RawMessage `json:"data"`
+}
+
+//checksum按推送的价格和数量原文计算 , texts随全量和增量更新
+type wsBook struct {
+	book  *OrderBook
+	texts *DepthTexts
+	size  int
+}
+
+func (b *wsBook) setTexts(item map[string]interface{}) {
+	for key, set := range map[string]func(price, amount string){"asks": b.texts.SetAsk, "bids": b.texts.SetBid} {
+		rows, _ := item[key].([]interface{})
+		for _, r := range rows {
+			row, isok := r.([]interface{})
+			if !isok || len(row) < 2 {
+				continue
+			}
+			set(fmt.Sprint(row[0]), fmt.Sprint(row[1]))
+		}
+	}
+}
+
+//交割合约的别名 this_week , next_week , quarter 对应的合约代码 , 交割后失效
+type contract struct {
+	instrumentId string
+	expiry       time.Time
+}
+
+//每次发送时重新签名 , 重连后重新登录不会因为时间戳过期失败
+type wsLoginRequest struct {
+	ok *OKExV3Ws
+}
+
+func (r wsLoginRequest) MarshalJSON() ([]byte, error) {
+	timestamp := fmt.Sprintf("%.3f", float64(time.Now().UnixNano())/float64(time.Second))
+	sign, err := GetParamHmacSHA256Base64Sign(r.ok.config.ApiSecretKey, timestamp+"GET/users/self/verify")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"op":   _WS_LOGIN_CHANNEL,
+		"args": []string{r.ok.config.ApiKey, r.ok.config.ApiPassphrase, timestamp, sign}})
+}
+
+/**
+ * okex v3 websocket , 现货 , 交割合约和永续合约共用
+ * 频道格式: spot/ticker:ETH-USDT , futures/trade:BTC-USD-190628 , swap/candle60s:BTC-USD-SWAP
+ * 私有频道和逐笔深度在单独的连接上登录后订阅
+ */
+type OKExV3Ws struct {
+	config          *APIConfig
+	createWsLock    sync.Mutex
+	wsShards        *WsShards
+	wsMaxSubs       int
+	wsHandlers      *WsHandlers
+	wsLock          sync.Mutex
+	wsAuth          *WsConn
+	wsBooks         map[string]*wsBook
+	wsPrivHandles   map[string]func(item map[string]interface{})
+	wsSubErrHandles []func(channel string, err error)
+	contractLock    sync.Mutex
+	contracts       map[string]*contract
+}
+
+func NewOKExV3Ws(config *APIConfig) *OKExV3Ws {
+	return &OKExV3Ws{
+		config:        config,
+		wsHandlers:    NewWsHandlers(),
+		wsBooks:       make(map[string]*wsBook),
+		wsPrivHandles: make(map[string]func(item map[string]interface{})),
+		contracts:     make(map[string]*contract)}
+}
+
+//每个连接最多订阅n个频道 , 超过后新建连接 , 默认不限制
+func (ok *OKExV3Ws) WsMaxSubsPerConn(n int) *OKExV3Ws {
+	ok.createWsLock.Lock()
+	defer ok.createWsLock.Unlock()
+	ok.wsMaxSubs = n
+	return ok
+}
+
+//连接在第一次订阅时建立
+func (ok *OKExV3Ws) wsConns() *WsShards {
+	ok.createWsLock.Lock()
+	defer ok.createWsLock.Unlock()
+
+	if ok.wsShards == nil {
+		ok.wsShards = NewWsShards(ok.wsMaxSubs, ok.dialWs)
+	}
+	return ok.wsShards
+}
+
+//30秒内没有消息会被服务端断开 , 发送文本ping , 服务端返回pong
+func (ok *OKExV3Ws) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn(V3_WS_URL)
+	if err != nil {
+		return nil, err
+	}
+	ws.Heartbeat(func() interface{} { return []byte("ping") }, 20*time.Second)
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		ok.handleWsMessage(ws, msg)
+	})
+	return ws, nil
+}
+
+/**
+ * 所有消息都是deflate压缩的
+ * 订阅回执: {"event":"subscribe","channel":"spot/ticker:ETH-USDT"}
+ * 登录回执: {"event":"login","success":true}
+ * 错误: {"event":"error","message":"Channel spot/ticker:ETH-USD doesn't exist","errorCode":30040}
+ * 数据: {"table":"spot/depth","action":"partial/update","data":[...]}
+ */
+func (ok *OKExV3Ws) handleWsMessage(ws *WsConn, msg []byte) {
+	data, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(msg)))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	ws.UpdateActivedTime()
+	if string(data) == "pong" {
+		return
+	}
+
+	var resp wsMessage
+	err = json.Unmarshal(data, &resp)
+	if err != nil {
+		log.Println("json unmarshal error for ", string(data))
+		return
+	}
+
+	switch resp.Event {
+	case "subscribe":
+		ws.AckSubscribe(resp.Channel)
+		return
+	case "login":
+		if resp.Success {
+			ws.AckSubscribe(_WS_LOGIN_CHANNEL)
+		}
+		return
+	case "error":
+		ok.handleWsError(ws, &resp)
+		return
+	}
+
+	if resp.Table == "" {
+		return
+	}
+
+	items := make([]map[string]interface{}, 0, len(resp.Data))
+	for _, raw := range resp.Data {
+		var item map[string]interface{}
+		if json.Unmarshal(raw, &item) == nil {
+			items = append(items, item)
+		}
+	}
+
+	_, table := ok.splitTable(resp.Table)
+	switch {
+	case table == "ticker":
+		ok.handleWsTicker(resp.Table, items)
+	case table == "depth5":
+		ok.handleWsDepth5(resp.Table, items)
+	case table == "depth" || table == "depth_l2_tbt":
+		ok.handleWsBook(ws, resp.Table, resp.Action, items)
+	case table == "trade":
+		ok.handleWsTrade(resp.Table, items)
+	case strings.HasPrefix(table, "candle"):
+		ok.handleWsCandle(resp.Table, items)
+	default:
+		ok.handleWsPrivate(resp.Table, items)
+	}
+}
+
+//错误消息不带频道 , 从消息内容里找对应的订阅 , 找不到时认为是登录失败
+func (ok *OKExV3Ws) handleWsError(ws *WsConn, resp *wsMessage) {
+	err := fmt.Errorf("%d: %s", resp.ErrorCode, resp.Message)
+	for _, sub := range ws.Subscriptions() {
+		if sub.Channel != _WS_LOGIN_CHANNEL && strings.Contains(resp.Message, sub.Channel) {
+			ws.FailSubscribe(sub.Channel, err)
+			return
+		}
+	}
+
+	if sub, isok := ws.Subscription(_WS_LOGIN_CHANNEL); isok && sub.State == WS_SUB_PENDING {
+		ws.FailSubscribe(_WS_LOGIN_CHANNEL, err)
+		return
+	}
+	log.Println(err)
+}
+
+//spot/ticker -> spot , ticker
+func (ok *OKExV3Ws) splitTable(table string) (string, string) {
+	i := strings.Index(table, "/")
+	if i < 0 {
+		return "", table
+	}
+	return table[:i], table[i+1:]
+}
+
+func (ok *OKExV3Ws) handleWsTicker(table string, items []map[string]interface{}) {
+	for _, item := range items {
+		instrumentId := fmt.Sprint(item["instrument_id"])
+		handle := ok.wsHandlers.Ticker(table + ":" + instrumentId)
+		if handle == nil {
+			continue
+		}
+
+		vol := item["volume_24h"]
+		if vol == nil {
+			vol = item["base_volume_24h"] //现货
+		}
+		handle(&Ticker{
+			ContractType: ok.contractName(table, instrumentId),
+			Last:         ToFloat64(item["last"]),
+			Buy:          ToFloat64(item["best_bid"]),
+			Sell:         ToFloat64(item["best_ask"]),
+			High:         ToFloat64(item["high_24h"]),
+			Low:          ToFloat64(item["low_24h"]),
+			Vol:          ToFloat64(vol),
+			Date:         uint64(parseIsoTime(item["timestamp"]).UnixNano() / int64(time.Millisecond))})
+	}
+}
+
+//现货没有合约代码
+func (ok *OKExV3Ws) contractName(table, instrumentId string) string {
+	if strings.HasPrefix(table, "spot/") {
+		return ""
+	}
+	return instrumentId
+}
+
+//[[price, size, num_orders]] , 合约为 [[price, size, liquidated_orders, num_orders]]
+func (ok *OKExV3Ws) parseDepthRecords(v interface{}) DepthRecords {
+	rows, _ := v.([]interface{})
+	records := make(DepthRecords, 0, len(rows))
+	for _, r := range rows {
+		row, isok := r.([]interface{})
+		if !isok || len(row) < 2 {
+			continue
+		}
+		records = append(records, DepthRecord{
+			Price:  ToFloat64(row[0]),
+			Amount: ToFloat64(row[1])})
+	}
+	return records
+}
+
+//前5档全量 , asks价格升序 , bids价格降序
+func (ok *OKExV3Ws) handleWsDepth5(table string, items []map[string]interface{}) {
+	for _, item := range items {
+		instrumentId := fmt.Sprint(item["instrument_id"])
+		handle := ok.wsHandlers.Depth(table + ":" + instrumentId)
+		if handle == nil {
+			continue
+		}
+		handle(&Depth{
+			ContractType: ok.contractName(table, instrumentId),
+			UTime:        parseIsoTime(item["timestamp"]),
+			AskList:      ok.parseDepthRecords(item["asks"]),
+			BidList:      ok.parseDepthRecords(item["bids"])})
+	}
+}
+
+/**
+ * partial为全量 , update为增量 , size为0表示删除该价位
+ * 每条消息带前25档的crc32校验和 , 校验失败时重新订阅获取全量
+ */
+func (ok *OKExV3Ws) handleWsBook(ws *WsConn, table, action string, items []map[string]interface{}) {
+	for _, item := range items {
+		channel := table + ":" + fmt.Sprint(item["instrument_id"])
+		ok.wsLock.Lock()
+		b := ok.wsBooks[channel]
+		ok.wsLock.Unlock()
+		if b == nil {
+			continue
+		}
+
+		dep := &Depth{
+			UTime:   parseIsoTime(item["timestamp"]),
+			AskList: ok.parseDepthRecords(item["asks"]),
+			BidList: ok.parseDepthRecords(item["bids"])}
+		checksum := int32(ToInt(item["checksum"]))
+
+		var err error
+		if action == "partial" {
+			b.texts.Reset()
+			b.setTexts(item)
+			if OKExDepthChecksum(b.texts)(dep.AskList, dep.BidList) != checksum {
+				err = ErrOrderBookChecksum
+			} else {
+				b.book.Snapshot(dep, 0)
+			}
+		} else {
+			b.setTexts(item)
+			err = b.book.Update(&DepthUpdate{
+				AskList:     dep.AskList,
+				BidList:     dep.BidList,
+				Checksum:    checksum,
+				HasChecksum: true})
+		}
+
+		switch err {
+		case nil:
+			if handle := ok.wsHandlers.Depth(channel); handle != nil {
+				book := b.book.Depth(b.size)
+				book.ContractType = ok.contractName(table, fmt.Sprint(item["instrument_id"]))
+				handle(book)
+			}
+		case ErrOrderBookNotSync: //等待全量
+		default:
+			log.Printf("[%s] %s , resubscribe ...", channel, err)
+			if sub, isok := ws.Subscription(channel); isok {
+				ws.SendWriteJSON(sub.Unsub)
+				ws.SendWriteJSON(sub.Sub)
+			}
+		}
+	}
+}
+
+//{"instrument_id", "price", "side", "size"(现货/永续) / "qty"(交割), "timestamp", "trade_id"}
+func (ok *OKExV3Ws) handleWsTrade(table string, items []map[string]interface{}) {
+	for _, item := range items {
+		handle := ok.wsHandlers.Trade(table + ":" + fmt.Sprint(item["instrument_id"]))
+		if handle == nil {
+			continue
+		}
+
+		amount := item["size"]
+		if amount == nil {
+			amount = item["qty"]
+		}
+		handle(&Trade{
+			Tid:    int64(ToFloat64(item["trade_id"])),
+			Type:   AdaptTradeSide(fmt.Sprint(item["side"])),
+			Amount: ToFloat64(amount),
+			Price:  ToFloat64(item["price"]),
+			Date:   parseIsoTime(item["timestamp"]).UnixNano() / int64(time.Millisecond)})
+	}
+}
+
+//{"candle":["2019-04-16T10:49:00.000Z", open, high, low, close, volume], "instrument_id"}
+func (ok *OKExV3Ws) handleWsCandle(table string, items []map[string]interface{}) {
+	for _, item := range items {
+		handle := ok.wsHandlers.Kline(table + ":" + fmt.Sprint(item["instrument_id"]))
+		candle, _ := item["candle"].([]interface{})
+		if handle == nil || len(candle) < 6 {
+			continue
+		}
+		handle(&Kline{
+			Timestamp: parseIsoTime(candle[0]).Unix(),
+			Open:      ToFloat64(candle[1]),
+			High:      ToFloat64(candle[2]),
+			Low:       ToFloat64(candle[3]),
+			Close:     ToFloat64(candle[4]),
+			Vol:       ToFloat64(candle[5])})
+	}
+}
+
+/**
+ * 私有频道按 table:instrument_id 分发 , 现货账户为 spot/account:currency
+ * futures/account 的数据为 {"BTC":{...}} , 按币种分发
+ */
+func (ok *OKExV3Ws) handleWsPrivate(table string, items []map[string]interface{}) {
+	for _, item := range items {
+		if table == "futures/account" {
+			for currency, v := range item {
+				if info, isok := v.(map[string]interface{}); isok {
+					ok.dispatchPrivate(table+":"+currency, info)
+				}
+			}
+			continue
+		}
+
+		key := item["instrument_id"]
+		if key == nil {
+			key = item["currency"]
+		}
+		ok.dispatchPrivate(table+":"+fmt.Sprint(key), item)
+	}
+}
+
+func (ok *OKExV3Ws) dispatchPrivate(channel string, item map[string]interface{}) {
+	ok.wsLock.Lock()
+	handle := ok.wsPrivHandles[channel]
+	ok.wsLock.Unlock()
+	if handle != nil {
+		handle(item)
+	}
+}
+
+func parseIsoTime(v interface{}) time.Time {
+	t, _ := time.Parse(time.RFC3339, fmt.Sprint(v))
+	return t
+}
+
+func wsSubscribeRequest(op, channel string) map[string]interface{} {
+	return map[string]interface{}{"op": op, "args": []string{channel}}
+}
+
+func (ok *OKExV3Ws) subscribe(channel string) error {
+	return ok.wsConns().SubscribeChannel(channel, wsSubscribeRequest("subscribe", channel), wsSubscribeRequest("unsubscribe", channel))
+}
+
+func (ok *OKExV3Ws) unsubscribe(channel string) error {
+	ok.wsHandlers.Remove(channel)
+	return ok.wsConns().UnsubscribeChannel(channel)
+}
+
+//spot , futures , swap
+func instrumentType(instrumentId string) string {
+	parts := strings.Split(instrumentId, "-")
+	switch {
+	case len(parts) == 2:
+		return "spot"
+	case strings.HasSuffix(instrumentId, "-SWAP"):
+		return "swap"
+	default:
+		return "futures"
+	}
+}
+
+func (ok *OKExV3Ws) SubscribeInstrumentTicker(instrumentId string, handle func(ticker *Ticker)) error {
+	channel := instrumentType(instrumentId) + "/ticker:" + instrumentId
+	ok.wsHandlers.SetTicker(channel, handle)
+	return ok.subscribe(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribeInstrumentTicker(instrumentId string) error {
+	return ok.unsubscribe(instrumentType(instrumentId) + "/ticker:" + instrumentId)
+}
+
+//前5档 , 每次推送全量
+func (ok *OKExV3Ws) SubscribeDepth5(instrumentId string, handle func(dep *Depth)) error {
+	channel := instrumentType(instrumentId) + "/depth5:" + instrumentId
+	ok.wsHandlers.SetDepth(channel, handle)
+	return ok.subscribe(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribeDepth5(instrumentId string) error {
+	return ok.unsubscribe(instrumentType(instrumentId) + "/depth5:" + instrumentId)
+}
+
+func (ok *OKExV3Ws) subscribeBook(channel string, book *OrderBook, size int, handle func(dep *Depth)) {
+	ok.wsLock.Lock()
+	texts := NewDepthTexts()
+	ok.wsBooks[channel] = &wsBook{book: book.SetChecksumFunc(OKExDepthChecksum(texts)), texts: texts, size: size}
+	ok.wsLock.Unlock()
+	ok.wsHandlers.SetDepth(channel, handle)
+}
+
+func (ok *OKExV3Ws) unsubscribeBook(channel string) {
+	ok.wsLock.Lock()
+	delete(ok.wsBooks, channel)
+	ok.wsLock.Unlock()
+	ok.wsHandlers.Remove(channel)
+}
+
+//400档增量深度 , 本地维护并校验 , 回调前size档
+func (ok *OKExV3Ws) SubscribeBook(instrumentId string, size int, handle func(dep *Depth)) error {
+	channel := instrumentType(instrumentId) + "/depth:" + instrumentId
+	ok.subscribeBook(channel, NewOrderBook(CurrencyPair{}).SetMaxLevels(_WS_BOOK_LEVELS), size, handle)
+	return ok.subscribe(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribeBook(instrumentId string) error {
+	channel := instrumentType(instrumentId) + "/depth:" + instrumentId
+	ok.unsubscribeBook(channel)
+	return ok.wsConns().UnsubscribeChannel(channel)
+}
+
+//逐笔全量深度 , 需要登录
+func (ok *OKExV3Ws) SubscribeBookTbt(instrumentId string, size int, handle func(dep *Depth)) error {
+	channel := instrumentType(instrumentId) + "/depth_l2_tbt:" + instrumentId
+	ok.subscribeBook(channel, NewOrderBook(CurrencyPair{}), size, handle)
+	return ok.subscribePrivate(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribeBookTbt(instrumentId string) error {
+	channel := instrumentType(instrumentId) + "/depth_l2_tbt:" + instrumentId
+	ok.unsubscribeBook(channel)
+	return ok.unsubscribePrivate(channel)
+}
+
+func (ok *OKExV3Ws) SubscribeTrades(instrumentId string, handle func(trade *Trade)) error {
+	channel := instrumentType(instrumentId) + "/trade:" + instrumentId
+	ok.wsHandlers.SetTrade(channel, handle)
+	return ok.subscribe(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribeTrades(instrumentId string) error {
+	return ok.unsubscribe(instrumentType(instrumentId) + "/trade:" + instrumentId)
+}
+
+func (ok *OKExV3Ws) candleChannel(instrumentId string, period int) (string, error) {
+	seconds, isok := _WS_CANDLE_PERIOD[period]
+	if !isok {
+		return "", ErrKlinePeriodNotSupport
+	}
+	return fmt.Sprintf("%s/candle%ds:%s", instrumentType(instrumentId), seconds, instrumentId), nil
+}
+
+func (ok *OKExV3Ws) SubscribeCandles(instrumentId string, period int, handle func(kline *Kline)) error {
+	channel, err := ok.candleChannel(instrumentId, period)
+	if err != nil {
+		return err
+	}
+	ok.wsHandlers.SetKline(channel, handle)
+	return ok.subscribe(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribeCandles(instrumentId string, period int) error {
+	channel, err := ok.candleChannel(instrumentId, period)
+	if err != nil {
+		return err
+	}
+	return ok.unsubscribe(channel)
+}
+
+func (ok *OKExV3Ws) OnSubscribeError(handle func(channel string, err error)) {
+	ok.wsLock.Lock()
+	ok.wsSubErrHandles = append(ok.wsSubErrHandles, handle)
+	auth := ok.wsAuth
+	ok.wsLock.Unlock()
+
+	ok.wsConns().OnSubscribeError(handle)
+	if auth != nil {
+		auth.OnSubscribeError(handle)
+	}
+}
+
+//关闭所有websocket连接
+func (ok *OKExV3Ws) CloseWs() {
+	ok.wsConns().CloseWs()
+
+	ok.wsLock.Lock()
+	auth := ok.wsAuth
+	ok.wsAuth = nil
+	ok.wsBooks = make(map[string]*wsBook)
+	ok.wsLock.Unlock()
+
+	if auth != nil {
+		auth.CloseWs()
+	}
+}
+
+/**
+ * 交割合约别名对应的合约代码 , 例如 BTC-USD-190628
+ * 合约在交割日16:00(北京时间)交割 , 交割后别名指向新的合约
+ */
+func (ok *OKExV3Ws) futuresInstrument(pair CurrencyPair, alias string) (string, error) {
+	key := pair.ToSymbol("-") + ":" + alias
+
+	ok.contractLock.Lock()
+	c := ok.contracts[key]
+	ok.contractLock.Unlock()
+	if c != nil && time.Now().Before(c.expiry) {
+		return c.instrumentId, nil
+	}
+
+	var instruments []map[string]interface{}
+	err := HttpGet4(ok.config.HttpClient, Endpoint+"/api/futures/v3/instruments", nil, &instruments)
+	if err != nil {
+		return "", err
+	}
+
+	ok.contractLock.Lock()
+	defer ok.contractLock.Unlock()
+	for _, inst := range instruments {
+		delivery, err := time.Parse("2006-01-02", fmt.Sprint(inst["delivery"]))
+		if err != nil {
+			continue
+		}
+		k := fmt.Sprintf("%v-%v:%v", inst["underlying_index"], inst["quote_currency"], inst["alias"])
+		ok.contracts[k] = &contract{
+			instrumentId: fmt.Sprint(inst["instrument_id"]),
+			expiry:       delivery.Add(8 * time.Hour)}
+	}
+
+	c = ok.contracts[key]
+	if c == nil {
+		return "", errors.New("okex future contract not found: " + key)
+	}
+	return c.instrumentId, nil
+}
+
+/**
+ * contractType: 空字符串为现货 , SWAP_CONTRACT为永续合约
+ * THIS_WEEK_CONTRACT , NEXT_WEEK_CONTRACT , QUARTER_CONTRACT 为交割合约 , 其他值作为合约代码
+ */
+func (ok *OKExV3Ws) instrumentId(pair CurrencyPair, contractType string) (string, error) {
+	switch contractType {
+	case "":
+		return pair.ToSymbol("-"), nil
+	case SWAP_CONTRACT:
+		return pair.AdaptUsdtToUsd().ToSymbol("-") + "-SWAP", nil
+	case THIS_WEEK_CONTRACT, NEXT_WEEK_CONTRACT, QUARTER_CONTRACT:
+		return ok.futuresInstrument(pair.AdaptUsdtToUsd(), contractType)
+	default:
+		return contractType, nil
+	}
+}
+
+/**
+ * 固定合约类型的StreamingAPI , 现货 , 交割合约和永续合约共用同一组连接
+ * ok.Stream(QUARTER_CONTRACT).SubscribeDepth(BTC_USD, handle)
+ */
+type OKExV3Stream struct {
+	ok           *OKExV3Ws
+	contractType string
+}
+
+func (ok *OKExV3Ws) Stream(contractType string) *OKExV3Stream {
+	return &OKExV3Stream{ok: ok, contractType: contractType}
+}
+
+func (s *OKExV3Stream) GetExchangeName() string {
+	switch s.contractType {
+	case "":
+		return OKEX
+	case SWAP_CONTRACT:
+		return OKEX_SWAP
+	default:
+		return OKEX_FUTURE
+	}
+}
+
+func (s *OKExV3Stream) SubscribeTicker(pair CurrencyPair, handle func(*Ticker)) error {
+	instrumentId, err := s.ok.instrumentId(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.ok.SubscribeInstrumentTicker(instrumentId, func(ticker *Ticker) {
+		ticker.Pair = pair
+		handle(ticker)
+	})
+}
+
+func (s *OKExV3Stream) UnsubscribeTicker(pair CurrencyPair) error {
+	instrumentId, err := s.ok.instrumentId(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.ok.UnsubscribeInstrumentTicker(instrumentId)
+}
+
+//前5档
+func (s *OKExV3Stream) SubscribeDepth(pair CurrencyPair, handle func(*Depth)) error {
+	instrumentId, err := s.ok.instrumentId(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.ok.SubscribeDepth5(instrumentId, func(dep *Depth) {
+		dep.Pair = pair
+		handle(dep)
+	})
+}
+
+func (s *OKExV3Stream) UnsubscribeDepth(pair CurrencyPair) error {
+	instrumentId, err := s.ok.instrumentId(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.ok.UnsubscribeDepth5(instrumentId)
+}
+
+func (s *OKExV3Stream) SubscribeTrade(pair CurrencyPair, handle func(*Trade)) error {
+	instrumentId, err := s.ok.instrumentId(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.ok.SubscribeTrades(instrumentId, func(trade *Trade) {
+		trade.Pair = pair
+		handle(trade)
+	})
+}
+
+func (s *OKExV3Stream) UnsubscribeTrade(pair CurrencyPair) error {
+	instrumentId, err := s.ok.instrumentId(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.ok.UnsubscribeTrades(instrumentId)
+}
+
+func (s *OKExV3Stream) SubscribeKline(pair CurrencyPair, period int, handle func(*Kline)) error {
+	instrumentId, err := s.ok.instrumentId(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.ok.SubscribeCandles(instrumentId, period, func(kline *Kline) {
+		kline.Pair = pair
+		handle(kline)
+	})
+}
+
+func (s *OKExV3Stream) UnsubscribeKline(pair CurrencyPair, period int) error {
+	instrumentId, err := s.ok.instrumentId(pair, s.contractType)
+	if err != nil {
+		return err
+	}
+	return s.ok.UnsubscribeCandles(instrumentId, period)
+}
+
+func (s *OKExV3Stream) OnSubscribeError(handle func(channel string, err error)) {
+	s.ok.OnSubscribeError(handle)
+}
@@ -0,0 +1,277 @@
+package okex
+
+import (
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"strings"
+	"time"
+)
+
+//私有频道的连接在第一次订阅时建立 , 先登录再订阅
+func (ok *OKExV3Ws) authConn() (*WsConn, error) {
+	ok.createWsLock.Lock()
+	defer ok.createWsLock.Unlock()
+
+	ok.wsLock.Lock()
+	auth := ok.wsAuth
+	handles := append([]func(string, error){}, ok.wsSubErrHandles...)
+	ok.wsLock.Unlock()
+	if auth != nil {
+		return auth, nil
+	}
+
+	ws, err := ok.dialWs()
+	if err != nil {
+		return nil, err
+	}
+	for _, handle := range handles {
+		ws.OnSubscribeError(handle)
+	}
+	//登录作为第一个订阅 , 重连后先于私有频道重发
+	err = ws.SubscribeChannel(_WS_LOGIN_CHANNEL, wsLoginRequest{ok}, nil)
+	if err != nil {
+		ws.CloseWs()
+		return nil, err
+	}
+
+	ok.wsLock.Lock()
+	ok.wsAuth = ws
+	ok.wsLock.Unlock()
+	return ws, nil
+}
+
+func (ok *OKExV3Ws) subscribePrivate(channel string) error {
+	ws, err := ok.authConn()
+	if err != nil {
+		return err
+	}
+	return ws.SubscribeChannel(channel, wsSubscribeRequest("subscribe", channel), wsSubscribeRequest("unsubscribe", channel))
+}
+
+func (ok *OKExV3Ws) unsubscribePrivate(channel string) error {
+	ok.wsLock.Lock()
+	auth := ok.wsAuth
+	delete(ok.wsPrivHandles, channel)
+	ok.wsLock.Unlock()
+	if auth == nil {
+		return nil
+	}
+	return auth.UnsubscribeChannel(channel)
+}
+
+func (ok *OKExV3Ws) setPrivHandle(channel string, handle func(item map[string]interface{})) {
+	ok.wsLock.Lock()
+	ok.wsPrivHandles[channel] = handle
+	ok.wsLock.Unlock()
+}
+
+/**
+ * state: -2失败 , -1撤单成功 , 0等待成交 , 1部分成交 , 2完全成交 , 3下单中 , 4撤单中
+ */
+func adaptOrderState(state int) TradeStatus {
+	switch state {
+	case -2:
+		return ORDER_REJECT
+	case -1:
+		return ORDER_CANCEL
+	case 1:
+		return ORDER_PART_FINISH
+	case 2:
+		return ORDER_FINISH
+	case 4:
+		return ORDER_CANCEL_ING
+	default:
+		return ORDER_UNFINISH
+	}
+}
+
+/**
+ * {"order_id", "client_oid", "price", "size", "notional", "instrument_id", "side":"buy/sell", "type":"limit/market",
+ *  "timestamp", "filled_size", "filled_notional", "state"}
+ * filled_*为累计值
+ */
+func parseWsSpotOrder(item map[string]interface{}) *Order {
+	side := AdaptTradeSide(fmt.Sprint(item["side"]))
+	if item["type"] == "market" {
+		if side == BUY {
+			side = BUY_MARKET
+		} else {
+			side = SELL_MARKET
+		}
+	}
+
+	ord := &Order{
+		OrderID2:   fmt.Sprint(item["order_id"]),
+		OrderID:    ToInt(item["order_id"]),
+		Price:      ToFloat64(item["price"]),
+		Amount:     ToFloat64(item["size"]),
+		DealAmount: ToFloat64(item["filled_size"]),
+		OrderTime:  int(parseIsoTime(item["timestamp"]).UnixNano() / int64(time.Millisecond)),
+		Status:     adaptOrderState(ToInt(item["state"])),
+		Side:       side}
+	if ord.DealAmount > 0 {
+		ord.AvgPrice = ToFloat64(item["filled_notional"]) / ord.DealAmount
+	}
+	return ord
+}
+
+/**
+ * {"order_id", "client_oid", "instrument_id", "price", "size", "type":"1开多/2开空/3平多/4平空", "leverage",
+ *  "filled_qty", "price_avg", "fee", "timestamp", "state"}
+ */
+func parseWsFutureOrder(item map[string]interface{}) *FutureOrder {
+	return &FutureOrder{
+		OrderID2:     fmt.Sprint(item["order_id"]),
+		OrderID:      int64(ToInt(item["order_id"])),
+		Price:        ToFloat64(item["price"]),
+		Amount:       ToFloat64(item["size"]),
+		AvgPrice:     ToFloat64(item["price_avg"]),
+		DealAmount:   ToFloat64(item["filled_qty"]),
+		OrderTime:    parseIsoTime(item["timestamp"]).UnixNano() / int64(time.Millisecond),
+		Status:       adaptOrderState(ToInt(item["state"])),
+		OType:        ToInt(item["type"]),
+		LeverRate:    ToInt(item["leverage"]),
+		Fee:          ToFloat64(item["fee"]),
+		ContractName: fmt.Sprint(item["instrument_id"])}
+}
+
+/**
+ * 交割合约(全仓): {"long_qty", "long_avail_qty", "long_avg_cost", "long_settlement_price", "realised_pnl",
+ *  "short_qty", "short_avail_qty", "short_avg_cost", "short_settlement_price", "liquidation_price", "leverage", "created_at"}
+ * 永续合约: {"holding":[{"side":"long/short", "position", "avail_position", "avg_cost", "settlement_price",
+ *  "realized_pnl", "leverage", "liquidation_price", "timestamp"}]}
+ */
+func parseWsPosition(item map[string]interface{}) *FuturePosition {
+	pos := &FuturePosition{ContractType: fmt.Sprint(item["instrument_id"])}
+
+	holding, isok := item["holding"].([]interface{})
+	if !isok {
+		pos.BuyAmount = ToFloat64(item["long_qty"])
+		pos.BuyAvailable = ToFloat64(item["long_avail_qty"])
+		pos.BuyPriceAvg = ToFloat64(item["long_avg_cost"])
+		pos.BuyPriceCost = ToFloat64(item["long_settlement_price"])
+		pos.BuyProfitReal = ToFloat64(item["realised_pnl"])
+		pos.SellAmount = ToFloat64(item["short_qty"])
+		pos.SellAvailable = ToFloat64(item["short_avail_qty"])
+		pos.SellPriceAvg = ToFloat64(item["short_avg_cost"])
+		pos.SellPriceCost = ToFloat64(item["short_settlement_price"])
+		pos.SellProfitReal = ToFloat64(item["realised_pnl"])
+		pos.LeverRate = ToInt(item["leverage"])
+		pos.ForceLiquPrice = ToFloat64(item["liquidation_price"])
+		pos.CreateDate = parseIsoTime(item["created_at"]).UnixNano() / int64(time.Millisecond)
+		return pos
+	}
+
+	for _, h := range holding {
+		hold, _ := h.(map[string]interface{})
+		pos.LeverRate = ToInt(hold["leverage"])
+		pos.ForceLiquPrice = ToFloat64(hold["liquidation_price"])
+		pos.CreateDate = parseIsoTime(hold["timestamp"]).UnixNano() / int64(time.Millisecond)
+		switch hold["side"] {
+		case "long":
+			pos.BuyAmount = ToFloat64(hold["position"])
+			pos.BuyAvailable = ToFloat64(hold["avail_position"])
+			pos.BuyPriceAvg = ToFloat64(hold["avg_cost"])
+			pos.BuyPriceCost = ToFloat64(hold["settlement_price"])
+			pos.BuyProfitReal = ToFloat64(hold["realized_pnl"])
+		case "short":
+			pos.SellAmount = ToFloat64(hold["position"])
+			pos.SellAvailable = ToFloat64(hold["avail_position"])
+			pos.SellPriceAvg = ToFloat64(hold["avg_cost"])
+			pos.SellPriceCost = ToFloat64(hold["settlement_price"])
+			pos.SellProfitReal = ToFloat64(hold["realized_pnl"])
+		}
+	}
+	return pos
+}
+
+//{"equity", "margin", "realized_pnl", "unrealized_pnl", "margin_ratio"}
+func parseWsFutureAccount(currency Currency, item map[string]interface{}) *FutureSubAccount {
+	return &FutureSubAccount{
+		Currency:      currency,
+		AccountRights: ToFloat64(item["equity"]),
+		KeepDeposit:   ToFloat64(item["margin"]),
+		ProfitReal:    ToFloat64(item["realized_pnl"]),
+		ProfitUnreal:  ToFloat64(item["unrealized_pnl"]),
+		RiskRate:      ToFloat64(item["margin_ratio"])}
+}
+
+//现货订单 , 每次推送订单的完整状态 , 可以直接交给OrderTracker.Update
+func (ok *OKExV3Ws) SubscribeSpotOrders(pair CurrencyPair, handle func(order *Order)) error {
+	channel := "spot/order:" + pair.ToSymbol("-")
+	ok.setPrivHandle(channel, func(item map[string]interface{}) {
+		order := parseWsSpotOrder(item)
+		order.Currency = pair
+		handle(order)
+	})
+	return ok.subscribePrivate(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribeSpotOrders(pair CurrencyPair) error {
+	return ok.unsubscribePrivate("spot/order:" + pair.ToSymbol("-"))
+}
+
+//现货账户 , Amount为可用 , ForzenAmount为冻结
+func (ok *OKExV3Ws) SubscribeSpotAccount(currency Currency, handle func(sub *SubAccount)) error {
+	channel := "spot/account:" + currency.Symbol
+	ok.setPrivHandle(channel, func(item map[string]interface{}) {
+		handle(&SubAccount{
+			Currency:     currency,
+			Amount:       ToFloat64(item["available"]),
+			ForzenAmount: ToFloat64(item["hold"])})
+	})
+	return ok.subscribePrivate(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribeSpotAccount(currency Currency) error {
+	return ok.unsubscribePrivate("spot/account:" + currency.Symbol)
+}
+
+//交割或永续合约的订单 , instrumentId例如 BTC-USD-190628 , BTC-USD-SWAP
+func (ok *OKExV3Ws) SubscribeFutureOrders(instrumentId string, handle func(order *FutureOrder)) error {
+	channel := instrumentType(instrumentId) + "/order:" + instrumentId
+	ok.setPrivHandle(channel, func(item map[string]interface{}) {
+		handle(parseWsFutureOrder(item))
+	})
+	return ok.subscribePrivate(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribeFutureOrders(instrumentId string) error {
+	return ok.unsubscribePrivate(instrumentType(instrumentId) + "/order:" + instrumentId)
+}
+
+//交割或永续合约的持仓 , 多空合并为一个FuturePosition , ContractType为合约代码
+func (ok *OKExV3Ws) SubscribePosition(instrumentId string, handle func(pos *FuturePosition)) error {
+	channel := instrumentType(instrumentId) + "/position:" + instrumentId
+	ok.setPrivHandle(channel, func(item map[string]interface{}) {
+		handle(parseWsPosition(item))
+	})
+	return ok.subscribePrivate(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribePosition(instrumentId string) error {
+	return ok.unsubscribePrivate(instrumentType(instrumentId) + "/position:" + instrumentId)
+}
+
+/**
+ * 合约账户 , 交割合约按币种 (futures/account:BTC) , 永续合约按合约 (swap/account:BTC-USD-SWAP)
+ * 只解析全仓模式的字段
+ */
+func (ok *OKExV3Ws) SubscribeFutureAccount(pair CurrencyPair, contractType string, handle func(sub *FutureSubAccount)) error {
+	channel := ok.futureAccountChannel(pair, contractType)
+	ok.setPrivHandle(channel, func(item map[string]interface{}) {
+		handle(parseWsFutureAccount(pair.CurrencyA, item))
+	})
+	return ok.subscribePrivate(channel)
+}
+
+func (ok *OKExV3Ws) UnsubscribeFutureAccount(pair CurrencyPair, contractType string) error {
+	return ok.unsubscribePrivate(ok.futureAccountChannel(pair, contractType))
+}
+
+func (ok *OKExV3Ws) futureAccountChannel(pair CurrencyPair, contractType string) string {
+	if contractType == SWAP_CONTRACT || strings.HasSuffix(contractType, "-SWAP") {
+		return "swap/account:" + pair.AdaptUsdtToUsd().ToSymbol("-") + "-SWAP"
+	}
+	return "futures/account:" + pair.CurrencyA.Symbol
+}
@@ -0,0 +1,190 @@
+package okex
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func deflateMessage(msg string) []byte {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write([]byte(msg))
+	w.Close()
+	return buf.Bytes()
+}
+
+func newTestV3Ws() *OKExV3Ws {
+	return NewOKExV3Ws(&goex.APIConfig{
+		HttpClient:    http.DefaultClient,
+		ApiKey:        "key",
+		ApiSecretKey:  "secret",
+		ApiPassphrase: "passphrase"})
+}
+
+func TestOKExV3Ws_wsLoginRequest(t *testing.T) {
+	ok := newTestV3Ws()
+	data, err := json.Marshal(wsLoginRequest{ok})
+	assert.Nil(t, err)
+
+	var msg struct {
+		Op   string   `json:"op"`
+		Args []string `json:"args"`
+	}
+	json.Unmarshal(data, &msg)
+	assert.Equal(t, "login", msg.Op)
+	assert.Equal(t, 4, len(msg.Args))
+	assert.Equal(t, "key", msg.Args[0])
+	assert.Equal(t, "passphrase", msg.Args[1])
+
+	sign, _ := goex.GetParamHmacSHA256Base64Sign("secret", msg.Args[2]+"GET/users/self/verify")
+	assert.Equal(t, sign, msg.Args[3])
+}
+
+func TestOKExV3Ws_instrumentId(t *testing.T) {
+	ok := newTestV3Ws()
+
+	id, _ := ok.instrumentId(goex.ETH_USDT, "")
+	assert.Equal(t, "ETH-USDT", id)
+	assert.Equal(t, "spot", instrumentType(id))
+
+	id, _ = ok.instrumentId(goex.BTC_USDT, SWAP_CONTRACT)
+	assert.Equal(t, "BTC-USD-SWAP", id)
+	assert.Equal(t, "swap", instrumentType(id))
+
+	id, _ = ok.instrumentId(goex.BTC_USD, "BTC-USD-190628")
+	assert.Equal(t, "BTC-USD-190628", id)
+	assert.Equal(t, "futures", instrumentType(id))
+
+	channel, _ := ok.candleChannel("BTC-USD-SWAP", goex.KLINE_PERIOD_1MIN)
+	assert.Equal(t, "swap/candle60s:BTC-USD-SWAP", channel)
+	_, err := ok.candleChannel("BTC-USD-SWAP", goex.KLINE_PERIOD_1MONTH)
+	assert.Equal(t, goex.ErrKlinePeriodNotSupport, err)
+
+	assert.Equal(t, goex.OKEX_SWAP, ok.Stream(SWAP_CONTRACT).GetExchangeName())
+	assert.Equal(t, goex.OKEX_FUTURE, ok.Stream(goex.QUARTER_CONTRACT).GetExchangeName())
+}
+
+func TestOKExV3Ws_handleWsMarket(t *testing.T) {
+	ok := newTestV3Ws()
+	ws := &goex.WsConn{}
+
+	var ticker *goex.Ticker
+	ok.wsHandlers.SetTicker("futures/ticker:BTC-USD-190628", func(t *goex.Ticker) { ticker = t })
+	var dep *goex.Depth
+	ok.wsHandlers.SetDepth("spot/depth5:ETH-USDT", func(d *goex.Depth) { dep = d })
+	var trades []*goex.Trade
+	ok.wsHandlers.SetTrade("swap/trade:BTC-USD-SWAP", func(t *goex.Trade) { trades = append(trades, t) })
+	var kline *goex.Kline
+	ok.wsHandlers.SetKline("spot/candle60s:ETH-USDT", func(k *goex.Kline) { kline = k })
+
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"futures/ticker","data":[{"last":"3922.4959","best_bid":"3921.8319","high_24h":"4059.74","low_24h":"3922.4959","volume_24h":"2396.1","best_ask":"4036.9675","instrument_id":"BTC-USD-190628","timestamp":"2019-03-27T03:35:26.140Z"}]}`))
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"spot/depth5","data":[{"asks":[["8.8","96.99999966",1],["9","39",3]],"bids":[["7.9","3.2",1],["7.8","1",1]],"instrument_id":"ETH-USDT","timestamp":"2019-03-27T03:35:26.140Z"}]}`))
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"swap/trade","data":[{"instrument_id":"BTC-USD-SWAP","price":"5611.9","side":"sell","size":"2","timestamp":"2019-05-06T06:51:24.389Z","trade_id":"1210447366"}]}`))
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"spot/candle60s","data":[{"candle":["2019-04-16T10:49:00.000Z","162.03","162.04","161.96","161.98","336.452694"],"instrument_id":"ETH-USDT"}]}`))
+
+	assert.Equal(t, 3922.4959, ticker.Last)
+	assert.Equal(t, 3921.8319, ticker.Buy)
+	assert.Equal(t, 2396.1, ticker.Vol)
+	assert.Equal(t, "BTC-USD-190628", ticker.ContractType)
+	assert.Equal(t, uint64(1553657726140), ticker.Date)
+
+	assert.Equal(t, goex.DepthRecords{{Price: 8.8, Amount: 96.99999966}, {Price: 9, Amount: 39}}, dep.AskList)
+	assert.Equal(t, goex.DepthRecords{{Price: 7.9, Amount: 3.2}, {Price: 7.8, Amount: 1}}, dep.BidList)
+
+	assert.Equal(t, 1, len(trades))
+	assert.Equal(t, int64(1210447366), trades[0].Tid)
+	assert.Equal(t, goex.TradeSide(goex.SELL), trades[0].Type)
+	assert.Equal(t, 2.0, trades[0].Amount)
+
+	assert.Equal(t, int64(1555411740), kline.Timestamp)
+	assert.Equal(t, 161.98, kline.Close)
+	assert.Equal(t, 336.452694, kline.Vol)
+}
+
+func TestOKExV3Ws_handleWsBook(t *testing.T) {
+	ok := newTestV3Ws()
+	ws := &goex.WsConn{}
+
+	var deps []*goex.Depth
+	ok.subscribeBook("spot/depth:ETH-USDT", goex.NewOrderBook(goex.ETH_USDT), 5, func(d *goex.Depth) {
+		deps = append(deps, d)
+	})
+
+	//checksum按原文计算 , "7.9:3:8.80:1:7.8:4:9:2.0"
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"spot/depth","action":"partial","data":[{"instrument_id":"ETH-USDT","asks":[["8.80","1","1"],["9","2.0","1"]],"bids":[["7.9","3","1"],["7.8","4","1"]],"timestamp":"2019-03-27T03:35:26.140Z","checksum":2053022903}]}`))
+
+	//"7.9:3:8.7:5:7.8:4:9:2.0"
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"spot/depth","action":"update","data":[{"instrument_id":"ETH-USDT","asks":[["8.7","5","1"],["8.80","0","0"]],"bids":[],"timestamp":"2019-03-27T03:35:26.240Z","checksum":1263674006}]}`))
+	asks := goex.DepthRecords{{Price: 8.7, Amount: 5}, {Price: 9, Amount: 2}}
+	bids := goex.DepthRecords{{Price: 7.9, Amount: 3}, {Price: 7.8, Amount: 4}}
+
+	//校验和错误
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"spot/depth","action":"update","data":[{"instrument_id":"ETH-USDT","asks":[["8.6","1","1"]],"bids":[],"timestamp":"2019-03-27T03:35:26.340Z","checksum":1}]}`))
+	//重新订阅前的增量丢弃
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"spot/depth","action":"update","data":[{"instrument_id":"ETH-USDT","asks":[["8.5","1","1"]],"bids":[],"timestamp":"2019-03-27T03:35:26.440Z","checksum":1}]}`))
+
+	assert.Equal(t, 2, len(deps))
+	assert.Equal(t, asks, deps[1].AskList)
+	assert.Equal(t, bids, deps[1].BidList)
+	assert.False(t, ok.wsBooks["spot/depth:ETH-USDT"].book.IsSynced())
+}
+
+func TestOKExV3Ws_handleWsPrivate(t *testing.T) {
+	ok := newTestV3Ws()
+	ws := &goex.WsConn{}
+
+	var order *goex.Order
+	ok.setPrivHandle("spot/order:ETH-USDT", func(item map[string]interface{}) {
+		order = parseWsSpotOrder(item)
+	})
+	var futureOrder *goex.FutureOrder
+	ok.setPrivHandle("swap/order:BTC-USD-SWAP", func(item map[string]interface{}) {
+		futureOrder = parseWsFutureOrder(item)
+	})
+	var positions []*goex.FuturePosition
+	positionHandle := func(item map[string]interface{}) {
+		positions = append(positions, parseWsPosition(item))
+	}
+	ok.setPrivHandle("futures/position:BTC-USD-190628", positionHandle)
+	ok.setPrivHandle("swap/position:BTC-USD-SWAP", positionHandle)
+	var account *goex.FutureSubAccount
+	ok.setPrivHandle("futures/account:BTC", func(item map[string]interface{}) {
+		account = parseWsFutureAccount(goex.BTC, item)
+	})
+
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"spot/order","data":[{"client_oid":"","filled_notional":"16.5","filled_size":"2","instrument_id":"ETH-USDT","margin_trading":"1","notional":"","order_id":"2614163284165632","order_type":"0","price":"8.3","side":"buy","size":"5","state":"1","status":"part_filled","timestamp":"2019-04-01T04:09:21.000Z","type":"limit"}]}`))
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"swap/order","data":[{"filled_qty":"1","fee":"-0.0000089","price_avg":"5605.7","client_oid":"","last_fill_px":"5605.7","instrument_id":"BTC-USD-SWAP","size":"1","price":"5605.7","type":"1","order_type":"0","order_id":"64-a-3e3c3c359-0","leverage":"20","state":"2","timestamp":"2019-05-06T06:51:24.389Z"}]}`))
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"futures/position","data":[{"long_qty":"1","long_avail_qty":"1","long_avg_cost":"4001.5","long_settlement_price":"4001.5","realised_pnl":"-0.00012","short_qty":"2","short_avail_qty":"1","short_avg_cost":"4100","short_settlement_price":"4100","liquidation_price":"0.0","instrument_id":"BTC-USD-190628","leverage":"10","created_at":"2019-03-19T05:27:08.000Z","updated_at":"2019-03-27T04:07:23.000Z","margin_mode":"crossed"}]}`))
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"swap/position","data":[{"holding":[{"avail_position":"1","avg_cost":"5605.7","leverage":"20","liquidation_price":"5331.1","margin":"0.0009","position":"1","realized_pnl":"-0.0000089","settlement_price":"5605.7","side":"long","timestamp":"2019-05-06T06:51:24.389Z"}],"instrument_id":"BTC-USD-SWAP","margin_mode":"crossed"}]}`))
+	ok.handleWsMessage(ws, deflateMessage(`{"table":"futures/account","data":[{"BTC":{"equity":"102.8","margin":"0.05","margin_mode":"crossed","margin_ratio":"20.5","realized_pnl":"-0.01","total_avail_balance":"102.7","unrealized_pnl":"0.02"}}]}`))
+
+	assert.Equal(t, "2614163284165632", order.OrderID2)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_PART_FINISH), order.Status)
+	assert.Equal(t, goex.TradeSide(goex.BUY), order.Side)
+	assert.Equal(t, 2.0, order.DealAmount)
+	assert.Equal(t, 8.25, order.AvgPrice)
+
+	assert.Equal(t, "64-a-3e3c3c359-0", futureOrder.OrderID2)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_FINISH), futureOrder.Status)
+	assert.Equal(t, goex.OPEN_BUY, futureOrder.OType)
+	assert.Equal(t, 20, futureOrder.LeverRate)
+	assert.Equal(t, 5605.7, futureOrder.AvgPrice)
+
+	assert.Equal(t, 2, len(positions))
+	assert.Equal(t, 1.0, positions[0].BuyAmount)
+	assert.Equal(t, 2.0, positions[0].SellAmount)
+	assert.Equal(t, 4100.0, positions[0].SellPriceAvg)
+	assert.Equal(t, "BTC-USD-190628", positions[0].ContractType)
+	assert.Equal(t, 1.0, positions[1].BuyAmount)
+	assert.Equal(t, 0.0, positions[1].SellAmount)
+	assert.Equal(t, 5331.1, positions[1].ForceLiquPrice)
+
+	assert.Equal(t, 102.8, account.AccountRights)
+	assert.Equal(t, 0.02, account.ProfitUnreal)
+	assert.Equal(t, 20.5, account.RiskRate)
+}
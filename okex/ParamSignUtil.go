@@ -6,7 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/bxsmart/GoEx"
-	"internal/log"
+	"log"
 	"strings"
 	"time"
 )
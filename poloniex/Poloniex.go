@@ -10,27 +10,61 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const EXCHANGE_NAME = "poloniex.com"
 
 const (
-	BASE_URL       = "https://poloniex.com/"
-	TRADE_API      = BASE_URL + "tradingApi"
-	PUBLIC_URL     = BASE_URL + "public"
-	TICKER_API     = "?command=returnTicker"
-	ORDER_BOOK_API = "?command=returnOrderBook&currencyPair=%s&depth=%d"
+	BASE_URL          = "https://poloniex.com/"
+	TRADE_API         = BASE_URL + "tradingApi"
+	PUBLIC_URL        = BASE_URL + "public"
+	TICKER_API        = "?command=returnTicker"
+	ORDER_BOOK_API    = "?command=returnOrderBook&currencyPair=%s&depth=%d"
+	TRADE_HISTORY_API = "?command=returnTradeHistory&currencyPair=%s"
+	CHART_DATA_API    = "?command=returnChartData&currencyPair=%s&period=%d&start=%d&end=%d"
+	CURRENCIES_API    = "?command=returnCurrencies"
 )
 
+//period单位为秒
+var _KLINE_PERIOD_CONVERTER = map[int]int{
+	KLINE_PERIOD_5MIN:  300,
+	KLINE_PERIOD_15MIN: 900,
+	KLINE_PERIOD_30MIN: 1800,
+	KLINE_PERIOD_2H:    7200,
+	KLINE_PERIOD_4H:    14400,
+	KLINE_PERIOD_1DAY:  86400,
+}
+
 type Poloniex struct {
 	accessKey,
 	secretKey string
 	client *http.Client
+
+	wsShards        *WsShards
+	wsMaxSubs       int
+	createWsLock    sync.Mutex
+	wsHandlers      *WsHandlers
+	wsLock          sync.Mutex
+	wsBooks         map[string]*wsBook
+	wsTickers       map[string]bool
+	wsPairIds       map[int64]string
+	wsCurrencyIds   map[int64]Currency
+	wsAuthHandle    wsAuthHandlers
+	wsSubErrHandles []func(channel string, err error)
 }
 
 func New(client *http.Client, accessKey, secretKey string) *Poloniex {
-	return &Poloniex{accessKey, secretKey, client}
+	return &Poloniex{
+		accessKey:     accessKey,
+		secretKey:     secretKey,
+		client:        client,
+		wsHandlers:    NewWsHandlers(),
+		wsBooks:       make(map[string]*wsBook),
+		wsTickers:     make(map[string]bool),
+		wsPairIds:     make(map[int64]string),
+		wsCurrencyIds: make(map[int64]Currency)}
 }
 
 func (poloniex *Poloniex) GetExchangeName() string {
@@ -115,8 +149,49 @@ func (poloniex *Poloniex) GetDepth(size int, currency CurrencyPair) (*Depth, err
 
 	return &depth, nil
 }
-func (Poloniex *Poloniex) GetKlineRecords(currency CurrencyPair, period, size, since int) ([]Kline, error) {
-	return nil, nil
+/**
+ * since: unix秒 , 0为最近size条
+ * [{"date", "high", "low", "open", "close", "volume", "quoteVolume", "weightedAverage"}] , volume是计价币的成交额
+ */
+func (poloniex *Poloniex) GetKlineRecords(currency CurrencyPair, period, size, since int) ([]Kline, error) {
+	granularity, isok := _KLINE_PERIOD_CONVERTER[period]
+	if !isok {
+		return nil, ErrKlinePeriodNotSupport
+	}
+
+	end := time.Now().Unix()
+	start := int64(since)
+	if start <= 0 {
+		start = end - int64(size*granularity)
+	}
+
+	resp, err := HttpGet3(poloniex.client, PUBLIC_URL+fmt.Sprintf(CHART_DATA_API,
+		currency.AdaptUsdToUsdt().Reverse().ToSymbol("_"), granularity, start, end), nil)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var klines []Kline
+	for _, v := range resp {
+		vv, isok := v.(map[string]interface{})
+		if !isok || ToFloat64(vv["date"]) == 0 {
+			continue
+		}
+		klines = append(klines, Kline{
+			Pair:      currency,
+			Timestamp: int64(ToFloat64(vv["date"])),
+			Open:      ToFloat64(vv["open"]),
+			Close:     ToFloat64(vv["close"]),
+			High:      ToFloat64(vv["high"]),
+			Low:       ToFloat64(vv["low"]),
+			Vol:       ToFloat64(vv["quoteVolume"])})
+	}
+
+	if size > 0 && len(klines) > size {
+		klines = klines[:size]
+	}
+	return klines, nil
 }
 
 func (poloniex *Poloniex) placeLimitOrder(command, amount, price string, currency CurrencyPair) (*Order, error) {
@@ -502,8 +577,38 @@ func (poloniex *Poloniex) buildPostForm(postForm *url.Values) (string, error) {
 	return sign, nil
 }
 
+/**
+ * since: unix秒 , 0为最近200笔 , 否则返回since之后的成交(最多1000笔)
+ * [{"globalTradeID", "tradeID", "date":"2014-02-10 04:23:23", "type", "rate", "amount", "total"}]
+ */
 func (poloniex *Poloniex) GetTrades(currencyPair CurrencyPair, since int64) ([]Trade, error) {
-	panic("unimplements")
+	apiurl := PUBLIC_URL + fmt.Sprintf(TRADE_HISTORY_API, currencyPair.AdaptUsdToUsdt().Reverse().ToSymbol("_"))
+	if since > 0 {
+		apiurl += fmt.Sprintf("&start=%d&end=%d", since, time.Now().Unix())
+	}
+
+	resp, err := HttpGet3(poloniex.client, apiurl, nil)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var trades []Trade
+	for _, v := range resp {
+		vv, isok := v.(map[string]interface{})
+		if !isok {
+			continue
+		}
+		date, _ := time.Parse("2006-01-02 15:04:05", fmt.Sprint(vv["date"]))
+		trades = append(trades, Trade{
+			Tid:    int64(ToFloat64(vv["tradeID"])),
+			Type:   AdaptTradeSide(fmt.Sprint(vv["type"])),
+			Amount: ToFloat64(vv["amount"]),
+			Price:  ToFloat64(vv["rate"]),
+			Date:   date.UnixNano() / int64(time.Millisecond),
+			Pair:   currencyPair})
+	}
+	return trades, nil
 }
 
 func (poloniex *Poloniex) MarketBuy(amount, price string, currency CurrencyPair) (*Order, error) {
@@ -0,0 +1,606 @@
+package poloniex
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/bxsmart/GoEx"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	WS_URL = "wss://api2.poloniex.com"
+
+	_WS_CHANNEL_ACCOUNT   = 1000
+	_WS_CHANNEL_TICKER    = 1002
+	_WS_CHANNEL_HEARTBEAT = 1010
+
+	_WS_BOOK_SIZE = 20
+)
+
+/**
+ * 自己的成交 , 账户推送的成交消息不带交易对和方向 , 可以通过OrderId关联订单
+ */
+type OwnTrade struct {
+	Trade
+	OrderId int64
+	Fee     float64
+}
+
+type wsAuthHandlers struct {
+	order   func(*Order)
+	trade   func(*OwnTrade)
+	balance func(currency Currency, wallet string, delta float64)
+}
+
+//交易对频道 , 推送深度增量和成交 , 每条消息的序号连续
+type wsBook struct {
+	book *OrderBook
+	size int
+}
+
+//每次发送时重新生成nonce , 重连后重新订阅不会因为nonce过小失败
+type wsAuthRequest struct {
+	poloniex *Poloniex
+}
+
+func (r wsAuthRequest) MarshalJSON() ([]byte, error) {
+	payload := fmt.Sprintf("nonce=%d", time.Now().UnixNano())
+	sign, err := GetParamHmacSHA512Sign(r.poloniex.secretKey, payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"command": "subscribe",
+		"channel": _WS_CHANNEL_ACCOUNT,
+		"key":     r.poloniex.accessKey,
+		"payload": payload,
+		"sign":    sign})
+}
+
+//每个连接最多订阅n个频道 , 超过后新建连接 , 默认100
+func (poloniex *Poloniex) WsMaxSubsPerConn(n int) *Poloniex {
+	poloniex.createWsLock.Lock()
+	defer poloniex.createWsLock.Unlock()
+	poloniex.wsMaxSubs = n
+	return poloniex
+}
+
+//连接在第一次订阅时建立
+func (poloniex *Poloniex) wsConns() *WsShards {
+	poloniex.createWsLock.Lock()
+	defer poloniex.createWsLock.Unlock()
+
+	if poloniex.wsShards == nil {
+		if poloniex.wsMaxSubs == 0 {
+			poloniex.wsMaxSubs = 100
+		}
+		poloniex.wsShards = NewWsShards(poloniex.wsMaxSubs, poloniex.dialWs)
+	}
+	return poloniex.wsShards
+}
+
+//服务端没有其他推送时每秒推送一次心跳[1010]
+func (poloniex *Poloniex) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn(WS_URL)
+	if err != nil {
+		return nil, err
+	}
+	ws.AckTimeout(10 * time.Second)
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		poloniex.handleWsMessage(ws, msg)
+	})
+	return ws, nil
+}
+
+/**
+ * 推送里的交易对和币种都是数字id , 第一次订阅ticker或账户时从rest接口加载
+ */
+func (poloniex *Poloniex) loadWsIds() error {
+	poloniex.wsLock.Lock()
+	loaded := len(poloniex.wsPairIds) > 0 && len(poloniex.wsCurrencyIds) > 0
+	poloniex.wsLock.Unlock()
+	if loaded {
+		return nil
+	}
+
+	tickers, err := HttpGet(poloniex.client, PUBLIC_URL+TICKER_API)
+	if err != nil {
+		return err
+	}
+	currencies, err := HttpGet(poloniex.client, PUBLIC_URL+CURRENCIES_API)
+	if err != nil {
+		return err
+	}
+
+	poloniex.wsLock.Lock()
+	defer poloniex.wsLock.Unlock()
+	for symbol, v := range tickers {
+		if vv, isok := v.(map[string]interface{}); isok {
+			poloniex.wsPairIds[int64(ToFloat64(vv["id"]))] = symbol
+		}
+	}
+	for symbol, v := range currencies {
+		if vv, isok := v.(map[string]interface{}); isok {
+			poloniex.wsCurrencyIds[int64(ToFloat64(vv["id"]))] = NewCurrency(symbol, "")
+		}
+	}
+	return nil
+}
+
+/**
+ * [1010] 心跳
+ * [channel, 1] 订阅确认 , [channel, 0] 取消订阅确认
+ * [1002, null, [pairId, last, lowestAsk, highestBid, ...]] ticker
+ * [1000, "", [[type, ...], ...]] 账户
+ * [pairId, seq, [["i", ...], ["o", ...], ["t", ...]]] 交易对
+ */
+func (poloniex *Poloniex) handleWsMessage(ws *WsConn, msg []byte) {
+	ws.UpdateActivedTime()
+
+	if len(msg) > 0 && msg[0] == '{' {
+		datamap := make(map[string]interface{})
+		json.Unmarshal(msg, &datamap)
+		//错误消息不带频道 , 等待确认的订阅都视为失败
+		err := fmt.Errorf("%v", datamap["error"])
+		for _, s := range ws.Subscriptions() {
+			if s.State == WS_SUB_PENDING {
+				ws.FailSubscribe(s.Channel, err)
+			}
+		}
+		return
+	}
+
+	var data []interface{}
+	err := json.Unmarshal(msg, &data)
+	if err != nil || len(data) == 0 {
+		log.Println("json unmarshal error for ", string(msg))
+		return
+	}
+
+	chanId := int64(wsFloat(data, 0))
+	if chanId == _WS_CHANNEL_HEARTBEAT {
+		return
+	}
+
+	if len(data) == 2 {
+		if wsFloat(data, 1) == 1 {
+			ws.AckSubscribe(fmt.Sprint(chanId))
+		}
+		return
+	}
+
+	entries, _ := data[2].([]interface{})
+	switch chanId {
+	case _WS_CHANNEL_TICKER:
+		poloniex.handleWsTicker(entries)
+	case _WS_CHANNEL_ACCOUNT:
+		poloniex.handleWsAccount(entries)
+	default:
+		poloniex.handleWsBook(ws, chanId, int64(wsFloat(data, 1)), entries)
+	}
+}
+
+//[pairId, last, lowestAsk, highestBid, percentChange, baseVolume, quoteVolume, isFrozen, high24hr, low24hr]
+func (poloniex *Poloniex) handleWsTicker(entry []interface{}) {
+	poloniex.wsLock.Lock()
+	symbol := poloniex.wsPairIds[int64(wsFloat(entry, 0))]
+	poloniex.wsLock.Unlock()
+
+	handle := poloniex.wsHandlers.Ticker("ticker:" + symbol)
+	if handle == nil {
+		return
+	}
+	handle(&Ticker{
+		Last: ToFloat64(wsString(entry, 1)),
+		Sell: ToFloat64(wsString(entry, 2)),
+		Buy:  ToFloat64(wsString(entry, 3)),
+		Vol:  ToFloat64(wsString(entry, 6)),
+		High: ToFloat64(wsString(entry, 8)),
+		Low:  ToFloat64(wsString(entry, 9)),
+		Date: uint64(time.Now().Unix())})
+}
+
+/**
+ * ["i", {"currencyPair":"BTC_ETH", "orderBook":[{asks price:size}, {bids price:size}]}] 全量
+ * ["o", 1买/0卖, price, size] 增量 , size为0表示删除
+ * ["t", tradeId, 1买/0卖, price, size, timestamp] 成交
+ * 序号不连续时重新订阅获取全量
+ */
+func (poloniex *Poloniex) handleWsBook(ws *WsConn, pairId, seq int64, entries []interface{}) {
+	var snapshot *Depth
+	var trades []*Trade
+	update := &DepthUpdate{Seq: seq, PrevSeq: seq - 1}
+
+	poloniex.wsLock.Lock()
+	for _, e := range entries {
+		entry, _ := e.([]interface{})
+		switch wsString(entry, 0) {
+		case "i":
+			info, _ := entry[1].(map[string]interface{})
+			symbol := fmt.Sprint(info["currencyPair"])
+			poloniex.wsPairIds[pairId] = symbol
+			snapshot = parseWsSnapshot(info["orderBook"])
+		case "o":
+			record := DepthRecord{Price: ToFloat64(wsString(entry, 2)), Amount: ToFloat64(wsString(entry, 3))}
+			if wsFloat(entry, 1) == 1 {
+				update.BidList = append(update.BidList, record)
+			} else {
+				update.AskList = append(update.AskList, record)
+			}
+		case "t":
+			trades = append(trades, parseWsTrade(entry))
+		}
+	}
+
+	symbol := poloniex.wsPairIds[pairId]
+	b := poloniex.wsBooks[symbol]
+	if b == nil {
+		poloniex.wsLock.Unlock()
+		return
+	}
+
+	var err error
+	if snapshot != nil {
+		b.book.Snapshot(snapshot, seq)
+	} else {
+		err = b.book.Update(update)
+	}
+	dep := b.book.Depth(b.size)
+	poloniex.wsLock.Unlock()
+
+	if snapshot != nil {
+		ws.AckSubscribe(symbol)
+	}
+
+	if handle := poloniex.wsHandlers.Trade(symbol); handle != nil {
+		for _, trade := range trades {
+			handle(trade)
+		}
+	}
+
+	switch err {
+	case nil:
+		if handle := poloniex.wsHandlers.Depth(symbol); handle != nil && (snapshot != nil || len(update.AskList)+len(update.BidList) > 0) {
+			handle(dep)
+		}
+	case ErrOrderBookGap:
+		log.Printf("[%s] %s , resubscribe ...", symbol, err)
+		if sub, isok := ws.Subscription(symbol); isok {
+			ws.SendWriteJSON(sub.Unsub)
+			ws.SendWriteJSON(sub.Sub)
+		}
+	}
+}
+
+/**
+ * ["b", currencyId, wallet, delta] 余额变化 , wallet: e(exchange) , m(margin) , l(lending)
+ * ["n", pairId, orderNumber, 1买/0卖, rate, amount, date, originalAmount] 新订单
+ * ["o", orderNumber, newAmount, orderType] 订单剩余数量变化 , orderType: f(成交) , c(取消) , s(自成交)
+ * ["t", tradeId, rate, amount, feeMultiplier, fundingType, orderNumber, totalFee, date] 成交
+ */
+func (poloniex *Poloniex) handleWsAccount(entries []interface{}) {
+	poloniex.wsLock.Lock()
+	handles := poloniex.wsAuthHandle
+	poloniex.wsLock.Unlock()
+
+	for _, e := range entries {
+		entry, _ := e.([]interface{})
+		switch wsString(entry, 0) {
+		case "b":
+			if handles.balance != nil {
+				poloniex.wsLock.Lock()
+				currency := poloniex.wsCurrencyIds[int64(wsFloat(entry, 1))]
+				poloniex.wsLock.Unlock()
+				handles.balance(currency, wsString(entry, 2), ToFloat64(wsString(entry, 3)))
+			}
+		case "n":
+			if handles.order != nil {
+				handles.order(poloniex.parseWsNewOrder(entry))
+			}
+		case "o":
+			if handles.order != nil {
+				handles.order(parseWsOrderUpdate(entry))
+			}
+		case "t":
+			if handles.trade != nil {
+				handles.trade(parseWsOwnTrade(entry))
+			}
+		}
+	}
+}
+
+func (poloniex *Poloniex) subscribe(channel string, sub, unsub interface{}) error {
+	return poloniex.wsConns().SubscribeChannel(channel, sub, unsub)
+}
+
+func (poloniex *Poloniex) subscribeCommand(channel interface{}) error {
+	return poloniex.subscribe(fmt.Sprint(channel),
+		map[string]interface{}{"command": "subscribe", "channel": channel},
+		map[string]interface{}{"command": "unsubscribe", "channel": channel})
+}
+
+//BTC_ETH , 第一个是计价币
+func wsSymbol(pair CurrencyPair) string {
+	return pair.AdaptUsdToUsdt().Reverse().ToSymbol("_")
+}
+
+func symbolToPair(symbol string) CurrencyPair {
+	currencies := strings.Split(symbol, "_")
+	if len(currencies) != 2 {
+		return UNKNOWN_PAIR
+	}
+	return NewCurrencyPair(NewCurrency(currencies[1], ""), NewCurrency(currencies[0], ""))
+}
+
+//所有交易对的ticker在同一个频道 , 没有ticker订阅后取消频道订阅
+func (poloniex *Poloniex) SubscribeTicker(pair CurrencyPair, handle func(ticker *Ticker)) error {
+	if err := poloniex.loadWsIds(); err != nil {
+		return err
+	}
+
+	symbol := wsSymbol(pair)
+	poloniex.wsHandlers.SetTicker("ticker:"+symbol, func(ticker *Ticker) {
+		ticker.Pair = pair
+		handle(ticker)
+	})
+	poloniex.wsLock.Lock()
+	poloniex.wsTickers[symbol] = true
+	poloniex.wsLock.Unlock()
+	return poloniex.subscribeCommand(_WS_CHANNEL_TICKER)
+}
+
+func (poloniex *Poloniex) UnsubscribeTicker(pair CurrencyPair) error {
+	symbol := wsSymbol(pair)
+	poloniex.wsHandlers.Remove("ticker:" + symbol)
+
+	poloniex.wsLock.Lock()
+	delete(poloniex.wsTickers, symbol)
+	empty := len(poloniex.wsTickers) == 0
+	poloniex.wsLock.Unlock()
+
+	if !empty {
+		return nil
+	}
+	return poloniex.wsConns().UnsubscribeChannel(fmt.Sprint(_WS_CHANNEL_TICKER))
+}
+
+//前20档
+func (poloniex *Poloniex) SubscribeDepth(pair CurrencyPair, handle func(dep *Depth)) error {
+	return poloniex.SubscribeBook(pair, _WS_BOOK_SIZE, handle)
+}
+
+func (poloniex *Poloniex) UnsubscribeDepth(pair CurrencyPair) error {
+	return poloniex.UnsubscribeBook(pair)
+}
+
+//本地维护全量深度 , 每次更新后回调前size档 , size<=0回调全部
+func (poloniex *Poloniex) SubscribeBook(pair CurrencyPair, size int, handle func(dep *Depth)) error {
+	symbol := wsSymbol(pair)
+	poloniex.wsHandlers.SetDepth(symbol, func(dep *Depth) {
+		dep.Pair = pair
+		handle(dep)
+	})
+	return poloniex.subscribePair(pair, size)
+}
+
+func (poloniex *Poloniex) UnsubscribeBook(pair CurrencyPair) error {
+	symbol := wsSymbol(pair)
+	poloniex.wsHandlers.SetDepth(symbol, nil)
+	return poloniex.unsubscribePair(symbol)
+}
+
+func (poloniex *Poloniex) SubscribeTrade(pair CurrencyPair, handle func(trade *Trade)) error {
+	symbol := wsSymbol(pair)
+	poloniex.wsHandlers.SetTrade(symbol, func(trade *Trade) {
+		trade.Pair = pair
+		handle(trade)
+	})
+	return poloniex.subscribePair(pair, _WS_BOOK_SIZE)
+}
+
+func (poloniex *Poloniex) UnsubscribeTrade(pair CurrencyPair) error {
+	symbol := wsSymbol(pair)
+	poloniex.wsHandlers.SetTrade(symbol, nil)
+	return poloniex.unsubscribePair(symbol)
+}
+
+//深度和成交在同一个频道
+func (poloniex *Poloniex) subscribePair(pair CurrencyPair, size int) error {
+	symbol := wsSymbol(pair)
+	poloniex.wsLock.Lock()
+	if b, isok := poloniex.wsBooks[symbol]; isok {
+		b.size = size
+	} else {
+		poloniex.wsBooks[symbol] = &wsBook{book: NewOrderBook(pair), size: size}
+	}
+	poloniex.wsLock.Unlock()
+	return poloniex.subscribeCommand(symbol)
+}
+
+//深度和成交都取消后才取消频道订阅
+func (poloniex *Poloniex) unsubscribePair(symbol string) error {
+	if poloniex.wsHandlers.Depth(symbol) != nil || poloniex.wsHandlers.Trade(symbol) != nil {
+		return nil
+	}
+	poloniex.wsHandlers.Remove(symbol)
+	poloniex.wsLock.Lock()
+	delete(poloniex.wsBooks, symbol)
+	poloniex.wsLock.Unlock()
+	return poloniex.wsConns().UnsubscribeChannel(symbol)
+}
+
+func (poloniex *Poloniex) SubscribeKline(pair CurrencyPair, period int, handle func(kline *Kline)) error {
+	return ErrStreamNotSupport
+}
+
+func (poloniex *Poloniex) UnsubscribeKline(pair CurrencyPair, period int) error {
+	return ErrStreamNotSupport
+}
+
+//新订单和订单变化 , 变化只包含OrderID和Status(剩余数量为0时为完成或取消 , 否则为部分成交)
+func (poloniex *Poloniex) OnWsOrder(handle func(order *Order)) *Poloniex {
+	poloniex.wsLock.Lock()
+	defer poloniex.wsLock.Unlock()
+	poloniex.wsAuthHandle.order = handle
+	return poloniex
+}
+
+func (poloniex *Poloniex) OnWsTrade(handle func(trade *OwnTrade)) *Poloniex {
+	poloniex.wsLock.Lock()
+	defer poloniex.wsLock.Unlock()
+	poloniex.wsAuthHandle.trade = handle
+	return poloniex
+}
+
+//wallet: e(exchange) , m(margin) , l(lending) , delta为变化量
+func (poloniex *Poloniex) OnWsBalance(handle func(currency Currency, wallet string, delta float64)) *Poloniex {
+	poloniex.wsLock.Lock()
+	defer poloniex.wsLock.Unlock()
+	poloniex.wsAuthHandle.balance = handle
+	return poloniex
+}
+
+/**
+ * 账户推送 , 通过OnWsOrder , OnWsTrade , OnWsBalance设置的回调接收
+ * 认证失败通过OnSubscribeError回调 , channel为1000
+ */
+func (poloniex *Poloniex) SubscribeAccount() error {
+	if err := poloniex.loadWsIds(); err != nil {
+		return err
+	}
+	return poloniex.subscribe(fmt.Sprint(_WS_CHANNEL_ACCOUNT), wsAuthRequest{poloniex},
+		map[string]interface{}{"command": "unsubscribe", "channel": _WS_CHANNEL_ACCOUNT})
+}
+
+func (poloniex *Poloniex) UnsubscribeAccount() error {
+	return poloniex.wsConns().UnsubscribeChannel(fmt.Sprint(_WS_CHANNEL_ACCOUNT))
+}
+
+func (poloniex *Poloniex) OnSubscribeError(handle func(channel string, err error)) {
+	poloniex.wsLock.Lock()
+	poloniex.wsSubErrHandles = append(poloniex.wsSubErrHandles, handle)
+	poloniex.wsLock.Unlock()
+	poloniex.wsConns().OnSubscribeError(handle)
+}
+
+func (poloniex *Poloniex) CloseWs() {
+	poloniex.wsConns().CloseWs()
+
+	poloniex.wsLock.Lock()
+	poloniex.wsBooks = make(map[string]*wsBook)
+	poloniex.wsTickers = make(map[string]bool)
+	poloniex.wsLock.Unlock()
+}
+
+//[{asks price:size}, {bids price:size}]
+func parseWsSnapshot(v interface{}) *Depth {
+	books, _ := v.([]interface{})
+	dep := &Depth{}
+	for i, side := range books {
+		levels, _ := side.(map[string]interface{})
+		for price, size := range levels {
+			record := DepthRecord{Price: ToFloat64(price), Amount: ToFloat64(size)}
+			if i == 0 {
+				dep.AskList = append(dep.AskList, record)
+			} else {
+				dep.BidList = append(dep.BidList, record)
+			}
+		}
+	}
+	return dep
+}
+
+//["t", tradeId, 1买/0卖, price, size, timestamp]
+func parseWsTrade(entry []interface{}) *Trade {
+	trade := &Trade{
+		Tid:    int64(ToFloat64(wsString(entry, 1))),
+		Price:  ToFloat64(wsString(entry, 3)),
+		Amount: ToFloat64(wsString(entry, 4)),
+		Date:   int64(wsFloat(entry, 5)) * 1000,
+		Type:   SELL}
+	if wsFloat(entry, 2) == 1 {
+		trade.Type = BUY
+	}
+	return trade
+}
+
+func (poloniex *Poloniex) parseWsNewOrder(entry []interface{}) *Order {
+	poloniex.wsLock.Lock()
+	symbol := poloniex.wsPairIds[int64(wsFloat(entry, 1))]
+	poloniex.wsLock.Unlock()
+
+	orderId := int64(wsFloat(entry, 2))
+	amount := ToFloat64(wsString(entry, 5))
+	original := amount
+	if len(entry) > 7 && entry[7] != nil {
+		original = ToFloat64(wsString(entry, 7))
+	}
+	date, _ := time.Parse("2006-01-02 15:04:05", wsString(entry, 6))
+
+	order := &Order{
+		OrderID:    int(orderId),
+		OrderID2:   fmt.Sprint(orderId),
+		Currency:   symbolToPair(symbol),
+		Price:      ToFloat64(wsString(entry, 4)),
+		Amount:     original,
+		DealAmount: original - amount,
+		OrderTime:  int(date.Unix()),
+		Side:       SELL,
+		Status:     ORDER_UNFINISH}
+	if wsFloat(entry, 3) == 1 {
+		order.Side = BUY
+	}
+	if order.DealAmount > 0 {
+		order.Status = ORDER_PART_FINISH
+	}
+	return order
+}
+
+func parseWsOrderUpdate(entry []interface{}) *Order {
+	orderId := int64(wsFloat(entry, 1))
+	order := &Order{
+		OrderID:  int(orderId),
+		OrderID2: fmt.Sprint(orderId),
+		Status:   ORDER_PART_FINISH}
+	switch {
+	case wsString(entry, 3) == "c":
+		order.Status = ORDER_CANCEL
+	case ToFloat64(wsString(entry, 2)) == 0:
+		order.Status = ORDER_FINISH
+	}
+	return order
+}
+
+func parseWsOwnTrade(entry []interface{}) *OwnTrade {
+	date, _ := time.Parse("2006-01-02 15:04:05", wsString(entry, 8))
+	trade := &OwnTrade{
+		OrderId: int64(wsFloat(entry, 6)),
+		Fee:     ToFloat64(wsString(entry, 7))}
+	trade.Tid = int64(wsFloat(entry, 1))
+	trade.Price = ToFloat64(wsString(entry, 2))
+	trade.Amount = ToFloat64(wsString(entry, 3))
+	trade.Date = date.UnixNano() / int64(time.Millisecond)
+	return trade
+}
+
+//数组第i个数字 , 越界或者null返回0
+func wsFloat(arr []interface{}, i int) float64 {
+	if i < len(arr) {
+		if v, isok := arr[i].(float64); isok {
+			return v
+		}
+	}
+	return 0
+}
+
+func wsString(arr []interface{}, i int) string {
+	if i < len(arr) {
+		if v, isok := arr[i].(string); isok {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package poloniex
+
+import (
+	"github.com/bxsmart/GoEx"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestPoloniex_wsSymbol(t *testing.T) {
+	assert.Equal(t, "BTC_ETH", wsSymbol(goex.ETH_BTC))
+	assert.Equal(t, "USDT_BTC", wsSymbol(goex.BTC_USD))
+	assert.Equal(t, goex.ETH_BTC, symbolToPair("BTC_ETH"))
+}
+
+func TestPoloniex_WsBook(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	ws := &goex.WsConn{}
+
+	var deps []*goex.Depth
+	var trades []*goex.Trade
+	ex.wsBooks["BTC_ETH"] = &wsBook{book: goex.NewOrderBook(goex.ETH_BTC), size: 10}
+	ex.wsHandlers.SetDepth("BTC_ETH", func(dep *goex.Depth) {
+		deps = append(deps, dep)
+	})
+	ex.wsHandlers.SetTrade("BTC_ETH", func(trade *goex.Trade) {
+		trades = append(trades, trade)
+	})
+
+	ex.handleWsMessage(ws, []byte(`[148,100,[["i",{"currencyPair":"BTC_ETH","orderBook":[{"0.021":"2","0.022":"1"},{"0.020":"3","0.019":"4"}]}]]]`))
+	ex.handleWsMessage(ws, []byte(`[148,101,[["o",1,"0.020","0.00000000"],["t","42706057",0,"0.020","3",1522877119]]]`))
+	ex.handleWsMessage(ws, []byte(`[148,102,[["t","42706058",1,"0.021","0.5",1522877120]]]`))
+	ex.handleWsMessage(ws, []byte(`[148,103,[["o",0,"0.021","1.5"]]]`))
+
+	assert.Equal(t, 3, len(deps))
+	dep := deps[2]
+	assert.Equal(t, goex.DepthRecords{{Price: 0.019, Amount: 4}}, dep.BidList)
+	assert.Equal(t, goex.DepthRecords{{Price: 0.021, Amount: 1.5}, {Price: 0.022, Amount: 1}}, dep.AskList)
+
+	assert.Equal(t, 2, len(trades))
+	assert.Equal(t, int64(42706057), trades[0].Tid)
+	assert.Equal(t, goex.TradeSide(goex.SELL), trades[0].Type)
+	assert.Equal(t, goex.TradeSide(goex.BUY), trades[1].Type)
+	assert.Equal(t, int64(1522877120000), trades[1].Date)
+}
+
+func TestPoloniex_WsBookGap(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	ws := &goex.WsConn{}
+
+	var deps []*goex.Depth
+	ex.wsBooks["BTC_ETH"] = &wsBook{book: goex.NewOrderBook(goex.ETH_BTC), size: 10}
+	ex.wsHandlers.SetDepth("BTC_ETH", func(dep *goex.Depth) {
+		deps = append(deps, dep)
+	})
+	ex.handleWsMessage(ws, []byte(`[148,100,[["i",{"currencyPair":"BTC_ETH","orderBook":[{"0.021":"2"},{"0.020":"3"}]}]]]`))
+	ex.handleWsMessage(ws, []byte(`[148,102,[["o",1,"0.020","1"]]]`))
+	ex.handleWsMessage(ws, []byte(`[148,103,[["o",1,"0.020","2"]]]`))
+
+	assert.Equal(t, 1, len(deps))
+}
+
+func TestPoloniex_handleWsAccount(t *testing.T) {
+	ex := New(http.DefaultClient, "", "")
+	ex.wsPairIds[148] = "BTC_ETH"
+	ex.wsCurrencyIds[28] = goex.BTC
+
+	var orders []*goex.Order
+	var trades []*OwnTrade
+	var deltas []float64
+	ex.OnWsOrder(func(order *goex.Order) {
+		orders = append(orders, order)
+	}).OnWsTrade(func(trade *OwnTrade) {
+		trades = append(trades, trade)
+	}).OnWsBalance(func(currency goex.Currency, wallet string, delta float64) {
+		assert.Equal(t, goex.BTC, currency)
+		assert.Equal(t, "e", wallet)
+		deltas = append(deltas, delta)
+	})
+
+	ex.handleWsMessage(&goex.WsConn{}, []byte(`[1000,"",[["n",148,6083059,1,"0.03000000","2.00000000","2018-09-08 04:54:09","2.00000000"],["b",28,"e","-0.06000000"],["t",12345,"0.03000000","0.50000000","0.00250000",0,6083059,"0.00000375","2018-09-08 05:54:09"],["o",6083059,"1.50000000","f"],["o",6083059,"0.00000000","c"]]]`))
+
+	assert.Equal(t, 3, len(orders))
+	assert.Equal(t, 6083059, orders[0].OrderID)
+	assert.Equal(t, goex.ETH_BTC, orders[0].Currency)
+	assert.Equal(t, goex.TradeSide(goex.BUY), orders[0].Side)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_UNFINISH), orders[0].Status)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_PART_FINISH), orders[1].Status)
+	assert.Equal(t, goex.TradeStatus(goex.ORDER_CANCEL), orders[2].Status)
+
+	assert.Equal(t, []float64{-0.06}, deltas)
+
+	assert.Equal(t, 1, len(trades))
+	assert.Equal(t, int64(6083059), trades[0].OrderId)
+	assert.Equal(t, 0.5, trades[0].Amount)
+	assert.Equal(t, 0.00000375, trades[0].Fee)
+}
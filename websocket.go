@@ -1,27 +1,66 @@
 package goex
 
 import (
+	"context"
+	"errors"
 	"github.com/gorilla/websocket"
 	"log"
-	"time"
+	"math/rand"
 	"sync"
+	"time"
 )
 
+type WsState int
+
+const (
+	WS_CONNECTED    WsState = 1 + iota
+	WS_DISCONNECTED         //连接断开 , 等待重连
+	WS_RECONNECTING
+	WS_CLOSED //主动关闭 , 不会再重连
+)
+
+func (s WsState) String() string {
+	switch s {
+	case WS_CONNECTED:
+		return "CONNECTED"
+	case WS_DISCONNECTED:
+		return "DISCONNECTED"
+	case WS_RECONNECTING:
+		return "RECONNECTING"
+	case WS_CLOSED:
+		return "CLOSED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+var ErrWsClosed = errors.New("websocket connection closed")
+
 type WsConn struct {
 	*websocket.Conn
 	lock                     sync.Mutex
+	writeLock                sync.Mutex
 	url                      string
+	ctx                      context.Context
+	cancel                   context.CancelFunc
 	heartbeatIntervalTime    time.Duration
 	checkConnectIntervalTime time.Duration
+	minBackoff               time.Duration
+	maxBackoff               time.Duration
 	actived                  time.Time
-	close                    chan int
-	isClose                  bool
-	subs                     []interface{}
+	state                    WsState
+	stateHandles             []func(state WsState)
+	connChanged              chan struct{} //每次重连成功后关闭并替换 , 通知读协程切换连接
+	reconnectC               chan struct{}
+	supervised               bool
+	subscriptions            map[string]*WsSubscription
+	subOrder                 []string
+	subErrHandles            []func(channel string, err error)
+	ackTimeout               time.Duration
 }
 
-
 const (
-	SUB_TICKER      = 1 + iota
+	SUB_TICKER = 1 + iota
 	SUB_ORDERBOOK
 	SUB_KLINE_1M
 	SUB_KLINE_15M
@@ -31,12 +70,92 @@ const (
 	UNSUB_ORDERBOOK
 )
 
-func NewWsConn(wsurl string) *WsConn {
-	wsConn, _, err := websocket.DefaultDialer.Dial(wsurl, nil)
+func NewWsConn(wsurl string) (*WsConn, error) {
+	return NewWsConnWithContext(context.Background(), wsurl)
+}
+
+/**
+ * ctx结束时关闭连接 , 所有后台协程退出
+ */
+func NewWsConnWithContext(ctx context.Context, wsurl string) (*WsConn, error) {
+	wsConn, _, err := websocket.DefaultDialer.DialContext(ctx, wsurl, nil)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	ws := &WsConn{
+		Conn:                     wsConn,
+		url:                      wsurl,
+		actived:                  time.Now(),
+		state:                    WS_CONNECTED,
+		checkConnectIntervalTime: 30 * time.Second,
+		minBackoff:               time.Second,
+		maxBackoff:               time.Minute,
+		connChanged:              make(chan struct{}),
+		subscriptions:            make(map[string]*WsSubscription),
+		reconnectC:               make(chan struct{}, 1)}
+	ws.ctx, ws.cancel = context.WithCancel(ctx)
+
+	go func() {
+		<-ws.ctx.Done()
+		ws.shutdown()
+	}()
+
+	return ws, nil
+}
+
+//重连间隔从min开始每次加倍 , 最大max , 实际等待时间在[d/2, d]之间随机
+func (ws *WsConn) ReconnectBackoff(min, max time.Duration) *WsConn {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	ws.minBackoff = min
+	ws.maxBackoff = max
+	return ws
+}
+
+//连接状态变化回调
+func (ws *WsConn) OnStateChange(handle func(state WsState)) *WsConn {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	ws.stateHandles = append(ws.stateHandles, handle)
+	return ws
+}
+
+func (ws *WsConn) State() WsState {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	return ws.state
+}
+
+func (ws *WsConn) Context() context.Context {
+	return ws.ctx
+}
+
+func (ws *WsConn) setState(state WsState) {
+	ws.lock.Lock()
+	if ws.state == state || ws.state == WS_CLOSED {
+		ws.lock.Unlock()
+		return
 	}
-	return &WsConn{Conn: wsConn, url: wsurl, actived: time.Now(), checkConnectIntervalTime: 30 * time.Second, close: make(chan int, 1)}
+	ws.state = state
+	handles := append([]func(WsState){}, ws.stateHandles...)
+	ws.lock.Unlock()
+
+	for _, handle := range handles {
+		handle(state)
+	}
+}
+
+func (ws *WsConn) getConn() (*websocket.Conn, chan struct{}) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	return ws.Conn, ws.connChanged
+}
+
+func (ws *WsConn) getCheckConnectInterval() time.Duration {
+	defer ws.lock.Unlock()
+	ws.lock.Lock()
+	return ws.checkConnectIntervalTime
 }
 
 func (ws *WsConn) setActived(t time.Time) {
@@ -53,62 +172,148 @@ func (ws *WsConn) getActived() time.Time {
 
 //并发安全写入，  不要用WriteJSON，或者会导致DATA RACE
 func (ws *WsConn) SendWriteJSON(v interface{}) error {
-	defer ws.lock.Unlock()
-	ws.lock.Lock()
+	if ws.ctx.Err() != nil {
+		return ErrWsClosed
+	}
 
-	return ws.WriteJSON(v)
+	conn, _ := ws.getConn()
+	defer ws.writeLock.Unlock()
+	ws.writeLock.Lock()
+
+	return conn.WriteJSON(v)
 }
 
+/**
+ * 启动重连协程: 读取出错或超过2个检查周期没有活动时重连 , 失败按指数退避重试直到成功或关闭
+ */
 func (ws *WsConn) ReConnect() {
+	ws.lock.Lock()
+	if ws.supervised {
+		ws.lock.Unlock()
+		return
+	}
+	ws.supervised = true
+	interval := ws.checkConnectIntervalTime
+	ws.lock.Unlock()
 
-	timer := time.NewTimer(ws.checkConnectIntervalTime)
-	go func() {
+	go func(interval time.Duration) {
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
 		for {
 			select {
 			case <-timer.C:
-				if time.Now().Sub(ws.getActived()) >= 2*ws.checkConnectIntervalTime {
-					ws.Close()
-					log.Println("start reconnect websocket:", ws.url)
-					wsConn, _, err := websocket.DefaultDialer.Dial(ws.url, nil)
-					if err != nil {
-						log.Println("reconnect fail ???")
-					} else {
-						ws.Conn = wsConn
-						ws.UpdateActivedTime()
-						//re subscribe
-						for _, sub := range ws.subs {
-							log.Println("subscribe:", sub)
-							ws.SendWriteJSON(sub)
-						}
-					}
+				interval = ws.getCheckConnectInterval()
+				if time.Now().Sub(ws.getActived()) >= 2*interval {
+					log.Println("websocket inactive, reconnect:", ws.url)
+					ws.reconnect()
 				}
-				timer.Reset(ws.checkConnectIntervalTime)
-			case <-ws.close:
-				timer.Stop()
+				timer.Reset(interval)
+			case <-ws.reconnectC:
+				ws.reconnect()
+				timer.Reset(ws.getCheckConnectInterval())
+			case <-ws.ctx.Done():
 				log.Println("close websocket connect, exiting reconnect goroutine.")
 				return
 			}
 		}
-	}()
+	}(interval)
+}
+
+func (ws *WsConn) backoff(attempt int) time.Duration {
+	ws.lock.Lock()
+	min, max := ws.minBackoff, ws.maxBackoff
+	ws.lock.Unlock()
+
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (ws *WsConn) reconnect() {
+	ws.setState(WS_RECONNECTING)
+
+	old, _ := ws.getConn()
+	old.Close()
+
+	for attempt := 0; ; attempt++ {
+		log.Println("start reconnect websocket:", ws.url)
+		wsConn, _, err := websocket.DefaultDialer.DialContext(ws.ctx, ws.url, nil)
+		if err == nil {
+			ws.lock.Lock()
+			if ws.state == WS_CLOSED {
+				ws.lock.Unlock()
+				wsConn.Close()
+				return
+			}
+			ws.Conn = wsConn
+			close(ws.connChanged)
+			ws.connChanged = make(chan struct{})
+			ws.lock.Unlock()
+
+			ws.UpdateActivedTime()
+			ws.setState(WS_CONNECTED)
+			ws.resubscribe()
+			return
+		}
+
+		delay := ws.backoff(attempt)
+		log.Printf("reconnect fail: %s , retry after %s", err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ws.ctx.Done():
+			return
+		}
+	}
 }
 
+//并发安全写入文本消息 , 用于不是json的消息(例如bitmex的ping)
+func (ws *WsConn) SendText(msg []byte) error {
+	if ws.ctx.Err() != nil {
+		return ErrWsClosed
+	}
+
+	conn, _ := ws.getConn()
+	defer ws.writeLock.Unlock()
+	ws.writeLock.Lock()
+
+	return conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+//heartbeat返回[]byte时按文本消息原样发送 , 否则按json发送
 func (ws *WsConn) Heartbeat(heartbeat func() interface{}, interval time.Duration) {
+	ws.lock.Lock()
 	ws.heartbeatIntervalTime = interval
 	ws.checkConnectIntervalTime = 2 * ws.heartbeatIntervalTime
+	ws.lock.Unlock()
 
-	timer := time.NewTimer(interval)
 	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 		for {
 			select {
-			case <-timer.C:
-				err := ws.SendWriteJSON(heartbeat())
+			case <-ticker.C:
+				if ws.State() != WS_CONNECTED {
+					continue
+				}
+				var err error
+				msg := heartbeat()
+				if text, isok := msg.([]byte); isok {
+					err = ws.SendText(text)
+				} else {
+					err = ws.SendWriteJSON(msg)
+				}
 				if err != nil {
 					log.Println("heartbeat error , ", err)
-					time.Sleep(time.Second)
 				}
-				timer.Reset(interval)
-			case <-ws.close:
-				timer.Stop()
+			case <-ws.ctx.Done():
 				log.Println("close websocket connect , exiting heartbeat goroutine.")
 				return
 			}
@@ -116,36 +321,65 @@ func (ws *WsConn) Heartbeat(heartbeat func() interface{}, interval time.Duration
 	}()
 }
 
+//以消息内容作为channel订阅 , 需要确认回执或按名字取消时用SubscribeChannel
 func (ws *WsConn) Subscribe(subEvent interface{}) error {
-	err := ws.SendWriteJSON(subEvent)
-	if err != nil {
-		return err
-	}
-	ws.subs = append(ws.subs, subEvent)
-	return nil
+	return ws.SubscribeChannel(wsSubscriptionKey(subEvent), subEvent, nil)
+}
+
+//取消订阅 , 同时从重连后需要重新订阅的列表里移除subEvent
+func (ws *WsConn) Unsubscribe(subEvent, unsubEvent interface{}) error {
+	ws.removeSubscription(wsSubscriptionKey(subEvent))
+	return ws.SendWriteJSON(unsubEvent)
 }
 
+/**
+ * 读协程 , 出错时通知重连协程 , 并等待新连接建立
+ * 没有调用ReConnect时 , 连接断开后退出
+ */
 func (ws *WsConn) ReceiveMessage(handle func(msg []byte)) {
 	go func() {
 		for {
-			t, msg, err := ws.ReadMessage()
+			conn, connChanged := ws.getConn()
+			t, msg, err := conn.ReadMessage()
 			if err != nil {
+				if ws.ctx.Err() != nil {
+					log.Println("exiting receive message goroutine.")
+					return
+				}
 				log.Println(err)
-				if ws.isClose {
+
+				//只有当前连接出错才需要重连 , 重连过程中关闭的旧连接忽略
+				ws.lock.Lock()
+				supervised := ws.supervised
+				current := ws.Conn == conn && ws.state == WS_CONNECTED
+				ws.lock.Unlock()
+
+				if current {
+					ws.setState(WS_DISCONNECTED)
+				}
+				if !supervised {
+					log.Println("websocket disconnected without reconnect, exiting receive message goroutine.")
+					return
+				}
+				if current {
+					select {
+					case ws.reconnectC <- struct{}{}:
+					default:
+					}
+				}
+
+				select {
+				case <-connChanged:
+				case <-ws.ctx.Done():
 					log.Println("exiting receive message goroutine.")
-					break
+					return
 				}
-				time.Sleep(time.Second)
 				continue
 			}
+
 			switch t {
 			case websocket.TextMessage, websocket.BinaryMessage:
 				handle(msg)
-			case websocket.PongMessage:
-				ws.UpdateActivedTime()
-			case websocket.CloseMessage:
-				ws.CloseWs()
-				return
 			default:
 				log.Println("error websocket message type , content is :\n", string(msg))
 			}
@@ -160,16 +394,29 @@ func (ws *WsConn) UpdateActivedTime() {
 	ws.actived = time.Now()
 }
 
+//关闭连接 , 可重复调用
 func (ws *WsConn) CloseWs() {
-	ws.close <- 1 //exit reconnect goroutine
-	if ws.heartbeatIntervalTime > 0 {
-		ws.close <- 1 //exit heartbeat goroutine
+	ws.cancel()
+	ws.shutdown()
+}
+
+func (ws *WsConn) shutdown() {
+	ws.lock.Lock()
+	if ws.state == WS_CLOSED {
+		ws.lock.Unlock()
+		return
 	}
+	ws.state = WS_CLOSED
+	conn := ws.Conn
+	handles := append([]func(WsState){}, ws.stateHandles...)
+	ws.lock.Unlock()
 
-	err := ws.Close()
+	err := conn.Close()
 	if err != nil {
 		log.Println("close websocket connect error , ", err)
 	}
 
-	ws.isClose = true
+	for _, handle := range handles {
+		handle(WS_CLOSED)
+	}
 }
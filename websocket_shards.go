@@ -0,0 +1,217 @@
+package goex
+
+import "sync"
+
+/**
+ * websocket回调 , 按频道保存 , 并发安全
+ */
+type WsHandlers struct {
+	lock   sync.RWMutex
+	ticker map[string]func(*Ticker)
+	depth  map[string]func(*Depth)
+	trade  map[string]func(*Trade)
+	kline  map[string]func(*Kline)
+}
+
+func NewWsHandlers() *WsHandlers {
+	return &WsHandlers{
+		ticker: make(map[string]func(*Ticker)),
+		depth:  make(map[string]func(*Depth)),
+		trade:  make(map[string]func(*Trade)),
+		kline:  make(map[string]func(*Kline))}
+}
+
+func (h *WsHandlers) SetTicker(channel string, handle func(*Ticker)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.ticker[channel] = handle
+}
+
+func (h *WsHandlers) Ticker(channel string) func(*Ticker) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.ticker[channel]
+}
+
+func (h *WsHandlers) SetDepth(channel string, handle func(*Depth)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.depth[channel] = handle
+}
+
+func (h *WsHandlers) Depth(channel string) func(*Depth) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.depth[channel]
+}
+
+func (h *WsHandlers) SetTrade(channel string, handle func(*Trade)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.trade[channel] = handle
+}
+
+func (h *WsHandlers) Trade(channel string) func(*Trade) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.trade[channel]
+}
+
+func (h *WsHandlers) SetKline(channel string, handle func(*Kline)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.kline[channel] = handle
+}
+
+func (h *WsHandlers) Kline(channel string) func(*Kline) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.kline[channel]
+}
+
+//删除频道的所有回调
+func (h *WsHandlers) Remove(channel string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.ticker, channel)
+	delete(h.depth, channel)
+	delete(h.trade, channel)
+	delete(h.kline, channel)
+}
+
+/**
+ * 多个websocket连接 , 每个连接最多maxSubsPerConn个频道 , 满了自动新建连接
+ * maxSubsPerConn <= 0 时不限制 , 只用一个连接
+ * 连接在第一次订阅时才建立
+ */
+type WsShards struct {
+	lock          sync.Mutex
+	dial          func() (*WsConn, error)
+	maxSubs       int
+	conns         []*WsConn
+	counts        map[*WsConn]int
+	channels      map[string]*WsConn
+	subErrHandles []func(channel string, err error)
+}
+
+func NewWsShards(maxSubsPerConn int, dial func() (*WsConn, error)) *WsShards {
+	return &WsShards{
+		dial:     dial,
+		maxSubs:  maxSubsPerConn,
+		counts:   make(map[*WsConn]int),
+		channels: make(map[string]*WsConn)}
+}
+
+//分配连接 , 已经订阅过的频道返回原来的连接 , 需要新建连接时在锁外建立
+func (s *WsShards) assign(channel string) (*WsConn, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for {
+		if ws, ok := s.channels[channel]; ok {
+			return ws, nil
+		}
+
+		for _, ws := range s.conns {
+			if s.maxSubs <= 0 || s.counts[ws] < s.maxSubs {
+				s.channels[channel] = ws
+				s.counts[ws]++
+				return ws, nil
+			}
+		}
+
+		s.lock.Unlock()
+		ws, err := s.dial()
+		s.lock.Lock()
+		if err != nil {
+			return nil, err
+		}
+
+		//交易所拒绝订阅时空出位置
+		ws.OnSubscribeError(func(channel string, err error) {
+			s.releaseConn(ws, channel)
+		})
+		for _, handle := range s.subErrHandles {
+			ws.OnSubscribeError(handle)
+		}
+		s.conns = append(s.conns, ws)
+	}
+}
+
+func (s *WsShards) release(channel string) *WsConn {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ws, ok := s.channels[channel]
+	if !ok {
+		return nil
+	}
+	delete(s.channels, channel)
+	s.counts[ws]--
+	return ws
+}
+
+//频道仍在ws上时才释放 , 避免释放已经重新分配到其他连接的频道
+func (s *WsShards) releaseConn(ws *WsConn, channel string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.channels[channel] == ws {
+		delete(s.channels, channel)
+		s.counts[ws]--
+	}
+}
+
+func (s *WsShards) SubscribeChannel(channel string, sub, unsub interface{}) error {
+	ws, err := s.assign(channel)
+	if err != nil {
+		return err
+	}
+	err = ws.SubscribeChannel(channel, sub, unsub)
+	if err != nil {
+		s.releaseConn(ws, channel)
+	}
+	return err
+}
+
+func (s *WsShards) UnsubscribeChannel(channel string) error {
+	ws := s.release(channel)
+	if ws == nil {
+		return nil
+	}
+	return ws.UnsubscribeChannel(channel)
+}
+
+//频道所在的连接 , 没有订阅返回nil
+func (s *WsShards) Conn(channel string) *WsConn {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.channels[channel]
+}
+
+func (s *WsShards) Conns() []*WsConn {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*WsConn{}, s.conns...)
+}
+
+func (s *WsShards) OnSubscribeError(handle func(channel string, err error)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.subErrHandles = append(s.subErrHandles, handle)
+	for _, ws := range s.conns {
+		ws.OnSubscribeError(handle)
+	}
+}
+
+//关闭所有连接 , 之后的订阅会重新建立连接
+func (s *WsShards) CloseWs() {
+	s.lock.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.counts = make(map[*WsConn]int)
+	s.channels = make(map[string]*WsConn)
+	s.lock.Unlock()
+
+	for _, ws := range conns {
+		ws.CloseWs()
+	}
+}
@@ -0,0 +1,86 @@
+package goex
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWsShards(t *testing.T) {
+	subs := make(chan string, 10)
+	server := newTestWsServer(subs)
+	defer server.Close()
+
+	dials := 0
+	shards := NewWsShards(2, func() (*WsConn, error) {
+		dials++
+		ws, err := NewWsConn("ws" + strings.TrimPrefix(server.URL, "http"))
+		if err != nil {
+			return nil, err
+		}
+		ws.ReceiveMessage(func(msg []byte) {})
+		return ws, nil
+	})
+	defer shards.CloseWs()
+
+	assert.Nil(t, shards.SubscribeChannel("ticker", map[string]string{"sub": "ticker"}, map[string]string{"unsub": "ticker"}))
+	assert.Nil(t, shards.SubscribeChannel("depth", map[string]string{"sub": "depth"}, nil))
+	assert.Nil(t, shards.SubscribeChannel("ticker", map[string]string{"sub": "ticker"}, map[string]string{"unsub": "ticker"}))
+	assert.Equal(t, 1, dials)
+	assert.Nil(t, shards.SubscribeChannel("kline", map[string]string{"sub": "kline"}, nil))
+	assert.Equal(t, 2, dials)
+	assert.Equal(t, 2, len(shards.Conns()))
+	assert.True(t, shards.Conn("ticker") == shards.Conn("depth"))
+	assert.True(t, shards.Conn("ticker") != shards.Conn("kline"))
+
+	//取消订阅后空出的位置可以复用
+	assert.Nil(t, shards.UnsubscribeChannel("ticker"))
+	assert.True(t, shards.Conn("ticker") == nil)
+	assert.Nil(t, shards.SubscribeChannel("trade", map[string]string{"sub": "trade"}, nil))
+	assert.Equal(t, 2, dials)
+	assert.True(t, shards.Conn("depth") == shards.Conn("trade"))
+
+	received := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		select {
+		case msg := <-subs:
+			received[strings.TrimSpace(msg)] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+	}
+	assert.True(t, received[`{"sub":"ticker"}`])
+	assert.True(t, received[`{"unsub":"ticker"}`])
+	assert.True(t, received[`{"sub":"trade"}`])
+
+	//订阅失败的频道不再占用位置
+	ws := shards.Conn("kline")
+	ws.FailSubscribe("kline", errors.New("invalid channel"))
+	assert.True(t, shards.Conn("kline") == nil)
+	assert.Nil(t, shards.SubscribeChannel("kline", map[string]string{"sub": "kline"}, nil))
+	assert.Nil(t, shards.SubscribeChannel("ticker", map[string]string{"sub": "ticker"}, nil))
+	assert.Equal(t, 2, dials)
+	assert.True(t, shards.Conn("ticker") == ws)
+
+	shards.CloseWs()
+	assert.Equal(t, 0, len(shards.Conns()))
+}
+
+func TestWsHandlers(t *testing.T) {
+	handlers := NewWsHandlers()
+	assert.Nil(t, handlers.Depth("depth"))
+
+	called := 0
+	handlers.SetDepth("depth", func(depth *Depth) { called++ })
+	handlers.SetTicker("depth", func(ticker *Ticker) { called++ })
+	handlers.Depth("depth")(&Depth{})
+	handlers.Ticker("depth")(&Ticker{})
+	assert.Equal(t, 2, called)
+
+	handlers.Remove("depth")
+	assert.Nil(t, handlers.Depth("depth"))
+	assert.Nil(t, handlers.Ticker("depth"))
+}
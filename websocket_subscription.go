@@ -0,0 +1,220 @@
+package goex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+type WsSubState int
+
+const (
+	WS_SUB_PENDING WsSubState = 1 + iota //已发送 , 等待交易所确认
+	WS_SUB_ACTIVE
+	WS_SUB_FAILED
+)
+
+func (s WsSubState) String() string {
+	switch s {
+	case WS_SUB_PENDING:
+		return "PENDING"
+	case WS_SUB_ACTIVE:
+		return "ACTIVE"
+	case WS_SUB_FAILED:
+		return "FAILED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+var ErrWsSubscribeTimeout = errors.New("websocket subscribe ack timeout")
+
+type WsSubscription struct {
+	Channel string
+	Sub     interface{} //订阅消息
+	Unsub   interface{} //取消订阅消息 , nil表示交易所不支持取消
+	State   WsSubState
+	Err     error
+	SentAt  time.Time
+}
+
+/**
+ * 订阅频道 , 同一个channel只订阅一次 , 重连后自动重新订阅
+ * 未连接时只登记 , 连接成功后发送; 发送失败返回错误且不登记
+ * 交易所回执由adapter调用AckSubscribe / FailSubscribe确认
+ */
+func (ws *WsConn) SubscribeChannel(channel string, sub, unsub interface{}) error {
+	ws.lock.Lock()
+	if s, ok := ws.subscriptions[channel]; ok && s.State != WS_SUB_FAILED {
+		ws.lock.Unlock()
+		return nil
+	}
+	if _, ok := ws.subscriptions[channel]; !ok {
+		ws.subOrder = append(ws.subOrder, channel)
+	}
+	s := &WsSubscription{Channel: channel, Sub: sub, Unsub: unsub, State: WS_SUB_PENDING}
+	ws.subscriptions[channel] = s
+	connected := ws.state == WS_CONNECTED
+	ws.lock.Unlock()
+
+	if !connected {
+		return nil
+	}
+
+	if err := ws.sendSubscription(s); err != nil {
+		ws.removeSubscription(channel)
+		return err
+	}
+	return nil
+}
+
+//取消订阅 , 没有订阅过的channel直接返回
+func (ws *WsConn) UnsubscribeChannel(channel string) error {
+	s := ws.removeSubscription(channel)
+	if s == nil || s.Unsub == nil || ws.State() != WS_CONNECTED {
+		return nil
+	}
+	return ws.SendWriteJSON(s.Unsub)
+}
+
+//交易所确认订阅成功
+func (ws *WsConn) AckSubscribe(channel string) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if s, ok := ws.subscriptions[channel]; ok {
+		s.State = WS_SUB_ACTIVE
+		s.Err = nil
+	}
+}
+
+//交易所返回订阅失败 , 失败的订阅不会在重连后重发 , 可以再次调用SubscribeChannel
+func (ws *WsConn) FailSubscribe(channel string, err error) {
+	ws.lock.Lock()
+	s, ok := ws.subscriptions[channel]
+	if !ok || s.State == WS_SUB_FAILED {
+		ws.lock.Unlock()
+		return
+	}
+	s.State = WS_SUB_FAILED
+	s.Err = err
+	handles := append([]func(string, error){}, ws.subErrHandles...)
+	ws.lock.Unlock()
+
+	log.Printf("subscribe %s fail: %s", channel, err)
+	for _, handle := range handles {
+		handle(channel, err)
+	}
+}
+
+//订阅失败回调 , 包括交易所拒绝和确认超时
+func (ws *WsConn) OnSubscribeError(handle func(channel string, err error)) *WsConn {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	ws.subErrHandles = append(ws.subErrHandles, handle)
+	return ws
+}
+
+//超过d没有确认的订阅视为失败 , 默认0不检查 , 只对会调用AckSubscribe的adapter开启
+func (ws *WsConn) AckTimeout(d time.Duration) *WsConn {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	ws.ackTimeout = d
+	return ws
+}
+
+func (ws *WsConn) Subscription(channel string) (WsSubscription, bool) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	s, ok := ws.subscriptions[channel]
+	if !ok {
+		return WsSubscription{}, false
+	}
+	return *s, true
+}
+
+//按订阅顺序返回
+func (ws *WsConn) Subscriptions() []WsSubscription {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	ret := make([]WsSubscription, 0, len(ws.subOrder))
+	for _, channel := range ws.subOrder {
+		ret = append(ret, *ws.subscriptions[channel])
+	}
+	return ret
+}
+
+func (ws *WsConn) removeSubscription(channel string) *WsSubscription {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	s, ok := ws.subscriptions[channel]
+	if !ok {
+		return nil
+	}
+	delete(ws.subscriptions, channel)
+	for i, c := range ws.subOrder {
+		if c == channel {
+			ws.subOrder = append(ws.subOrder[:i], ws.subOrder[i+1:]...)
+			break
+		}
+	}
+	return s
+}
+
+func (ws *WsConn) sendSubscription(s *WsSubscription) error {
+	ws.lock.Lock()
+	sentAt := time.Now()
+	s.SentAt = sentAt
+	timeout := ws.ackTimeout
+	ws.lock.Unlock()
+
+	err := ws.SendWriteJSON(s.Sub)
+	if err != nil {
+		return err
+	}
+
+	if timeout > 0 {
+		time.AfterFunc(timeout, func() {
+			ws.lock.Lock()
+			cur, ok := ws.subscriptions[s.Channel]
+			expired := ok && cur == s && s.State == WS_SUB_PENDING && s.SentAt == sentAt && ws.state == WS_CONNECTED
+			ws.lock.Unlock()
+			if expired {
+				ws.FailSubscribe(s.Channel, ErrWsSubscribeTimeout)
+			}
+		})
+	}
+	return nil
+}
+
+//重连后重发所有未失败的订阅
+func (ws *WsConn) resubscribe() {
+	ws.lock.Lock()
+	var subs []*WsSubscription
+	for _, channel := range ws.subOrder {
+		s := ws.subscriptions[channel]
+		if s.State == WS_SUB_FAILED {
+			continue
+		}
+		s.State = WS_SUB_PENDING
+		subs = append(subs, s)
+	}
+	ws.lock.Unlock()
+
+	for _, s := range subs {
+		log.Println("subscribe:", s.Channel)
+		if err := ws.sendSubscription(s); err != nil {
+			log.Printf("resubscribe %s error: %s", s.Channel, err)
+		}
+	}
+}
+
+//没有channel名字的订阅消息用消息内容作为key
+func wsSubscriptionKey(subEvent interface{}) string {
+	data, err := json.Marshal(subEvent)
+	if err != nil {
+		return fmt.Sprintf("%v", subEvent)
+	}
+	return string(data)
+}
@@ -0,0 +1,66 @@
+package goex
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWsConn_SubscribeChannel(t *testing.T) {
+	subs := make(chan string, 10)
+	server := newTestWsServer(subs)
+	defer server.Close()
+
+	ws, err := NewWsConn("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.Nil(t, err)
+	defer ws.CloseWs()
+
+	failed := make(chan string, 10)
+	ws.ReconnectBackoff(10*time.Millisecond, 50*time.Millisecond).OnSubscribeError(func(channel string, err error) {
+		failed <- channel
+	})
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {})
+
+	assert.Nil(t, ws.SubscribeChannel("ticker", map[string]string{"sub": "ticker"}, map[string]string{"unsub": "ticker"}))
+	assert.Nil(t, ws.SubscribeChannel("ticker", map[string]string{"sub": "ticker"}, map[string]string{"unsub": "ticker"}))
+	assert.Nil(t, ws.SubscribeChannel("depth", map[string]string{"sub": "depth"}, nil))
+	assert.Nil(t, ws.SubscribeChannel("kline", map[string]string{"sub": "kline"}, map[string]string{"unsub": "kline"}))
+	assert.Equal(t, `{"sub":"ticker"}`, strings.TrimSpace(<-subs))
+	assert.Equal(t, `{"sub":"depth"}`, strings.TrimSpace(<-subs))
+	assert.Equal(t, `{"sub":"kline"}`, strings.TrimSpace(<-subs))
+
+	ws.AckSubscribe("ticker")
+	ws.FailSubscribe("depth", errors.New("bad-request"))
+	assert.Equal(t, "depth", <-failed)
+	assert.Nil(t, ws.UnsubscribeChannel("kline"))
+	assert.Equal(t, `{"unsub":"kline"}`, strings.TrimSpace(<-subs))
+
+	s, _ := ws.Subscription("ticker")
+	assert.Equal(t, WS_SUB_ACTIVE, s.State)
+	s, _ = ws.Subscription("depth")
+	assert.Equal(t, WS_SUB_FAILED, s.State)
+	_, ok := ws.Subscription("kline")
+	assert.False(t, ok)
+
+	//重连后只重新订阅ticker , 没有确认时超时失败
+	ws.AckTimeout(50 * time.Millisecond)
+	ws.SendWriteJSON(map[string]string{"event": "close"})
+	select {
+	case sub := <-subs:
+		assert.Equal(t, `{"sub":"ticker"}`, strings.TrimSpace(sub))
+	case <-time.After(5 * time.Second):
+		t.Fatal("not resubscribe after reconnect")
+	}
+	select {
+	case channel := <-failed:
+		assert.Equal(t, "ticker", channel)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ack timeout not reported")
+	}
+	assert.Equal(t, 0, len(subs))
+	assert.Equal(t, 2, len(ws.Subscriptions()))
+}
@@ -3,8 +3,14 @@ package goex
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -15,8 +21,12 @@ func Test_time(t *testing.T) {
 
 func TestNewWsConn(t *testing.T) {
 	//os.Setenv("https_proxy" , "socks5://127.0.0.1:1080")
-	ws := NewWsConn("wss://api.huobipro.com/ws")
-	//ws := NewWsConn("wss://real.okex.com:10441/websocket")
+	ws, err := NewWsConn("wss://api.huobipro.com/ws")
+	//ws, err := NewWsConn("wss://real.okex.com:10441/websocket")
+	if err != nil {
+		t.Log(err)
+		return
+	}
 	time.Sleep(time.Second)
 
 	ws.Heartbeat(func() interface{} {
@@ -52,3 +62,118 @@ func TestNewWsConn(t *testing.T) {
 
 	time.Sleep(time.Second)
 }
+
+//收到close消息后断开连接 , 其他消息发到subs并原样返回
+func newTestWsServer(subs chan string) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if strings.Contains(string(msg), "close") {
+				return
+			}
+			subs <- string(msg)
+			conn.WriteMessage(websocket.TextMessage, msg)
+		}
+	}))
+}
+
+func TestNewWsConn_DialError(t *testing.T) {
+	ws, err := NewWsConn("ws://127.0.0.1:1/ws")
+	assert.Nil(t, ws)
+	assert.NotNil(t, err)
+}
+
+func TestWsConn_ReConnect(t *testing.T) {
+	subs := make(chan string, 10)
+	server := newTestWsServer(subs)
+	defer server.Close()
+
+	ws, err := NewWsConn("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.Nil(t, err)
+
+	states := make(chan WsState, 10)
+	ws.ReconnectBackoff(10*time.Millisecond, 50*time.Millisecond).OnStateChange(func(state WsState) {
+		states <- state
+	})
+	ws.ReConnect()
+
+	received := make(chan string, 10)
+	ws.ReceiveMessage(func(msg []byte) {
+		received <- string(msg)
+	})
+
+	assert.Nil(t, ws.Subscribe(map[string]string{"sub": "ticker"}))
+	assert.Nil(t, ws.Unsubscribe(map[string]string{"sub": "ticker"}, map[string]string{"unsub": "ticker"}))
+	assert.Nil(t, ws.Subscribe(map[string]string{"sub": "depth"}))
+	for i := 0; i < 3; i++ {
+		<-subs
+		<-received
+	}
+	ws.SendWriteJSON(map[string]string{"event": "close"})
+
+	select {
+	case sub := <-subs:
+		assert.Equal(t, `{"sub":"depth"}`, strings.TrimSpace(sub)) //只重新订阅有效的频道
+	case <-time.After(5 * time.Second):
+		t.Fatal("not resubscribe after reconnect")
+	}
+	assert.Equal(t, `{"sub":"depth"}`, strings.TrimSpace(<-received))
+	assert.Equal(t, WS_DISCONNECTED, <-states)
+	assert.Equal(t, WS_RECONNECTING, <-states)
+	assert.Equal(t, WS_CONNECTED, <-states)
+
+	ws.CloseWs()
+	ws.CloseWs()
+	assert.Equal(t, WS_CLOSED, ws.State())
+	assert.Equal(t, ErrWsClosed, ws.SendWriteJSON(map[string]string{"sub": "ticker"}))
+}
+
+func TestNewWsConnWithContext(t *testing.T) {
+	server := newTestWsServer(make(chan string, 10))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ws, err := NewWsConnWithContext(ctx, "ws"+strings.TrimPrefix(server.URL, "http"))
+	assert.Nil(t, err)
+
+	closed := make(chan struct{})
+	ws.OnStateChange(func(state WsState) {
+		if state == WS_CLOSED {
+			close(closed)
+		}
+	})
+	cancel()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not closed after context cancel")
+	}
+}
+
+func TestWsConn_TextHeartbeat(t *testing.T) {
+	subs := make(chan string, 10)
+	server := newTestWsServer(subs)
+	defer server.Close()
+
+	ws, err := NewWsConn("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.Nil(t, err)
+	ws.Heartbeat(func() interface{} { return []byte("ping") }, 50*time.Millisecond)
+
+	select {
+	case msg := <-subs:
+		assert.Equal(t, "ping", msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no heartbeat")
+	}
+	ws.CloseWs()
+}
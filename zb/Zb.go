@@ -34,19 +34,19 @@ const (
 	CANCELWITHDRAW_API        = "cancelWithdraw"
 )
 
-var onceWsConn sync.Once
-
 type Zb struct {
 	httpClient           *http.Client
 	accessKey, secretKey string
-	ws                   *WsConn
-	wsDepthHandleMap     map[string]func(*Depth)
+	wsShards             *WsShards
+	wsMaxSubs            int
+	createWsLock         sync.Mutex
+	wsHandlers           *WsHandlers
 }
 
 func New(httpClient *http.Client, accessKey, secretKey string) *Zb {
-	zb := Zb{httpClient: httpClient, accessKey: accessKey, secretKey: secretKey}
-	zb.wsDepthHandleMap = make(map[string]func(*Depth))
-	return &zb
+	zb := &Zb{httpClient: httpClient, accessKey: accessKey, secretKey: secretKey}
+	zb.wsHandlers = NewWsHandlers()
+	return zb
 }
 
 func (zb *Zb) GetExchangeName() string {
@@ -485,20 +485,78 @@ Decoder step
 3. json parser
 */
 func (zb *Zb) GetDepthWithWs(pair CurrencyPair, handle func(depth *Depth)) error {
-	zb.createWsConn()
-	sub := fmt.Sprintf("dish_length_5_%sdefault", strings.ToLower(pair.ToSymbol("")))
+	return zb.SubscribeDepth(pair, handle)
+}
+
+func (zb *Zb) depthChannel(pair CurrencyPair) string {
+	return fmt.Sprintf("dish_length_5_%sdefault", strings.ToLower(pair.ToSymbol("")))
+}
 
-	zb.wsDepthHandleMap[sub] = handle
-	return zb.ws.Subscribe(map[string]interface{}{
+func (zb *Zb) SubscribeDepth(pair CurrencyPair, handle func(depth *Depth)) error {
+	sub := zb.depthChannel(pair)
+
+	zb.wsHandlers.SetDepth(sub, handle)
+	return zb.wsConns().SubscribeChannel(sub, map[string]interface{}{
 		"binary": "true",
 		"channel": sub,
 		"event": "addChannel",
 		"isZip": "true",
+	}, map[string]interface{}{
+		"channel": sub,
+		"event": "removeChannel",
 	})
 }
 
+func (zb *Zb) UnsubscribeDepth(pair CurrencyPair) error {
+	sub := zb.depthChannel(pair)
+
+	zb.wsHandlers.Remove(sub)
+	return zb.wsConns().UnsubscribeChannel(sub)
+}
+
+//zb没有订阅回执 , 只有发送失败会通过Subscribe返回
+func (zb *Zb) OnSubscribeError(handle func(channel string, err error)) {
+	zb.wsConns().OnSubscribeError(handle)
+}
+
+//关闭所有websocket连接
+func (zb *Zb) CloseWs() {
+	zb.wsConns().CloseWs()
+}
+
+func (zb *Zb) SubscribeTicker(pair CurrencyPair, handle func(*Ticker)) error {
+	return ErrStreamNotSupport
+}
+
+func (zb *Zb) UnsubscribeTicker(pair CurrencyPair) error {
+	return ErrStreamNotSupport
+}
+
+func (zb *Zb) SubscribeTrade(pair CurrencyPair, handle func(*Trade)) error {
+	return ErrStreamNotSupport
+}
+
+func (zb *Zb) UnsubscribeTrade(pair CurrencyPair) error {
+	return ErrStreamNotSupport
+}
+
+func (zb *Zb) SubscribeKline(pair CurrencyPair, period int, handle func(*Kline)) error {
+	return ErrStreamNotSupport
+}
+
+func (zb *Zb) UnsubscribeKline(pair CurrencyPair, period int) error {
+	return ErrStreamNotSupport
+}
+
+//dish_length_5_zbbtcdefault , 格式不对时返回UNKNOWN_PAIR
 func (zb *Zb) getPairFromChannel(ch string) CurrencyPair {
-	s := strings.Split(ch[:len(ch) - len("default")], "_")
+	if !strings.HasSuffix(ch, "default") {
+		return UNKNOWN_PAIR
+	}
+	s := strings.Split(strings.TrimSuffix(ch, "default"), "_")
+	if len(s) <= 3 {
+		return UNKNOWN_PAIR
+	}
 	var currA, currB string
 	if strings.HasSuffix(s[3], "usdt") {
 		currB = "usdt"
@@ -528,16 +586,22 @@ func (zb *Zb) parseDepthData(tick map[string]interface{}) *Depth {
 
 	depth := new(Depth)
 	for _, r := range asks {
+		rr, isok := r.([]interface{})
+		if !isok || len(rr) < 2 {
+			continue
+		}
 		var dr DepthRecord
-		rr := r.([]interface{})
 		dr.Price = ToFloat64(rr[0])
 		dr.Amount = ToFloat64(rr[1])
 		depth.AskList = append(depth.AskList, dr)
 	}
 
 	for _, r := range bids {
+		rr, isok := r.([]interface{})
+		if !isok || len(rr) < 2 {
+			continue
+		}
 		var dr DepthRecord
-		rr := r.([]interface{})
 		dr.Price = ToFloat64(rr[0])
 		dr.Amount = ToFloat64(rr[1])
 		depth.BidList = append(depth.BidList, dr)
@@ -549,64 +613,97 @@ func (zb *Zb) parseDepthData(tick map[string]interface{}) *Depth {
 }
 
 
-func (zb *Zb) createWsConn() {
-	onceWsConn.Do(func() {
-		zb.ws = NewWsConn("wss://kline.zb.cn/websocket")
-		zb.ws.Heartbeat(func() interface{} {
-			return map[string]interface{}{"ping": time.Now().Unix()}
-		}, 5*time.Second)
-
-		zb.ws.ReConnect()
-		zb.ws.ReceiveMessage(func(msg []byte) {
-			resp := string(msg)
-			var dataMap map[string]interface{}
-			err := json.Unmarshal(msg, &dataMap)
-			if err == nil && dataMap["code"].(float64) == 1008 {
-				log.Println(resp)
-				return
-			}
-
-			decodeBytes, err := base64.StdEncoding.DecodeString(resp)
-			if err != nil {
-				log.Println(err)
-			}
-
-			gzipReader, err := gzip.NewReader(bytes.NewReader(decodeBytes))
-			data, _ := ioutil.ReadAll(gzipReader)
-			var dataArr []map[string]interface{}
-			data = data[1 : len(data)-1]
-			err = json.Unmarshal(data, &dataArr)
-			if err != nil || len(dataArr)<1 {
-				log.Println("json unmarshal error for ", string(data))
-				return
-			}
-
-			datamap := dataArr[0]
-			if datamap["ping"] != nil {
-				zb.ws.UpdateActivedTime()
-				zb.ws.SendWriteJSON(map[string]interface{}{"pong": datamap["ping"]}) // 回应心跳
-				return
-			}
-
-			if datamap["pong"] != nil { //
-				zb.ws.UpdateActivedTime()
-				return
-			}
-
-			if datamap["id"] != nil { //忽略订阅成功的回执消息
-				log.Println(string(data))
-				return
-			}
-
-			ch := datamap["channel"].(string)
-			pair := zb.getPairFromChannel(ch)
-			if zb.wsDepthHandleMap[ch] != nil {
-				depth := zb.parseDepthData(datamap)
-				depth.Pair = pair
-				(zb.wsDepthHandleMap[ch])(depth)
-				return
-			}
-		})
+//每个连接最多订阅n个频道 , 超过后新建连接 , 默认不限制
+func (zb *Zb) WsMaxSubsPerConn(n int) *Zb {
+	zb.createWsLock.Lock()
+	defer zb.createWsLock.Unlock()
+	zb.wsMaxSubs = n
+	return zb
+}
+
+//连接在第一次订阅时建立
+func (zb *Zb) wsConns() *WsShards {
+	zb.createWsLock.Lock()
+	defer zb.createWsLock.Unlock()
+
+	if zb.wsShards == nil {
+		zb.wsShards = NewWsShards(zb.wsMaxSubs, zb.dialWs)
+	}
+	return zb.wsShards
+}
+
+func (zb *Zb) dialWs() (*WsConn, error) {
+	ws, err := NewWsConn("wss://kline.zb.cn/websocket")
+	if err != nil {
+		return nil, err
+	}
+	ws.Heartbeat(func() interface{} {
+		return map[string]interface{}{"ping": time.Now().Unix()}
+	}, 5*time.Second)
+
+	ws.ReConnect()
+	ws.ReceiveMessage(func(msg []byte) {
+		zb.handleWsMessage(ws, msg)
 	})
+	return ws, nil
+}
+
+func (zb *Zb) handleWsMessage(ws *WsConn, msg []byte) {
+	resp := string(msg)
+	var dataMap map[string]interface{}
+	err := json.Unmarshal(msg, &dataMap)
+	if code, _ := dataMap["code"].(float64); err == nil && code == 1008 {
+		log.Println(resp)
+		return
+	}
+
+	decodeBytes, err := base64.StdEncoding.DecodeString(resp)
+	if err != nil {
+		log.Println(err)
+	}
 
+	gzipReader, err := gzip.NewReader(bytes.NewReader(decodeBytes))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	data, _ := ioutil.ReadAll(gzipReader)
+	if len(data) < 2 {
+		return
+	}
+	var dataArr []map[string]interface{}
+	data = data[1 : len(data)-1]
+	err = json.Unmarshal(data, &dataArr)
+	if err != nil || len(dataArr)<1 {
+		log.Println("json unmarshal error for ", string(data))
+		return
+	}
+
+	datamap := dataArr[0]
+	if datamap["ping"] != nil {
+		ws.UpdateActivedTime()
+		ws.SendWriteJSON(map[string]interface{}{"pong": datamap["ping"]}) // 回应心跳
+		return
+	}
+
+	if datamap["pong"] != nil { //
+		ws.UpdateActivedTime()
+		return
+	}
+
+	if datamap["id"] != nil { //忽略订阅成功的回执消息
+		log.Println(string(data))
+		return
+	}
+
+	ch, isok := datamap["channel"].(string)
+	if !isok {
+		return
+	}
+	if handle := zb.wsHandlers.Depth(ch); handle != nil {
+		depth := zb.parseDepthData(datamap)
+		depth.Pair = zb.getPairFromChannel(ch)
+		handle(depth)
+		return
+	}
 }
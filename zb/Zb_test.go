@@ -85,3 +85,14 @@ func TestZb_GetDepthWithWs(t *testing.T) {
 
 	time.Sleep(time.Minute)
 }
+
+func TestZb_getPairFromChannel(t *testing.T) {
+	if pair := zb.getPairFromChannel("dish_length_5_zbbtcdefault"); pair.ToSymbol("_") != "ZB_BTC" {
+		t.Errorf("unexpected pair %s", pair.ToSymbol("_"))
+	}
+	for _, ch := range []string{"", "default", "dish_5default", "pong"} {
+		if pair := zb.getPairFromChannel(ch); pair != goex.UNKNOWN_PAIR {
+			t.Errorf("%q should be unknown pair, got %s", ch, pair.ToSymbol("_"))
+		}
+	}
+}